@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/urfave/cli/v2"
+)
+
+// certInfo describes the certificate gotunnel serves for a domain
+type certInfo struct {
+	Domain          string    `json:"domain"`
+	Subject         string    `json:"subject"`
+	SANs            []string  `json:"sans"`
+	Issuer          string    `json:"issuer"`
+	NotBefore       time.Time `json:"not_before"`
+	NotAfter        time.Time `json:"not_after"`
+	DaysUntilExpiry int       `json:"days_until_expiry"` // Negative once expired
+}
+
+// CertInfo prints the certificate a tunnel for the domain argument would
+// serve, generating it first if needed, as JSON with --json
+func CertInfo(c *cli.Context) error {
+	domain := c.Args().First()
+	if domain == "" {
+		return fmt.Errorf("%w: usage: gotunnel cert info <domain>", tunnel.ErrInvalidDomain)
+	}
+	if suffix := "." + manager.TLD(); !strings.HasSuffix(domain, suffix) {
+		domain += suffix
+	}
+
+	cert, err := certManager.EnsureCert(domain)
+	if err != nil {
+		return fmt.Errorf("%w: %w", tunnel.ErrCertUnavailable, err)
+	}
+	info, err := certInfoFor(domain, cert, time.Now())
+	if err != nil {
+		return fmt.Errorf("%w: %w", tunnel.ErrCertUnavailable, err)
+	}
+	return writeCertInfo(c.App.Writer, info, c.Bool("json"))
+}
+
+// certInfoFor describes cert's leaf as of now
+func certInfoFor(domain string, cert *tls.Certificate, now time.Time) (certInfo, error) {
+	leaf := cert.Leaf
+	if leaf == nil {
+		if len(cert.Certificate) == 0 {
+			return certInfo{}, fmt.Errorf("certificate for %s is empty", domain)
+		}
+		var err error
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return certInfo{}, fmt.Errorf("failed to parse certificate for %s: %w", domain, err)
+		}
+	}
+
+	sans := append([]string{}, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return certInfo{
+		Domain:          domain,
+		Subject:         leaf.Subject.String(),
+		SANs:            sans,
+		Issuer:          leaf.Issuer.String(),
+		NotBefore:       leaf.NotBefore.UTC(),
+		NotAfter:        leaf.NotAfter.UTC(),
+		DaysUntilExpiry: int(math.Floor(leaf.NotAfter.Sub(now).Hours() / 24)),
+	}, nil
+}
+
+// writeCertInfo prints info as aligned fields, or as JSON
+func writeCertInfo(w io.Writer, info certInfo, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(info)
+	}
+
+	expiry := fmt.Sprintf("%d days left", info.DaysUntilExpiry)
+	if info.DaysUntilExpiry < 0 {
+		expiry = fmt.Sprintf("expired %d days ago", -info.DaysUntilExpiry)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Domain:\t%s\n", info.Domain)
+	fmt.Fprintf(tw, "Subject:\t%s\n", info.Subject)
+	fmt.Fprintf(tw, "SANs:\t%s\n", strings.Join(info.SANs, ", "))
+	fmt.Fprintf(tw, "Issuer:\t%s\n", info.Issuer)
+	fmt.Fprintf(tw, "Valid from:\t%s\n", info.NotBefore.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Valid until:\t%s (%s)\n", info.NotAfter.Format(time.RFC3339), expiry)
+	return tw.Flush()
+}
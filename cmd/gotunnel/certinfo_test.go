@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/cert"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// knownCert returns a certificate for myapp.local valid until notAfter
+func knownCert(t *testing.T, notAfter time.Time) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "myapp.local"},
+		DNSNames:     []string{"myapp.local", "www.myapp.local"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCertInfo(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	notAfter := now.Add(30*24*time.Hour + time.Hour)
+
+	info, err := certInfoFor("myapp.local", knownCert(t, notAfter), now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"myapp.local", "www.myapp.local", "127.0.0.1"}, info.SANs)
+	assert.Equal(t, "CN=myapp.local", info.Subject)
+	assert.Equal(t, 30, info.DaysUntilExpiry)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeCertInfo(&buf, info, false))
+	assert.Contains(t, buf.String(), "SANs:         myapp.local, www.myapp.local, 127.0.0.1\n")
+	assert.Contains(t, buf.String(), "Valid until:  2026-11-16T13:00:00Z (30 days left)\n")
+
+	buf.Reset()
+	require.NoError(t, writeCertInfo(&buf, info, true))
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, []any{"myapp.local", "www.myapp.local", "127.0.0.1"}, decoded["sans"])
+	assert.Equal(t, "2026-11-16T13:00:00Z", decoded["not_after"])
+	assert.Equal(t, float64(30), decoded["days_until_expiry"])
+
+	// An expired certificate counts days since it expired
+	info, err = certInfoFor("myapp.local", knownCert(t, now.Add(-36*time.Hour)), now)
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, writeCertInfo(&buf, info, false))
+	assert.Contains(t, buf.String(), "(expired 2 days ago)")
+}
+
+func TestCertInfoCommand(t *testing.T) {
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	originalManager, originalCerts := manager, certManager
+	manager, certManager = m, cert.NewWithProvider(cert.NewSelfSignedProvider())
+	defer func() { manager, certManager = originalManager, originalCerts }()
+
+	var out bytes.Buffer
+	app := &cli.App{
+		Writer: &out,
+		Commands: []*cli.Command{{
+			Name:   "info",
+			Flags:  []cli.Flag{&cli.BoolFlag{Name: "json"}},
+			Action: CertInfo,
+		}},
+	}
+	require.NoError(t, app.Run([]string{"gotunnel", "info", "--json", "myapp"}))
+
+	var info certInfo
+	require.NoError(t, json.Unmarshal(out.Bytes(), &info))
+	assert.Equal(t, "myapp.local", info.Domain)
+	assert.Equal(t, []string{"myapp.local"}, info.SANs)
+	assert.InDelta(t, 364, info.DaysUntilExpiry, 1)
+
+	err := app.Run([]string{"gotunnel", "info"})
+	assert.ErrorIs(t, err, tunnel.ErrInvalidDomain)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the subset of the config file (see
+// configs/gotunnel.example.yaml) that sets global flags. Values from the file
+// replace the flags' built-in defaults, so the precedence is:
+//
+//	command-line flags > environment variables > config file > defaults
+//
+// Keys the CLI doesn't use are ignored, and ${VAR} references are expanded
+// from the environment before parsing.
+type fileConfig struct {
+	Service struct {
+		Environment string `yaml:"environment"` // --environment
+	} `yaml:"service"`
+
+	Proxy struct {
+		Mode      string `yaml:"mode"`       // --proxy
+		HTTPPort  int    `yaml:"http_port"`  // --proxy-http-port
+		HTTPSPort int    `yaml:"https_port"` // --proxy-https-port
+	} `yaml:"proxy"`
+
+	Observability struct {
+		Logging struct {
+			Level  string `yaml:"level"`  // "debug" sets --debug
+			Format string `yaml:"format"` // --log-format
+			Output string `yaml:"output"` // A path sets --log-file; stdout and stderr are ignored
+		} `yaml:"logging"`
+	} `yaml:"observability"`
+}
+
+// configPath returns the config file to load: $GOTUNNEL_CONFIG if set,
+// otherwise ~/.config/gotunnel/config.yaml. required is true when the user
+// named the file explicitly, so a missing file is an error.
+func configPath() (path string, required bool) {
+	if path := os.Getenv("GOTUNNEL_CONFIG"); path != "" {
+		return path, true
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(home, ".config", "gotunnel", "config.yaml"), false
+}
+
+// loadFileConfig reads and parses the config file at path
+func loadFileConfig(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg fileConfig
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// applyConfigFile loads the config file, if any, into the defaults of flags
+func applyConfigFile(flags []cli.Flag) error {
+	path, required := configPath()
+	if path == "" {
+		return nil
+	}
+	cfg, err := loadFileConfig(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load config file: %w", err)
+	}
+	return cfg.applyDefaults(flags)
+}
+
+// applyDefaults sets the default value of each flag the file configures.
+// Values left empty in the file keep the flag's built-in default.
+func (cfg *fileConfig) applyDefaults(flags []cli.Flag) error {
+	values := map[string]any{
+		"environment":      cfg.Service.Environment,
+		"proxy":            cfg.Proxy.Mode,
+		"proxy-http-port":  cfg.Proxy.HTTPPort,
+		"proxy-https-port": cfg.Proxy.HTTPSPort,
+		"log-format":       cfg.Observability.Logging.Format,
+	}
+	if cfg.Observability.Logging.Level == "debug" {
+		values["debug"] = true
+	}
+	if out := cfg.Observability.Logging.Output; out != "stdout" && out != "stderr" {
+		values["log-file"] = out
+	}
+
+	for _, flag := range flags {
+		value, ok := values[flag.Names()[0]]
+		if !ok {
+			continue
+		}
+		switch f := flag.(type) {
+		case *cli.StringFlag:
+			if s := value.(string); s != "" {
+				f.Value = s
+			}
+		case *cli.IntFlag:
+			if n := value.(int); n != 0 {
+				f.Value = n
+			}
+		case *cli.BoolFlag:
+			f.Value = value.(bool)
+		default:
+			return fmt.Errorf("config file can't set --%s", flag.Names()[0])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// writeConfig writes a config file and points GOTUNNEL_CONFIG at it
+func writeConfig(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	t.Setenv("GOTUNNEL_CONFIG", path)
+}
+
+// runWithConfig applies the config file to a copy of the proxy port and
+// log flags, runs them with args and returns the values the command saw
+func runWithConfig(t *testing.T, args ...string) (port int, format string, debug bool) {
+	t.Helper()
+	flags := []cli.Flag{
+		&cli.IntFlag{Name: "proxy-http-port", EnvVars: []string{"GOTUNNEL_PROXY_HTTP_PORT"}, Value: 80},
+		&cli.StringFlag{Name: "log-format", EnvVars: []string{"GOTUNNEL_LOG_FORMAT"}, Value: "text"},
+		&cli.BoolFlag{Name: "debug", EnvVars: []string{"DEBUG"}},
+	}
+	require.NoError(t, applyConfigFile(flags))
+
+	app := &cli.App{
+		Flags: flags,
+		Action: func(c *cli.Context) error {
+			port, format, debug = c.Int("proxy-http-port"), c.String("log-format"), c.Bool("debug")
+			return nil
+		},
+	}
+	require.NoError(t, app.Run(append([]string{"gotunnel"}, args...)))
+	return port, format, debug
+}
+
+func TestConfigFilePrecedence(t *testing.T) {
+	writeConfig(t, `
+proxy:
+  http_port: 8001
+observability:
+  logging:
+    level: debug
+    format: json
+`)
+
+	t.Run("file overrides defaults", func(t *testing.T) {
+		port, format, debug := runWithConfig(t)
+		assert.Equal(t, 8001, port)
+		assert.Equal(t, "json", format)
+		assert.True(t, debug)
+	})
+
+	t.Run("env overrides file", func(t *testing.T) {
+		t.Setenv("GOTUNNEL_PROXY_HTTP_PORT", "8002")
+		port, format, _ := runWithConfig(t)
+		assert.Equal(t, 8002, port)
+		assert.Equal(t, "json", format)
+	})
+
+	t.Run("flag overrides env", func(t *testing.T) {
+		t.Setenv("GOTUNNEL_PROXY_HTTP_PORT", "8002")
+		port, _, _ := runWithConfig(t, "--proxy-http-port", "8003")
+		assert.Equal(t, 8003, port)
+	})
+}
+
+func TestConfigFileKeepsDefaultsForUnsetKeys(t *testing.T) {
+	writeConfig(t, `
+service:
+  name: "gotunnel"
+observability:
+  logging:
+    output: stdout
+`)
+	port, format, debug := runWithConfig(t)
+	assert.Equal(t, 80, port)
+	assert.Equal(t, "text", format)
+	assert.False(t, debug)
+}
+
+func TestConfigFileExpandsEnv(t *testing.T) {
+	t.Setenv("TEST_LOG_FORMAT", "json")
+	writeConfig(t, `
+observability:
+  logging:
+    format: "${TEST_LOG_FORMAT}"
+`)
+	_, format, _ := runWithConfig(t)
+	assert.Equal(t, "json", format)
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	t.Run("named file missing", func(t *testing.T) {
+		t.Setenv("GOTUNNEL_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.Error(t, applyConfigFile(nil))
+	})
+
+	t.Run("invalid YAML", func(t *testing.T) {
+		writeConfig(t, "proxy: [unclosed")
+		assert.ErrorContains(t, applyConfigFile(nil), "failed to parse config file")
+	})
+
+	t.Run("default file missing", func(t *testing.T) {
+		t.Setenv("GOTUNNEL_CONFIG", "")
+		t.Setenv("HOME", t.TempDir())
+		assert.NoError(t, applyConfigFile(nil))
+	})
+}
+
+func TestExportedTunnelsFileSetsProxyDefaults(t *testing.T) {
+	cfg := tunnel.Config{
+		Proxy:   &tunnel.ProxySettings{Mode: "builtin", HTTPPort: 8004},
+		Tunnels: []tunnel.TunnelConfig{{Domain: "app.local", Port: 3000}},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, cfg.Write(&buf))
+	writeConfig(t, buf.String())
+
+	port, _, _ := runWithConfig(t)
+	assert.Equal(t, 8004, port)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/docker"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+)
+
+// dockerPollInterval is how often a tunnel to a container checks whether
+// the container came back with a new address
+const dockerPollInterval = 2 * time.Second
+
+// For testing purposes
+var newDockerInspector = func() (docker.Inspector, error) {
+	return docker.NewClient("")
+}
+
+// containerBackend resolves --docker-container to the address the tunnel
+// forwards to. A port of 0 picks the container's only exposed port.
+func containerBackend(ctx context.Context, name string, port int) (docker.Inspector, docker.Target, error) {
+	inspector, err := newDockerInspector()
+	if err != nil {
+		return nil, docker.Target{}, fmt.Errorf("%w: %w", tunnel.ErrBackendUnreachable, err)
+	}
+	target, err := docker.Resolve(ctx, inspector, name, port)
+	if err != nil {
+		return nil, docker.Target{}, fmt.Errorf("%w: %w", tunnel.ErrBackendUnreachable, err)
+	}
+	return inspector, target, nil
+}
+
+// followContainer re-resolves the container every interval until ctx is
+// done, pointing the tunnel for domain at its new address when it moves
+// (e.g. after docker restart). While the container is gone the tunnel
+// keeps its last address, so requests fail with the usual 502 page.
+func followContainer(ctx context.Context, inspector docker.Inspector, name string, port int, domain string, current docker.Target, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		target, err := docker.Resolve(ctx, inspector, name, port)
+		if err != nil {
+			if ctx.Err() == nil && (lastErr == nil || lastErr.Error() != err.Error()) {
+				logAttrs(ctx, slog.LevelWarn, "Can't resolve container, keeping its last address",
+					slog.String("container", name),
+					slog.Any("error", err),
+				)
+			}
+			lastErr = err
+			continue
+		}
+		lastErr = nil
+		if target == current {
+			continue
+		}
+
+		if err := manager.Retarget(domain, target.Host, target.Port); err != nil {
+			logAttrs(ctx, slog.LevelError, "Failed to follow container",
+				slog.String("container", name),
+				slog.Any("error", err),
+			)
+			continue
+		}
+		if running != nil {
+			running.notify()
+		}
+		logAttrs(ctx, slog.LevelInfo, "Container moved, tunnel follows it",
+			slog.String("container", name),
+			slog.String("host", target.Host),
+			slog.Int("port", target.Port),
+		)
+		current = target
+	}
+}
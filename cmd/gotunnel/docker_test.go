@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/docker"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDocker stands in for the Docker API with one container whose
+// address the test can move
+type fakeDocker struct {
+	mu        sync.Mutex
+	container docker.Container
+}
+
+func (f *fakeDocker) InspectContainer(_ context.Context, name string) (docker.Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if name != f.container.Name {
+		return docker.Container{}, fmt.Errorf("%w: %s", docker.ErrContainerNotFound, name)
+	}
+	return f.container, nil
+}
+
+func (f *fakeDocker) move(port int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.container.ExposedPorts = []int{port}
+}
+
+func useFakeDocker(t *testing.T, fake *fakeDocker) {
+	t.Helper()
+	original := newDockerInspector
+	newDockerInspector = func() (docker.Inspector, error) { return fake, nil }
+	t.Cleanup(func() { newDockerInspector = original })
+}
+
+func TestDockerContainerBackend(t *testing.T) {
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	originalManager := manager
+	manager = m
+	defer func() { manager = originalManager }()
+
+	_, firstPort, stopFirst := setupTestServerWithCleanup(t)
+	defer stopFirst()
+
+	fake := &fakeDocker{container: docker.Container{Name: "myapp", Running: true, IP: "127.0.0.1", ExposedPorts: []int{firstPort}}}
+	useFakeDocker(t, fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.Stop(context.Background())
+
+	inspector, target, err := containerBackend(ctx, "myapp", 0)
+	require.NoError(t, err)
+	assert.Equal(t, docker.Target{Host: "127.0.0.1", Port: firstPort}, target)
+
+	require.NoError(t, m.StartTunnelWithOptions(ctx, tunnel.Options{
+		BackendHost: target.Host,
+		BackendPort: target.Port,
+		Domain:      "docker-app",
+		HTTPPort:    8310,
+	}))
+	get := func() string {
+		resp, err := http.Get("http://127.0.0.1:8310/")
+		if err != nil {
+			return err.Error()
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Sprintf("%d %s", resp.StatusCode, body)
+	}
+	assert.Equal(t, "200 Hello from test server!", get())
+
+	// The container restarts on another port; the tunnel follows it
+	go followContainer(ctx, inspector, "myapp", 0, "docker-app.local", target, 10*time.Millisecond)
+	stopFirst()
+	_, secondPort, stopSecond := setupTestServerWithCleanup(t)
+	defer stopSecond()
+	fake.move(secondPort)
+
+	assert.Eventually(t, func() bool {
+		return get() == "200 Hello from test server!"
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, secondPort, m.ListTunnels()[0]["port"])
+}
+
+func TestDockerContainerErrors(t *testing.T) {
+	useFakeDocker(t, &fakeDocker{container: docker.Container{Name: "bare", Running: true, IP: "172.17.0.2"}})
+
+	_, _, err := containerBackend(context.Background(), "missing", 0)
+	assert.ErrorIs(t, err, docker.ErrContainerNotFound)
+	assert.Equal(t, exitBackendError, exitCodeFor(err))
+
+	_, _, err = containerBackend(context.Background(), "bare", 0)
+	assert.ErrorIs(t, err, docker.ErrNoExposedPorts)
+}
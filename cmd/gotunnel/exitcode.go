@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/johncferguson/gotunnel/internal/state"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+)
+
+// Process exit codes, so scripts can tell why gotunnel failed
+const (
+	exitOK           = 0
+	exitFailure      = 1 // Anything not covered below
+	exitInvalidInput = 2 // Bad flags, ports, or domains
+	exitBindFailed   = 3 // Port in use or not permitted
+	exitCertError    = 4 // Certificate could not be generated or loaded
+	exitBackendError = 5 // Backend unreachable
+	exitLocked       = 6 // Another gotunnel holds the lock file
+)
+
+// exitCodeFor maps an error returned by the CLI to a process exit code
+func exitCodeFor(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, tunnel.ErrInvalidPort),
+		errors.Is(err, tunnel.ErrInvalidDomain),
+		errors.Is(err, tunnel.ErrInvalidOptions),
+		errors.Is(err, tunnel.ErrDuplicateDomain),
+		errors.Is(err, tunnel.ErrTunnelNotFound):
+		return exitInvalidInput
+	case errors.Is(err, tunnel.ErrBindFailed), errors.Is(err, os.ErrPermission):
+		return exitBindFailed
+	case errors.Is(err, tunnel.ErrCertUnavailable):
+		return exitCertError
+	case errors.Is(err, tunnel.ErrBackendUnreachable):
+		return exitBackendError
+	case errors.Is(err, state.ErrLocked), errors.Is(err, state.ErrStaleLock):
+		return exitLocked
+	default:
+		return exitFailure
+	}
+}
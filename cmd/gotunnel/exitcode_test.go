@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/johncferguson/gotunnel/internal/state"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitOK},
+		{"unclassified", errors.New("boom"), exitFailure},
+		{"invalid port", fmt.Errorf("%w for backend: -1", tunnel.ErrInvalidPort), exitInvalidInput},
+		{"duplicate domain", fmt.Errorf("failed to start tunnel: %w", tunnel.ErrDuplicateDomain), exitInvalidInput},
+		{"unknown tunnel", tunnel.ErrTunnelNotFound, exitInvalidInput},
+		{"port in use", fmt.Errorf("failed to start tunnel: %w", fmt.Errorf("%w 0.0.0.0:80 for HTTP: %w", tunnel.ErrBindFailed, errors.New("address already in use"))), exitBindFailed},
+		{"permission denied", fmt.Errorf("failed to update hosts file: %w", fs.ErrPermission), exitBindFailed},
+		{"certificate", fmt.Errorf("failed to start tunnel: %w", tunnel.ErrCertUnavailable), exitCertError},
+		{"backend", fmt.Errorf("%w: exec: not found", tunnel.ErrBackendUnreachable), exitBackendError},
+		{"already running", fmt.Errorf("%w (pid 42)", state.ErrLocked), exitLocked},
+		{"stale lock", fmt.Errorf("%w: pid 42 is no longer running", state.ErrStaleLock), exitLocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, exitCodeFor(tt.err))
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/urfave/cli/v2"
+)
+
+// ExportTunnels writes the running gotunnel's tunnels as a config file
+// `gotunnel up -f` can start again, to stdout unless --output names a file
+func ExportTunnels(c *cli.Context) error {
+	snapshot, err := loadRunning(getRunningFileFunc())
+	if err != nil {
+		return err
+	}
+	cfg := snapshot.Config
+
+	path := c.String("output")
+	if path == "" || path == "-" {
+		return cfg.Write(c.App.Writer)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := cfg.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Printf("Exported %d tunnel(s) to %s\n", len(cfg.Tunnels), path)
+	return nil
+}
+
+// UpTunnels starts every tunnel in a config file and keeps them running
+// until interrupted
+func UpTunnels(c *cli.Context) error {
+	ctx := context.Background()
+	ctx, span := obsProvider.StartSpan(ctx, "tunnel.up")
+	defer span.End()
+
+	cfg, err := tunnel.LoadConfig(c.String("file"))
+	if err != nil {
+		obsProvider.RecordError(ctx, span, err, "tunnel config load failed")
+		return err
+	}
+	if len(cfg.Tunnels) == 0 {
+		return fmt.Errorf("%w: %s lists no tunnels", tunnel.ErrInvalidOptions, c.String("file"))
+	}
+
+	for _, opts := range cfg.Options() {
+		netPreset.applyTunnel(&opts)
+		if err := manager.StartTunnelWithOptions(ctx, opts); err != nil {
+			obsProvider.RecordError(ctx, span, err, "tunnel start failed")
+			manager.Stop(ctx)
+			return fmt.Errorf("failed to start tunnel %s: %w", opts.Domain, err)
+		}
+	}
+	if c.Bool("dry-run") {
+		fmt.Println("\nDry run: nothing was changed")
+		return nil
+	}
+
+	fmt.Printf("\nStarted %d tunnel(s):\n", len(cfg.Tunnels))
+	for _, tc := range cfg.Tunnels {
+		scheme := "http"
+		if tc.HTTPS {
+			scheme = "https"
+		}
+		fmt.Printf("  %s://%s -> localhost:%d\n", scheme, tc.Domain, tc.Port)
+	}
+
+	// The tunnels come down through the same shutdown a signal triggers
+	sigCh := claimSignals()
+	defer shutdown()
+	<-sigCh
+	obsProvider.Logger().InfoContext(ctx, "Received shutdown signal, stopping tunnels",
+		slog.Int("tunnels", len(cfg.Tunnels)),
+	)
+	return nil
+}
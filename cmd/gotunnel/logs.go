@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/logging"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/urfave/cli/v2"
+)
+
+// TailLogs pretty-prints the JSON log file, following it like tail -f
+func TailLogs(c *cli.Context) error {
+	path := c.String("log-file")
+	if path == "" {
+		fmt.Println("gotunnel is logging to stdout, so there is no log file to tail.")
+		fmt.Println("Start it with --log-file <path> --log-format json, then run:")
+		fmt.Println("  gotunnel --log-file <path> logs")
+		return nil
+	}
+
+	filter := logging.Filter{
+		Level:  logging.LogLevel(c.String("level")),
+		Tunnel: c.String("tunnel"),
+	}
+	switch filter.Level {
+	case "", logging.LevelDebug, logging.LevelInfo, logging.LevelWarn, logging.LevelError:
+	default:
+		return fmt.Errorf("%w: invalid --level %q", tunnel.ErrInvalidOptions, filter.Level)
+	}
+
+	color := !c.Bool("no-color") && isTerminal(os.Stdout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if c.Bool("no-follow") {
+		cancel() // Follow returns once it reaches the end of the file
+	} else {
+		sigCh := claimSignals()
+		go func() {
+			<-sigCh
+			cancel()
+		}()
+	}
+
+	return logging.Follow(ctx, path, 250*time.Millisecond, func(line []byte) {
+		printLogLine(os.Stdout, line, filter, color)
+	})
+}
+
+// printLogLine writes line to w if it passes filter. Lines that aren't JSON
+// (e.g. a file written in text format) are passed through unfiltered.
+func printLogLine(w io.Writer, line []byte, filter logging.Filter, color bool) {
+	if len(line) == 0 {
+		return
+	}
+	entry, err := logging.ParseEntry(line)
+	if err != nil {
+		fmt.Fprintln(w, string(line))
+		return
+	}
+	if filter.Match(entry) {
+		fmt.Fprintln(w, entry.Format(color))
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
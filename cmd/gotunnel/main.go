@@ -2,21 +2,30 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
+	"net"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/johncferguson/gotunnel/internal/cert"
 	"github.com/johncferguson/gotunnel/internal/dnsserver"
+	"github.com/johncferguson/gotunnel/internal/docker"
 	"github.com/johncferguson/gotunnel/internal/logging"
+	"github.com/johncferguson/gotunnel/internal/middleware"
+	"github.com/johncferguson/gotunnel/internal/netutil"
 	"github.com/johncferguson/gotunnel/internal/observability"
 	"github.com/johncferguson/gotunnel/internal/privilege"
+	"github.com/johncferguson/gotunnel/internal/process"
 	"github.com/johncferguson/gotunnel/internal/proxy"
+	"github.com/johncferguson/gotunnel/internal/state"
 	"github.com/johncferguson/gotunnel/internal/tunnel"
 	"github.com/urfave/cli/v2"
 	"go.opentelemetry.io/otel/attribute"
@@ -30,17 +39,39 @@ var (
 )
 
 var (
-	manager      *tunnel.Manager
-	obsProvider  *observability.Provider
-	metrics      *observability.Metrics
-	proxyManager *proxy.Manager
+	manager        *tunnel.Manager
+	certManager    *cert.CertManager
+	obsProvider    *observability.Provider
+	metrics        *observability.Metrics
+	proxyManager   *proxy.Manager
+	backendProcess *process.Supervisor
+
+	// tunnelStopped receives the domain of each tunnel the manager stops,
+	// so start notices a tunnel that stopped itself after idling
+	tunnelStopped = make(chan string, 16)
+
+	// netPreset is the --local-only or --allow-lan preset, nil for neither
+	netPreset *networkPreset
+
+	// instanceLock is held while start, up or serve runs, so two gotunnels
+	// don't race on the hosts file and mDNS names
+	instanceLock *state.Lock
+
+	// stateFile is the --state-file reload reads, empty for the default
+	stateFile string
+
+	// running publishes the tunnels and proxy routes while the lock is
+	// held, for export and routes
+	running *runningPublisher
 )
 
 func main() {
+	observability.SetServiceVersion(currentBuildInfo().Version)
+
 	app := &cli.App{
 		Name:    "gotunnel",
 		Usage:   "Create secure local tunnels for development",
-		Version: fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date),
+		Version: currentBuildInfo().String(),
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
 				Name:  "no-privilege-check",
@@ -50,8 +81,17 @@ func main() {
 			&cli.StringFlag{
 				Name:    "sentry-dsn",
 				EnvVars: []string{"SENTRY_DSN"},
-				Usage:   "Sentry DSN for error tracking and performance monitoring",
-				Value:   "https://2df8619717cb8316ef83612d2ec29b95@sentry.fergify.work/11",
+				Usage:   "Sentry DSN for error tracking and performance monitoring (disabled when unset)",
+			},
+			&cli.StringFlag{
+				Name:    "otlp-endpoint",
+				EnvVars: []string{"OTEL_EXPORTER_OTLP_ENDPOINT"},
+				Usage:   "OTLP/HTTP collector endpoint for trace export (e.g. http://localhost:4318)",
+			},
+			&cli.StringSliceFlag{
+				Name:    "otlp-header",
+				EnvVars: []string{"OTEL_EXPORTER_OTLP_HEADERS"},
+				Usage:   "Header sent with OTLP exports as key=value, repeatable",
 			},
 			&cli.StringFlag{
 				Name:    "environment",
@@ -67,7 +107,7 @@ func main() {
 			&cli.StringFlag{
 				Name:    "proxy",
 				EnvVars: []string{"GOTUNNEL_PROXY"},
-				Usage:   "Proxy mode: builtin, nginx, caddy, auto, config, none",
+				Usage:   "Proxy mode: builtin, nginx, caddy, traefik, auto, config, none",
 				Value:   "auto",
 			},
 			&cli.IntFlag{
@@ -82,8 +122,127 @@ func main() {
 				Usage:   "HTTPS port for proxy (default: 443)",
 				Value:   443,
 			},
+			&cli.StringFlag{
+				Name:    "tunnel-port-range",
+				EnvVars: []string{"GOTUNNEL_TUNNEL_PORT_RANGE"},
+				Usage:   "Ports proxy-mode tunnels listen on internally, e.g. 9000-9100 (default: any free port)",
+			},
+			&cli.StringFlag{
+				Name:    "tld",
+				EnvVars: []string{"GOTUNNEL_TLD"},
+				Usage:   "TLD for tunnel domains; anything but local resolves through the hosts file only",
+				Value:   tunnel.DefaultLocalTLD,
+			},
+			&cli.StringFlag{
+				Name:    "mdns-suffix",
+				EnvVars: []string{"GOTUNNEL_MDNS_SUFFIX"},
+				Usage:   "Suffix mDNS instance names with this machine's hostname or a random tag, so several machines can serve the same domain: hostname, random",
+			},
+			&cli.StringFlag{
+				Name:    "advertise-ip",
+				EnvVars: []string{"GOTUNNEL_ADVERTISE_IP"},
+				Usage:   "IP address to advertise over mDNS instead of the detected one",
+			},
+			&cli.StringFlag{
+				Name:    "proxy-bind-addr",
+				EnvVars: []string{"GOTUNNEL_PROXY_BIND_ADDR"},
+				Usage:   "Interface address the built-in proxy listens on (default: all interfaces; e.g. 127.0.0.1 to keep it off the network)",
+			},
+			&cli.BoolFlag{
+				Name:    "proxy-https",
+				EnvVars: []string{"GOTUNNEL_PROXY_HTTPS"},
+				Usage:   "Terminate HTTPS in the built-in proxy, picking certificates by SNI",
+			},
+			&cli.BoolFlag{
+				Name:    "proxy-protocol",
+				EnvVars: []string{"GOTUNNEL_PROXY_PROTOCOL"},
+				Usage:   "Require a PROXY protocol (v1/v2) header on incoming connections, from a load balancer in front of gotunnel, and log the client it names",
+			},
+			&cli.DurationFlag{
+				Name:    "proxy-read-header-timeout",
+				EnvVars: []string{"GOTUNNEL_PROXY_READ_HEADER_TIMEOUT"},
+				Usage:   "How long the built-in proxy waits for request headers (0 for no limit)",
+				Value:   proxy.DefaultReadHeaderTimeout,
+			},
+			&cli.DurationFlag{
+				Name:    "proxy-read-timeout",
+				EnvVars: []string{"GOTUNNEL_PROXY_READ_TIMEOUT"},
+				Usage:   "How long the built-in proxy allows for reading a whole request, body included (0 for no limit)",
+			},
+			&cli.DurationFlag{
+				Name:    "proxy-write-timeout",
+				EnvVars: []string{"GOTUNNEL_PROXY_WRITE_TIMEOUT"},
+				Usage:   "How long the built-in proxy allows for writing a response (0 for no limit, for long downloads and server-sent events)",
+				Value:   proxy.DefaultWriteTimeout,
+			},
+			&cli.DurationFlag{
+				Name:    "proxy-idle-timeout",
+				EnvVars: []string{"GOTUNNEL_PROXY_IDLE_TIMEOUT"},
+				Usage:   "How long the built-in proxy keeps idle keep-alive connections open (0 for no limit)",
+				Value:   proxy.DefaultIdleTimeout,
+			},
+			&cli.StringFlag{
+				Name:    "state-file",
+				EnvVars: []string{"GOTUNNEL_STATE_FILE"},
+				Usage:   "Tunnel list re-applied on SIGHUP, read as JSON if it ends in .json and YAML otherwise (default: ~/.gotunnel/tunnels.yaml)",
+			},
+			&cli.StringFlag{
+				Name:    "log-file",
+				EnvVars: []string{"GOTUNNEL_LOG_FILE"},
+				Usage:   "Write logs to this file instead of stdout (read it back with `gotunnel logs`)",
+			},
+			&cli.StringFlag{
+				Name:    "log-format",
+				EnvVars: []string{"GOTUNNEL_LOG_FORMAT"},
+				Usage:   "Log format: text or json",
+				Value:   "text",
+			},
+			&cli.BoolFlag{
+				Name:  "no-mdns",
+				Usage: "Don't advertise tunnels over mDNS; resolve them through the hosts file only",
+			},
+			&cli.BoolFlag{
+				Name:  "no-hosts",
+				Usage: "Don't edit the hosts file; resolve tunnels through mDNS only",
+			},
+			&cli.BoolFlag{
+				Name:  "local-only",
+				Usage: "Keep tunnels on this machine: listen on 127.0.0.1, skip mDNS and resolve through the hosts file",
+			},
+			&cli.BoolFlag{
+				Name:  "allow-lan",
+				Usage: "Serve other devices on the network: listen on all interfaces and advertise the LAN address over mDNS",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Take over the lock file left by a gotunnel that exited without removing it",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the hosts edits, port binds, mDNS records and proxy routes a command would make, without making them",
+			},
+			&cli.BoolFlag{
+				Name:  "quiet",
+				Usage: "Only log errors, and don't print the session summary on shutdown",
+			},
+			&cli.BoolFlag{
+				Name:  "verbose",
+				Usage: "Log at debug level",
+			},
+			&cli.DurationFlag{
+				Name:    "shutdown-timeout",
+				Value:   10 * time.Second,
+				EnvVars: []string{"GOTUNNEL_SHUTDOWN_TIMEOUT"},
+				Usage:   "How long shutdown waits for in-flight requests before closing their connections",
+			},
 		},
 		Before: func(c *cli.Context) error {
+			// Printing the version needs none of the setup below, and
+			// startup logs would corrupt --json output
+			if c.Args().First() == "version" {
+				return nil
+			}
+
 			// Configure logging
 			logConfig := &logging.Config{
 				Level:      logging.LevelInfo,
@@ -93,15 +252,35 @@ func main() {
 				TimeFormat: time.RFC3339,
 			}
 			
+			level, err := logLevel(c.Bool("quiet"), c.Bool("verbose"), c.Bool("debug"))
+			if err != nil {
+				return err
+			}
+			logConfig.Level = level
 			if c.Bool("debug") {
-				logConfig.Level = logging.LevelDebug
 				logConfig.AddSource = true
 			}
+			stateFile = c.String("state-file")
+			// `gotunnel logs` reads the file, so it must not append its own startup logs to it
+			if path := c.String("log-file"); path != "" && c.Args().First() != "logs" {
+				logConfig.Output = path
+			}
+			switch format := logging.LogFormat(c.String("log-format")); format {
+			case logging.FormatText, logging.FormatJSON:
+				logConfig.Format = format
+			default:
+				return fmt.Errorf("%w: invalid --log-format %q", tunnel.ErrInvalidOptions, format)
+			}
 			
+			otlpHeaders, err := parseKeyValues(c.StringSlice("otlp-header"))
+			if err != nil {
+				return fmt.Errorf("invalid --otlp-header: %w", err)
+			}
+
 			// Initialize observability first
 			obsConfig := observability.Config{
 				ServiceName:      "gotunnel",
-				ServiceVersion:   version,
+				ServiceVersion:   currentBuildInfo().Version,
 				Environment:      c.String("environment"),
 				SentryDSN:        c.String("sentry-dsn"),
 				TracesSampleRate: 1.0,
@@ -109,6 +288,8 @@ func main() {
 				LogFormat:        "text",
 				Debug:            c.Bool("debug"),
 				Logging:          logConfig,
+				OTLPEndpoint:     c.String("otlp-endpoint"),
+				OTLPHeaders:      otlpHeaders,
 			}
 
 			if obsConfig.Debug {
@@ -116,7 +297,6 @@ func main() {
 				obsConfig.LogFormat = "text" // Keep text format for debug readability
 			}
 
-			var err error
 			obsProvider, err = observability.NewProvider(obsConfig)
 			if err != nil {
 				return fmt.Errorf("failed to initialize observability: %w", err)
@@ -138,6 +318,13 @@ func main() {
 				"environment", obsConfig.Environment,
 			)
 
+			// export and routes read what the running gotunnel published; a
+			// manager of their own would have no tunnels, and its proxy would
+			// fight over ports
+			if cmd := c.Args().First(); cmd == "export" || cmd == "routes" {
+				return nil
+			}
+
 			if !c.Bool("no-privilege-check") {
 				if err := privilege.CheckPrivileges(); err != nil {
 					metrics.RecordError(ctx, "privilege_check", "startup", err)
@@ -145,19 +332,52 @@ func main() {
 				}
 			}
 
+			netPreset, err = presetFromFlags(c)
+			if err != nil {
+				return err
+			}
+
+			// Only the commands that keep tunnels running edit the hosts file
+			if cmd := c.Args().First(); (cmd == "start" || cmd == "up" || cmd == "serve") && !c.Bool("dry-run") {
+				instanceLock, err = state.AcquireLock(c.Bool("force"))
+				if err != nil {
+					return err
+				}
+			}
+
 			// Create cert manager
-			certManager := cert.New("./certs")
+			certManager = cert.New("./certs")
 			
+			tld, err := tunnel.NormalizeTLD(c.String("tld"))
+			if err != nil {
+				return fmt.Errorf("invalid --tld: %w", err)
+			}
+
 			// Initialize proxy if requested
 			proxyModeStr := c.String("proxy")
 			var useProxy bool
 			
 			if proxyModeStr != "none" {
+				bindAddr := netPreset.proxyBindAddr(c.String("proxy-bind-addr"))
+				if bindAddr != "" && net.ParseIP(bindAddr) == nil {
+					return fmt.Errorf("%w: invalid --proxy-bind-addr %q", tunnel.ErrInvalidOptions, bindAddr)
+				}
 				proxyConfig := proxy.ProxyConfig{
 					Mode:        proxy.ProxyMode(proxyModeStr),
 					HTTPPort:    c.Int("proxy-http-port"),
 					HTTPSPort:   c.Int("proxy-https-port"),
 					AutoInstall: false, // Don't auto-install external tools
+					BindAddr:    bindAddr,
+
+					TerminateTLS:  c.Bool("proxy-https"),
+					ProxyProtocol: c.Bool("proxy-protocol"),
+					LocalTLD:      tld,
+					Timeouts: &proxy.ServerTimeouts{
+						ReadHeaderTimeout: c.Duration("proxy-read-header-timeout"),
+						ReadTimeout:       c.Duration("proxy-read-timeout"),
+						WriteTimeout:      c.Duration("proxy-write-timeout"),
+						IdleTimeout:       c.Duration("proxy-idle-timeout"),
+					},
 				}
 				
 				// Auto-detect best proxy if mode is "auto"
@@ -176,6 +396,7 @@ func main() {
 				
 				if proxyConfig.Mode != proxy.NoProxy {
 					proxyManager = proxy.NewManager(proxyConfig)
+					proxyManager.SetLogger(obsProvider.Logger())
 					useProxy = true
 					
 					obsProvider.Logger().InfoContext(ctx, "Proxy initialized",
@@ -186,34 +407,98 @@ func main() {
 				}
 			}
 			
+			managerOpts := tunnel.ManagerOptions{
+				UseMDNS:  !c.Bool("no-mdns"),
+				UseHosts: !c.Bool("no-hosts"),
+				LocalTLD: tld,
+				DryRun:   c.Bool("dry-run"),
+			}
+			netPreset.applyManager(&managerOpts)
+			naming, err := dnsserver.ParseDisambiguation(c.String("mdns-suffix"))
+			if err != nil {
+				return fmt.Errorf("%w: invalid --mdns-suffix: %w", tunnel.ErrInvalidOptions, err)
+			}
+			dnsserver.SetDisambiguation(naming)
+			// Warn when another machine already advertises a tunnel's name
+			dnsserver.SetConflictCheck(300 * time.Millisecond)
+
+			if addr := c.String("advertise-ip"); addr != "" {
+				ip := net.ParseIP(addr)
+				if ip == nil {
+					return fmt.Errorf("%w: invalid --advertise-ip %q", tunnel.ErrInvalidOptions, addr)
+				}
+				managerOpts.AdvertiseIP = ip
+			}
+			if spec := c.String("tunnel-port-range"); spec != "" {
+				portRange, err := tunnel.ParsePortRange(spec)
+				if err != nil {
+					return fmt.Errorf("invalid --tunnel-port-range: %w", err)
+				}
+				// Check before the proxy binds a port a tunnel would need
+				if useProxy && proxyManager != nil {
+					if err := tunnel.CheckProxyPorts(portRange, proxyManager.Config()); err != nil {
+						return fmt.Errorf("%w; move the proxy with --proxy-http-port/--proxy-https-port or change --tunnel-port-range", err)
+					}
+				}
+				managerOpts.TunnelPorts = &portRange
+			}
+
 			// Create tunnel manager with proxy integration
-			if useProxy && proxyManager != nil {
-				manager = tunnel.NewManagerWithProxy(certManager, proxyManager, true, obsProvider.Logger())
-				
+			if useProxy && proxyManager != nil && managerOpts.DryRun {
+				// Plan routes through the proxy without binding its ports
+				managerOpts.ProxyManager = proxyManager
+				managerOpts.UseProxy = true
+			} else if useProxy && proxyManager != nil {
 				// Start the proxy system
 				if err := proxyManager.Start(); err != nil {
 					obsProvider.Logger().WithContext(ctx).Error("Failed to start proxy", "error", err)
 					metrics.RecordError(ctx, "proxy", "startup", err)
 					// Don't fail completely, fall back to direct mode
-					manager = tunnel.NewManager(certManager, obsProvider.Logger())
 					proxyManager = nil
 					obsProvider.Logger().WithContext(ctx).Warn("Falling back to direct tunnel mode")
 				} else {
+					managerOpts.ProxyManager = proxyManager
+					managerOpts.UseProxy = true
 					obsProvider.Logger().WithContext(ctx).Info("Proxy system started successfully")
 				}
-			} else {
-				manager = tunnel.NewManager(certManager, obsProvider.Logger())
 			}
 
-			// Set up DNS server
-			go func() {
-				if err := dnsserver.StartDNSServer(); err != nil {
-					obsProvider.Logger().ErrorContext(ctx, "Failed to start DNS server", slog.Any("error", err))
-					metrics.RecordError(ctx, "dns_server", "startup", err)
+			manager, err = tunnel.NewManagerWithOptions(certManager, obsProvider.Logger(), managerOpts)
+			if err != nil {
+				return fmt.Errorf("failed to create tunnel manager: %w", err)
+			}
+			if _, err := metrics.ObserveActiveTunnels(manager.Count); err != nil {
+				obsProvider.Logger().WarnContext(ctx, "Failed to register active tunnel gauge", slog.Any("error", err))
+			}
+			if _, err := metrics.ObserveTunnelBytes(tunnelBytes); err != nil {
+				obsProvider.Logger().WarnContext(ctx, "Failed to register tunnel byte counter", slog.Any("error", err))
+			}
+			if _, err := metrics.ObserveBadGateways(badGateways); err != nil {
+				obsProvider.Logger().WarnContext(ctx, "Failed to register bad gateway counter", slog.Any("error", err))
+			}
+			manager.OnEvent(func(ev tunnel.TunnelEvent) {
+				if ev.Type == tunnel.EventError && errors.Is(ev.Err, middleware.ErrPanic) {
+					metrics.RecordError(context.Background(), "panic", "serve_request", ev.Err)
+				}
+				if ev.Type == tunnel.EventStopped {
+					select {
+					case tunnelStopped <- ev.Domain:
+					default:
+					}
+				}
+				if running != nil && (ev.Type == tunnel.EventStarted || ev.Type == tunnel.EventStopped) {
+					running.notify()
 				}
-			}()
+			})
+			if instanceLock != nil {
+				running = publishRunning(getRunningFileFunc())
+			}
+			manager.OnRegistration(func(r tunnel.Registration) {
+				metrics.DNSRegistration(context.Background(), r.Method, r.Domain, r.Duration, r.Err)
+			})
 
-			setupCleanup()
+			// The tunnel manager started the DNS server if it uses mDNS
+			setupCleanup(c.Bool("quiet"), c.Duration("shutdown-timeout"))
 			
 			span.SetAttributes(
 				attribute.String("service.version", obsConfig.ServiceVersion),
@@ -231,12 +516,16 @@ func main() {
 						Name:    "port",
 						Aliases: []string{"p"},
 						Value:   80,
-						Usage:   "Local port to tunnel",
+						Usage:   "Local port to tunnel (0 picks a free port when used with --exec)",
 					},
 					&cli.StringFlag{
 						Name:    "domain",
 						Aliases: []string{"d"},
-						Usage:   "Domain name for the tunnel (will be suffixed with .local if not provided)",
+						Usage:   "Domain name for the tunnel (will be suffixed with the --tld if not provided)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "alias",
+						Usage: "Additional domain routed to the same backend (repeatable, e.g. www.myapp)",
 					},
 					&cli.BoolFlag{
 						Name:    "https",
@@ -249,6 +538,152 @@ func main() {
 						Value: 443,
 						Usage: "HTTPS port (default: 443)",
 					},
+					&cli.BoolFlag{
+						Name:  "also-http",
+						Usage: "With HTTPS, serve plain HTTP on port 80 as well (needs --proxy none)",
+					},
+					&cli.BoolFlag{
+						Name:  "redirect-http",
+						Usage: "With HTTPS, redirect plain HTTP on port 80 to HTTPS (needs --proxy none)",
+					},
+					&cli.StringFlag{
+						Name:  "listen-addr",
+						Usage: "Interface address the tunnel binds to (default: all interfaces; e.g. 127.0.0.1 to keep it off the network)",
+					},
+					&cli.StringFlag{
+						Name:  "ip-family",
+						Value: tunnel.IPFamilyDual,
+						Usage: "IP family the tunnel listens on: 4, 6 or dual (IPv4 alone where IPv6 is disabled)",
+					},
+					&cli.StringFlag{
+						Name:  "cert-file",
+						Usage: "Serve HTTPS with this certificate instead of generating one with mkcert",
+					},
+					&cli.StringFlag{
+						Name:  "key-file",
+						Usage: "Private key for --cert-file",
+					},
+					&cli.BoolFlag{
+						Name:  "watch-certs",
+						Usage: "Reload --cert-file and --key-file when they change, e.g. after rotation",
+					},
+					&cli.StringFlag{
+						Name:  "client-ca",
+						Usage: "PEM bundle of CAs; HTTPS clients must present a certificate signed by one (mutual TLS, needs --proxy none; not with --also-http)",
+					},
+					&cli.BoolFlag{
+						Name:  "mdns-when-healthy",
+						Usage: "Advertise the domain over mDNS only while the backend accepts connections",
+					},
+					&cli.StringSliceFlag{
+						Name:  "mdns-txt",
+						Usage: "Extra mDNS TXT record as key=value (e.g. path=/health), repeatable; adds to, or replaces same-named, default records",
+					},
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "Tag the tunnel as key=value (e.g. project=web), repeatable, for selecting it with list or stop-all --label",
+					},
+					&cli.BoolFlag{
+						Name:  "install-ca",
+						Usage: "Run mkcert -install if its root CA isn't trusted yet, instead of only warning",
+					},
+					&cli.BoolFlag{
+						Name:  "clean-hosts",
+						Usage: "Remove hosts file entries left by gotunnel processes that didn't exit cleanly, instead of only warning",
+					},
+					&cli.StringFlag{
+						Name:  "backend-scheme",
+						Value: "http",
+						Usage: "Scheme the backend speaks: http, or https for dev servers that terminate TLS themselves",
+					},
+					&cli.BoolFlag{
+						Name:  "backend-insecure",
+						Usage: "Accept self-signed or otherwise untrusted backend certificates",
+					},
+					&cli.BoolFlag{
+						Name:  "backend-h2c",
+						Usage: "Speak HTTP/2 without TLS (h2c) to the backend, e.g. for gRPC dev servers",
+					},
+					&cli.BoolFlag{
+						Name:  "grpc",
+						Usage: "Tunnel a gRPC server: HTTP/2 end to end, immediate flushing and no write timeout on streams",
+					},
+					&cli.BoolFlag{
+						Name:  "preserve-host",
+						Usage: "Send the tunnel's domain as the Host header instead of the backend address",
+					},
+					&cli.StringFlag{
+						Name:  "strip-path-prefix",
+						Usage: "Remove this path prefix from requests before they reach the backend",
+					},
+					&cli.StringFlag{
+						Name:  "add-path-prefix",
+						Usage: "Put this path prefix in front of requests, e.g. for a backend mounted under a subpath",
+					},
+					&cli.StringFlag{
+						Name:  "inject-html",
+						Usage: "HTML inserted before </body> in the backend's HTML pages, e.g. a staging banner",
+					},
+					&cli.IntFlag{
+						Name:  "backend-retries",
+						Value: 3,
+						Usage: "Times to retry connecting to a backend that refuses connections (e.g. while it starts)",
+					},
+					&cli.DurationFlag{
+						Name:  "backend-dial-timeout",
+						Value: 5 * time.Second,
+						Usage: "Give up on a backend connection attempt after this long",
+					},
+					&cli.DurationFlag{
+						Name:  "backend-keepalive",
+						Value: 30 * time.Second,
+						Usage: "TCP keep-alive period for backend connections (negative disables)",
+					},
+					&cli.DurationFlag{
+						Name:  "idle-timeout",
+						Usage: "Stop the tunnel after this long without a request, e.g. 30m for a demo (0 disables)",
+					},
+					&cli.DurationFlag{
+						Name:  "response-timeout",
+						Usage: "Answer 504 when the backend hasn't responded within this long (0 waits for the client to give up)",
+					},
+					&cli.IntFlag{
+						Name:  "circuit-breaker",
+						Usage: "Fail requests fast with a 503 after this many backend failures in a row (0 disables)",
+					},
+					&cli.DurationFlag{
+						Name:  "circuit-breaker-cooldown",
+						Value: 10 * time.Second,
+						Usage: "How long the circuit breaker fails requests fast before trying the backend again",
+					},
+					&cli.StringFlag{
+						Name:  "exec",
+						Usage: "Backend command to launch with PORT set in its environment (e.g. \"npm run dev\")",
+					},
+					&cli.StringFlag{
+						Name:  "docker-container",
+						Usage: "Tunnel to this Docker container's exposed port (--port picks one of several) where it's published on the host, or else the container's address, following it across restarts",
+					},
+					&cli.StringSliceFlag{
+						Name:  "watch",
+						Usage: "Restart the --exec command when files under this directory change, repeatable",
+					},
+					&cli.StringSliceFlag{
+						Name:  "cors-origin",
+						Usage: "Allowed CORS origin, repeatable (use * for any origin)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "cors-method",
+						Usage: "Allowed CORS method, repeatable (default: common methods; needs --cors-origin)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "cors-header",
+						Usage: "Allowed CORS request header, repeatable (default: common headers; needs --cors-origin)",
+					},
+					&cli.BoolFlag{
+						Name:  "cors-allow-credentials",
+						Usage: "Allow credentialed CORS requests (not compatible with --cors-origin '*')",
+					},
 				},
 				Action: StartTunnel,
 			},
@@ -259,76 +694,228 @@ func main() {
 				Action:    StopTunnel,
 			},
 			{
-				Name:   "list",
-				Usage:  "List active tunnels",
+				Name:  "list",
+				Usage: "List active tunnels",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "Only list tunnels with this key=value label, repeatable; all must match",
+					},
+				},
 				Action: ListTunnels,
 			},
 			{
-				Name:   "stop-all",
-				Usage:  "Stop all tunnels",
+				Name:  "routes",
+				Usage: "List the running gotunnel's proxy routes",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print as JSON for tooling",
+					},
+				},
+				Action: ListRoutes,
+			},
+			{
+				Name:  "stop-all",
+				Usage: "Stop all tunnels",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "Only stop tunnels with this key=value label, repeatable; all must match",
+					},
+				},
 				Action: StopAllTunnels,
 			},
+			{
+				Name:  "export",
+				Usage: "Write the active tunnels as a config file for `gotunnel up -f`",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "File to write instead of stdout",
+					},
+				},
+				Action: ExportTunnels,
+			},
+			{
+				Name:  "up",
+				Usage: "Start every tunnel in a config file written by `gotunnel export`",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Usage:    "Tunnel config file",
+						Required: true,
+					},
+				},
+				Action: UpTunnels,
+			},
+			{
+				Name:  "logs",
+				Usage: "Tail the log file written with --log-file --log-format json",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "level",
+						Usage: "Only show entries at or above this level (debug, info, warn, error)",
+					},
+					&cli.StringFlag{
+						Name:  "tunnel",
+						Usage: "Only show entries for this tunnel domain",
+					},
+					&cli.BoolFlag{
+						Name:  "no-follow",
+						Usage: "Print the current contents and exit instead of waiting for new entries",
+					},
+					&cli.BoolFlag{
+						Name:  "no-color",
+						Usage: "Disable colorized output",
+					},
+				},
+				Action: TailLogs,
+			},
+			{
+				Name:      "serve",
+				Usage:     "Serve a directory's files through a tunnel, without running a server",
+				ArgsUsage: "<dir> (flags go before the directory)",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "domain",
+						Aliases: []string{"d"},
+						Usage:   "Domain name for the tunnel (will be suffixed with the --tld if not provided)",
+					},
+					&cli.BoolFlag{
+						Name:    "https",
+						Aliases: []string{"s"},
+						Value:   true,
+						Usage:   "Enable HTTPS (default: true)",
+					},
+					&cli.IntFlag{
+						Name:  "https-port",
+						Value: 443,
+						Usage: "HTTPS port (default: 443)",
+					},
+					&cli.StringFlag{
+						Name:  "listen-addr",
+						Usage: "Interface address the tunnel binds to (default: all interfaces; e.g. 127.0.0.1 to keep it off the network)",
+					},
+					&cli.BoolFlag{
+						Name:  "listing",
+						Usage: "List the files in directories without an index.html instead of answering 404",
+					},
+					&cli.BoolFlag{
+						Name:  "index-fallback",
+						Usage: "Serve the root index.html for paths that don't exist (single-page apps)",
+					},
+					&cli.BoolFlag{
+						Name:  "dotfiles",
+						Usage: "Serve files and folders whose names start with a dot, such as .env and .git (hidden by default)",
+					},
+				},
+				Action: ServeDirectory,
+			},
+			{
+				Name:  "cert",
+				Usage: "Inspect the certificates tunnels serve",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "info",
+						Usage:     "Show the certificate a tunnel for the domain would serve, generating it if needed",
+						ArgsUsage: "<domain>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "json",
+								Usage: "Print as JSON for tooling",
+							},
+						},
+						Action: CertInfo,
+					},
+				},
+			},
+			{
+				Name:  "version",
+				Usage: "Print version and build information",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print as JSON for tooling",
+					},
+				},
+				Action: PrintVersion,
+			},
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+	// The config file only changes flag defaults, so the environment and
+	// the command line still override it
+	if err := applyConfigFile(app.Flags); err != nil {
+		log.Print(err)
+		os.Exit(exitInvalidInput)
 	}
-}
-
-func setupCleanup() {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-
-		ctx := context.Background()
-		if obsProvider != nil {
-			ctx, span := obsProvider.StartSpan(ctx, "application.shutdown")
-			defer span.End()
-
-			obsProvider.Logger().InfoContext(ctx, "Shutting down application...")
-		}
-
-		shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-		defer cancel()
 
-		// Stop proxy manager first
-		if proxyManager != nil {
-			if err := proxyManager.Stop(); err != nil {
-				if obsProvider != nil {
-					obsProvider.Logger().ErrorContext(shutdownCtx, "Error stopping proxy manager", slog.Any("error", err))
-					metrics.RecordError(shutdownCtx, "proxy_manager", "shutdown", err)
-				} else {
-					log.Printf("Error during proxy manager shutdown: %v", err)
-				}
-			}
-		}
+	err := app.Run(os.Args)
+	releaseInstanceLock()
+	if err != nil {
+		log.Print(err)
+		os.Exit(exitCodeFor(err))
+	}
+}
 
-		// Stop tunnel manager
-		if manager != nil {
-			if err := manager.Stop(shutdownCtx); err != nil {
-				if obsProvider != nil {
-					obsProvider.Logger().ErrorContext(shutdownCtx, "Error stopping tunnel manager", slog.Any("error", err))
-					metrics.RecordError(shutdownCtx, "tunnel_manager", "shutdown", err)
-				} else {
-					log.Printf("Error during tunnel manager shutdown: %v", err)
-				}
-			}
-		}
+// releaseInstanceLock removes the lock file start, up or serve took, if any
+func releaseInstanceLock() {
+	if instanceLock == nil {
+		return
+	}
+	if err := instanceLock.Release(); err != nil {
+		log.Printf("Error removing lock file: %v", err)
+	}
+}
 
-		// Shutdown observability provider
-		if obsProvider != nil {
-			obsProvider.Logger().InfoContext(shutdownCtx, "Shutting down observability...")
-			if err := obsProvider.Shutdown(shutdownCtx); err != nil {
-				// Can't use obsProvider.Logger here since we're shutting it down
-				log.Printf("Error during observability shutdown: %v", err)
-			}
-		}
+// checkRootCA warns when mkcert's root CA isn't trusted, since browsers then
+// reject every certificate gotunnel generates. With install set it runs
+// mkcert -install instead.
+func checkRootCA(ctx context.Context, install bool) error {
+	installed, err := certManager.IsRootCAInstalled()
+	if err != nil {
+		// mkcert may not be installed yet; EnsureCert reports that properly
+		obsProvider.Logger().DebugContext(ctx, "Could not check mkcert's root CA", slog.Any("error", err))
+		return nil
+	}
+	if installed {
+		return nil
+	}
+	if install {
+		fmt.Println("Installing mkcert's root CA into the system trust store...")
+		return certManager.InstallRootCA()
+	}
+	fmt.Printf("Warning: mkcert's root CA is not trusted, so browsers will reject HTTPS tunnels.\n")
+	fmt.Printf("Fix it with: %s (or start with --install-ca)\n", cert.InstallCACommand)
+	return nil
+}
 
-		fmt.Println("Shutdown complete")
-		os.Exit(0)
-	}()
+// checkStaleHosts warns about hosts file entries left by gotunnel processes
+// that crashed, since they keep resolving names nothing serves. With clean
+// set it removes them instead.
+func checkStaleHosts(ctx context.Context, clean bool) {
+	stale, err := tunnel.StaleHostsEntries()
+	if err != nil {
+		obsProvider.Logger().DebugContext(ctx, "Could not check the hosts file for stale entries", slog.Any("error", err))
+		return
+	}
+	if len(stale) == 0 {
+		return
+	}
+	if !clean {
+		fmt.Printf("Warning: the hosts file still maps %s from a gotunnel process that didn't exit cleanly.\n", strings.Join(stale, ", "))
+		fmt.Printf("Remove them by starting with --clean-hosts\n")
+		return
+	}
+	removed, err := tunnel.RemoveStaleHostsEntries()
+	if err != nil {
+		obsProvider.Logger().WarnContext(ctx, "Failed to remove stale hosts entries", slog.Any("error", err))
+		return
+	}
+	fmt.Printf("Removed stale hosts entries: %s\n", strings.Join(removed, ", "))
 }
 
 func StartTunnel(c *cli.Context) error {
@@ -338,20 +925,97 @@ func StartTunnel(c *cli.Context) error {
 
 	domain := c.String("domain")
 	if domain == "" {
-		err := fmt.Errorf("domain is required")
+		err := fmt.Errorf("%w: domain is required", tunnel.ErrInvalidDomain)
 		obsProvider.RecordError(ctx, span, err, "domain parameter missing")
 		return err
 	}
 
-	// Ensure domain has .local suffix
-	if !strings.HasSuffix(domain, ".local") {
-		domain = domain + ".local"
+	// Ensure domain has the TLD suffix
+	if suffix := "." + manager.TLD(); !strings.HasSuffix(domain, suffix) {
+		domain += suffix
 	}
 
 	port := c.Int("port")
 	https := c.Bool("https")
 	httpsPort := c.Int("https-port")
 
+	// Launch the backend command, handing it the port to listen on
+	command := c.String("exec")
+	watchDirs := c.StringSlice("watch")
+	if len(watchDirs) > 0 && command == "" {
+		return fmt.Errorf("%w: --watch restarts the --exec command, so it needs one", tunnel.ErrInvalidOptions)
+	}
+	container := c.String("docker-container")
+	if container != "" && command != "" {
+		return fmt.Errorf("%w: --docker-container and --exec can't be used together", tunnel.ErrInvalidOptions)
+	}
+	if command != "" && port == 0 {
+		freeP, err := netutil.FreePort()
+		if err != nil {
+			obsProvider.RecordError(ctx, span, err, "backend port allocation failed")
+			return fmt.Errorf("failed to allocate backend port: %w", err)
+		}
+		port = freeP
+	}
+	if command != "" && c.Bool("dry-run") {
+		fmt.Printf("[dry-run] would run %q with PORT=%d\n", command, port)
+	} else if command != "" {
+		proc, err := process.Supervise(command, port, obsProvider.Logger())
+		if err != nil {
+			obsProvider.RecordError(ctx, span, err, "backend command failed to start")
+			return fmt.Errorf("%w: %w", tunnel.ErrBackendUnreachable, err)
+		}
+		backendProcess = proc
+		defer proc.Stop(context.Background())
+
+		readyCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err = proc.Process().WaitReady(readyCtx)
+		cancel()
+		if err != nil {
+			obsProvider.Logger().WarnContext(ctx, "Backend is not accepting connections yet",
+				slog.String("command", command),
+				slog.Int("port", port),
+				slog.Any("error", err),
+			)
+		}
+		span.SetAttributes(attribute.String("tunnel.exec", command))
+	}
+
+	// Point the tunnel at the container's address and exposed port
+	var (
+		inspector       docker.Inspector
+		containerTarget docker.Target
+		containerPort   int // 0 follows the container's only exposed port
+	)
+	if container != "" {
+		if c.IsSet("port") {
+			containerPort = port
+		}
+		var err error
+		inspector, containerTarget, err = containerBackend(ctx, container, containerPort)
+		if err != nil {
+			obsProvider.RecordError(ctx, span, err, "docker container resolution failed")
+			return err
+		}
+		port = containerTarget.Port
+		span.SetAttributes(attribute.String("tunnel.docker_container", container))
+	}
+
+	// Watch before starting the tunnel so a bad directory fails fast
+	var watcher *process.Watcher
+	if backendProcess != nil && len(watchDirs) > 0 {
+		var err error
+		watcher, err = process.NewWatcher(watchDirs, obsProvider.Logger())
+		if err != nil {
+			obsProvider.RecordError(ctx, span, err, "file watcher failed to start")
+			return fmt.Errorf("%w: %w", tunnel.ErrInvalidOptions, err)
+		}
+		defer watcher.Close()
+		if path := c.String("log-file"); path != "" {
+			watcher.Ignore(path)
+		}
+	}
+
 	// Add span attributes
 	span.SetAttributes(
 		attribute.String("tunnel.domain", domain),
@@ -368,12 +1032,98 @@ func StartTunnel(c *cli.Context) error {
 		slog.Int("https_port", httpsPort),
 	)
 
+	opts := tunnel.Options{
+		BackendPort: port,
+		Domain:      domain,
+		Aliases:     c.StringSlice("alias"),
+		HTTPS:       https,
+		HTTPPort:    80,
+		HTTPSPort:   httpsPort,
+		ListenAddr:  c.String("listen-addr"),
+		IPFamily:    c.String("ip-family"),
+		CertFile:    c.String("cert-file"),
+		KeyFile:     c.String("key-file"),
+		WatchCerts:  c.Bool("watch-certs"),
+
+		ClientCAFile: c.String("client-ca"),
+
+		AlsoHTTP:     c.Bool("also-http"),
+		RedirectHTTP: c.Bool("redirect-http"),
+
+		// Behind the built-in proxy, clients connect to it rather than the tunnel
+		ProxyProtocol: c.Bool("proxy-protocol") && proxyManager == nil,
+
+		BackendRetries:            c.Int("backend-retries"),
+		BackendDialTimeout:        c.Duration("backend-dial-timeout"),
+		BackendKeepAlive:          c.Duration("backend-keepalive"),
+		BackendScheme:             c.String("backend-scheme"),
+		BackendInsecureSkipVerify: c.Bool("backend-insecure"),
+		BackendH2C:                c.Bool("backend-h2c"),
+		GRPC:                      c.Bool("grpc"),
+		PreserveHost:              c.Bool("preserve-host"),
+		StripPathPrefix:           c.String("strip-path-prefix"),
+		AddPathPrefix:             c.String("add-path-prefix"),
+		InjectHTML:                c.String("inject-html"),
+		HealthGatedMDNS:           c.Bool("mdns-when-healthy"),
+		IdleTimeout:               c.Duration("idle-timeout"),
+		ResponseTimeout:           c.Duration("response-timeout"),
+	}
+	if container != "" {
+		opts.BackendHost = containerTarget.Host
+	}
+	// The global flags were checked before start's own flags were parsed
+	if _, err := presetFromFlags(c); err != nil {
+		return err
+	}
+	netPreset.applyTunnel(&opts)
+	if threshold := c.Int("circuit-breaker"); threshold != 0 {
+		opts.CircuitBreaker = &tunnel.CircuitBreaker{
+			FailureThreshold: threshold,
+			Cooldown:         c.Duration("circuit-breaker-cooldown"),
+		}
+	}
+	if records := c.StringSlice("mdns-txt"); len(records) > 0 {
+		txt, err := parseKeyValues(records)
+		if err != nil {
+			return fmt.Errorf("%w: invalid --mdns-txt: %w", tunnel.ErrInvalidOptions, err)
+		}
+		opts.MDNSTXT = txt
+	}
+	if pairs := c.StringSlice("label"); len(pairs) > 0 {
+		labels, err := parseKeyValues(pairs)
+		if err != nil {
+			return fmt.Errorf("%w: invalid --label: %w", tunnel.ErrInvalidOptions, err)
+		}
+		opts.Labels = labels
+		for key, value := range labels {
+			span.SetAttributes(attribute.String("tunnel.label."+key, value))
+		}
+	}
+	if origins := c.StringSlice("cors-origin"); len(origins) > 0 {
+		opts.CORS = &middleware.CORSConfig{
+			AllowedOrigins:   origins,
+			AllowedMethods:   c.StringSlice("cors-method"),
+			AllowedHeaders:   c.StringSlice("cors-header"),
+			AllowCredentials: c.Bool("cors-allow-credentials"),
+		}
+	} else if c.IsSet("cors-method") || c.IsSet("cors-header") || c.Bool("cors-allow-credentials") {
+		return fmt.Errorf("%w: --cors-method, --cors-header and --cors-allow-credentials need --cors-origin", tunnel.ErrInvalidOptions)
+	}
+
+	checkStaleHosts(ctx, c.Bool("clean-hosts") && !c.Bool("dry-run"))
+	if https && opts.CertFile == "" {
+		if err := checkRootCA(ctx, c.Bool("install-ca") && !c.Bool("dry-run")); err != nil {
+			obsProvider.RecordError(ctx, span, err, "root CA installation failed")
+			return fmt.Errorf("%w: %w", tunnel.ErrCertUnavailable, err)
+		}
+	}
+
 	// Record tunnel creation metric
 	metrics.TunnelCreated(ctx, domain, port, https)
 
 	// Start the tunnel
 	timer := metrics.StartOperation(ctx, "tunnel_start")
-	err := manager.StartTunnel(ctx, port, domain, https, httpsPort)
+	err := manager.StartTunnelWithOptions(ctx, opts)
 	timer.End(err)
 
 	if err != nil {
@@ -381,6 +1131,10 @@ func StartTunnel(c *cli.Context) error {
 		obsProvider.RecordError(ctx, span, err, "tunnel start failed")
 		return errMsg
 	}
+	if c.Bool("dry-run") {
+		fmt.Println("\nDry run: nothing was changed")
+		return nil
+	}
 
 	obsProvider.Logger().InfoContext(ctx, "Tunnel started successfully",
 		slog.String("domain", domain),
@@ -389,12 +1143,29 @@ func StartTunnel(c *cli.Context) error {
 
 	// Print success information
 	fmt.Printf("\nTunnel started successfully!\n")
-	fmt.Printf("Local endpoint: http://localhost:%d\n", port)
-	if https {
-		fmt.Printf("Access your service at: https://%s\n", domain)
+	if container != "" {
+		fmt.Printf("Backend container: %s (http://%s)\n", container, net.JoinHostPort(containerTarget.Host, strconv.Itoa(port)))
 	} else {
-		fmt.Printf("Access your service at: http://%s\n", domain)
+		fmt.Printf("Local endpoint: http://localhost:%d\n", port)
+	}
+	if backendProcess != nil {
+		fmt.Printf("Backend command: %s (PORT=%d)\n", backendProcess.Command, port)
 	}
+	scheme, host, publicPort := "http", domain, 0
+	if proxyManager != nil {
+		// The built-in proxy may have landed on a fallback port
+		publicPort = proxyManager.ActualPort()
+	}
+	if https {
+		scheme = "https"
+		if proxyManager != nil {
+			publicPort = proxyManager.TLSPort()
+		}
+	}
+	if publicPort != 0 && publicPort != 80 && publicPort != 443 {
+		host = net.JoinHostPort(domain, strconv.Itoa(publicPort))
+	}
+	fmt.Printf("Access your service at: %s://%s\n", scheme, host)
 	fmt.Printf("\nDomain is accessible:\n")
 	fmt.Printf("- Locally via /etc/hosts: https://%s\n", domain)
 	fmt.Printf("- On your network via mDNS: https://%s\n", domain)
@@ -402,37 +1173,68 @@ func StartTunnel(c *cli.Context) error {
 	// Track tunnel start time for duration calculation
 	startTime := time.Now()
 
-	// Wait for interrupt signal
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+	// Re-apply the state file on SIGHUP, keeping this tunnel running
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+	reloadCtx, stopReload := context.WithCancel(ctx)
+	defer stopReload()
+	go reloadOnSignal(reloadCtx, hupCh, []tunnel.Options{opts})
 
-	obsProvider.Logger().InfoContext(ctx, "Received shutdown signal, stopping tunnel",
-		slog.String("domain", domain),
-	)
+	// Restart the backend when its files change, keeping the tunnel up
+	if watcher != nil {
+		go backendProcess.RestartOnChange(reloadCtx, watcher, c.Duration("shutdown-timeout"))
+		fmt.Printf("Restarting the backend when files change in: %s\n", strings.Join(watchDirs, ", "))
+	}
 
-	// Stop tunnel with proper tracing
-	stopCtx, stopSpan := obsProvider.StartSpan(ctx, "tunnel.stop")
-	defer stopSpan.End()
+	// Follow the container to its new address when it restarts
+	if container != "" {
+		go followContainer(reloadCtx, inspector, container, containerPort, domain, containerTarget, dockerPollInterval)
+	}
 
-	stopTimer := metrics.StartOperation(stopCtx, "tunnel_stop")
-	err = manager.StopTunnel(stopCtx, domain)
-	stopTimer.End(err)
+	// Wait for interrupt signal, or for the backend command to exit. When
+	// watching, a backend that exits (e.g. on a compile error) is restarted
+	// by the next change instead. Either way the tunnel, backend and proxy
+	// come down through the same shutdown a signal triggers.
+	sigCh := claimSignals()
+	defer shutdown()
 
-	// Record tunnel duration
-	duration := time.Since(startTime)
-	metrics.TunnelDestroyed(stopCtx, domain, duration)
+	var backendDone <-chan struct{}
+	if backendProcess != nil && watcher == nil {
+		backendDone = backendProcess.Process().Done()
+	}
 
-	if err != nil {
-		obsProvider.RecordError(stopCtx, stopSpan, err, "tunnel stop failed")
-		return err
+	idleStopped := false
+	for waiting := true; waiting; {
+		select {
+		case <-sigCh:
+			obsProvider.Logger().InfoContext(ctx, "Received shutdown signal, stopping tunnel",
+				slog.String("domain", domain),
+			)
+			waiting = false
+		case <-backendDone:
+			obsProvider.Logger().WarnContext(ctx, "Backend command exited, stopping tunnel",
+				slog.String("domain", domain),
+				slog.Any("error", backendProcess.Process().Err()),
+			)
+			waiting = false
+		case stopped := <-tunnelStopped:
+			// Only the idle timeout stops the tunnel from inside the manager
+			idleStopped = stopped == domain
+			waiting = !idleStopped
+		}
+	}
+	if idleStopped {
+		fmt.Printf("Tunnel %s stopped after %s without requests\n", domain, c.Duration("idle-timeout"))
 	}
 
-	obsProvider.Logger().InfoContext(stopCtx, "Tunnel stopped successfully",
+	// Record tunnel duration; the deferred shutdown stops the tunnel
+	duration := time.Since(startTime)
+	metrics.TunnelDestroyed(ctx, domain, duration)
+	obsProvider.Logger().InfoContext(ctx, "Tunnel session ended",
 		slog.String("domain", domain),
 		slog.Duration("total_duration", duration),
 	)
-
 	return nil
 }
 
@@ -440,7 +1242,7 @@ func StopTunnel(c *cli.Context) error {
 	ctx := context.Background()
 	domain := c.Args().Get(0)
 	if domain == "" {
-		return fmt.Errorf("domain is required")
+		return fmt.Errorf("%w: domain is required", tunnel.ErrInvalidDomain)
 	}
 	return manager.StopTunnel(ctx, domain)
 }
@@ -449,11 +1251,23 @@ func StopAllTunnels(c *cli.Context) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	return manager.Stop(ctx)
+	selector, err := parseKeyValues(c.StringSlice("label"))
+	if err != nil {
+		return fmt.Errorf("%w: invalid --label: %w", tunnel.ErrInvalidOptions, err)
+	}
+	return manager.StopAllMatching(ctx, selector)
 }
 
 func ListTunnels(c *cli.Context) error {
-	tunnels := manager.ListTunnels()
+	selector, err := parseKeyValues(c.StringSlice("label"))
+	if err != nil {
+		return fmt.Errorf("%w: invalid --label: %w", tunnel.ErrInvalidOptions, err)
+	}
+	tunnels := manager.ListTunnelsMatching(selector)
+	if len(tunnels) == 0 && len(selector) > 0 {
+		fmt.Println("No active tunnels match the labels")
+		return nil
+	}
 	if len(tunnels) == 0 {
 		fmt.Println("No active tunnels")
 		return nil
@@ -461,8 +1275,75 @@ func ListTunnels(c *cli.Context) error {
 
 	fmt.Println("Active tunnels:")
 	for _, t := range tunnels {
-		fmt.Printf("  %s -> localhost:%d (HTTPS: %v)\n",
-			t["domain"], t["port"], t["https"])
+		fmt.Printf("  %s -> localhost:%d (HTTPS: %v, requests: %d, bytes in/out: %d/%d)\n",
+			t["domain"], t["port"], t["https"], t["requests"], t["bytes_in"], t["bytes_out"])
+		if aliases, ok := t["aliases"].([]string); ok && len(aliases) > 0 {
+			fmt.Printf("    aliases: %s\n", strings.Join(aliases, ", "))
+		}
+		if labels, ok := t["labels"].(map[string]string); ok && len(labels) > 0 {
+			fmt.Printf("    labels: %s\n", formatLabels(labels))
+		}
 	}
 	return nil
 }
+
+// tunnelBytes reads the byte counters of the running tunnels for metrics
+func tunnelBytes() []observability.TunnelBytes {
+	var totals []observability.TunnelBytes
+	for _, info := range manager.ListTunnels() {
+		t := observability.TunnelBytes{}
+		t.Domain, _ = info["domain"].(string)
+		t.In, _ = info["bytes_in"].(int64)
+		t.Out, _ = info["bytes_out"].(int64)
+		totals = append(totals, t)
+	}
+	return totals
+}
+
+// badGateways returns how many 502 error pages each running tunnel has served
+func badGateways() map[string]int64 {
+	counts := make(map[string]int64)
+	for _, info := range manager.ListTunnels() {
+		domain, _ := info["domain"].(string)
+		counts[domain], _ = info["bad_gateways"].(int64)
+	}
+	return counts
+}
+
+// formatLabels writes labels as key=value pairs, sorted by key
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// parseKeyValues turns key=value pairs into a map
+func parseKeyValues(pairs []string) (map[string]string, error) {
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+	return values, nil
+}
+
+// logLevel picks the log level for the --quiet, --verbose and --debug flags
+func logLevel(quiet, verbose, debug bool) (logging.LogLevel, error) {
+	switch {
+	case quiet && (verbose || debug):
+		return "", fmt.Errorf("%w: --quiet can't be combined with --verbose or --debug", tunnel.ErrInvalidOptions)
+	case quiet:
+		return logging.LevelError, nil
+	case verbose || debug:
+		return logging.LevelDebug, nil
+	default:
+		return logging.LevelInfo, nil
+	}
+}
@@ -3,21 +3,25 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/johncferguson/gotunnel/internal/cert"
+	"github.com/johncferguson/gotunnel/internal/logging"
+	"github.com/johncferguson/gotunnel/internal/observability"
 	"github.com/johncferguson/gotunnel/internal/tunnel"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
 )
 
 func TestMain(m *testing.M) {
@@ -71,11 +75,13 @@ func setupTunnelManagerWithCleanup(t *testing.T) (*tunnel.Manager, func()) {
 	tmpDir, err := os.MkdirTemp("", "gotunnel-test-*")
 	require.NoError(t, err)
 
-	// Create cert manager with temp dir for certs
+	// Create cert manager with temp dir for certs, generating them without
+	// mkcert so HTTPS tunnels work anywhere
 	certManager := cert.New(tmpDir)
+	certManager.SetRunner(fakeMkcert(t))
 
 	// Create tunnel manager with temp file for hosts backup
-	manager := tunnel.NewManager(certManager)
+	manager := tunnel.NewManager(certManager, nil)
 	manager.SetHostsBackupDir(filepath.Join(tmpDir, "hosts.bak"))
 
 	return manager, func() {
@@ -84,6 +90,27 @@ func setupTunnelManagerWithCleanup(t *testing.T) (*tunnel.Manager, func()) {
 	}
 }
 
+// fakeMkcert returns a cert.Runner that stands in for mkcert, writing a
+// self-signed certificate for the domain to the files it's given
+func fakeMkcert(t *testing.T) cert.Runner {
+	selfSigned := cert.NewSelfSignedProvider()
+	return func(name string, arg ...string) ([]byte, error) {
+		require.Equal(t, "mkcert", name)
+		require.Len(t, arg, 5)
+		certFile, keyFile, domain := arg[1], arg[3], arg[4]
+
+		c, err := selfSigned.EnsureCert(domain)
+		require.NoError(t, err)
+		key, err := x509.MarshalPKCS8PrivateKey(c.PrivateKey)
+		require.NoError(t, err)
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Certificate[0]})
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+		require.NoError(t, os.WriteFile(certFile, certPEM, 0644))
+		require.NoError(t, os.WriteFile(keyFile, keyPEM, 0600))
+		return nil, nil
+	}
+}
+
 func TestTunnelCreation(t *testing.T) {
 	// Remove the privilege check
 	// if os.Getuid() != 0 {
@@ -116,13 +143,6 @@ func TestTunnelCreation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Skip HTTPS tests if mkcert is not available
-			if tt.https {
-				if _, err := exec.LookPath("mkcert"); err != nil {
-					t.Skip("Skipping HTTPS test - mkcert not available")
-				}
-			}
-
 			// Create test server for this test case (this is our target)
 			srv, targetPort := setupTestServer(t)
 			defer func() {
@@ -229,7 +249,7 @@ func TestTunnelManagement(t *testing.T) {
 	certManager := cert.New(tempDir)
 
 	// Create tunnel manager with temp file for hosts backup
-	manager := tunnel.NewManager(certManager)
+	manager := tunnel.NewManager(certManager, nil)
 	manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.bak"))
 
 	// Test tunnel management operations
@@ -300,7 +320,7 @@ func TestErrorHandling(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	certManager := cert.New(tempDir)
-	manager := tunnel.NewManager(certManager)
+	manager := tunnel.NewManager(certManager, nil)
 	manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.bak"))
 
 	tests := []struct {
@@ -347,3 +367,67 @@ func TestErrorHandling(t *testing.T) {
 		})
 	}
 }
+
+func TestParseKeyValues(t *testing.T) {
+	values, err := parseKeyValues([]string{"Authorization=Bearer abc", " x-team = web "})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer abc", "x-team": "web"}, values)
+
+	_, err = parseKeyValues([]string{"missing-separator"})
+	assert.Error(t, err)
+
+	_, err = parseKeyValues([]string{"=value"})
+	assert.Error(t, err)
+}
+
+func TestLogLevel(t *testing.T) {
+	level, err := logLevel(false, false, false)
+	require.NoError(t, err)
+	assert.Equal(t, logging.LevelInfo, level)
+
+	level, err = logLevel(true, false, false)
+	require.NoError(t, err)
+	assert.Equal(t, logging.LevelError, level)
+
+	level, err = logLevel(false, true, false)
+	require.NoError(t, err)
+	assert.Equal(t, logging.LevelDebug, level)
+
+	level, err = logLevel(false, false, true)
+	require.NoError(t, err)
+	assert.Equal(t, logging.LevelDebug, level)
+
+	_, err = logLevel(true, true, false)
+	assert.ErrorIs(t, err, tunnel.ErrInvalidOptions)
+}
+
+func TestCORSFlagsNeedOrigin(t *testing.T) {
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	originalManager, originalProvider := manager, obsProvider
+	defer func() { manager, obsProvider = originalManager, originalProvider }()
+	provider, err := observability.NewProvider(observability.DefaultConfig())
+	require.NoError(t, err)
+	manager, obsProvider = m, provider
+
+	app := &cli.App{
+		Commands: []*cli.Command{{
+			Name: "start",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "domain"},
+				&cli.IntFlag{Name: "port"},
+				&cli.StringSliceFlag{Name: "cors-origin"},
+				&cli.StringSliceFlag{Name: "cors-method"},
+				&cli.StringSliceFlag{Name: "cors-header"},
+				&cli.BoolFlag{Name: "cors-allow-credentials"},
+			},
+			Action: StartTunnel,
+		}},
+	}
+	for _, flag := range [][]string{{"--cors-method", "PUT"}, {"--cors-header", "X-Token"}, {"--cors-allow-credentials"}} {
+		args := append([]string{"gotunnel", "start", "--domain", "cors-flags", "--port", "8080"}, flag...)
+		err := app.Run(args)
+		assert.ErrorIs(t, err, tunnel.ErrInvalidOptions, flag[0])
+	}
+	assert.Zero(t, m.Count())
+}
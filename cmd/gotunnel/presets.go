@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/urfave/cli/v2"
+)
+
+// networkPreset is a consistent set of the lower-level network flags,
+// picked with --local-only or --allow-lan
+type networkPreset struct {
+	name       string // The flag that picked it
+	listenAddr string // Where tunnels and the built-in proxy listen
+	useMDNS    bool
+	useHosts   bool
+}
+
+var (
+	// localOnlyPreset keeps tunnels on this machine: loopback only,
+	// resolved through the hosts file
+	localOnlyPreset = networkPreset{name: "local-only", listenAddr: "127.0.0.1", useMDNS: false, useHosts: true}
+
+	// allowLANPreset serves other devices on the network: every interface,
+	// advertised over mDNS with the detected (or --advertise-ip) LAN address
+	allowLANPreset = networkPreset{name: "allow-lan", listenAddr: "0.0.0.0", useMDNS: true, useHosts: true}
+)
+
+// presetConflicts lists, for each preset, the flags it sets itself and so
+// can't be combined with
+var presetConflicts = map[string][]string{
+	"local-only": {"listen-addr", "proxy-bind-addr", "no-mdns", "no-hosts", "advertise-ip"},
+	"allow-lan":  {"listen-addr", "proxy-bind-addr", "no-mdns"},
+}
+
+// selectPreset returns the preset picked on the command line, or nil if
+// none was. isSet reports whether a flag was given explicitly.
+func selectPreset(localOnly, allowLAN bool, isSet func(name string) bool) (*networkPreset, error) {
+	var preset networkPreset
+	switch {
+	case localOnly && allowLAN:
+		return nil, fmt.Errorf("%w: --local-only and --allow-lan can't be used together", tunnel.ErrInvalidOptions)
+	case localOnly:
+		preset = localOnlyPreset
+	case allowLAN:
+		preset = allowLANPreset
+	default:
+		return nil, nil
+	}
+	for _, name := range presetConflicts[preset.name] {
+		if isSet(name) {
+			return nil, fmt.Errorf("%w: --%s can't be combined with --%s", tunnel.ErrInvalidOptions, preset.name, name)
+		}
+	}
+	return &preset, nil
+}
+
+// presetFromFlags is selectPreset for the global flags of c
+func presetFromFlags(c *cli.Context) (*networkPreset, error) {
+	return selectPreset(c.Bool("local-only"), c.Bool("allow-lan"), c.IsSet)
+}
+
+// applyManager sets the name resolution the preset calls for
+func (p *networkPreset) applyManager(opts *tunnel.ManagerOptions) {
+	if p == nil {
+		return
+	}
+	opts.UseMDNS = p.useMDNS
+	opts.UseHosts = p.useHosts
+}
+
+// applyTunnel sets the address a tunnel listens on, unless it has one
+func (p *networkPreset) applyTunnel(opts *tunnel.Options) {
+	if p == nil || opts.ListenAddr != "" {
+		return
+	}
+	opts.ListenAddr = p.listenAddr
+}
+
+// proxyBindAddr is the address the built-in proxy listens on under the
+// preset, or fallback without one
+func (p *networkPreset) proxyBindAddr(fallback string) string {
+	if p == nil {
+		return fallback
+	}
+	return p.listenAddr
+}
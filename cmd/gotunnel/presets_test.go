@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/johncferguson/gotunnel/internal/observability"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestPresets(t *testing.T) {
+	tests := []struct {
+		name       string
+		localOnly  bool
+		allowLAN   bool
+		listenAddr string
+		proxyAddr  string
+		useMDNS    bool
+		useHosts   bool
+	}{
+		{name: "local-only", localOnly: true, listenAddr: "127.0.0.1", proxyAddr: "127.0.0.1", useMDNS: false, useHosts: true},
+		{name: "allow-lan", allowLAN: true, listenAddr: "0.0.0.0", proxyAddr: "0.0.0.0", useMDNS: true, useHosts: true},
+		// Without a preset the lower-level flags apply unchanged
+		{name: "none", listenAddr: "", proxyAddr: "10.0.0.2", useMDNS: false, useHosts: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preset, err := selectPreset(tt.localOnly, tt.allowLAN, func(string) bool { return false })
+			require.NoError(t, err)
+
+			var opts tunnel.Options
+			preset.applyTunnel(&opts)
+			assert.Equal(t, tt.listenAddr, opts.ListenAddr)
+			assert.Equal(t, tt.proxyAddr, preset.proxyBindAddr("10.0.0.2"))
+
+			var managerOpts tunnel.ManagerOptions
+			preset.applyManager(&managerOpts)
+			assert.Equal(t, tt.useMDNS, managerOpts.UseMDNS)
+			assert.Equal(t, tt.useHosts, managerOpts.UseHosts)
+		})
+	}
+}
+
+func TestPresetKeepsTunnelListenAddr(t *testing.T) {
+	opts := tunnel.Options{ListenAddr: "192.168.1.10"}
+	allowLANPreset.applyTunnel(&opts)
+	assert.Equal(t, "192.168.1.10", opts.ListenAddr)
+}
+
+func TestUpAppliesPreset(t *testing.T) {
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	originalManager, originalPreset, originalProvider := manager, netPreset, obsProvider
+	defer func() { manager, netPreset, obsProvider = originalManager, originalPreset, originalProvider }()
+	provider, err := observability.NewProvider(observability.DefaultConfig())
+	require.NoError(t, err)
+	manager, netPreset, obsProvider = m, &localOnlyPreset, provider
+
+	_, backendPort, stopServer := setupTestServerWithCleanup(t)
+	defer stopServer()
+	defer m.Stop(context.Background())
+
+	file := filepath.Join(t.TempDir(), "tunnels.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(fmt.Sprintf(
+		"tunnels:\n  - domain: up-local\n    port: %d\n    http_port: 8293\n", backendPort)), 0644))
+
+	// --dry-run on a real manager starts the tunnels without waiting for a signal
+	app := &cli.App{
+		Flags: []cli.Flag{&cli.BoolFlag{Name: "dry-run"}},
+		Commands: []*cli.Command{{
+			Name:   "up",
+			Flags:  []cli.Flag{&cli.StringFlag{Name: "file"}},
+			Action: UpTunnels,
+		}},
+	}
+	require.NoError(t, app.Run([]string{"gotunnel", "--dry-run", "up", "--file", file}))
+
+	cfg := m.Export()
+	require.Len(t, cfg.Tunnels, 1)
+	assert.Equal(t, "127.0.0.1", cfg.Tunnels[0].ListenAddr)
+}
+
+func TestPresetConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantError bool
+	}{
+		{name: "both presets", args: []string{"--local-only", "--allow-lan"}, wantError: true},
+		{name: "local-only with no-hosts", args: []string{"--local-only", "--no-hosts"}, wantError: true},
+		{name: "local-only with advertise-ip", args: []string{"--local-only", "--advertise-ip", "10.0.0.2"}, wantError: true},
+		{name: "allow-lan with no-mdns", args: []string{"--allow-lan", "--no-mdns"}, wantError: true},
+		{name: "allow-lan with proxy-bind-addr", args: []string{"--allow-lan", "--proxy-bind-addr", "127.0.0.1"}, wantError: true},
+		{name: "allow-lan with advertise-ip", args: []string{"--allow-lan", "--advertise-ip", "10.0.0.2"}},
+		{name: "local-only", args: []string{"--local-only"}},
+		{name: "no preset", args: []string{"--no-mdns"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var presetErr error
+			app := &cli.App{
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "local-only"},
+					&cli.BoolFlag{Name: "allow-lan"},
+					&cli.BoolFlag{Name: "no-mdns"},
+					&cli.BoolFlag{Name: "no-hosts"},
+					&cli.StringFlag{Name: "advertise-ip"},
+					&cli.StringFlag{Name: "proxy-bind-addr"},
+				},
+				Commands: []*cli.Command{{
+					Name:  "start",
+					Flags: []cli.Flag{&cli.StringFlag{Name: "listen-addr"}},
+					Action: func(c *cli.Context) error {
+						_, presetErr = presetFromFlags(c)
+						return nil
+					},
+				}},
+			}
+			require.NoError(t, app.Run(append(append([]string{"gotunnel"}, tt.args...), "start")))
+			if tt.wantError {
+				assert.ErrorIs(t, presetErr, tunnel.ErrInvalidOptions)
+			} else {
+				assert.NoError(t, presetErr)
+			}
+		})
+	}
+}
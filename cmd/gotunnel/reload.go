@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/johncferguson/gotunnel/internal/state"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+)
+
+// reloadOnSignal re-applies the state file each time a signal arrives on
+// sigCh, until ctx is done. Tunnels in keep (e.g. the one started from the
+// command line) stay up whatever the file says.
+func reloadOnSignal(ctx context.Context, sigCh <-chan os.Signal, keep []tunnel.Options) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+			reloadTunnels(ctx, keep)
+		}
+	}
+}
+
+// reloadTunnels converges the running tunnels on the state file plus keep
+func reloadTunnels(ctx context.Context, keep []tunnel.Options) tunnel.ReloadResult {
+	saved, err := loadState()
+	if err != nil {
+		logAttrs(ctx, slog.LevelError, "Failed to read tunnel state, keeping current tunnels", slog.Any("error", err))
+		return tunnel.ReloadResult{}
+	}
+
+	desired := append([]tunnel.Options(nil), keep...)
+	for _, ts := range saved {
+		desired = append(desired, tunnel.OptionsFromState(ts))
+	}
+	// Restored tunnels stay on the network the preset picked, like new ones
+	for i := range desired {
+		netPreset.applyTunnel(&desired[i])
+	}
+
+	result := manager.Reload(ctx, desired)
+	logAttrs(ctx, slog.LevelInfo, "Reloaded tunnels",
+		slog.String("added", strings.Join(result.Added, ",")),
+		slog.String("removed", strings.Join(result.Removed, ",")),
+		slog.String("updated", strings.Join(result.Updated, ",")),
+		slog.String("unchanged", strings.Join(result.Unchanged, ",")),
+	)
+	for domain, err := range result.Errors {
+		logAttrs(ctx, slog.LevelWarn, "Failed to reload tunnel",
+			slog.String("domain", domain),
+			slog.Any("error", err),
+		)
+	}
+	return result
+}
+
+// loadState reads the --state-file, or the default state file without one
+func loadState() ([]state.TunnelState, error) {
+	if stateFile != "" {
+		return state.LoadTunnelsFrom(stateFile)
+	}
+	return state.LoadTunnels()
+}
+
+// logAttrs logs through the observability logger, or the standard logger
+// before it's set up
+func logAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if obsProvider != nil {
+		obsProvider.Logger().LogAttrs(ctx, level, msg, attrs...)
+		return
+	}
+	parts := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		parts = append(parts, fmt.Sprintf("%s=%s", attr.Key, attr.Value))
+	}
+	log.Printf("%s %s", msg, strings.Join(parts, " "))
+}
@@ -0,0 +1,107 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/state"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	// LoadTunnels reads ~/.gotunnel/tunnels.yaml
+	t.Setenv("HOME", t.TempDir())
+
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	originalManager := manager
+	manager = m
+	defer func() { manager = originalManager }()
+
+	_, backendPort, stopServer := setupTestServerWithCleanup(t)
+	defer stopServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer m.Stop(context.Background())
+
+	// The tunnel started from the command line
+	keep := tunnel.Options{BackendPort: backendPort, Domain: "hup-keep", HTTPPort: 8301, HTTPSPort: 8601}
+	require.NoError(t, m.StartTunnelWithOptions(ctx, keep))
+
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+	go reloadOnSignal(ctx, hupCh, []tunnel.Options{keep})
+
+	domains := func() []string {
+		var names []string
+		for _, info := range m.ListTunnels() {
+			names = append(names, info["domain"].(string))
+		}
+		sort.Strings(names)
+		return names
+	}
+	sendHUP := func() {
+		p, err := os.FindProcess(os.Getpid())
+		require.NoError(t, err)
+		require.NoError(t, p.Signal(syscall.SIGHUP))
+	}
+
+	// Add two tunnels, one of them invalid
+	require.NoError(t, state.SaveTunnels([]state.TunnelState{
+		{Port: backendPort, Domain: "hup-added.local", HTTPPort: 8302, HTTPSPort: 8602},
+		{Port: 0, Domain: "hup-broken.local", HTTPPort: 8303, HTTPSPort: 8603},
+	}))
+	sendHUP()
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"hup-added.local", "hup-keep.local"}, domains())
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Emptying the file removes the added tunnel but keeps the pinned one
+	require.NoError(t, state.SaveTunnels(nil))
+	sendHUP()
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"hup-keep.local"}, domains())
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestReloadReadsStateFileFlag(t *testing.T) {
+	// The default file isn't the one read
+	t.Setenv("HOME", t.TempDir())
+
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	originalManager, originalStateFile := manager, stateFile
+	defer func() { manager, stateFile = originalManager, originalStateFile }()
+	manager = m
+	defer m.Stop(context.Background())
+
+	_, backendPort, stopServer := setupTestServerWithCleanup(t)
+	defer stopServer()
+
+	// As --state-file tunnels.json sets it
+	path := filepath.Join(t.TempDir(), "tunnels.json")
+	stateFile = path
+	require.NoError(t, state.SaveTunnelsTo(path, []state.TunnelState{
+		{Port: backendPort, Domain: "json-state.local", HTTPPort: 8314, HTTPSPort: 8614},
+	}))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.True(t, json.Valid(data))
+
+	result := reloadTunnels(context.Background(), nil)
+	assert.Equal(t, []string{"json-state.local"}, result.Added)
+	assert.Empty(t, result.Errors)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/johncferguson/gotunnel/internal/proxy"
+	"github.com/urfave/cli/v2"
+)
+
+// ListRoutes prints the running gotunnel's proxy routes, as JSON with --json
+func ListRoutes(c *cli.Context) error {
+	snapshot, err := loadRunning(getRunningFileFunc())
+	if err != nil {
+		return err
+	}
+	if snapshot.Config.Proxy == nil {
+		if c.Bool("json") {
+			return writeRoutes(c.App.Writer, nil, true)
+		}
+		_, err := fmt.Fprintln(c.App.Writer, "Proxy mode is off; tunnels are reached directly")
+		return err
+	}
+	return writeRoutes(c.App.Writer, snapshot.Routes, c.Bool("json"))
+}
+
+// proxyRoutes returns m's routes once each, sorted by domain, with the
+// default route last
+func proxyRoutes(m *proxy.Manager) []*proxy.Route {
+	routes := m.Routes()
+	if fallback := m.DefaultRoute(); fallback != nil {
+		routes = append(routes, fallback)
+	}
+	return routes
+}
+
+// writeRoutes prints routes as a table of domain -> target, or as JSON
+func writeRoutes(w io.Writer, routes []*proxy.Route, asJSON bool) error {
+	if asJSON {
+		if routes == nil {
+			routes = []*proxy.Route{}
+		}
+		return json.NewEncoder(w).Encode(routes)
+	}
+	if len(routes) == 0 {
+		_, err := fmt.Fprintln(w, "No proxy routes")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOMAIN\tTARGET\tHTTPS")
+	for _, route := range routes {
+		target := net.JoinHostPort(route.TargetHost, strconv.Itoa(route.TargetPort))
+		fmt.Fprintf(tw, "%s\t%s\t%v\n", route.Domain, target, route.HTTPS)
+	}
+	return tw.Flush()
+}
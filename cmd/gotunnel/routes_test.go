@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/cert"
+	"github.com/johncferguson/gotunnel/internal/proxy"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestWriteRoutes(t *testing.T) {
+	m := proxy.NewManager(proxy.ProxyConfig{Mode: proxy.BuiltInProxy})
+	require.NoError(t, m.AddRoute(&proxy.Route{Domain: "web.local", TargetHost: "127.0.0.1", TargetPort: 9001}))
+	require.NoError(t, m.AddRoute(&proxy.Route{Domain: "api.local", TargetHost: "127.0.0.1", TargetPort: 9002, HTTPS: true}))
+	require.NoError(t, m.AddRoute(&proxy.Route{Domain: proxy.DefaultRouteDomain, TargetHost: "127.0.0.1", TargetPort: 9003}))
+
+	var buf bytes.Buffer
+	require.NoError(t, writeRoutes(&buf, proxyRoutes(m), false))
+	assert.Equal(t, ""+
+		"DOMAIN     TARGET          HTTPS\n"+
+		"api.local  127.0.0.1:9002  true\n"+
+		"web.local  127.0.0.1:9001  false\n"+
+		"*          127.0.0.1:9003  false\n", buf.String())
+	// Routes are keyed with and without the TLD but listed once
+	assert.Equal(t, 1, strings.Count(buf.String(), "web.local"))
+
+	buf.Reset()
+	require.NoError(t, writeRoutes(&buf, proxyRoutes(m), true))
+	var routes []proxy.Route
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &routes))
+	require.Len(t, routes, 3)
+	assert.Equal(t, "api.local", routes[0].Domain)
+	assert.Equal(t, 9002, routes[0].TargetPort)
+	assert.True(t, routes[0].HTTPS)
+
+	buf.Reset()
+	require.NoError(t, writeRoutes(&buf, nil, true))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestListRoutesReadsRunningInstance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "running.json")
+	originalFile := getRunningFileFunc
+	getRunningFileFunc = func() string { return path }
+	defer func() { getRunningFileFunc = originalFile }()
+
+	var out bytes.Buffer
+	app := &cli.App{
+		Writer: &out,
+		Commands: []*cli.Command{{
+			Name:   "routes",
+			Flags:  []cli.Flag{&cli.BoolFlag{Name: "json"}},
+			Action: ListRoutes,
+		}},
+	}
+	assert.ErrorIs(t, app.Run([]string{"gotunnel", "routes"}), errNotRunning)
+
+	pm := proxy.NewManager(proxy.ProxyConfig{Mode: proxy.BuiltInProxy, HTTPPort: proxy.AnyPort})
+	require.NoError(t, pm.Start())
+	defer pm.Stop(context.Background())
+	m, err := tunnel.NewManagerWithOptions(cert.New(t.TempDir()), nil, tunnel.ManagerOptions{
+		ProxyManager: pm,
+		UseProxy:     true,
+		UseMDNS:      true,
+	})
+	require.NoError(t, err)
+	defer m.Stop(context.Background())
+	originalManager, originalProxy := manager, proxyManager
+	manager, proxyManager = m, pm
+	defer func() { manager, proxyManager = originalManager, originalProxy }()
+
+	_, backendPort, stopServer := setupTestServerWithCleanup(t)
+	defer stopServer()
+	require.NoError(t, m.StartTunnelWithOptions(context.Background(), tunnel.Options{BackendPort: backendPort, Domain: "routed"}))
+
+	p := publishRunning(path)
+	defer p.close()
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// As if from another shell: the running gotunnel's route, listed once
+	require.NoError(t, app.Run([]string{"gotunnel", "routes", "--json"}))
+	var routes []proxy.Route
+	require.NoError(t, json.Unmarshal(out.Bytes(), &routes))
+	require.Len(t, routes, 1)
+	assert.Equal(t, "routed.local", routes[0].Domain)
+	assert.Equal(t, "127.0.0.1", routes[0].TargetHost)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/johncferguson/gotunnel/internal/process"
+	"github.com/johncferguson/gotunnel/internal/proxy"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+)
+
+// errNotRunning means no gotunnel is running to report on
+var errNotRunning = errors.New("no gotunnel is running")
+
+// runningSnapshot is what the running gotunnel publishes about itself, so
+// commands run from another shell, which have no tunnels of their own, can
+// report on it
+type runningSnapshot struct {
+	PID    int            `json:"pid"`
+	Config tunnel.Config  `json:"config"` // The tunnels, as `gotunnel export` writes them
+	Routes []*proxy.Route `json:"routes"` // The proxy's routes, if Config.Proxy is set
+}
+
+// For testing purposes
+var getRunningFileFunc = getRunningFile
+
+func getRunningFile() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".gotunnel", "running.json")
+}
+
+// runningPublisher rewrites the snapshot file whenever the tunnels change,
+// from its own goroutine since manager events arrive with the manager locked
+type runningPublisher struct {
+	path    string
+	changed chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// publishRunning writes the snapshot now and then after every notify, until
+// close removes it
+func publishRunning(path string) *runningPublisher {
+	p := &runningPublisher{
+		path:    path,
+		changed: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	p.notify()
+	go p.run()
+	return p
+}
+
+// notify marks the snapshot out of date; it never blocks
+func (p *runningPublisher) notify() {
+	select {
+	case p.changed <- struct{}{}:
+	default: // A rewrite is already pending
+	}
+}
+
+func (p *runningPublisher) run() {
+	defer close(p.done)
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-p.changed:
+			if err := p.write(); err != nil {
+				log.Printf("Failed to record the running tunnels: %v", err)
+			}
+		}
+	}
+}
+
+// write replaces the snapshot file in one rename, so readers never see it
+// half written
+func (p *runningPublisher) write() error {
+	snapshot := runningSnapshot{PID: os.Getpid(), Config: manager.Export()}
+	if snapshot.Config.Proxy != nil && proxyManager != nil {
+		snapshot.Routes = proxyRoutes(proxyManager)
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// close stops publishing and removes the snapshot, as nothing is running
+// any more
+func (p *runningPublisher) close() {
+	close(p.stop)
+	<-p.done
+	if err := os.Remove(p.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Error removing %s: %v", p.path, err)
+	}
+}
+
+// loadRunning reads the snapshot the running gotunnel published. A missing
+// file, or one left by a gotunnel that crashed, fails with errNotRunning.
+func loadRunning(path string) (*runningSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNotRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshot runningSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if !process.Alive(snapshot.PID) {
+		return nil, errNotRunning
+	}
+	return &snapshot, nil
+}
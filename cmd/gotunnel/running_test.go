@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/cert"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// exportApp runs export the way the CLI does, writing to a buffer
+func exportApp(out *bytes.Buffer) *cli.App {
+	return &cli.App{
+		Writer: out,
+		Commands: []*cli.Command{{
+			Name:   "export",
+			Flags:  []cli.Flag{&cli.StringFlag{Name: "output", Aliases: []string{"o"}}},
+			Action: ExportTunnels,
+		}},
+	}
+}
+
+func TestExportReadsRunningInstance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "running.json")
+	originalFile := getRunningFileFunc
+	getRunningFileFunc = func() string { return path }
+	defer func() { getRunningFileFunc = originalFile }()
+
+	// Nothing has published its tunnels yet
+	var out bytes.Buffer
+	assert.ErrorIs(t, exportApp(&out).Run([]string{"gotunnel", "export"}), errNotRunning)
+
+	m, err := tunnel.NewManagerWithOptions(cert.New(t.TempDir()), nil, tunnel.ManagerOptions{UseMDNS: true})
+	require.NoError(t, err)
+	originalManager := manager
+	manager = m
+	defer func() { manager = originalManager }()
+	defer m.Stop(context.Background())
+
+	_, backendPort, stopServer := setupTestServerWithCleanup(t)
+	defer stopServer()
+	require.NoError(t, m.StartTunnelWithOptions(context.Background(), tunnel.Options{BackendPort: backendPort, Domain: "exported", HTTPPort: 8313}))
+
+	// The running gotunnel publishes its tunnels; export, as if from
+	// another shell, writes them out
+	p := publishRunning(path)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	file := filepath.Join(t.TempDir(), "tunnels.yaml")
+	require.NoError(t, exportApp(&out).Run([]string{"gotunnel", "export", "-o", file}))
+	cfg, err := tunnel.LoadConfig(file)
+	require.NoError(t, err)
+	require.Len(t, cfg.Tunnels, 1)
+	assert.Equal(t, "exported.local", cfg.Tunnels[0].Domain)
+	assert.Equal(t, backendPort, cfg.Tunnels[0].Port)
+	assert.Equal(t, 8313, cfg.Tunnels[0].HTTPPort)
+
+	// Once it stops, there's nothing to export
+	p.close()
+	assert.NoFileExists(t, path)
+	assert.ErrorIs(t, exportApp(&out).Run([]string{"gotunnel", "export"}), errNotRunning)
+}
+
+func TestLoadRunningIgnoresCrashedInstance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "running.json")
+	data, err := json.Marshal(runningSnapshot{PID: 999999999})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	_, err = loadRunning(path)
+	assert.ErrorIs(t, err, errNotRunning)
+}
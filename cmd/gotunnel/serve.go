@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/johncferguson/gotunnel/internal/httpserver"
+	"github.com/johncferguson/gotunnel/internal/static"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/urfave/cli/v2"
+)
+
+// ServeDirectory tunnels to a file server for the directory argument,
+// keeping both up until interrupted
+func ServeDirectory(c *cli.Context) error {
+	ctx := context.Background()
+	ctx, span := obsProvider.StartSpan(ctx, "tunnel.serve")
+	defer span.End()
+
+	// urfave/cli stops parsing flags at the directory, so they go first
+	dir := c.Args().First()
+	if dir == "" || c.NArg() > 1 {
+		return fmt.Errorf("%w: usage: gotunnel serve --domain <name> [flags] <dir>", tunnel.ErrInvalidOptions)
+	}
+	domain := c.String("domain")
+	if domain == "" {
+		return fmt.Errorf("%w: domain is required", tunnel.ErrInvalidDomain)
+	}
+	if suffix := "." + manager.TLD(); !strings.HasSuffix(domain, suffix) {
+		domain += suffix
+	}
+
+	opts := tunnel.Options{
+		Domain:     domain,
+		HTTPS:      c.Bool("https"),
+		HTTPPort:   80,
+		HTTPSPort:  c.Int("https-port"),
+		ListenAddr: c.String("listen-addr"),
+	}
+	// The global flags were checked before serve's own flags were parsed
+	if _, err := presetFromFlags(c); err != nil {
+		return err
+	}
+	netPreset.applyTunnel(&opts)
+	if opts.HTTPS {
+		if err := checkRootCA(ctx, c.Bool("install-ca") && !c.Bool("dry-run")); err != nil {
+			obsProvider.RecordError(ctx, span, err, "root CA installation failed")
+			return fmt.Errorf("%w: %w", tunnel.ErrCertUnavailable, err)
+		}
+	}
+
+	files, err := startStaticTunnel(ctx, dir, opts, static.Options{
+		Listing:       c.Bool("listing"),
+		IndexFallback: c.Bool("index-fallback"),
+		Dotfiles:      c.Bool("dotfiles"),
+	})
+	if err != nil {
+		obsProvider.RecordError(ctx, span, err, "static tunnel start failed")
+		return err
+	}
+	// Runs after the shutdown below has stopped the tunnel in front of it
+	defer files.Shutdown(context.Background())
+	if c.Bool("dry-run") {
+		fmt.Println("\nDry run: nothing was changed")
+		return nil
+	}
+
+	scheme, host := "http", domain
+	if opts.HTTPS {
+		scheme = "https"
+	}
+	if proxyManager != nil {
+		publicPort := proxyManager.ActualPort()
+		if opts.HTTPS {
+			publicPort = proxyManager.TLSPort()
+		}
+		if publicPort != 0 && publicPort != 80 && publicPort != 443 {
+			host = net.JoinHostPort(domain, strconv.Itoa(publicPort))
+		}
+	}
+	fmt.Printf("\nServing %s at %s://%s\n", dir, scheme, host)
+
+	// The tunnel comes down through the same shutdown a signal triggers
+	sigCh := claimSignals()
+	defer shutdown()
+	<-sigCh
+	obsProvider.Logger().InfoContext(ctx, "Received shutdown signal, stopping tunnel",
+		slog.String("domain", domain),
+	)
+	return nil
+}
+
+// startStaticTunnel serves dir on a loopback port and starts a tunnel
+// described by opts in front of it. The caller shuts down the returned file
+// server once the tunnel has stopped.
+func startStaticTunnel(ctx context.Context, dir string, opts tunnel.Options, staticOpts static.Options) (*httpserver.Server, error) {
+	files, err := static.Serve(dir, staticOpts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", tunnel.ErrInvalidOptions, err)
+	}
+	opts.BackendPort = files.Port()
+	if err := manager.StartTunnelWithOptions(ctx, opts); err != nil {
+		files.Close()
+		return nil, fmt.Errorf("failed to start tunnel: %w", err)
+	}
+	return files, nil
+}
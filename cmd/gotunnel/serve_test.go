@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/johncferguson/gotunnel/internal/observability"
+	"github.com/johncferguson/gotunnel/internal/static"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestServeDirectory(t *testing.T) {
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	originalManager := manager
+	manager = m
+	defer func() { manager = originalManager }()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello from a folder"), 0644))
+
+	ctx := context.Background()
+	defer m.Stop(ctx)
+	files, err := startStaticTunnel(ctx, dir, tunnel.Options{Domain: "files.local", HTTPPort: 8311}, static.Options{})
+	require.NoError(t, err)
+
+	resp, err := http.Get("http://127.0.0.1:8311/hello.txt")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello from a folder", string(body))
+
+	// Stopping tears down the tunnel, then the file server behind it
+	require.NoError(t, m.StopTunnel(ctx, "files.local"))
+	require.NoError(t, files.Shutdown(ctx))
+	_, err = http.Get("http://" + files.Addr().String() + "/hello.txt")
+	assert.Error(t, err)
+}
+
+func TestServeDirectoryMissing(t *testing.T) {
+	_, err := startStaticTunnel(context.Background(), filepath.Join(t.TempDir(), "missing"), tunnel.Options{Domain: "files.local", HTTPPort: 8312}, static.Options{})
+	assert.ErrorIs(t, err, tunnel.ErrInvalidOptions)
+}
+
+func TestServeDirectoryUsage(t *testing.T) {
+	app := &cli.App{
+		Commands: []*cli.Command{{
+			Name:   "serve",
+			Flags:  []cli.Flag{&cli.StringFlag{Name: "domain"}},
+			Action: ServeDirectory,
+		}},
+	}
+	originalProvider := obsProvider
+	defer func() { obsProvider = originalProvider }()
+	provider, err := observability.NewProvider(observability.DefaultConfig())
+	require.NoError(t, err)
+	obsProvider = provider
+
+	// Flags after the directory aren't parsed, so they're refused
+	err = app.Run([]string{"gotunnel", "serve", "./dist", "--domain", "files"})
+	assert.ErrorIs(t, err, tunnel.ErrInvalidOptions)
+	err = app.Run([]string{"gotunnel", "serve", "--domain", "files"})
+	assert.ErrorIs(t, err, tunnel.ErrInvalidOptions)
+}
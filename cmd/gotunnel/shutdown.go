@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/dnsserver"
+)
+
+var (
+	// shutdownQuiet and shutdownTimeout configure the shutdown sequence;
+	// set by setupCleanup
+	shutdownQuiet   bool
+	shutdownTimeout time.Duration
+	shutdownOnce    sync.Once
+
+	// signalsClaimed, while set, receives SIGINT and SIGTERM in place of
+	// the shutdown that would otherwise run straight away
+	signalsMu      sync.Mutex
+	signalsClaimed chan os.Signal
+)
+
+// setupCleanup subscribes to SIGINT and SIGTERM; nothing else does. A
+// signal goes to the foreground command that claimed it (see claimSignals),
+// or else shuts gotunnel down and exits.
+func setupCleanup(quiet bool, timeout time.Duration) {
+	shutdownQuiet, shutdownTimeout = quiet, timeout
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go handleSignals(c, func() { os.Exit(0) })
+}
+
+// handleSignals hands each signal from c to the claiming command, or runs
+// the shutdown and then exit if none has claimed it
+func handleSignals(c <-chan os.Signal, exit func()) {
+	for sig := range c {
+		signalsMu.Lock()
+		claimed := signalsClaimed
+		signalsMu.Unlock()
+		if claimed != nil {
+			select {
+			case claimed <- sig:
+			default: // Already asked to stop
+			}
+			continue
+		}
+		shutdown()
+		exit()
+		return
+	}
+}
+
+// claimSignals sends SIGINT and SIGTERM to the returned channel instead of
+// shutting down straight away, so a foreground command can wind up its own
+// work first. Commands that keep tunnels running then call shutdown.
+func claimSignals() <-chan os.Signal {
+	signalsMu.Lock()
+	defer signalsMu.Unlock()
+	if signalsClaimed == nil {
+		signalsClaimed = make(chan os.Signal, 1)
+	}
+	return signalsClaimed
+}
+
+// shutdown stops the backend command, the proxy, the tunnel manager and the
+// mDNS responders, prints the session summary, releases the lock file and
+// flushes observability. Whether a signal or a returning command triggers
+// it, it runs once.
+func shutdown() {
+	shutdownOnce.Do(runShutdown)
+}
+
+func runShutdown() {
+	// Tally the tunnels before they're stopped
+	var summary *sessionSummary
+	if !shutdownQuiet && manager != nil {
+		s := collectSummary(manager, time.Since(sessionStart), 0)
+		summary = &s
+	}
+
+	ctx := context.Background()
+	if obsProvider != nil {
+		ctx, span := obsProvider.StartSpan(ctx, "application.shutdown")
+		defer span.End()
+
+		obsProvider.Logger().InfoContext(ctx, "Shutting down application...")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+
+	// Nothing will be running once the tunnels are down
+	if running != nil {
+		running.close()
+	}
+
+	// Stop the backend command if gotunnel launched one
+	if backendProcess != nil {
+		if err := backendProcess.Stop(shutdownCtx); err != nil {
+			if obsProvider != nil {
+				obsProvider.Logger().ErrorContext(shutdownCtx, "Error stopping backend command", slog.Any("error", err))
+			} else {
+				log.Printf("Error stopping backend command: %v", err)
+			}
+		}
+	}
+
+	// Stop proxy manager first
+	if proxyManager != nil {
+		if err := proxyManager.Stop(shutdownCtx); err != nil {
+			if obsProvider != nil {
+				obsProvider.Logger().ErrorContext(shutdownCtx, "Error stopping proxy manager", slog.Any("error", err))
+				metrics.RecordError(shutdownCtx, "proxy_manager", "shutdown", err)
+			} else {
+				log.Printf("Error during proxy manager shutdown: %v", err)
+			}
+		}
+	}
+
+	// Stop tunnel manager
+	if manager != nil {
+		if err := manager.Stop(shutdownCtx); err != nil {
+			if obsProvider != nil {
+				obsProvider.Logger().ErrorContext(shutdownCtx, "Error stopping tunnel manager", slog.Any("error", err))
+				metrics.RecordError(shutdownCtx, "tunnel_manager", "shutdown", err)
+			} else {
+				log.Printf("Error during tunnel manager shutdown: %v", err)
+			}
+		}
+	}
+
+	// Release the mDNS responders of any tunnels left registered
+	if err := dnsserver.Shutdown(); err != nil {
+		log.Printf("Error shutting down DNS server: %v", err)
+	}
+
+	releaseInstanceLock()
+
+	if summary != nil {
+		if metrics != nil {
+			summary.Errors = metrics.ErrorsRecorded() // Includes shutdown errors
+		}
+		fmt.Println("\nSession summary:")
+		if err := writeSummary(os.Stdout, *summary); err != nil {
+			log.Printf("Error printing session summary: %v", err)
+		}
+	}
+
+	// Shutdown observability provider
+	if obsProvider != nil {
+		obsProvider.Logger().InfoContext(shutdownCtx, "Shutting down observability...")
+		if err := obsProvider.Shutdown(shutdownCtx); err != nil {
+			// Can't use obsProvider.Logger here since we're shutting it down
+			log.Printf("Error during observability shutdown: %v", err)
+		}
+	}
+
+	fmt.Println("Shutdown complete")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetShutdown lets a test run the shutdown sequence again, and restores
+// the globals it touches afterwards
+func resetShutdown(t *testing.T, m *tunnel.Manager) {
+	t.Helper()
+	originalManager := manager
+	manager = m
+	shutdownOnce = sync.Once{}
+	shutdownQuiet, shutdownTimeout = true, time.Second
+	t.Cleanup(func() {
+		manager = originalManager
+		shutdownOnce = sync.Once{}
+		signalsMu.Lock()
+		signalsClaimed = nil
+		signalsMu.Unlock()
+	})
+}
+
+func TestShutdownRunsOnce(t *testing.T) {
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	resetShutdown(t, m)
+
+	_, backendPort, stopServer := setupTestServerWithCleanup(t)
+	defer stopServer()
+
+	ctx := context.Background()
+	defer m.Stop(ctx)
+	require.NoError(t, m.StartTunnelWithOptions(ctx, tunnel.Options{BackendPort: backendPort, Domain: "shutdown-a", HTTPPort: 8306}))
+
+	shutdown()
+	assert.Zero(t, m.Count(), "the shutdown stops every tunnel")
+
+	// A signal arriving as a foreground command returns doesn't tear down
+	// twice. A fresh manager brings back the mDNS server the shutdown stopped.
+	m, cleanup = setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	manager = m
+	defer m.Stop(ctx)
+	require.NoError(t, m.StartTunnelWithOptions(ctx, tunnel.Options{BackendPort: backendPort, Domain: "shutdown-b", HTTPPort: 8307}))
+	shutdown()
+	assert.Equal(t, 1, m.Count())
+}
+
+func TestClaimedSignal(t *testing.T) {
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	resetShutdown(t, m)
+
+	_, backendPort, stopServer := setupTestServerWithCleanup(t)
+	defer stopServer()
+
+	ctx := context.Background()
+	defer m.Stop(ctx)
+	require.NoError(t, m.StartTunnelWithOptions(ctx, tunnel.Options{BackendPort: backendPort, Domain: "shutdown-claimed", HTTPPort: 8308}))
+
+	signals := make(chan os.Signal, 2)
+	exited := make(chan struct{})
+	go func() {
+		handleSignals(signals, func() { close(exited) })
+	}()
+	defer close(signals)
+
+	// The foreground command gets the signal; the tunnel stays up until it
+	// has wound up and called shutdown itself
+	claimed := claimSignals()
+	signals <- syscall.SIGTERM
+	select {
+	case sig := <-claimed:
+		assert.Equal(t, syscall.SIGTERM, sig)
+	case <-time.After(2 * time.Second):
+		t.Fatal("claimed signal not delivered")
+	}
+	assert.Equal(t, 1, m.Count())
+	select {
+	case <-exited:
+		t.Fatal("exited while the signal was claimed")
+	default:
+	}
+}
+
+func TestUnclaimedSignalShutsDown(t *testing.T) {
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+	resetShutdown(t, m)
+
+	_, backendPort, stopServer := setupTestServerWithCleanup(t)
+	defer stopServer()
+
+	ctx := context.Background()
+	defer m.Stop(ctx)
+	require.NoError(t, m.StartTunnelWithOptions(ctx, tunnel.Options{BackendPort: backendPort, Domain: "shutdown-unclaimed", HTTPPort: 8309}))
+
+	signals := make(chan os.Signal, 1)
+	exited := make(chan struct{})
+	go handleSignals(signals, func() { close(exited) })
+
+	signals <- os.Interrupt
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no shutdown after an unclaimed signal")
+	}
+	assert.Zero(t, m.Count())
+}
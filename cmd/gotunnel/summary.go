@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+)
+
+// sessionStart is when gotunnel started, for the uptime in the summary
+var sessionStart = time.Now()
+
+// sessionSummary is the tally printed when gotunnel shuts down
+type sessionSummary struct {
+	Uptime  time.Duration
+	Errors  int64
+	Tunnels []tunnelTally // Sorted by domain
+}
+
+type tunnelTally struct {
+	Domain   string
+	Requests int64
+}
+
+// collectSummary reads the request counters of m's running tunnels. Call it
+// before the tunnels are stopped.
+func collectSummary(m *tunnel.Manager, uptime time.Duration, errors int64) sessionSummary {
+	summary := sessionSummary{Uptime: uptime, Errors: errors}
+	if m == nil {
+		return summary
+	}
+	for _, info := range m.ListTunnels() {
+		domain, _ := info["domain"].(string)
+		requests, _ := info["requests"].(int64)
+		summary.Tunnels = append(summary.Tunnels, tunnelTally{Domain: domain, Requests: requests})
+	}
+	sort.Slice(summary.Tunnels, func(i, j int) bool {
+		return summary.Tunnels[i].Domain < summary.Tunnels[j].Domain
+	})
+	return summary
+}
+
+// writeSummary prints s as a table of per-tunnel requests with totals
+func writeSummary(w io.Writer, s sessionSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TUNNEL\tREQUESTS")
+	var total int64
+	for _, t := range s.Tunnels {
+		fmt.Fprintf(tw, "%s\t%d\n", t.Domain, t.Requests)
+		total += t.Requests
+	}
+	fmt.Fprintf(tw, "total\t%d\n", total)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Uptime: %s, errors: %d\n", s.Uptime.Round(time.Second), s.Errors)
+	return err
+}
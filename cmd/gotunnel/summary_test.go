@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionSummary(t *testing.T) {
+	m, cleanup := setupTunnelManagerWithCleanup(t)
+	defer cleanup()
+
+	_, backendPort, stopServer := setupTestServerWithCleanup(t)
+	defer stopServer()
+
+	ctx := context.Background()
+	defer m.Stop(ctx)
+	require.NoError(t, m.StartTunnelWithOptions(ctx, tunnel.Options{BackendPort: backendPort, Domain: "summary-b", HTTPPort: 8304, HTTPSPort: 8604}))
+	require.NoError(t, m.StartTunnelWithOptions(ctx, tunnel.Options{BackendPort: backendPort, Domain: "summary-a", HTTPPort: 8305, HTTPSPort: 8605}))
+
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get("http://127.0.0.1:8304/")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	summary := collectSummary(m, 90*time.Second+400*time.Millisecond, 2)
+	assert.Equal(t, []tunnelTally{{"summary-a.local", 0}, {"summary-b.local", 3}}, summary.Tunnels)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeSummary(&buf, summary))
+	assert.Equal(t, fmt.Sprint(
+		"TUNNEL           REQUESTS\n",
+		"summary-a.local  0\n",
+		"summary-b.local  3\n",
+		"total            3\n",
+		"Uptime: 1m30s, errors: 2\n",
+	), buf.String())
+}
+
+func TestSessionSummaryWithoutManager(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeSummary(&buf, collectSummary(nil, time.Minute, 0)))
+	assert.Equal(t, "TUNNEL  REQUESTS\ntotal   0\nUptime: 1m0s, errors: 0\n", buf.String())
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/urfave/cli/v2"
+)
+
+// buildInfo describes the running binary
+type buildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+	Go      string `json:"go"`
+}
+
+func (b buildInfo) String() string {
+	return fmt.Sprintf("%s (commit: %s, built: %s)", b.Version, b.Commit, b.Date)
+}
+
+// currentBuildInfo returns the ldflag-provided version details, filling any
+// left unset from the module and VCS information embedded by `go build`
+func currentBuildInfo() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, Date: date, Go: runtime.Version()}
+
+	embedded, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && embedded.Main.Version != "" && embedded.Main.Version != "(devel)" {
+		info.Version = embedded.Main.Version
+	}
+	for _, setting := range embedded.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "unknown" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.Date == "unknown" {
+				info.Date = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// PrintVersion prints the build details, as JSON with --json
+func PrintVersion(c *cli.Context) error {
+	return writeVersion(c.App.Writer, currentBuildInfo(), c.Bool("json"))
+}
+
+func writeVersion(w io.Writer, info buildInfo, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(info)
+	}
+	_, err := fmt.Fprintf(w, "gotunnel %s, %s\n", info, info.Go)
+	return err
+}
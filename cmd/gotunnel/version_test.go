@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteVersionJSON(t *testing.T) {
+	info := buildInfo{Version: "v1.2.3", Commit: "abc1234", Date: "2026-01-02T03:04:05Z", Go: "go1.23.0"}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeVersion(&buf, info, true))
+
+	var decoded map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, map[string]string{
+		"version": "v1.2.3",
+		"commit":  "abc1234",
+		"date":    "2026-01-02T03:04:05Z",
+		"go":      "go1.23.0",
+	}, decoded)
+}
+
+func TestWriteVersionText(t *testing.T) {
+	info := buildInfo{Version: "v1.2.3", Commit: "abc1234", Date: "2026-01-02", Go: "go1.23.0"}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeVersion(&buf, info, false))
+	assert.Equal(t, "gotunnel v1.2.3 (commit: abc1234, built: 2026-01-02), go1.23.0\n", buf.String())
+}
+
+func TestCurrentBuildInfoPrefersLdflags(t *testing.T) {
+	prevVersion, prevCommit, prevDate := version, commit, date
+	defer func() { version, commit, date = prevVersion, prevCommit, prevDate }()
+	version, commit, date = "v9.9.9", "deadbeef", "2026-10-17"
+
+	info := currentBuildInfo()
+	assert.Equal(t, buildInfo{Version: "v9.9.9", Commit: "deadbeef", Date: "2026-10-17", Go: runtime.Version()}, info)
+}
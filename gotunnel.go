@@ -0,0 +1,261 @@
+// Package gotunnel runs gotunnel's local HTTPS tunnels inside another Go
+// program. New wires up certificates, the optional built-in proxy and the
+// tunnel manager the same way the gotunnel CLI does.
+//
+//	g, err := gotunnel.New(gotunnel.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	defer g.Close(context.Background())
+//	err = g.Start(ctx, gotunnel.TunnelSpec{BackendPort: 3000, Domain: "myapp"})
+package gotunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/johncferguson/gotunnel/internal/cert"
+	"github.com/johncferguson/gotunnel/internal/logging"
+	"github.com/johncferguson/gotunnel/internal/middleware"
+	"github.com/johncferguson/gotunnel/internal/proxy"
+	"github.com/johncferguson/gotunnel/internal/tunnel"
+)
+
+// TunnelSpec describes a tunnel to start. Domain gets the configured TLD
+// appended if it doesn't already have it.
+type TunnelSpec = tunnel.Options
+
+// Middleware wraps a tunnel's reverse proxy; see TunnelSpec.Middleware
+type Middleware = middleware.Middleware
+
+// CORSConfig configures CORS handling in front of a tunnel's backend
+type CORSConfig = middleware.CORSConfig
+
+// CircuitBreaker fails requests fast while a tunnel's backend keeps failing;
+// see TunnelSpec.CircuitBreaker
+type CircuitBreaker = tunnel.CircuitBreaker
+
+// CertProvider supplies the certificate served for a domain; see
+// Options.CertProvider
+type CertProvider = cert.CertProvider
+
+// ProxyTimeouts bounds the built-in proxy's client connections; see
+// Options.ProxyTimeouts
+type ProxyTimeouts = proxy.ServerTimeouts
+
+// PortRange bounds the internal ports proxy-mode tunnels listen on
+type PortRange = tunnel.PortRange
+
+// Event reports a change in a tunnel's state; see Options.OnEvent
+type Event = tunnel.TunnelEvent
+
+// EventType identifies an Event
+type EventType = tunnel.EventType
+
+const (
+	EventStarted     = tunnel.EventStarted
+	EventStopped     = tunnel.EventStopped
+	EventBackendDown = tunnel.EventBackendDown
+	EventBackendUp   = tunnel.EventBackendUp
+	EventCircuitOpen = tunnel.EventCircuitOpen
+	EventCircuitShut = tunnel.EventCircuitShut
+	EventError       = tunnel.EventError
+)
+
+// IP families a tunnel can listen on; see TunnelSpec.IPFamily
+const (
+	IPFamilyDual = tunnel.IPFamilyDual
+	IPFamily4    = tunnel.IPFamily4
+	IPFamily6    = tunnel.IPFamily6
+)
+
+// Errors returned (wrapped) by Start and Stop; match them with errors.Is
+var (
+	ErrInvalidPort        = tunnel.ErrInvalidPort
+	ErrInvalidDomain      = tunnel.ErrInvalidDomain
+	ErrInvalidOptions     = tunnel.ErrInvalidOptions
+	ErrDuplicateDomain    = tunnel.ErrDuplicateDomain
+	ErrTunnelNotFound     = tunnel.ErrTunnelNotFound
+	ErrBindFailed         = tunnel.ErrBindFailed
+	ErrCertUnavailable    = tunnel.ErrCertUnavailable
+	ErrBackendUnreachable = tunnel.ErrBackendUnreachable
+)
+
+// Options configures New. The zero value starts tunnels directly on their
+// ports and makes them resolvable through mDNS and the hosts file.
+type Options struct {
+	CertDir         string // Where certificates are kept (default "./certs")
+	HostsBackupPath string // Copy of the hosts file taken before editing it (default in os.TempDir)
+
+	// CertProvider, if set, supplies HTTPS certificates instead of mkcert
+	// generating them in CertDir. Tunnels given their own CertFile still
+	// use that.
+	CertProvider CertProvider
+
+	DisableMDNS  bool   // Don't advertise tunnels over mDNS
+	DisableHosts bool   // Don't edit the hosts file
+	TLD          string // Suffix for bare domains (default "local")
+	AdvertiseIP  net.IP // Address advertised over mDNS instead of the detected one
+
+	// Proxy routes every tunnel through gotunnel's built-in proxy on
+	// ProxyHTTPPort/ProxyHTTPSPort (default 80/443) instead of binding each
+	// tunnel's own ports
+	Proxy          bool
+	ProxyHTTPPort  int
+	ProxyHTTPSPort int
+	ProxyHTTPS     bool       // Terminate HTTPS in the proxy, picking certificates by SNI
+	TunnelPorts    *PortRange // Internal ports for proxied tunnels (default any free port)
+
+	// ProxyTransport, if set, carries the proxy's requests to tunnels; see
+	// TunnelSpec.Transport to tune a single tunnel's backend connections
+	ProxyTransport *http.Transport
+
+	// ProxyTimeouts, if set, replaces the proxy's default read, write and
+	// idle timeouts. Zero disables one, e.g. WriteTimeout for streaming.
+	ProxyTimeouts *ProxyTimeouts
+
+	// OnEvent, if set, receives tunnel lifecycle events. It runs
+	// synchronously and must not call back into the Manager.
+	OnEvent func(Event)
+}
+
+// Manager runs tunnels for an embedding program. It is safe for concurrent
+// use.
+type Manager struct {
+	tunnels *tunnel.Manager
+	proxy   *proxy.Manager // nil unless Options.Proxy is set
+}
+
+// TunnelInfo describes a running tunnel
+type TunnelInfo struct {
+	Domain   string
+	Aliases  []string
+	Port     int // Backend port
+	HTTPS    bool
+	Requests int64 // Requests served since the tunnel started
+	BytesIn  int64 // Forwarded from clients to the backend
+	BytesOut int64 // Forwarded from the backend to clients
+
+	BadGateways int64 // Requests answered with a 502 because the backend failed
+}
+
+// New creates a Manager, starting the built-in proxy if Options.Proxy is set
+func New(opts Options) (*Manager, error) {
+	if opts.CertDir == "" {
+		opts.CertDir = "./certs"
+	}
+	if opts.HostsBackupPath == "" {
+		opts.HostsBackupPath = filepath.Join(os.TempDir(), "gotunnel-hosts.backup")
+	}
+	tld, err := tunnel.NormalizeTLD(opts.TLD)
+	if err != nil {
+		return nil, err
+	}
+
+	logger, err := logging.New(logging.DefaultConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create logger: %w", err)
+	}
+
+	managerOpts := tunnel.ManagerOptions{
+		UseMDNS:     !opts.DisableMDNS,
+		UseHosts:    !opts.DisableHosts,
+		LocalTLD:    tld,
+		AdvertiseIP: opts.AdvertiseIP,
+		TunnelPorts: opts.TunnelPorts,
+	}
+
+	var proxyManager *proxy.Manager
+	if opts.Proxy {
+		proxyManager = proxy.NewManager(proxy.ProxyConfig{
+			Mode:         proxy.BuiltInProxy,
+			Type:         proxy.BuiltInProxyType,
+			HTTPPort:     opts.ProxyHTTPPort,
+			HTTPSPort:    opts.ProxyHTTPSPort,
+			TerminateTLS: opts.ProxyHTTPS,
+			LocalTLD:     tld,
+			Transport:    opts.ProxyTransport,
+			Timeouts:     opts.ProxyTimeouts,
+		})
+		proxyManager.SetLogger(logger)
+		if err := proxyManager.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start proxy: %w", err)
+		}
+		managerOpts.ProxyManager = proxyManager
+		managerOpts.UseProxy = true
+	}
+
+	var certs CertProvider = cert.New(opts.CertDir)
+	if opts.CertProvider != nil {
+		certs = opts.CertProvider
+	}
+	tunnels, err := tunnel.NewManagerWithOptions(certs, logger, managerOpts)
+	if err != nil {
+		if proxyManager != nil {
+			proxyManager.Stop(context.Background())
+		}
+		return nil, err
+	}
+	tunnels.SetHostsBackupDir(opts.HostsBackupPath)
+	if opts.OnEvent != nil {
+		tunnels.OnEvent(opts.OnEvent)
+	}
+
+	return &Manager{tunnels: tunnels, proxy: proxyManager}, nil
+}
+
+// Start starts the tunnel described by spec
+func (m *Manager) Start(ctx context.Context, spec TunnelSpec) error {
+	return m.tunnels.StartTunnelWithOptions(ctx, spec)
+}
+
+// Stop stops the tunnel serving domain. A bare domain gets the configured TLD.
+func (m *Manager) Stop(ctx context.Context, domain string) error {
+	return m.tunnels.StopTunnel(ctx, m.Domain(domain))
+}
+
+// Domain returns domain with the configured TLD appended if it's missing,
+// as Start does with TunnelSpec.Domain
+func (m *Manager) Domain(domain string) string {
+	if tld := "." + m.tunnels.TLD(); !strings.HasSuffix(domain, tld) {
+		return domain + tld
+	}
+	return domain
+}
+
+// List returns the running tunnels, sorted by domain
+func (m *Manager) List() []TunnelInfo {
+	var list []TunnelInfo
+	for _, info := range m.tunnels.ListTunnels() {
+		t := TunnelInfo{}
+		t.Domain, _ = info["domain"].(string)
+		t.Aliases, _ = info["aliases"].([]string)
+		t.Port, _ = info["port"].(int)
+		t.HTTPS, _ = info["https"].(bool)
+		t.Requests, _ = info["requests"].(int64)
+		t.BytesIn, _ = info["bytes_in"].(int64)
+		t.BytesOut, _ = info["bytes_out"].(int64)
+		t.BadGateways, _ = info["bad_gateways"].(int64)
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Domain < list[j].Domain })
+	return list
+}
+
+// Close stops every tunnel, then the proxy and the mDNS responder. Requests
+// still in flight when ctx is done are cut off. The Manager can't be used
+// afterwards.
+func (m *Manager) Close(ctx context.Context) error {
+	err := m.tunnels.Close(ctx)
+	if m.proxy != nil {
+		err = errors.Join(err, m.proxy.Stop(ctx))
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package gotunnel_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/johncferguson/gotunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicAPI(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello from "+r.Host)
+	}))
+	defer backend.Close()
+
+	var mu sync.Mutex
+	var events []gotunnel.EventType
+	g, err := gotunnel.New(gotunnel.Options{
+		CertDir:      t.TempDir(),
+		DisableHosts: true, // Leave the real hosts file alone
+		OnEvent: func(e gotunnel.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e.Type)
+		},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	defer g.Close(ctx)
+
+	require.NoError(t, g.Start(ctx, gotunnel.TunnelSpec{
+		BackendPort:  backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:       "embedded",
+		HTTPPort:     8240,
+		HTTPSPort:    8540,
+		PreserveHost: true,
+	}))
+	err = g.Start(ctx, gotunnel.TunnelSpec{BackendPort: 3000, Domain: "embedded.local", HTTPPort: 8241, HTTPSPort: 8541})
+	assert.ErrorIs(t, err, gotunnel.ErrDuplicateDomain)
+
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:8240/", nil)
+	require.NoError(t, err)
+	req.Host = "embedded.local"
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello from embedded.local", string(body))
+
+	list := g.List()
+	require.Len(t, list, 1)
+	assert.Equal(t, "embedded.local", list[0].Domain)
+	assert.Equal(t, backend.Listener.Addr().(*net.TCPAddr).Port, list[0].Port)
+	assert.Equal(t, int64(1), list[0].Requests)
+
+	require.NoError(t, g.Stop(ctx, "embedded"))
+	assert.Empty(t, g.List())
+	assert.ErrorIs(t, g.Stop(ctx, "embedded"), gotunnel.ErrTunnelNotFound)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []gotunnel.EventType{gotunnel.EventStarted, gotunnel.EventError, gotunnel.EventStopped}, events)
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	_, err := gotunnel.New(gotunnel.Options{CertDir: t.TempDir(), TLD: "not.valid"})
+	assert.ErrorIs(t, err, gotunnel.ErrInvalidOptions)
+
+	_, err = gotunnel.New(gotunnel.Options{CertDir: t.TempDir(), DisableMDNS: true, DisableHosts: true})
+	assert.ErrorIs(t, err, gotunnel.ErrInvalidOptions)
+}
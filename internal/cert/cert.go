@@ -2,13 +2,13 @@ package cert
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"os"
 	"os/exec"
 	"os/user"
-	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 )
 
 func isMkcertInstalled() bool {
@@ -16,14 +16,55 @@ func isMkcertInstalled() bool {
 	return err == nil
 }
 
+// CertManager serves certificates from mkcert, or another CertProvider
 type CertManager struct {
-	certsDir string
+	provider CertProvider
+	runner   Runner // Runs mkcert and its installer; nil runs them as the current user
 }
 
+// New returns a CertManager that generates certificates with mkcert in
+// certsDir
 func New(certsDir string) *CertManager {
-	return &CertManager{
-		certsDir: certsDir,
+	return NewWithProvider(NewMkcertProvider(certsDir))
+}
+
+// NewWithProvider returns a CertManager that gets certificates from
+// provider for domains without files of their own
+func NewWithProvider(provider CertProvider) *CertManager {
+	return &CertManager{provider: provider}
+}
+
+// SetRunner makes the manager, and its mkcert provider if it has one, run
+// external commands with runner instead of executing them directly
+func (m *CertManager) SetRunner(runner Runner) {
+	m.runner = runner
+	if p, ok := m.provider.(*MkcertProvider); ok {
+		p.runner = runner
+	}
+}
+
+// loadCertFiles loads a certificate/key pair and checks it can serve domain
+func loadCertFiles(domain, certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate %s: %w", certFile, err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", certFile, err)
+	}
+	if err := leaf.VerifyHostname(domain); err != nil {
+		return nil, fmt.Errorf("certificate %s does not cover %s: %w", certFile, domain, err)
+	}
+	now := time.Now()
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate %s is only valid from %s to %s",
+			certFile, leaf.NotBefore.Format(time.RFC3339), leaf.NotAfter.Format(time.RFC3339))
 	}
+
+	cert.Leaf = leaf
+	return &cert, nil
 }
 
 func getCurrentUser() (*user.User, error) {
@@ -45,7 +86,7 @@ func (m *CertManager) EnsureMkcertInstalled() error {
 	}
 
 	cmdParts := strings.Fields(installCmd)
-	if err := runAsUser(cmdParts[0], cmdParts[1:]...); err != nil {
+	if err := m.runner.run(cmdParts[0], cmdParts[1:]...); err != nil {
 		return fmt.Errorf("failed to install mkcert: %w", err)
 	}
 
@@ -53,35 +94,5 @@ func (m *CertManager) EnsureMkcertInstalled() error {
 }
 
 func (m *CertManager) EnsureCert(domain string) (*tls.Certificate, error) {
-	if err := os.MkdirAll(m.certsDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create certs directory: %w", err)
-	}
-
-	certFile := filepath.Join(m.certsDir, domain+".pem")
-	keyFile := filepath.Join(m.certsDir, domain+"-key.pem")
-
-	// Check if certificate already exists
-	if _, err := os.Stat(certFile); err == nil {
-		if _, err := os.Stat(keyFile); err == nil {
-			// Both files exist, load and return the certificate
-			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-			if err != nil {
-				return nil, fmt.Errorf("failed to load existing certificate: %w", err)
-			}
-			return &cert, nil
-		}
-	}
-
-	// Generate new certificate
-	if err := runAsUser("mkcert", "-cert-file", certFile, "-key-file", keyFile, domain); err != nil {
-		return nil, fmt.Errorf("failed to generate certificate: %w", err)
-	}
-
-	// Load and return the new certificate
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load new certificate: %w", err)
-	}
-
-	return &cert, nil
+	return m.provider.EnsureCert(domain)
 }
@@ -193,4 +193,4 @@ func TestInvalidCertificateHandling(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, cert)
 	assert.Contains(t, err.Error(), "failed to load existing certificate")
-}
\ No newline at end of file
+}
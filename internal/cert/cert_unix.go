@@ -10,19 +10,20 @@ import (
 	"syscall"
 )
 
-func runAsUser(name string, arg ...string) error {
+// userCommand prepares a command that runs as the current user
+func userCommand(name string, arg ...string) (*exec.Cmd, error) {
 	originalUser, err := getCurrentUser()
 	if err != nil {
-		return fmt.Errorf("failed to get current user: %w", err)
+		return nil, fmt.Errorf("failed to get current user: %w", err)
 	}
 
 	uid, err := strconv.Atoi(originalUser.Uid)
 	if err != nil {
-		return fmt.Errorf("failed to parse user ID: %w", err)
+		return nil, fmt.Errorf("failed to parse user ID: %w", err)
 	}
 	gid, err := strconv.Atoi(originalUser.Gid)
 	if err != nil {
-		return fmt.Errorf("failed to parse group ID: %w", err)
+		return nil, fmt.Errorf("failed to parse group ID: %w", err)
 	}
 
 	cmd := exec.Command(name, arg...)
@@ -36,11 +37,5 @@ func runAsUser(name string, arg ...string) error {
 		fmt.Sprintf("HOME=%s", originalUser.HomeDir),
 		fmt.Sprintf("USER=%s", originalUser.Username),
 	)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("command failed: %w\nOutput: %s", err, string(output))
-	}
-
-	return nil
+	return cmd, nil
 }
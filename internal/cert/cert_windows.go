@@ -9,24 +9,19 @@ import (
 	"syscall"
 )
 
-func runAsUser(name string, arg ...string) error {
+// userCommand prepares a command that runs as the current user
+func userCommand(name string, arg ...string) (*exec.Cmd, error) {
 	cmd := exec.Command(name, arg...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{}
 
 	originalUser, err := getCurrentUser()
 	if err != nil {
-		return fmt.Errorf("failed to get current user: %w", err)
+		return nil, fmt.Errorf("failed to get current user: %w", err)
 	}
 
 	cmd.Env = append(os.Environ(),
 		fmt.Sprintf("HOME=%s", originalUser.HomeDir),
 		fmt.Sprintf("USER=%s", originalUser.Username),
 	)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("command failed: %w\nOutput: %s", err, string(output))
-	}
-
-	return nil
+	return cmd, nil
 }
@@ -0,0 +1,85 @@
+package cert
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+// Common reasons a command like mkcert fails, matched with errors.Is
+var (
+	ErrMkcertNotInstalled = errors.New("mkcert is not installed or not in PATH")
+	ErrCANotInstalled     = errors.New("mkcert's root CA is missing or unreadable (run " + InstallCACommand + ")")
+	ErrPermissionDenied   = errors.New("permission denied")
+)
+
+// outputTailLines and outputTailBytes bound how much of a failed command's
+// output its error carries
+const (
+	outputTailLines = 5
+	outputTailBytes = 512
+)
+
+// CommandError is a failed run of an external command. Output is only the
+// last few lines of what it printed.
+type CommandError struct {
+	Command string
+	Output  string
+	Err     error
+	kind    error // One of the sentinel errors above, or nil
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("%s failed: %v", e.Command, e.Err)
+	if e.kind != nil {
+		msg = fmt.Sprintf("%s failed: %v: %v", e.Command, e.kind, e.Err)
+	}
+	if e.Output != "" {
+		msg += "\n" + e.Output
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() []error {
+	if e.kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.kind, e.Err}
+}
+
+// classifyFailure picks the sentinel error describing why name failed, or
+// nil if it's none of the common causes
+func classifyFailure(name string, err error, output []byte) error {
+	text := strings.ToLower(string(output))
+	switch {
+	case errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist):
+		if name == "mkcert" {
+			return ErrMkcertNotInstalled
+		}
+		return nil
+	case errors.Is(err, fs.ErrPermission) || strings.Contains(text, "permission denied"):
+		return ErrPermissionDenied
+	case name == "mkcert" && (strings.Contains(text, "the ca key") ||
+		strings.Contains(text, "the ca certificate") ||
+		strings.Contains(text, "local ca is not installed")):
+		return ErrCANotInstalled
+	}
+	return nil
+}
+
+// outputTail returns the last few lines of output, trimmed, so errors stay
+// readable when a command prints a lot
+func outputTail(output []byte) string {
+	text := strings.TrimSpace(string(output))
+	lines := strings.Split(text, "\n")
+	if len(lines) > outputTailLines {
+		lines = lines[len(lines)-outputTailLines:]
+		text = "...\n" + strings.Join(lines, "\n")
+	}
+	if len(text) > outputTailBytes {
+		text = "..." + text[len(text)-outputTailBytes:]
+	}
+	return text
+}
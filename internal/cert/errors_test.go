@@ -0,0 +1,98 @@
+package cert
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingRunner returns a Runner whose commands all fail with err after
+// printing output
+func failingRunner(output string, err error) Runner {
+	return func(name string, arg ...string) ([]byte, error) {
+		return []byte(output), err
+	}
+}
+
+func TestMkcertFailures(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+	tests := []struct {
+		name   string
+		output string
+		err    error
+		want   error
+	}{
+		{"not installed", "", &exec.Error{Name: "mkcert", Err: exec.ErrNotFound}, ErrMkcertNotInstalled},
+		{"CA not installed", "ERROR: failed to read the CA key: open /home/u/.local/share/mkcert/rootCA-key.pem: no such file or directory", exitErr, ErrCANotInstalled},
+		{"permission denied", "ERROR: failed to save certificate: open /certs/app.local.pem: permission denied", exitErr, ErrPermissionDenied},
+		{"permission error", "", &fs.PathError{Op: "fork/exec", Path: "mkcert", Err: fs.ErrPermission}, ErrPermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := NewMkcertProvider(dir)
+			p.runner = failingRunner(tt.output, tt.err)
+
+			_, err := p.EnsureCert("app.local")
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tt.want)
+			assert.ErrorIs(t, err, tt.err, "the underlying error is kept")
+			assert.Contains(t, err.Error(), "app.local")
+			assert.Contains(t, err.Error(), dir)
+
+			var cmdErr *CommandError
+			require.ErrorAs(t, err, &cmdErr)
+			assert.Equal(t, "mkcert", cmdErr.Command)
+		})
+	}
+}
+
+func TestUnclassifiedFailure(t *testing.T) {
+	p := NewMkcertProvider(t.TempDir())
+	p.runner = failingRunner("ERROR: something unexpected", errors.New("exit status 1"))
+
+	_, err := p.EnsureCert("app.local")
+	require.Error(t, err)
+	for _, sentinel := range []error{ErrMkcertNotInstalled, ErrCANotInstalled, ErrPermissionDenied} {
+		assert.NotErrorIs(t, err, sentinel)
+	}
+	assert.Contains(t, err.Error(), "something unexpected")
+}
+
+func TestOutputTail(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	run := failingRunner(strings.Join(lines, "\n")+"\n", errors.New("exit status 1"))
+
+	err := run.run("mkcert", "-install")
+	require.Error(t, err)
+	var cmdErr *CommandError
+	require.ErrorAs(t, err, &cmdErr)
+	assert.Equal(t, "...\nline 96\nline 97\nline 98\nline 99\nline 100", cmdErr.Output)
+	assert.NotContains(t, err.Error(), "line 95")
+
+	// Long lines are cut to the last few hundred bytes
+	run = failingRunner(strings.Repeat("x", 10000), errors.New("exit status 1"))
+	err = run.run("mkcert", "-install")
+	require.ErrorAs(t, err, &cmdErr)
+	assert.LessOrEqual(t, len(cmdErr.Output), outputTailBytes+len("..."))
+}
+
+func TestOtherCommandNotFound(t *testing.T) {
+	// Only a missing mkcert means mkcert isn't installed
+	run := failingRunner("", &exec.Error{Name: "nix-env", Err: exec.ErrNotFound})
+
+	err := run.run("nix-env", "-iA", "nixpkgs.mkcert")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrMkcertNotInstalled)
+	assert.ErrorIs(t, err, exec.ErrNotFound)
+}
@@ -0,0 +1,152 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CertProvider supplies the certificate served for a domain
+type CertProvider interface {
+	EnsureCert(domain string) (*tls.Certificate, error)
+}
+
+var (
+	_ CertProvider = (*CertManager)(nil)
+	_ CertProvider = (*MkcertProvider)(nil)
+	_ CertProvider = (*SelfSignedProvider)(nil)
+	_ CertProvider = (*FileProvider)(nil)
+)
+
+// MkcertProvider generates certificates with mkcert, trusted wherever
+// mkcert's root CA is installed, and keeps them in a directory for reuse
+type MkcertProvider struct {
+	certsDir string
+	runner   Runner // nil runs mkcert as the current user
+}
+
+func NewMkcertProvider(certsDir string) *MkcertProvider {
+	return &MkcertProvider{certsDir: certsDir}
+}
+
+// EnsureCert loads domain's certificate from the directory, running mkcert
+// to generate it first if it isn't there
+func (p *MkcertProvider) EnsureCert(domain string) (*tls.Certificate, error) {
+	if err := os.MkdirAll(p.certsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create certs directory: %w", err)
+	}
+
+	certFile := filepath.Join(p.certsDir, domain+".pem")
+	keyFile := filepath.Join(p.certsDir, domain+"-key.pem")
+
+	// Check if certificate already exists
+	if _, err := os.Stat(certFile); err == nil {
+		if _, err := os.Stat(keyFile); err == nil {
+			// Both files exist, load and return the certificate
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load existing certificate: %w", err)
+			}
+			return &cert, nil
+		}
+	}
+
+	// Generate new certificate
+	if err := p.runner.run("mkcert", "-cert-file", certFile, "-key-file", keyFile, domain); err != nil {
+		return nil, fmt.Errorf("failed to generate certificate for %s in %s: %w", domain, p.certsDir, err)
+	}
+
+	// Load and return the new certificate
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load new certificate: %w", err)
+	}
+
+	return &cert, nil
+}
+
+// FileProvider serves an existing certificate and key, e.g. issued by a
+// corporate CA or a wildcard. The files are reread on every call so rotated
+// certificates are picked up.
+type FileProvider struct {
+	CertFile string
+	KeyFile  string
+}
+
+// EnsureCert loads the pair, failing unless it covers domain and is
+// currently valid
+func (p *FileProvider) EnsureCert(domain string) (*tls.Certificate, error) {
+	return loadCertFiles(domain, p.CertFile, p.KeyFile)
+}
+
+// selfSignedValidity is how long SelfSignedProvider's certificates last
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// SelfSignedProvider generates a self-signed certificate per domain in
+// memory. Clients don't trust them, so it suits tests and clients that
+// skip verification; nothing is written to disk or needs mkcert.
+type SelfSignedProvider struct {
+	mu    sync.Mutex
+	certs map[string]*tls.Certificate
+}
+
+func NewSelfSignedProvider() *SelfSignedProvider {
+	return &SelfSignedProvider{certs: make(map[string]*tls.Certificate)}
+}
+
+// EnsureCert returns domain's certificate, generating it on first use
+func (p *SelfSignedProvider) EnsureCert(domain string) (*tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cert, ok := p.certs[domain]; ok {
+		return cert, nil
+	}
+	cert, err := selfSigned(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate self-signed certificate for %s: %w", domain, err)
+	}
+	p.certs[domain] = cert
+	return cert, nil
+}
+
+// selfSigned creates a certificate for domain signed by its own key
+func selfSigned(domain string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: domain, Organization: []string{"gotunnel self-signed"}},
+		DNSNames:     []string{domain},
+		NotBefore:    now.Add(-time.Minute), // Tolerate small clock differences
+		NotAfter:     now.Add(selfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
@@ -0,0 +1,72 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfSignedProvider(t *testing.T) {
+	p := NewSelfSignedProvider()
+
+	cert, err := p.EnsureCert("app.local")
+	require.NoError(t, err)
+	require.NotNil(t, cert.Leaf)
+	assert.NoError(t, cert.Leaf.VerifyHostname("app.local"))
+	assert.Error(t, cert.Leaf.VerifyHostname("other.local"))
+
+	// The key matches the certificate
+	key, ok := cert.PrivateKey.(*ecdsa.PrivateKey)
+	require.True(t, ok)
+	assert.True(t, key.PublicKey.Equal(cert.Leaf.PublicKey))
+
+	// Certificates are generated once per domain
+	again, err := p.EnsureCert("app.local")
+	require.NoError(t, err)
+	assert.Same(t, cert, again)
+
+	other, err := p.EnsureCert("other.local")
+	require.NoError(t, err)
+	assert.NotEqual(t, cert.Leaf.SerialNumber, other.Leaf.SerialNumber)
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "wildcard.crt")
+	keyFile := filepath.Join(dir, "wildcard.key")
+	certPEM, keyPEM, err := generateTestCertificate("*.corp.local")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0644))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0600))
+
+	p := &FileProvider{CertFile: certFile, KeyFile: keyFile}
+	cert, err := p.EnsureCert("app.corp.local")
+	require.NoError(t, err)
+	assert.Contains(t, cert.Leaf.DNSNames, "*.corp.local")
+
+	_, err = p.EnsureCert("app.local")
+	assert.ErrorContains(t, err, "does not cover app.local")
+
+	// The key must belong to the certificate
+	_, otherKeyPEM, err := generateTestCertificate("app.corp.local")
+	require.NoError(t, err)
+	mismatchedKey := filepath.Join(dir, "mismatched.key")
+	require.NoError(t, os.WriteFile(mismatchedKey, otherKeyPEM, 0600))
+	_, err = (&FileProvider{CertFile: certFile, KeyFile: mismatchedKey}).EnsureCert("app.corp.local")
+	assert.ErrorContains(t, err, "failed to load certificate")
+
+	_, err = (&FileProvider{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: keyFile}).EnsureCert("app.corp.local")
+	assert.Error(t, err)
+}
+
+func TestCertManagerWithProvider(t *testing.T) {
+	cm := NewWithProvider(NewSelfSignedProvider())
+
+	cert, err := cm.EnsureCert("dev.local")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gotunnel self-signed"}, cert.Leaf.Subject.Organization)
+}
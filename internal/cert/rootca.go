@@ -0,0 +1,82 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InstallCACommand is what users run to trust mkcert's certificates
+const InstallCACommand = "mkcert -install"
+
+var (
+	// mkcertOutput runs mkcert as the current user and returns its stdout;
+	// overridden in tests
+	mkcertOutput = func(arg ...string) ([]byte, error) {
+		cmd, err := userCommand("mkcert", arg...)
+		if err != nil {
+			return nil, err
+		}
+		return cmd.Output()
+	}
+
+	// systemTrusts reports whether the system trust store accepts ca;
+	// overridden in tests
+	systemTrusts = func(ca *x509.Certificate) bool {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			return false
+		}
+		_, err = ca.Verify(x509.VerifyOptions{
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		return err == nil
+	}
+)
+
+// IsRootCAInstalled reports whether mkcert's root CA exists and is trusted
+// by the system, so browsers accept the certificates EnsureCert generates.
+// Browsers with their own trust store (e.g. Firefox without NSS tools) may
+// still differ.
+func (m *CertManager) IsRootCAInstalled() (bool, error) {
+	out, err := mkcertOutput("-CAROOT")
+	if err != nil {
+		return false, fmt.Errorf("failed to locate mkcert's CA: %w", err)
+	}
+	caRoot := strings.TrimSpace(string(out))
+	if caRoot == "" {
+		return false, errors.New("mkcert reported no CA directory")
+	}
+
+	data, err := os.ReadFile(filepath.Join(caRoot, "rootCA.pem"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil // mkcert hasn't created a CA yet
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read mkcert's CA: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false, fmt.Errorf("mkcert's CA in %s is not PEM encoded", caRoot)
+	}
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse mkcert's CA: %w", err)
+	}
+
+	return systemTrusts(ca), nil
+}
+
+// InstallRootCA runs mkcert -install, creating the root CA if needed and
+// adding it to the system trust store
+func (m *CertManager) InstallRootCA() error {
+	if err := m.runner.run("mkcert", "-install"); err != nil {
+		return fmt.Errorf("failed to install mkcert's CA: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package cert
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMkcert makes mkcert -CAROOT report caRoot (or fail with err) for the
+// rest of the test
+func fakeMkcert(t *testing.T, caRoot string, err error) {
+	t.Helper()
+	orig := mkcertOutput
+	mkcertOutput = func(arg ...string) ([]byte, error) {
+		require.Equal(t, []string{"-CAROOT"}, arg)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(caRoot + "\n"), nil
+	}
+	t.Cleanup(func() { mkcertOutput = orig })
+}
+
+// writeRootCA writes a root certificate where mkcert keeps its CA
+func writeRootCA(t *testing.T, caRoot string) {
+	t.Helper()
+	certPEM, _, err := generateTestCertificate("mkcert development CA")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(caRoot, "rootCA.pem"), certPEM, 0644))
+}
+
+func TestIsRootCAInstalled(t *testing.T) {
+	cm := New(t.TempDir())
+
+	t.Run("no CA created yet", func(t *testing.T) {
+		fakeMkcert(t, t.TempDir(), nil)
+		installed, err := cm.IsRootCAInstalled()
+		require.NoError(t, err)
+		assert.False(t, installed)
+	})
+
+	t.Run("CA created but not trusted", func(t *testing.T) {
+		caRoot := t.TempDir()
+		fakeMkcert(t, caRoot, nil)
+		writeRootCA(t, caRoot)
+
+		installed, err := cm.IsRootCAInstalled()
+		require.NoError(t, err)
+		assert.False(t, installed)
+	})
+
+	t.Run("CA trusted", func(t *testing.T) {
+		caRoot := t.TempDir()
+		fakeMkcert(t, caRoot, nil)
+		writeRootCA(t, caRoot)
+
+		orig := systemTrusts
+		systemTrusts = func(ca *x509.Certificate) bool { return true }
+		t.Cleanup(func() { systemTrusts = orig })
+
+		installed, err := cm.IsRootCAInstalled()
+		require.NoError(t, err)
+		assert.True(t, installed)
+	})
+
+	t.Run("corrupt CA", func(t *testing.T) {
+		caRoot := t.TempDir()
+		fakeMkcert(t, caRoot, nil)
+		require.NoError(t, os.WriteFile(filepath.Join(caRoot, "rootCA.pem"), []byte("not a certificate"), 0644))
+
+		_, err := cm.IsRootCAInstalled()
+		assert.Error(t, err)
+	})
+
+	t.Run("mkcert fails", func(t *testing.T) {
+		fakeMkcert(t, "", errors.New("exec: \"mkcert\": executable file not found in $PATH"))
+		_, err := cm.IsRootCAInstalled()
+		assert.ErrorContains(t, err, "failed to locate mkcert's CA")
+	})
+}
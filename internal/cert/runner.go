@@ -0,0 +1,34 @@
+package cert
+
+// Runner runs an external command and returns its combined output. mkcert
+// and the package manager that installs it are run through one, so tests
+// can swap in a fake that never touches the system.
+type Runner func(name string, arg ...string) ([]byte, error)
+
+// runAsUser is the default Runner: it runs name as the current user, even
+// when gotunnel itself was started with sudo
+func runAsUser(name string, arg ...string) ([]byte, error) {
+	cmd, err := userCommand(name, arg...)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.CombinedOutput()
+}
+
+// run runs name with r, or runAsUser if r is nil, returning a *CommandError
+// that classifies the failure if it exits unsuccessfully
+func (r Runner) run(name string, arg ...string) error {
+	if r == nil {
+		r = runAsUser
+	}
+	output, err := r(name, arg...)
+	if err == nil {
+		return nil
+	}
+	return &CommandError{
+		Command: name,
+		Output:  outputTail(output),
+		Err:     err,
+		kind:    classifyFailure(name, err, output),
+	}
+}
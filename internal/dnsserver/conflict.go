@@ -0,0 +1,145 @@
+package dnsserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/mdns"
+)
+
+// Disambiguation controls whether mDNS instance names get a per-machine
+// suffix, so two machines serving the same domain advertise distinct
+// instances. The routing domain itself is unchanged.
+type Disambiguation string
+
+const (
+	DisambiguateNone     Disambiguation = ""         // Instance name is the bare domain
+	DisambiguateHostname Disambiguation = "hostname" // Append this machine's hostname
+	DisambiguateRandom   Disambiguation = "random"   // Append a random suffix chosen once per process
+)
+
+// ParseDisambiguation accepts "", "none", "hostname" or "random"
+func ParseDisambiguation(s string) (Disambiguation, error) {
+	switch d := Disambiguation(strings.ToLower(strings.TrimSpace(s))); d {
+	case DisambiguateNone, DisambiguateHostname, DisambiguateRandom:
+		return d, nil
+	case "none":
+		return DisambiguateNone, nil
+	default:
+		return "", fmt.Errorf("unknown mDNS name suffix %q (want hostname or random)", s)
+	}
+}
+
+var (
+	disambiguation Disambiguation
+	conflictCheck  time.Duration // Browse timeout before registering; 0 skips the check
+
+	randomSuffix = sync.OnceValue(func() string {
+		b := make([]byte, 2)
+		if _, err := rand.Read(b); err != nil {
+			return "0000"
+		}
+		return hex.EncodeToString(b)
+	})
+
+	// browse lists services of the given type answering on the network;
+	// overridden in tests
+	browse = browseNetwork
+)
+
+// SetDisambiguation changes how later registrations name their instances
+func SetDisambiguation(d Disambiguation) {
+	serverMu.Lock()
+	defer serverMu.Unlock()
+	disambiguation = d
+}
+
+// SetConflictCheck makes registrations first browse the network for up to
+// timeout and warn if another machine already advertises the name. Zero
+// disables the check.
+func SetConflictCheck(timeout time.Duration) {
+	serverMu.Lock()
+	defer serverMu.Unlock()
+	conflictCheck = timeout
+}
+
+// instanceName returns the mDNS instance name for serviceName under d
+func instanceName(serviceName string, d Disambiguation) string {
+	switch d {
+	case DisambiguateHostname:
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			return serviceName + "-" + randomSuffix()
+		}
+		host, _, _ = strings.Cut(strings.ToLower(host), ".")
+		return serviceName + "-" + host
+	case DisambiguateRandom:
+		return serviceName + "-" + randomSuffix()
+	default:
+		return serviceName
+	}
+}
+
+// warnOnConflict logs a warning if a machine other than ip already
+// advertises host or instance for serviceType. Browse failures are ignored;
+// the check is best effort.
+func warnOnConflict(serviceType, instance, host string, ip net.IP, timeout time.Duration) {
+	entries, err := browse(serviceType, timeout)
+	if err != nil {
+		return
+	}
+	fullInstance := fmt.Sprintf("%s.%s.local.", instance, serviceType)
+	for _, entry := range entries {
+		if entry.Host != host && entry.Name != fullInstance {
+			continue
+		}
+		if entry.AddrV4 != nil && entry.AddrV4.Equal(ip) {
+			continue // Our own advertisement
+		}
+		log.Printf("Warning: %s is already advertised over mDNS by %s; clients may reach either machine (see --mdns-suffix)",
+			strings.TrimSuffix(host, "."), entryAddr(entry))
+		return
+	}
+}
+
+// entryAddr returns the address a browsed service answered from
+func entryAddr(entry *mdns.ServiceEntry) string {
+	switch {
+	case entry.AddrV4 != nil:
+		return entry.AddrV4.String()
+	case entry.AddrV6 != nil:
+		return entry.AddrV6.String()
+	default:
+		return "another machine"
+	}
+}
+
+// browseNetwork queries the network for serviceType instances for timeout
+func browseNetwork(serviceType string, timeout time.Duration) ([]*mdns.ServiceEntry, error) {
+	entries := make(chan *mdns.ServiceEntry, 16)
+	done := make(chan []*mdns.ServiceEntry)
+	go func() {
+		var found []*mdns.ServiceEntry
+		for entry := range entries {
+			found = append(found, entry)
+		}
+		done <- found
+	}()
+
+	err := mdns.Query(&mdns.QueryParam{
+		Service:     serviceType,
+		Domain:      "local",
+		Timeout:     timeout,
+		Entries:     entries,
+		DisableIPv6: true,
+	})
+	close(entries)
+	return <-done, err
+}
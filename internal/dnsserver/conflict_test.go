@@ -0,0 +1,117 @@
+package dnsserver
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/mdns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDisambiguation(t *testing.T) {
+	for in, want := range map[string]Disambiguation{
+		"":         DisambiguateNone,
+		"none":     DisambiguateNone,
+		"hostname": DisambiguateHostname,
+		"Random":   DisambiguateRandom,
+	} {
+		got, err := ParseDisambiguation(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := ParseDisambiguation("uuid")
+	assert.Error(t, err)
+}
+
+func TestInstanceName(t *testing.T) {
+	assert.Equal(t, "app", instanceName("app", DisambiguateNone))
+
+	host, err := os.Hostname()
+	require.NoError(t, err)
+	host, _, _ = strings.Cut(strings.ToLower(host), ".")
+	assert.Equal(t, "app-"+host, instanceName("app", DisambiguateHostname))
+
+	random := instanceName("app", DisambiguateRandom)
+	assert.Regexp(t, `^app-[0-9a-f]{4}$`, random)
+	assert.Equal(t, random, instanceName("app", DisambiguateRandom), "suffix is stable within a process")
+}
+
+// fakeNetwork makes browse report entries and records the zone each
+// registration starts its responder with
+func fakeNetwork(t *testing.T, entries ...*mdns.ServiceEntry) *[]*mdns.MDNSService {
+	t.Helper()
+	originalBrowse, originalServer := browse, newServer
+	browse = func(string, time.Duration) ([]*mdns.ServiceEntry, error) {
+		return entries, nil
+	}
+	var zones []*mdns.MDNSService
+	newServer = func(config *mdns.Config) (*mdns.Server, error) {
+		zones = append(zones, config.Zone.(*mdns.MDNSService))
+		return originalServer(config)
+	}
+	t.Cleanup(func() { browse, newServer = originalBrowse, originalServer })
+	return &zones
+}
+
+// captureLog redirects the standard logger into a buffer for the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestRegisterDomainWarnsOnConflict(t *testing.T) {
+	require.NoError(t, StartDNSServer())
+	defer Shutdown()
+	SetAdvertiseIP(net.ParseIP("192.0.2.10"))
+	defer SetAdvertiseIP(nil)
+	SetConflictCheck(10 * time.Millisecond)
+	defer SetConflictCheck(0)
+	SetDisambiguation(DisambiguateRandom)
+	defer SetDisambiguation(DisambiguateNone)
+
+	zones := fakeNetwork(t, &mdns.ServiceEntry{
+		Name:   "shared._https._tcp.local.",
+		Host:   "shared.local.",
+		AddrV4: net.ParseIP("192.0.2.20"),
+		Port:   8443,
+	})
+	logs := captureLog(t)
+
+	require.NoError(t, RegisterDomain("shared.local", 8443))
+	assert.Contains(t, logs.String(), "shared.local is already advertised over mDNS by 192.0.2.20")
+
+	// The instance is disambiguated, the routing host is not
+	require.Len(t, *zones, 1)
+	assert.Equal(t, "shared-"+randomSuffix(), (*zones)[0].Instance)
+	assert.Equal(t, "shared.local.", (*zones)[0].HostName)
+	assert.True(t, IsRegistered("shared.local"))
+}
+
+func TestRegisterDomainIgnoresOwnAdvertisement(t *testing.T) {
+	require.NoError(t, StartDNSServer())
+	defer Shutdown()
+	SetAdvertiseIP(net.ParseIP("192.0.2.10"))
+	defer SetAdvertiseIP(nil)
+	SetConflictCheck(10 * time.Millisecond)
+	defer SetConflictCheck(0)
+
+	zones := fakeNetwork(t,
+		&mdns.ServiceEntry{Host: "mine.local.", AddrV4: net.ParseIP("192.0.2.10")},
+		&mdns.ServiceEntry{Host: "other.local.", AddrV4: net.ParseIP("192.0.2.20")},
+	)
+	logs := captureLog(t)
+
+	require.NoError(t, RegisterDomain("mine.local", 8443))
+	assert.Empty(t, logs.String())
+	require.Len(t, *zones, 1)
+	assert.Equal(t, "mine", (*zones)[0].Instance)
+}
@@ -1,10 +1,15 @@
 package dnsserver
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"net"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/mdns"
 )
@@ -12,6 +17,7 @@ import (
 type Server struct {
 	mu      sync.RWMutex
 	entries map[string]*ServiceEntry
+	closed  bool // Set by Shutdown; registrations still in flight are dropped
 }
 
 type ServiceEntry struct {
@@ -21,12 +27,70 @@ type ServiceEntry struct {
 	server *mdns.Server
 }
 
+// RetryPolicy controls how registration retries starting an mDNS responder,
+// which can fail transiently while another process holds the socket
+type RetryPolicy struct {
+	Attempts int           // Total attempts, including the first
+	Backoff  time.Duration // Delay before the first retry, doubled each time
+}
+
+// DefaultRetryPolicy is used until SetRetryPolicy is called
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 100 * time.Millisecond}
+
 var (
 	globalServer *Server
 	serverMu     sync.Mutex
+	retryPolicy  = DefaultRetryPolicy
+	advertiseIP  net.IP // Overrides GetOutboundIP when set
+
+	// newServer starts an mDNS responder; overridden in tests
+	newServer = mdns.NewServer
 )
 
-// StartDNSServer initializes the DNS server
+// SetRetryPolicy changes how registrations retry failed responder starts
+func SetRetryPolicy(policy RetryPolicy) {
+	serverMu.Lock()
+	defer serverMu.Unlock()
+	retryPolicy = policy
+}
+
+// SetAdvertiseIP makes registrations advertise ip instead of the detected
+// outbound address, for machines with several interfaces or a VPN. nil
+// restores detection.
+func SetAdvertiseIP(ip net.IP) {
+	serverMu.Lock()
+	defer serverMu.Unlock()
+	advertiseIP = ip
+}
+
+// AdvertisedIP returns the address registrations advertise
+func AdvertisedIP() net.IP {
+	serverMu.Lock()
+	ip := advertiseIP
+	serverMu.Unlock()
+	if ip == nil {
+		return GetOutboundIP()
+	}
+	return ip
+}
+
+// IsLocalAddress reports whether ip is assigned to one of this machine's
+// network interfaces
+func IsLocalAddress(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartDNSServer initializes the DNS server. It's safe to call more than
+// once; only the first call after Shutdown creates a new server.
 func StartDNSServer() error {
 	serverMu.Lock()
 	defer serverMu.Unlock()
@@ -61,13 +125,26 @@ func GetOutboundIP() net.IP {
 
 // RegisterDomain adds a new domain to the DNS server and advertises it via get
 func RegisterDomain(domain string, port int) error {
-	if globalServer == nil {
+	return RegisterDomainContext(context.Background(), domain, port)
+}
+
+// RegisterDomainContext is RegisterDomain with retries that stop when ctx is
+// cancelled
+func RegisterDomainContext(ctx context.Context, domain string, port int) error {
+	return RegisterDomainWithTXT(ctx, domain, port, nil)
+}
+
+// RegisterDomainWithTXT is RegisterDomainContext advertising txt as extra
+// TXT records (e.g. path=/health) for service-discovery clients. A key in
+// txt overrides the default record of the same name.
+func RegisterDomainWithTXT(ctx context.Context, domain string, port int, txt map[string]string) error {
+	serverMu.Lock()
+	s, policy, naming, checkTimeout := globalServer, retryPolicy, disambiguation, conflictCheck
+	serverMu.Unlock()
+	if s == nil {
 		return fmt.Errorf("DNS server not initialized")
 	}
 
-	globalServer.mu.Lock()
-	defer globalServer.mu.Unlock()
-
 	host := domain
 
 	// Make sure hostname is a proper FQDN
@@ -79,7 +156,7 @@ func RegisterDomain(domain string, port int) error {
 	serviceName := strings.TrimSuffix(domain, ".local")
 
 	// Get the machine's network IP
-	ip := GetOutboundIP()
+	ip := AdvertisedIP()
 
 	// Determine service type based on port
 	serviceType := "_http._tcp"
@@ -87,32 +164,46 @@ func RegisterDomain(domain string, port int) error {
 		serviceType = "_https._tcp"
 	}
 
+	instance := instanceName(serviceName, naming)
+	if checkTimeout > 0 {
+		warnOnConflict(serviceType, instance, host, ip, checkTimeout)
+	}
+
 	// Configure mDNS service
 	service, err := mdns.NewMDNSService(
-		serviceName,  // Instance name
+		instance,     // Instance name
 		serviceType,  // Service type (_http._tcp or _https._tcp)
 		"",           // Domain (empty for .local)
 		host,         // Host name
 		port,         // Port
 		[]net.IP{ip}, // Use the network IP instead of localhost
-		[]string{
-			"version=1",
-			fmt.Sprintf("ip=%s", ip.String()),
-			fmt.Sprintf("port=%d", port),
-		}, // TXT records with more info
+		txtRecords(ip, port, txt),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create mDNS service: %w", err)
 	}
 
-	// Create the mDNS server
-	server, err := mdns.NewServer(&mdns.Config{Zone: service})
+	// Create the mDNS server, without holding the lock while backing off
+	server, err := startServer(ctx, service, policy)
 	if err != nil {
 		return fmt.Errorf("failed to create mDNS server: %w", err)
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Shutdown ran while the responder was starting; don't leave it running
+	if s.closed {
+		server.Shutdown()
+		return fmt.Errorf("DNS server shut down while registering %s", domain)
+	}
+	// Re-registering replaces the previous responder rather than leaking it
+	if old, exists := s.entries[domain]; exists && old.server != nil {
+		old.server.Shutdown()
+	}
+
 	// Store the entry
-	globalServer.entries[domain] = &ServiceEntry{
+	s.entries[domain] = &ServiceEntry{
 		domain: domain,
 		ip:     ip,
 		port:   port,
@@ -122,16 +213,58 @@ func RegisterDomain(domain string, port int) error {
 	return nil
 }
 
-// UnregisterDomain removes a domain from the DNS server
+// txtRecords returns the TXT records for a service: version, ip and port,
+// merged with extra, as sorted key=value strings
+func txtRecords(ip net.IP, port int, extra map[string]string) []string {
+	fields := map[string]string{
+		"version": "1",
+		"ip":      ip.String(),
+		"port":    strconv.Itoa(port),
+	}
+	maps.Copy(fields, extra)
+
+	records := make([]string, 0, len(fields))
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		records = append(records, key+"="+fields[key])
+	}
+	return records
+}
+
+// startServer starts the responder for zone, retrying failures per policy
+func startServer(ctx context.Context, zone mdns.Zone, policy RetryPolicy) (*mdns.Server, error) {
+	delay := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		server, err := newServer(&mdns.Config{Zone: zone})
+		if err == nil {
+			return server, nil
+		}
+		if attempt >= policy.Attempts {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w after %d attempts: %w", ctx.Err(), attempt, err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// UnregisterDomain removes a domain from the DNS server. Nothing is
+// advertised once the server is shut down, so it's a no-op then.
 func UnregisterDomain(domain string) error {
-	if globalServer == nil {
-		// return fmt.Errorf("DNS server not initialized")
+	serverMu.Lock()
+	s := globalServer
+	serverMu.Unlock()
+	if s == nil {
+		return nil
 	}
 
-	globalServer.mu.Lock()
-	defer globalServer.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	entry, exists := globalServer.entries[domain]
+	entry, exists := s.entries[domain]
 	if !exists {
 		return nil
 	}
@@ -144,28 +277,50 @@ func UnregisterDomain(domain string) error {
 		}
 	}
 
-	delete(globalServer.entries, domain)
+	delete(s.entries, domain)
 	// log.Printf("Unregistered domain %s from mDNS", domain)
 	return nil
 }
 
-// Shutdown cleans up the DNS server
+// IsRegistered reports whether domain is currently advertised over mDNS
+func IsRegistered(domain string) bool {
+	serverMu.Lock()
+	s := globalServer
+	serverMu.Unlock()
+	if s == nil {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.entries[domain]
+	return exists
+}
+
+// Shutdown stops every mDNS responder and resets the DNS server, so a later
+// StartDNSServer begins with no entries. It's a no-op if the server isn't
+// running.
 func Shutdown() error {
-	if globalServer == nil {
+	serverMu.Lock()
+	defer serverMu.Unlock()
+	s := globalServer
+	if s == nil {
 		return nil
 	}
 
-	globalServer.mu.Lock()
-	defer globalServer.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// Shutdown all mDNS servers
-	for domain, entry := range globalServer.entries {
+	for domain, entry := range s.entries {
 		if entry.server != nil {
 			entry.server.Shutdown()
 		}
-		delete(globalServer.entries, domain)
+		delete(s.entries, domain)
 	}
 
+	s.closed = true
 	globalServer = nil
 	// log.Printf("DNS server shut down")
 	return nil
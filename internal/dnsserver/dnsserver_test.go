@@ -1,10 +1,14 @@
 package dnsserver
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/mdns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -39,6 +43,7 @@ func TestRegisterAndUnregisterDomain(t *testing.T) {
 	assert.True(t, exists)
 	assert.Equal(t, port, entry.port)
 	assert.Equal(t, domain, entry.domain)
+	assert.True(t, IsRegistered(domain))
 
 	// Test unregistration
 	err = UnregisterDomain(domain)
@@ -49,6 +54,7 @@ func TestRegisterAndUnregisterDomain(t *testing.T) {
 	_, exists = globalServer.entries[domain]
 	serverMu.Unlock()
 	assert.False(t, exists)
+	assert.False(t, IsRegistered(domain))
 }
 
 func TestGetOutboundIP(t *testing.T) {
@@ -114,3 +120,194 @@ func TestShutdown(t *testing.T) {
 	assert.Nil(t, globalServer)
 	serverMu.Unlock()
 }
+
+func TestUnregisterDomainAfterShutdown(t *testing.T) {
+	require.NoError(t, StartDNSServer())
+	require.NoError(t, RegisterDomain("test-unregister-after-shutdown.local", 8080))
+	require.NoError(t, Shutdown())
+
+	// A tunnel torn down after the server may still unregister its names
+	assert.NotPanics(t, func() {
+		assert.NoError(t, UnregisterDomain("test-unregister-after-shutdown.local"))
+	})
+	assert.False(t, IsRegistered("test-unregister-after-shutdown.local"))
+}
+
+func TestIsRegisteredDuringShutdown(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			StartDNSServer()
+			Shutdown()
+		}
+	}()
+
+	// Run with -race: the server may go away between checks
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			assert.NotPanics(t, func() { IsRegistered("test-is-registered.local") })
+		}
+	}
+}
+
+func TestStartShutdownCycle(t *testing.T) {
+	require.NoError(t, StartDNSServer())
+	require.NoError(t, StartDNSServer(), "starting twice is harmless")
+	require.NoError(t, RegisterDomain("test-cycle-first.local", 8080))
+	require.NoError(t, Shutdown())
+	require.NoError(t, Shutdown(), "shutting down twice is harmless")
+
+	// A restarted server begins empty and registers as before
+	require.NoError(t, StartDNSServer())
+	defer Shutdown()
+	assert.False(t, IsRegistered("test-cycle-first.local"))
+	serverMu.Lock()
+	assert.Empty(t, globalServer.entries)
+	serverMu.Unlock()
+
+	require.NoError(t, RegisterDomain("test-cycle-second.local", 8080))
+	assert.True(t, IsRegistered("test-cycle-second.local"))
+}
+
+func TestRegisterDuringShutdownDoesNotLeak(t *testing.T) {
+	require.NoError(t, StartDNSServer())
+	defer Shutdown()
+
+	// Shut down while the responder is starting
+	var started *mdns.Server
+	original := newServer
+	newServer = func(config *mdns.Config) (*mdns.Server, error) {
+		require.NoError(t, Shutdown())
+		server, err := original(config)
+		started = server
+		return server, err
+	}
+	t.Cleanup(func() { newServer = original })
+
+	err := RegisterDomain("test-register-during-shutdown.local", 8080)
+	assert.Error(t, err)
+	require.NotNil(t, started)
+	assert.False(t, IsRegistered("test-register-during-shutdown.local"))
+}
+
+// failingServer makes the first failures calls to newServer fail, then
+// delegates to the real responder
+func failingServer(t *testing.T, failures int) *int {
+	t.Helper()
+	calls := 0
+	original := newServer
+	newServer = func(config *mdns.Config) (*mdns.Server, error) {
+		calls++
+		if calls <= failures {
+			return nil, errors.New("address already in use")
+		}
+		return original(config)
+	}
+	t.Cleanup(func() { newServer = original })
+	return &calls
+}
+
+func TestRegisterDomainRetries(t *testing.T) {
+	require.NoError(t, StartDNSServer())
+	defer Shutdown()
+	SetRetryPolicy(RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+	defer SetRetryPolicy(DefaultRetryPolicy)
+
+	calls := failingServer(t, 1)
+	require.NoError(t, RegisterDomain("retry.local", 8080))
+	assert.Equal(t, 2, *calls)
+	assert.True(t, IsRegistered("retry.local"))
+}
+
+func TestRegisterDomainGivesUp(t *testing.T) {
+	require.NoError(t, StartDNSServer())
+	defer Shutdown()
+	SetRetryPolicy(RetryPolicy{Attempts: 2, Backoff: time.Millisecond})
+	defer SetRetryPolicy(DefaultRetryPolicy)
+
+	calls := failingServer(t, 5)
+	err := RegisterDomain("flaky.local", 8080)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "address already in use")
+	assert.Equal(t, 2, *calls)
+	assert.False(t, IsRegistered("flaky.local"))
+}
+
+func TestRegisterDomainContextCancelled(t *testing.T) {
+	require.NoError(t, StartDNSServer())
+	defer Shutdown()
+	SetRetryPolicy(RetryPolicy{Attempts: 5, Backoff: time.Hour})
+	defer SetRetryPolicy(DefaultRetryPolicy)
+
+	failingServer(t, 5)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := RegisterDomainContext(ctx, "cancelled.local", 8080)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second, "cancellation must cut the backoff short")
+}
+
+func TestRegisterDomainAdvertisesOverrideIP(t *testing.T) {
+	require.NoError(t, StartDNSServer())
+	defer Shutdown()
+
+	forced := net.ParseIP("192.0.2.10")
+	SetAdvertiseIP(forced)
+	defer SetAdvertiseIP(nil)
+	assert.True(t, forced.Equal(AdvertisedIP()))
+
+	var advertised []net.IP
+	original := newServer
+	newServer = func(config *mdns.Config) (*mdns.Server, error) {
+		advertised = config.Zone.(*mdns.MDNSService).IPs
+		return original(config)
+	}
+	defer func() { newServer = original }()
+
+	require.NoError(t, RegisterDomain("advertise.local", 8080))
+	require.Len(t, advertised, 1)
+	assert.True(t, forced.Equal(advertised[0]), "advertised %v", advertised)
+
+	SetAdvertiseIP(nil)
+	assert.True(t, GetOutboundIP().Equal(AdvertisedIP()))
+}
+
+func TestTXTRecords(t *testing.T) {
+	ip := net.ParseIP("192.0.2.10")
+	assert.Equal(t, []string{"ip=192.0.2.10", "port=8443", "version=1"}, txtRecords(ip, 8443, nil))
+	assert.Equal(t,
+		[]string{"ip=192.0.2.10", "path=/health", "port=443", "proto=https", "version=1"},
+		txtRecords(ip, 8443, map[string]string{"path": "/health", "proto": "https", "port": "443"}),
+		"extra records are merged in and override the defaults")
+}
+
+func TestRegisterDomainWithTXT(t *testing.T) {
+	require.NoError(t, StartDNSServer())
+	defer Shutdown()
+
+	var advertised []string
+	original := newServer
+	newServer = func(config *mdns.Config) (*mdns.Server, error) {
+		advertised = config.Zone.(*mdns.MDNSService).TXT
+		return original(config)
+	}
+	defer func() { newServer = original }()
+
+	require.NoError(t, RegisterDomainWithTXT(context.Background(), "txt.local", 8443,
+		map[string]string{"path": "/health", "version": "2"}))
+	assert.Contains(t, advertised, "path=/health")
+	assert.Contains(t, advertised, "version=2")
+	assert.NotContains(t, advertised, "version=1")
+	assert.Contains(t, advertised, "port=8443")
+}
+
+func TestIsLocalAddress(t *testing.T) {
+	assert.True(t, IsLocalAddress(net.ParseIP("127.0.0.1")))
+	assert.False(t, IsLocalAddress(net.ParseIP("192.0.2.10")))
+}
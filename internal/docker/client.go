@@ -0,0 +1,188 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSocket is where the Docker daemon listens when DOCKER_HOST is unset
+const DefaultSocket = "/var/run/docker.sock"
+
+// Client is an Inspector backed by the Docker Engine API
+type Client struct {
+	http    *http.Client
+	baseURL string
+}
+
+// NewClient returns a client for the daemon named by host, which takes the
+// DOCKER_HOST forms unix:///path and tcp://host:port. An empty host means
+// $DOCKER_HOST, or DefaultSocket without it.
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = "unix://" + DefaultSocket
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %q: %w", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &Client{http: &http.Client{Transport: transport, Timeout: 10 * time.Second}, baseURL: "http://docker"}, nil
+	case "tcp", "http":
+		return &Client{http: &http.Client{Timeout: 10 * time.Second}, baseURL: "http://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %q: want unix:// or tcp://", host)
+	}
+}
+
+// inspectResponse is the part of GET /containers/{id}/json gotunnel reads
+type inspectResponse struct {
+	Name  string `json:"Name"`
+	State struct {
+		Running bool `json:"Running"`
+	} `json:"State"`
+	Config struct {
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		IPAddress string `json:"IPAddress"`
+		Networks  map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+		Ports map[string][]portBinding `json:"Ports"` // Nil entries aren't published
+	} `json:"NetworkSettings"`
+}
+
+// portBinding is where Docker publishes a container port on the host
+type portBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+// InspectContainer looks up the container called name
+func (c *Client) InspectContainer(ctx context.Context, name string) (Container, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/containers/"+url.PathEscape(name)+"/json", nil)
+	if err != nil {
+		return Container{}, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Container{}, fmt.Errorf("failed to reach Docker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return Container{}, fmt.Errorf("%w: %s", ErrContainerNotFound, name)
+	default:
+		return Container{}, fmt.Errorf("docker inspect %s: %s", name, resp.Status)
+	}
+
+	var body inspectResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Container{}, fmt.Errorf("failed to decode Docker response for %s: %w", name, err)
+	}
+	return body.container(), nil
+}
+
+// container picks the address and TCP ports out of an inspect response.
+// Without a default bridge address it takes the first network by name, so
+// the choice is stable across restarts.
+func (r inspectResponse) container() Container {
+	c := Container{
+		Name:    strings.TrimPrefix(r.Name, "/"),
+		Running: r.State.Running,
+		IP:      r.NetworkSettings.IPAddress,
+	}
+	if c.IP == "" {
+		networks := make([]string, 0, len(r.NetworkSettings.Networks))
+		for name := range r.NetworkSettings.Networks {
+			networks = append(networks, name)
+		}
+		sort.Strings(networks)
+		for _, name := range networks {
+			if ip := r.NetworkSettings.Networks[name].IPAddress; ip != "" {
+				c.IP = ip
+				break
+			}
+		}
+	}
+
+	for spec := range r.Config.ExposedPorts {
+		port, proto, _ := strings.Cut(spec, "/")
+		if proto != "" && proto != "tcp" {
+			continue
+		}
+		if n, err := strconv.Atoi(port); err == nil {
+			c.ExposedPorts = append(c.ExposedPorts, n)
+		}
+	}
+	sort.Ints(c.ExposedPorts)
+
+	for spec, bindings := range r.NetworkSettings.Ports {
+		port, proto, _ := strings.Cut(spec, "/")
+		n, err := strconv.Atoi(port)
+		if err != nil || (proto != "" && proto != "tcp") {
+			continue
+		}
+		if target, ok := publishedTarget(bindings); ok {
+			if c.Published == nil {
+				c.Published = make(map[int]Target)
+			}
+			c.Published[n] = target
+		}
+	}
+	return c
+}
+
+// publishedTarget picks the binding to reach a published port through,
+// preferring one on IPv4 loopback or all IPv4 interfaces (Docker lists
+// 0.0.0.0 and :: alike). A binding to all interfaces is reached over
+// loopback.
+func publishedTarget(bindings []portBinding) (Target, bool) {
+	var fallback *Target
+	for _, b := range bindings {
+		port, err := strconv.Atoi(b.HostPort)
+		if err != nil || port == 0 {
+			continue
+		}
+		host, ip := b.HostIP, net.ParseIP(b.HostIP)
+		if ip == nil || ip.IsUnspecified() {
+			host = "127.0.0.1"
+			if ip != nil && ip.To4() == nil {
+				host = "::1"
+			}
+		}
+		if host == "127.0.0.1" || (ip != nil && ip.To4() != nil && ip.IsLoopback()) {
+			return Target{Host: host, Port: port}, true
+		}
+		if fallback == nil {
+			fallback = &Target{Host: host, Port: port}
+		}
+	}
+	if fallback == nil {
+		return Target{}, false
+	}
+	return *fallback, true
+}
@@ -0,0 +1,84 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientInspectContainer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/web/json":
+			w.Write([]byte(`{
+				"Name": "/web",
+				"State": {"Running": true},
+				"Config": {"ExposedPorts": {"3000/tcp": {}, "5353/udp": {}, "80/tcp": {}}},
+				"NetworkSettings": {
+					"IPAddress": "",
+					"Networks": {"zeta": {"IPAddress": "10.0.1.5"}, "app_default": {"IPAddress": "10.0.0.5"}},
+					"Ports": {
+						"80/tcp": [{"HostIp": "::", "HostPort": "8080"}, {"HostIp": "0.0.0.0", "HostPort": "8080"}],
+						"3000/tcp": null,
+						"5353/udp": [{"HostIp": "0.0.0.0", "HostPort": "5353"}]
+					}
+				}
+			}`))
+		default:
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient("tcp://" + server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	c, err := client.InspectContainer(context.Background(), "web")
+	require.NoError(t, err)
+	assert.Equal(t, Container{
+		Name:         "web",
+		Running:      true,
+		IP:           "10.0.0.5",
+		ExposedPorts: []int{80, 3000},
+		Published:    map[int]Target{80: {Host: "127.0.0.1", Port: 8080}},
+	}, c)
+
+	_, err = client.InspectContainer(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrContainerNotFound)
+}
+
+func TestPublishedTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		bindings []portBinding
+		want     Target
+		ok       bool
+	}{
+		{name: "all interfaces", bindings: []portBinding{{HostIP: "0.0.0.0", HostPort: "8080"}}, want: Target{Host: "127.0.0.1", Port: 8080}, ok: true},
+		{name: "loopback", bindings: []portBinding{{HostIP: "127.0.0.1", HostPort: "8080"}}, want: Target{Host: "127.0.0.1", Port: 8080}, ok: true},
+		{name: "IPv6 only", bindings: []portBinding{{HostIP: "::", HostPort: "8080"}}, want: Target{Host: "::1", Port: 8080}, ok: true},
+		{name: "IPv4 preferred", bindings: []portBinding{{HostIP: "192.168.1.4", HostPort: "9000"}, {HostIP: "", HostPort: "8080"}}, want: Target{Host: "127.0.0.1", Port: 8080}, ok: true},
+		{name: "one interface", bindings: []portBinding{{HostIP: "192.168.1.4", HostPort: "9000"}}, want: Target{Host: "192.168.1.4", Port: 9000}, ok: true},
+		{name: "not published", bindings: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := publishedTarget(tt.bindings)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "")
+	_, err := NewClient("")
+	assert.NoError(t, err)
+
+	_, err = NewClient("ssh://user@host")
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+// Package docker finds the address of a Docker container's app, so a tunnel
+// can point at the container instead of a local port.
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrContainerNotFound means Docker has no container by that name or ID
+	ErrContainerNotFound = errors.New("container not found")
+
+	// ErrContainerNotRunning means the container exists but is stopped, so
+	// it has no address
+	ErrContainerNotRunning = errors.New("container not running")
+
+	// ErrNoExposedPorts means the container exposes no TCP port to point a
+	// tunnel at
+	ErrNoExposedPorts = errors.New("container has no exposed ports")
+)
+
+// Container is what the resolver needs to know about a container
+type Container struct {
+	Name         string
+	Running      bool
+	IP           string // Address on the container's network
+	ExposedPorts []int  // Exposed TCP ports, in ascending order
+
+	// Published maps exposed ports published with -p to where they're
+	// reached on the host
+	Published map[int]Target
+}
+
+// Inspector looks up containers. Client talks to the Docker API; tests use
+// a fake.
+type Inspector interface {
+	InspectContainer(ctx context.Context, name string) (Container, error)
+}
+
+// Target is where a tunnel should send requests for a container
+type Target struct {
+	Host string
+	Port int
+}
+
+// Resolve looks up the container called name and returns where to reach
+// its port: the host port it's published on, or else the container's own
+// address, which only Linux hosts can reach (not Docker Desktop). A port of
+// 0 picks the container's exposed port, which must be the only one;
+// otherwise port must be one the container exposes.
+func Resolve(ctx context.Context, inspector Inspector, name string, port int) (Target, error) {
+	c, err := inspector.InspectContainer(ctx, name)
+	if err != nil {
+		return Target{}, err
+	}
+	if !c.Running {
+		return Target{}, fmt.Errorf("%w: %s", ErrContainerNotRunning, name)
+	}
+
+	ports := append([]int(nil), c.ExposedPorts...)
+	sort.Ints(ports)
+	switch {
+	case len(ports) == 0:
+		return Target{}, fmt.Errorf("%w: %s", ErrNoExposedPorts, name)
+	case port != 0:
+		if !containsPort(ports, port) {
+			return Target{}, fmt.Errorf("container %s doesn't expose port %d (it exposes %v)", name, port, ports)
+		}
+	case len(ports) > 1:
+		return Target{}, fmt.Errorf("container %s exposes several ports %v; pick one with --port", name, ports)
+	default:
+		port = ports[0]
+	}
+
+	if published, ok := c.Published[port]; ok {
+		return published, nil
+	}
+	if c.IP == "" {
+		return Target{}, fmt.Errorf("container %s doesn't publish port %d and has no IP address; publish it with -p", name, port)
+	}
+	return Target{Host: c.IP, Port: port}, nil
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
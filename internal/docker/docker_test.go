@@ -0,0 +1,65 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeInspector map[string]Container
+
+func (f fakeInspector) InspectContainer(_ context.Context, name string) (Container, error) {
+	c, ok := f[name]
+	if !ok {
+		return Container{}, fmt.Errorf("%w: %s", ErrContainerNotFound, name)
+	}
+	return c, nil
+}
+
+func TestResolve(t *testing.T) {
+	inspector := fakeInspector{
+		"web":     {Name: "web", Running: true, IP: "172.17.0.2", ExposedPorts: []int{3000}},
+		"multi":   {Name: "multi", Running: true, IP: "172.17.0.3", ExposedPorts: []int{8080, 443}},
+		"noports": {Name: "noports", Running: true, IP: "172.17.0.4"},
+		"stopped": {Name: "stopped", ExposedPorts: []int{3000}},
+		"published": {Name: "published", Running: true, IP: "172.17.0.5", ExposedPorts: []int{80, 3000},
+			Published: map[int]Target{80: {Host: "127.0.0.1", Port: 8081}}},
+		"desktop": {Name: "desktop", Running: true, ExposedPorts: []int{80}},
+	}
+
+	tests := []struct {
+		name      string
+		container string
+		port      int
+		want      Target
+		wantErr   error
+	}{
+		{name: "single exposed port", container: "web", want: Target{Host: "172.17.0.2", Port: 3000}},
+		{name: "explicit port", container: "multi", port: 443, want: Target{Host: "172.17.0.3", Port: 443}},
+		{name: "several ports", container: "multi"},
+		{name: "port not exposed", container: "web", port: 9000},
+		{name: "missing container", container: "nope", wantErr: ErrContainerNotFound},
+		{name: "no exposed ports", container: "noports", wantErr: ErrNoExposedPorts},
+		{name: "stopped", container: "stopped", wantErr: ErrContainerNotRunning},
+		{name: "published port", container: "published", port: 80, want: Target{Host: "127.0.0.1", Port: 8081}},
+		{name: "unpublished port falls back to the bridge", container: "published", port: 3000, want: Target{Host: "172.17.0.5", Port: 3000}},
+		{name: "neither published nor addressable", container: "desktop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(context.Background(), inspector, tt.container, tt.port)
+			if tt.want == (Target{}) {
+				require.Error(t, err)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
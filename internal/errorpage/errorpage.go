@@ -0,0 +1,110 @@
+// Package errorpage renders the pages gotunnel serves when it can't pass a
+// request on: HTML for browsers, JSON for API clients that ask for it.
+package errorpage
+
+import (
+	"encoding/json"
+	"html/template"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Page describes an error shown in place of a backend's response
+type Page struct {
+	Status  int      // HTTP status code
+	Title   string   // Short summary, e.g. "Backend Unavailable"
+	Message string   // What went wrong
+	Domain  string   // Name the request was for
+	Backend string   // Where the request was forwarded, if anywhere
+	Hint    string   // What to check next
+	Details []string // Extra items listed under the message, e.g. available routes
+}
+
+// body is the JSON form of a Page
+type body struct {
+	Status  int      `json:"status"`
+	Error   string   `json:"error"`
+	Message string   `json:"message"`
+	Domain  string   `json:"domain,omitempty"`
+	Backend string   `json:"backend,omitempty"`
+	Hint    string   `json:"hint,omitempty"`
+	Details []string `json:"details,omitempty"`
+}
+
+var page = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Status}} {{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #f5f5f7; color: #1d1d1f; margin: 0; }
+main { max-width: 40rem; margin: 4rem auto; background: #fff; border-radius: 12px; padding: 2rem 2.5rem; box-shadow: 0 2px 12px rgba(0, 0, 0, .08); }
+h1 { font-size: 1.4rem; margin-top: 0; }
+.status { color: #c62828; }
+.hint { background: #fff8e1; border-left: 4px solid #ffb300; padding: .75rem 1rem; }
+code { background: #f0f0f0; padding: .1rem .3rem; border-radius: 4px; }
+</style>
+</head>
+<body>
+<main>
+<h1>🚇 gotunnel - <span class="status">{{.Status}}</span> {{.Title}}</h1>
+<p>{{.Message}}</p>
+{{- if .Details}}
+<ul>
+{{- range .Details}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Domain}}
+<p>Tunnel: <strong>{{.Domain}}</strong>{{if .Backend}} -&gt; <code>{{.Backend}}</code>{{end}}</p>
+{{- end}}
+{{- if .Hint}}
+<p class="hint">{{.Hint}}</p>
+{{- end}}
+</main>
+</body>
+</html>
+`))
+
+// Write serves p as JSON if the request prefers it, or as HTML otherwise
+func Write(w http.ResponseWriter, r *http.Request, p Page) {
+	w.Header().Set("Cache-Control", "no-store")
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(p.Status)
+		json.NewEncoder(w).Encode(body{
+			Status:  p.Status,
+			Error:   p.Title,
+			Message: p.Message,
+			Domain:  p.Domain,
+			Backend: p.Backend,
+			Hint:    p.Hint,
+			Details: p.Details,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(p.Status)
+	page.Execute(w, p)
+}
+
+// wantsJSON reports whether the Accept header lists a JSON type before any
+// HTML one. Browsers list text/html first, so they get the HTML page.
+func wantsJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		switch {
+		case mediaType == "text/html":
+			return false
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			return true
+		}
+	}
+	return false
+}
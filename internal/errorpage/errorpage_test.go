@@ -0,0 +1,83 @@
+package errorpage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHTML(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, Page{
+		Status:  http.StatusBadGateway,
+		Title:   "Backend Unavailable",
+		Message: "Nothing is listening on localhost:3000.",
+		Domain:  "<app>.local",
+		Backend: "localhost:3000",
+		Hint:    "Check that your app is running.",
+		Details: []string{"one.local", "two.local"},
+	})
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	body := rec.Body.String()
+	assert.Contains(t, body, "Backend Unavailable")
+	assert.Contains(t, body, "Nothing is listening on localhost:3000.")
+	assert.Contains(t, body, "&lt;app&gt;.local", "the domain is escaped")
+	assert.Contains(t, body, "<li>two.local</li>")
+	assert.Contains(t, body, "Check that your app is running.")
+}
+
+func TestWriteJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, Page{
+		Status:  http.StatusNotFound,
+		Title:   "Route Not Found",
+		Message: "No tunnel is configured for x.local.",
+		Details: []string{"app.local"},
+	})
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, map[string]any{
+		"status":  float64(http.StatusNotFound),
+		"error":   "Route Not Found",
+		"message": "No tunnel is configured for x.local.",
+		"details": []any{"app.local"},
+	}, got)
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", true},
+		{"application/problem+json", true},
+		{"application/json, text/plain, */*", true},
+		{"text/html,application/json", false},
+		{"text/html;q=0.9, application/json", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			assert.Equal(t, tt.want, wantsJSON(req))
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package httpserver runs an http.Server on a listener: serving in the
+// background, reporting when it's ready, and shutting down gracefully. The
+// tunnels and the built-in proxy share it.
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ErrForceClosed is returned by Shutdown when requests were still running
+// at the deadline and their connections had to be closed
+var ErrForceClosed = errors.New("connections force-closed at the shutdown deadline")
+
+// Server serves an http.Server on a listener it owns
+type Server struct {
+	// OnError, if set, is called when the server stops serving with an
+	// error after Start returned
+	OnError func(error)
+
+	server   *http.Server
+	listener net.Listener
+
+	mu      sync.Mutex
+	started bool
+}
+
+// New returns a Server that will serve server on listener. If server has a
+// TLSConfig, connections are served over TLS with it, HTTP/2 included;
+// otherwise listener is served as is (it may already terminate TLS).
+func New(server *http.Server, listener net.Listener) *Server {
+	return &Server{server: server, listener: listener}
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Port returns the TCP port the server listens on
+func (s *Server) Port() int {
+	if addr, ok := s.listener.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
+
+// Start serves in the background and returns once the server is accepting
+// connections, or the error that stopped it first. check, if not nil, then
+// runs against the listen address (e.g. dialing it to make sure TLS
+// completes); if it fails the server is closed and its error returned.
+func (s *Server) Start(check func(addr net.Addr) error) error {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return fmt.Errorf("server on %s already started", s.Addr())
+	}
+	s.started = true
+	s.mu.Unlock()
+
+	listener := &readyListener{Listener: s.listener, ready: make(chan struct{})}
+	served := make(chan error, 1)
+	go func() {
+		var err error
+		if s.server.TLSConfig != nil {
+			err = s.server.ServeTLS(listener, "", "")
+		} else {
+			err = s.server.Serve(listener)
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		served <- err
+	}()
+
+	select {
+	case <-listener.ready:
+	case err := <-served:
+		if err == nil {
+			err = http.ErrServerClosed
+		}
+		return fmt.Errorf("server on %s stopped before serving: %w", s.Addr(), err)
+	}
+
+	if check != nil {
+		if err := check(s.Addr()); err != nil {
+			select {
+			case serveErr := <-served:
+				if serveErr != nil {
+					err = serveErr
+				}
+			default:
+			}
+			s.server.Close()
+			return err
+		}
+	}
+
+	go func() {
+		if err := <-served; err != nil && s.OnError != nil {
+			s.OnError(err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// until ctx is done, then force-closes the connections still open and
+// returns ErrForceClosed. A server that was never started just closes its
+// listener.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if !started {
+		s.listener.Close()
+		return nil
+	}
+
+	err := s.server.Shutdown(ctx)
+	if err != nil && ctx.Err() != nil {
+		s.server.Close()
+		return fmt.Errorf("%w: %w", ErrForceClosed, ctx.Err())
+	}
+	return err
+}
+
+// Close stops the server at once, closing its listener and connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if !started {
+		return s.listener.Close()
+	}
+	return s.server.Close()
+}
+
+// readyListener closes ready the first time the server asks for a
+// connection, i.e. once it's serving
+type readyListener struct {
+	net.Listener
+	once  sync.Once
+	ready chan struct{}
+}
+
+func (l *readyListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { close(l.ready) })
+	return l.Listener.Accept()
+}
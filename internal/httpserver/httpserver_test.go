@@ -0,0 +1,148 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, handler http.Handler) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return New(&http.Server{Handler: handler}, listener)
+}
+
+func get(t *testing.T, s *Server) string {
+	t.Helper()
+	resp, err := http.Get(fmt.Sprintf("http://%s/", s.Addr()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestStartServeShutdown(t *testing.T) {
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	assert.Equal(t, s.Addr().(*net.TCPAddr).Port, s.Port())
+
+	var checked net.Addr
+	require.NoError(t, s.Start(func(addr net.Addr) error {
+		checked = addr
+		return nil
+	}))
+	assert.Equal(t, s.Addr(), checked, "the check runs against the listen address")
+	assert.Equal(t, "ok", get(t, s))
+
+	assert.Error(t, s.Start(nil), "a server starts once")
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	_, err := net.DialTimeout("tcp", s.Addr().String(), time.Second)
+	assert.Error(t, err, "the listener is closed")
+}
+
+func TestStartReportsServeError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	// A TLS config without certificates makes ServeTLS fail straight away
+	s := New(&http.Server{TLSConfig: &tls.Config{}}, listener)
+
+	err = s.Start(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stopped before serving")
+	require.NoError(t, s.Close())
+}
+
+func TestStartReportsFailedCheck(t *testing.T) {
+	s := newTestServer(t, http.NotFoundHandler())
+	checkErr := errors.New("not answering")
+
+	err := s.Start(func(net.Addr) error { return checkErr })
+	assert.ErrorIs(t, err, checkErr)
+
+	_, err = net.DialTimeout("tcp", s.Addr().String(), time.Second)
+	assert.Error(t, err, "a server whose check failed is closed")
+}
+
+func TestShutdownForceClosesAtDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	require.NoError(t, s.Start(nil))
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://%s/", s.Addr()))
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := s.Shutdown(ctx)
+	assert.ErrorIs(t, err, ErrForceClosed)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	select {
+	case err := <-done:
+		assert.Error(t, err, "the stuck request's connection was closed")
+	case <-time.After(2 * time.Second):
+		t.Fatal("request still running after a forced shutdown")
+	}
+}
+
+func TestOnErrorAfterStart(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := New(&http.Server{Handler: http.NotFoundHandler()}, &failingListener{Listener: listener})
+	failed := make(chan error, 1)
+	s.OnError = func(err error) { failed <- err }
+	require.NoError(t, s.Start(nil))
+
+	// Serving stops with an error once the listener breaks
+	listener.Close()
+	select {
+	case err := <-failed:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnError not called")
+	}
+}
+
+// failingListener hides the close, so Serve sees Accept fail rather than
+// its own shutdown
+type failingListener struct {
+	net.Listener
+}
+
+func (l *failingListener) Close() error { return nil }
+
+func TestShutdownBeforeStartClosesListener(t *testing.T) {
+	s := newTestServer(t, http.NotFoundHandler())
+	require.NoError(t, s.Shutdown(context.Background()))
+
+	_, err := net.DialTimeout("tcp", s.Addr().String(), time.Second)
+	assert.Error(t, err)
+}
@@ -143,6 +143,15 @@ func New(config *Config) (*Logger, error) {
 	}, nil
 }
 
+// Default returns a logger that writes through slog's default logger, for
+// code that may run without a configured one
+func Default() *Logger {
+	return &Logger{
+		Logger: slog.Default(),
+		config: DefaultConfig(),
+	}
+}
+
 // WithContext creates a new logger with context values
 func (l *Logger) WithContext(ctx context.Context) *Logger {
 	logger := l.Logger
@@ -170,6 +179,14 @@ func (l *Logger) WithComponent(component string) *Logger {
 	}
 }
 
+// WithTunnel creates a new logger tagged with the tunnel's domain
+func (l *Logger) WithTunnel(domain string) *Logger {
+	return &Logger{
+		Logger: l.Logger.With(slog.String("tunnel", domain)),
+		config: l.config,
+	}
+}
+
 // WithFields creates a new logger with additional fields
 func (l *Logger) WithFields(fields map[string]any) *Logger {
 	args := make([]any, 0, len(fields)*2)
@@ -232,7 +249,7 @@ func (l *Logger) TunnelError(domain string, err error, details map[string]any) {
 }
 
 // ProxyRequest logs HTTP proxy requests
-func (l *Logger) ProxyRequest(method, host, path string, statusCode int, duration time.Duration, userAgent string) {
+func (l *Logger) ProxyRequest(method, host, path string, statusCode int, duration time.Duration, userAgent, clientIP string) {
 	l.Debug("Proxy request",
 		slog.String("event", "proxy_request"),
 		slog.String("method", method),
@@ -241,6 +258,7 @@ func (l *Logger) ProxyRequest(method, host, path string, statusCode int, duratio
 		slog.Int("status_code", statusCode),
 		slog.Duration("duration", duration),
 		slog.String("user_agent", userAgent),
+		slog.String("client_ip", clientIP),
 	)
 }
 
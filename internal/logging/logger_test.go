@@ -1,14 +1,18 @@
 package logging
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -99,6 +103,26 @@ func TestLoggerWithComponent(t *testing.T) {
 	assert.NotEqual(t, logger, componentLogger)
 }
 
+func TestLoggerWithTunnel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &Logger{Logger: slog.New(slog.NewJSONHandler(&buf, nil)), config: DefaultConfig()}
+
+	// A recording tracer so the span context is valid
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(context.Background())
+	ctx, span := tp.Tracer("test").Start(context.Background(), "test-span")
+	defer span.End()
+
+	logger.WithComponent("tunnel").WithTunnel("myapp.local").WithContext(ctx).Info("request served")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "myapp.local", record["tunnel"])
+	assert.Equal(t, "tunnel", record["component"])
+	assert.Equal(t, span.SpanContext().TraceID().String(), record["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), record["span_id"])
+}
+
 func TestLoggerWithFields(t *testing.T) {
 	logger, err := New(DefaultConfig())
 	require.NoError(t, err)
@@ -161,7 +185,7 @@ func TestProxyRequestLogging(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	logger.ProxyRequest("GET", "test.local", "/api/health", 200, time.Millisecond*150, "Mozilla/5.0")
+	logger.ProxyRequest("GET", "test.local", "/api/health", 200, time.Millisecond*150, "Mozilla/5.0", "192.0.2.10")
 }
 
 func TestCertificateLogging(t *testing.T) {
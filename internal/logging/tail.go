@@ -0,0 +1,222 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is one JSON log record as written by a FormatJSON logger
+type Entry struct {
+	Time    string
+	Level   string
+	Message string
+	Tunnel  string
+	Attrs   map[string]any // Remaining fields
+}
+
+// ParseEntry decodes a JSON log line
+func ParseEntry(line []byte) (Entry, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return Entry{}, fmt.Errorf("not a JSON log line: %w", err)
+	}
+
+	take := func(key string) string {
+		v, ok := fields[key]
+		if !ok {
+			return ""
+		}
+		delete(fields, key)
+		if s, ok := v.(string); ok {
+			return s
+		}
+		return fmt.Sprint(v)
+	}
+
+	return Entry{
+		Time:    take("time"),
+		Level:   take("level"),
+		Message: take("msg"),
+		Tunnel:  take("tunnel"),
+		Attrs:   fields,
+	}, nil
+}
+
+// levelRank orders slog level names, including offsets such as "INFO+2"
+func levelRank(level string) int {
+	name, offset, _ := strings.Cut(strings.ToUpper(level), "+")
+	rank := 0
+	switch name {
+	case "DEBUG":
+		rank = -4
+	case "WARN", "WARNING":
+		rank = 4
+	case "ERROR":
+		rank = 8
+	}
+	var n int
+	if _, err := fmt.Sscan(offset, &n); err == nil {
+		rank += n
+	}
+	return rank
+}
+
+// Filter selects log entries by minimum level and tunnel
+type Filter struct {
+	Level  LogLevel // Minimum level; empty matches everything
+	Tunnel string   // Tunnel domain; empty matches every tunnel
+}
+
+// Match reports whether e passes the filter
+func (f Filter) Match(e Entry) bool {
+	if f.Level != "" && levelRank(e.Level) < levelRank(string(f.Level)) {
+		return false
+	}
+	if f.Tunnel != "" && e.Tunnel != f.Tunnel && !isBareMatch(f.Tunnel, e.Tunnel) {
+		return false
+	}
+	return true
+}
+
+// isBareMatch reports whether domain is the bare name plus a single TLD
+// label, so "myapp" matches myapp.local and myapp.test
+func isBareMatch(bare, domain string) bool {
+	if strings.Contains(bare, ".") {
+		return false
+	}
+	tld, ok := strings.CutPrefix(domain, bare+".")
+	return ok && tld != "" && !strings.Contains(tld, ".")
+}
+
+const (
+	colorReset  = "\033[0m"
+	colorGray   = "\033[90m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorBlue   = "\033[34m"
+	colorCyan   = "\033[36m"
+)
+
+// Format renders e as a single human-readable line, optionally colorized
+func (e Entry) Format(color bool) string {
+	paint := func(code, s string) string {
+		if !color || s == "" {
+			return s
+		}
+		return code + s + colorReset
+	}
+
+	levelColor := colorBlue
+	switch {
+	case levelRank(e.Level) >= levelRank("ERROR"):
+		levelColor = colorRed
+	case levelRank(e.Level) >= levelRank("WARN"):
+		levelColor = colorYellow
+	case levelRank(e.Level) < levelRank("INFO"):
+		levelColor = colorGray
+	}
+
+	ts := e.Time
+	if t, err := time.Parse(time.RFC3339Nano, e.Time); err == nil {
+		ts = t.Local().Format("15:04:05")
+	}
+
+	var b strings.Builder
+	b.WriteString(paint(colorGray, ts))
+	fmt.Fprintf(&b, " %s", paint(levelColor, fmt.Sprintf("%-5s", e.Level)))
+	if e.Tunnel != "" {
+		fmt.Fprintf(&b, " [%s]", paint(colorCyan, e.Tunnel))
+	}
+	fmt.Fprintf(&b, " %s", e.Message)
+
+	keys := make([]string, 0, len(e.Attrs))
+	for k := range e.Attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", paint(colorGray, k), e.Attrs[k])
+	}
+	return b.String()
+}
+
+// Follow calls fn with each line of the file at path, then keeps waiting for
+// new lines like tail -f until ctx is done. If the file is rotated (replaced
+// or truncated) it starts again from the top of the new file.
+func Follow(ctx context.Context, path string, poll time.Duration, fn func(line []byte)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer func() { file.Close() }()
+
+	reader := bufio.NewReader(file)
+	var partial []byte
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		offset += int64(len(line))
+		if err == nil {
+			fn(append(partial, line[:len(line)-1]...))
+			partial = nil
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read log file: %w", err)
+		}
+		// Hold on to a half-written line until the rest arrives
+		partial = append(partial, line...)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(poll):
+		}
+
+		rotated, err := wasRotated(file, path, offset)
+		if err != nil {
+			return err
+		}
+		if rotated {
+			next, err := os.Open(path)
+			if err != nil {
+				// The new file may not exist yet; try again next poll
+				continue
+			}
+			file.Close()
+			file = next
+			reader.Reset(file)
+			partial, offset = nil, 0
+		}
+	}
+}
+
+// wasRotated reports whether path no longer refers to file, or file was
+// truncated below what has been read
+func wasRotated(file *os.File, path string, offset int64) (bool, error) {
+	current, err := file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to stat log file: %w", err)
+	}
+	if current.Size() < offset {
+		return true, nil
+	}
+
+	latest, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil // Mid-rotation; keep the old file until a new one appears
+		}
+		return false, fmt.Errorf("failed to stat log file: %w", err)
+	}
+	return !os.SameFile(current, latest), nil
+}
@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleLog = `{"time":"2026-01-02T15:04:05Z","level":"DEBUG","msg":"Proxy request","tunnel":"myapp.local","status_code":200}
+{"time":"2026-01-02T15:04:06Z","level":"INFO","msg":"Tunnel started","tunnel":"myapp.local","port":3000}
+{"time":"2026-01-02T15:04:07Z","level":"WARN","msg":"Backend request failed","tunnel":"api.local"}
+{"time":"2026-01-02T15:04:08Z","level":"ERROR","msg":"Tunnel error occurred","tunnel":"myapp.local"}
+{"time":"2026-01-02T15:04:09Z","level":"INFO","msg":"DNS server initialized successfully"}
+`
+
+func readSample(t *testing.T, filter Filter) []string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "gotunnel.log")
+	require.NoError(t, os.WriteFile(path, []byte(sampleLog), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Stop at the end of the file
+
+	var messages []string
+	err := Follow(ctx, path, time.Millisecond, func(line []byte) {
+		entry, err := ParseEntry(line)
+		require.NoError(t, err)
+		if filter.Match(entry) {
+			messages = append(messages, entry.Message)
+		}
+	})
+	require.NoError(t, err)
+	return messages
+}
+
+func TestFilterByLevel(t *testing.T) {
+	tests := []struct {
+		level LogLevel
+		want  []string
+	}{
+		{"", []string{"Proxy request", "Tunnel started", "Backend request failed", "Tunnel error occurred", "DNS server initialized successfully"}},
+		{LevelInfo, []string{"Tunnel started", "Backend request failed", "Tunnel error occurred", "DNS server initialized successfully"}},
+		{LevelWarn, []string{"Backend request failed", "Tunnel error occurred"}},
+		{LevelError, []string{"Tunnel error occurred"}},
+	}
+
+	for _, tt := range tests {
+		name := string(tt.level)
+		if name == "" {
+			name = "all"
+		}
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, readSample(t, Filter{Level: tt.level}))
+		})
+	}
+}
+
+func TestFilterByTunnel(t *testing.T) {
+	assert.Equal(t, []string{"Tunnel started", "Tunnel error occurred"},
+		readSample(t, Filter{Level: LevelInfo, Tunnel: "myapp"}))
+	assert.Equal(t, []string{"Backend request failed"},
+		readSample(t, Filter{Tunnel: "api.local"}))
+}
+
+func TestFilterBareNameMatchesAnyTLD(t *testing.T) {
+	f := Filter{Tunnel: "myapp"}
+	assert.True(t, f.Match(Entry{Tunnel: "myapp.test"}))
+	assert.True(t, f.Match(Entry{Tunnel: "myapp.local"}))
+	assert.False(t, f.Match(Entry{Tunnel: "myapp.api.test"}))
+	assert.False(t, f.Match(Entry{Tunnel: "myapp2.test"}))
+	assert.False(t, Filter{Tunnel: "myapp.local"}.Match(Entry{Tunnel: "myapp.test"}))
+}
+
+func TestParseEntry(t *testing.T) {
+	entry, err := ParseEntry([]byte(`{"time":"2026-01-02T15:04:06Z","level":"INFO","msg":"Tunnel started","tunnel":"myapp.local","port":3000}`))
+	require.NoError(t, err)
+	assert.Equal(t, "INFO", entry.Level)
+	assert.Equal(t, "Tunnel started", entry.Message)
+	assert.Equal(t, "myapp.local", entry.Tunnel)
+	assert.Equal(t, map[string]any{"port": float64(3000)}, entry.Attrs)
+
+	plain := entry.Format(false)
+	assert.Contains(t, plain, "INFO  [myapp.local] Tunnel started port=3000")
+	assert.NotContains(t, plain, "\033[")
+	assert.Contains(t, entry.Format(true), "\033[")
+
+	_, err = ParseEntry([]byte("time=2026-01-02 level=INFO msg=text"))
+	assert.Error(t, err)
+}
+
+func TestFollowAppendsAndRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gotunnel.log")
+	require.NoError(t, os.WriteFile(path, []byte("first\n"), 0644))
+
+	var (
+		mu    sync.Mutex
+		lines []string
+	)
+	got := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Join(lines, ",")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Follow(ctx, path, 10*time.Millisecond, func(line []byte) {
+			mu.Lock()
+			lines = append(lines, string(line))
+			mu.Unlock()
+		})
+	}()
+
+	assert.Eventually(t, func() bool { return got() == "first" }, time.Second, 10*time.Millisecond)
+
+	// Appended lines, including one written in two pieces
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("second\nthi")
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+	_, err = f.WriteString("rd\n")
+	require.NoError(t, err)
+	f.Close()
+	assert.Eventually(t, func() bool { return got() == "first,second,third" }, time.Second, 10*time.Millisecond)
+
+	// Rotation: the old file is moved away and a new one takes its place
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, os.WriteFile(path, []byte("rotated\n"), 0644))
+	assert.Eventually(t, func() bool { return got() == "first,second,third,rotated" }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// AccessLogEntry describes a completed request
+type AccessLogEntry struct {
+	Status   int
+	Bytes    int64 // Response body bytes written
+	Duration time.Duration
+}
+
+// AccessLog returns a middleware that calls record once each request has been
+// served
+func AccessLog(record func(r *http.Request, entry AccessLogEntry)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+			record(r, AccessLogEntry{Status: rec.status, Bytes: rec.bytes, Duration: time.Since(start)})
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	var entries []AccessLogEntry
+	var paths []string
+	handler := AccessLog(func(r *http.Request, entry AccessLogEntry) {
+		paths = append(paths, r.URL.Path)
+		entries = append(entries, entry)
+	})(backend)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/items", nil))
+
+	require.Len(t, entries, 1)
+	assert.Equal(t, []string{"/items"}, paths)
+	assert.Equal(t, http.StatusCreated, entries[0].Status)
+	assert.Equal(t, int64(len("created")), entries[0].Bytes)
+	assert.Equal(t, "created", rec.Body.String())
+}
+
+func TestAccessLogDefaultsToOK(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	var status int
+	handler := AccessLog(func(r *http.Request, entry AccessLogEntry) {
+		status = entry.Status
+	})(backend)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, status)
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasicAuth(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	})
+	handler := BasicAuth("gotunnel", "dev", "hunter2")(backend)
+
+	tests := []struct {
+		name       string
+		user, pass string
+		setAuth    bool
+		wantStatus int
+	}{
+		{"no credentials", "", "", false, http.StatusUnauthorized},
+		{"wrong password", "dev", "nope", true, http.StatusUnauthorized},
+		{"wrong user", "admin", "hunter2", true, http.StatusUnauthorized},
+		{"valid", "dev", "hunter2", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.setAuth {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Basic realm="gotunnel", charset="UTF-8"`, rec.Header().Get("WWW-Authenticate"))
+				assert.NotContains(t, rec.Body.String(), "secret")
+			} else {
+				assert.Equal(t, "secret", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("hello gotunnel ", 100)
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1500")
+		w.Write([]byte(body))
+	})
+	handler := Compress()(backend)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Empty(t, rec.Header().Get("Content-Length"))
+	assert.Contains(t, rec.Header().Values("Vary"), "Accept-Encoding")
+	assert.Less(t, rec.Body.Len(), len(body))
+
+	gz, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+}
+
+func TestCompressPassThrough(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		upgrade        string
+		backendEncoded bool
+	}{
+		{"client doesn't accept gzip", "br", "", false},
+		{"gzip refused with q=0", "gzip;q=0", "", false},
+		{"protocol upgrade", "gzip", "websocket", false},
+		{"already encoded", "gzip", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.backendEncoded {
+					w.Header().Set("Content-Encoding", "br")
+				}
+				w.Write([]byte("plain"))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			if tt.upgrade != "" {
+				req.Header.Set("Upgrade", tt.upgrade)
+			}
+			rec := httptest.NewRecorder()
+			Compress()(backend).ServeHTTP(rec, req)
+
+			assert.NotEqual(t, "gzip", rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, "plain", rec.Body.String())
+		})
+	}
+}
+
+func TestCompressSkipsBodylessResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		status int
+		body   string
+	}{
+		{"HEAD", http.MethodHead, http.StatusOK, "plain"},
+		{"no content", http.MethodGet, http.StatusNoContent, ""},
+		{"not modified", http.MethodGet, http.StatusNotModified, ""},
+		{"empty body", http.MethodGet, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				if r.Method != http.MethodHead {
+					w.Write([]byte(tt.body))
+				}
+			})
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			Compress()(backend).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Empty(t, rec.Header().Get("Content-Encoding"))
+			assert.Zero(t, rec.Body.Len(), "no gzip footer")
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Default values applied when a CORSConfig leaves them empty
+var (
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	DefaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", "X-Requested-With"}
+)
+
+// CORSConfig holds the cross-origin settings for a tunnel
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins" json:"allowed_origins"` // "*" allows any origin
+	AllowedMethods   []string `yaml:"allowed_methods" json:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers" json:"allowed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials" json:"allow_credentials"`
+	MaxAge           int      `yaml:"max_age" json:"max_age"` // Preflight cache duration in seconds
+}
+
+// Validate checks the configuration for unsupported combinations
+func (c *CORSConfig) Validate() error {
+	if len(c.AllowedOrigins) == 0 {
+		return errors.New("at least one CORS origin is required")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" && c.AllowCredentials {
+			// Browsers reject credentialed responses with a wildcard origin
+			return errors.New("wildcard CORS origin cannot be combined with credentials")
+		}
+	}
+	return nil
+}
+
+// CORS returns a middleware that answers preflight requests and adds
+// Access-Control-* headers to responses for allowed origins.
+// The config is expected to have passed Validate.
+func CORS(config CORSConfig) Middleware {
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	headers := config.AllowedHeaders
+	if len(headers) == 0 {
+		headers = DefaultCORSHeaders
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, wildcard := config.matchOrigin(origin)
+			w.Header().Add("Vary", "Origin")
+			if !allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cors := make(http.Header)
+			if wildcard {
+				cors.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				cors.Set("Access-Control-Allow-Origin", origin)
+			}
+			if config.AllowCredentials {
+				cors.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			// Preflight requests are answered here and never reach the backend
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				copyHeaders(w.Header(), cors)
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				if config.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			// Applied over the backend's own, once it has set them
+			cw := &corsResponseWriter{ResponseWriter: w, cors: cors}
+			next.ServeHTTP(cw, r)
+			if !cw.wroteHeader {
+				copyHeaders(w.Header(), cors)
+			}
+		})
+	}
+}
+
+// copyHeaders sets each of src's headers on dst, replacing any values
+// dst already has
+func copyHeaders(dst, src http.Header) {
+	for key, values := range src {
+		dst[key] = values
+	}
+}
+
+// corsResponseWriter sets the CORS headers when the response header is
+// written, replacing any the backend sent so none is duplicated
+type corsResponseWriter struct {
+	http.ResponseWriter
+	cors        http.Header
+	wroteHeader bool
+}
+
+func (w *corsResponseWriter) WriteHeader(status int) {
+	// Informational responses come before the real header
+	if !w.wroteHeader && (status >= http.StatusOK || status == http.StatusSwitchingProtocols) {
+		w.wroteHeader = true
+		copyHeaders(w.Header(), w.cors)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *corsResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working through the writer
+func (w *corsResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *corsResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// matchOrigin reports whether the origin is allowed and whether it matched the wildcard
+func (c *CORSConfig) matchOrigin(origin string) (allowed bool, wildcard bool) {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			return true, true
+		}
+		if strings.EqualFold(o, origin) {
+			return true, false
+		}
+	}
+	return false, false
+}
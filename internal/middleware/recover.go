@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// ErrPanic is wrapped by the errors Recover reports
+var ErrPanic = errors.New("handler panicked")
+
+// Recover returns a middleware that turns a panic in the wrapped handler into
+// a 500 response, calling report with the panic and its stack trace. If the
+// response has already started it can't be replaced, so the connection is
+// aborted instead. http.ErrAbortHandler is passed through untouched, as it's
+// how handlers deliberately abort a response.
+func Recover(report func(r *http.Request, err error, stack []byte)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := newResponseRecorder(w)
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				err := fmt.Errorf("%w: %v", ErrPanic, v)
+				if e, ok := v.(error); ok {
+					err = fmt.Errorf("%w: %w", ErrPanic, e)
+				}
+				report(r, err, debug.Stack())
+
+				if rec.wroteHeader {
+					panic(http.ErrAbortHandler)
+				}
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
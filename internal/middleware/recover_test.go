@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecover(t *testing.T) {
+	var reported []error
+	var stacks [][]byte
+	handler := Recover(func(r *http.Request, err error, stack []byte) {
+		reported = append(reported, err)
+		stacks = append(stacks, stack)
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/panic")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	require.Len(t, reported, 1)
+	assert.ErrorIs(t, reported[0], ErrPanic)
+	assert.ErrorContains(t, reported[0], "boom")
+	assert.Contains(t, string(stacks[0]), "recover_test.go")
+
+	// The server is still up
+	resp, err = http.Get(server.URL + "/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+}
+
+func TestRecoverWrapsPanickedError(t *testing.T) {
+	cause := errors.New("nil map")
+	var reported error
+	handler := Recover(func(r *http.Request, err error, stack []byte) {
+		reported = err
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(cause)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.ErrorIs(t, reported, cause)
+}
+
+func TestRecoverPassesAbortHandlerThrough(t *testing.T) {
+	handler := Recover(func(r *http.Request, err error, stack []byte) {
+		t.Error("ErrAbortHandler should not be reported")
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
+
+func TestRecoverAbortsStartedResponse(t *testing.T) {
+	handler := Recover(func(r *http.Request, err error, stack []byte) {})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("partial"))
+			panic("boom")
+		}))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans Trace creates
+const tracerName = "github.com/johncferguson/gotunnel/internal/middleware"
+
+// Trace returns a middleware that serves each request inside a server span
+// recording its method, host, path and status. Trace context in the request
+// headers (e.g. from an instrumented browser or upstream service) becomes the
+// span's parent, and the span's own context replaces it in the headers so an
+// instrumented backend continues the same trace.
+//
+// A nil provider or propagator uses the global one, which the observability
+// package installs and which does nothing until tracing is set up. attrs are
+// added to every span, e.g. the tunnel's domain.
+func Trace(provider trace.TracerProvider, propagator propagation.TextMapPropagator, attrs ...attribute.KeyValue) Middleware {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+	tracer := provider.Tracer(tracerName)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.ServerAddress(host),
+					semconv.URLPath(r.URL.Path),
+					semconv.URLScheme(scheme),
+				),
+				trace.WithAttributes(attrs...),
+			)
+			defer span.End()
+
+			r = r.WithContext(ctx)
+			r.Header = r.Header.Clone()
+			propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rec.status))
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestTracing(t *testing.T) (*tracetest.InMemoryExporter, trace.TracerProvider) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return exporter, provider
+}
+
+func spanAttrs(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTrace(t *testing.T) {
+	exporter, provider := newTestTracing(t)
+
+	var backendTraceparents []string
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendTraceparents = append(backendTraceparents, r.Header.Get("traceparent"))
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler := Trace(provider, propagation.TraceContext{}, attribute.String("tunnel.domain", "app.local"))(backend)
+
+	// An incoming traceparent becomes the parent of the request's span
+	const parentTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentSpanID = "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodPost, "http://app.local:8080/items", nil)
+	req.Header.Set("traceparent", "00-"+parentTraceID+"-"+parentSpanID+"-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://app.local/fail", nil))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2, "one span per request")
+
+	span := spans[0]
+	assert.Equal(t, "POST", span.Name)
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+	assert.Equal(t, parentTraceID, span.SpanContext.TraceID().String())
+	assert.Equal(t, parentSpanID, span.Parent.SpanID().String())
+	assert.True(t, span.Parent.IsRemote())
+	attrs := spanAttrs(span)
+	assert.Equal(t, "POST", attrs["http.request.method"].AsString())
+	assert.Equal(t, "app.local", attrs["server.address"].AsString())
+	assert.Equal(t, "/items", attrs["url.path"].AsString())
+	assert.Equal(t, int64(http.StatusCreated), attrs["http.response.status_code"].AsInt64())
+	assert.Equal(t, "app.local", attrs["tunnel.domain"].AsString())
+	assert.Equal(t, codes.Unset, span.Status.Code)
+
+	// Each request's span is the backend's parent, so the trace continues
+	traceparent := func(span tracetest.SpanStub) string {
+		return "00-" + span.SpanContext.TraceID().String() + "-" + span.SpanContext.SpanID().String() + "-01"
+	}
+	assert.Equal(t, []string{traceparent(spans[0]), traceparent(spans[1])}, backendTraceparents)
+	assert.Equal(t, "00-"+parentTraceID+"-"+parentSpanID+"-01", req.Header.Get("traceparent"), "the caller's request is left alone")
+
+	failed := spans[1]
+	assert.False(t, failed.Parent.IsValid(), "no incoming trace context starts a new trace")
+	assert.Equal(t, int64(http.StatusBadGateway), spanAttrs(failed)["http.response.status_code"].AsInt64())
+	assert.Equal(t, codes.Error, failed.Status.Code)
+}
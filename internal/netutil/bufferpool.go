@@ -0,0 +1,59 @@
+package netutil
+
+import "sync"
+
+// DefaultBufferSize matches the buffer httputil.ReverseProxy allocates per
+// copy when it has no BufferPool
+const DefaultBufferSize = 32 * 1024
+
+// BufferPool recycles copy buffers between reverse proxy requests. It
+// implements httputil.BufferPool and is safe for concurrent use.
+type BufferPool struct {
+	size int
+	pool sync.Pool // *[]byte holding a buffer
+
+	// headers recycles the *[]byte wrappers Get empties, so Put can hand a
+	// buffer back without allocating a new one
+	headers sync.Pool
+}
+
+// NewBufferPool returns a pool of size-byte buffers; size <= 0 means
+// DefaultBufferSize
+func NewBufferPool(size int) *BufferPool {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	p := &BufferPool{size: size}
+	p.pool.New = func() any {
+		b := make([]byte, size)
+		return &b
+	}
+	return p
+}
+
+// Size returns the length of the buffers the pool hands out
+func (p *BufferPool) Size() int {
+	return p.size
+}
+
+// Get returns a buffer of Size bytes
+func (p *BufferPool) Get() []byte {
+	h := p.pool.Get().(*[]byte)
+	b := *h
+	*h = nil
+	p.headers.Put(h)
+	return b
+}
+
+// Put returns b to the pool. Buffers of another size are dropped.
+func (p *BufferPool) Put(b []byte) {
+	if len(b) != p.size {
+		return
+	}
+	h, _ := p.headers.Get().(*[]byte)
+	if h == nil {
+		h = new([]byte)
+	}
+	*h = b
+	p.pool.Put(h)
+}
@@ -0,0 +1,21 @@
+// Package netutil holds small networking helpers shared across gotunnel
+package netutil
+
+import (
+	"fmt"
+	"net"
+)
+
+// FreePort asks the OS for an unused loopback TCP port.
+//
+// The port is released before FreePort returns, so another process can grab
+// it before the caller binds. Callers should bind to it immediately and treat
+// a bind failure as retryable.
+func FreePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,36 @@
+package netutil
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreePort(t *testing.T) {
+	port, err := FreePort()
+	require.NoError(t, err)
+	assert.Greater(t, port, 0)
+
+	// The port is usable straight away
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	require.NoError(t, err)
+	l.Close()
+}
+
+func TestFreePortDistinct(t *testing.T) {
+	// Hold each port open so the OS can't hand it out twice
+	seen := make(map[int]bool)
+	for i := 0; i < 10; i++ {
+		port, err := FreePort()
+		require.NoError(t, err)
+		assert.False(t, seen[port], "port %d returned twice", port)
+		seen[port] = true
+
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		require.NoError(t, err)
+		defer l.Close()
+	}
+}
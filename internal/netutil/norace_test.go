@@ -0,0 +1,6 @@
+//go:build !race
+
+package netutil
+
+// raceEnabled is set when tests run under the race detector
+const raceEnabled = false
@@ -0,0 +1,208 @@
+package netutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidProxyHeader is returned when a connection doesn't start with a
+// well-formed PROXY protocol header
+var ErrInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// ProxyHeaderTimeout bounds how long a connection may take to send its
+// PROXY protocol header
+const ProxyHeaderTimeout = 5 * time.Second
+
+const proxyV1MaxLen = 107 // Longest v1 header, CRLF included, per the spec
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// NewProxyProtocolListener wraps l so every accepted connection must start
+// with a PROXY protocol (v1 text or v2 binary) header, as sent by load
+// balancers such as HAProxy. The header is consumed and RemoteAddr reports
+// the client it names. Connections with a missing or malformed header are
+// closed and fail their first read with ErrInvalidProxyHeader.
+//
+// The header is parsed on the connection's first Read or RemoteAddr call,
+// so a slow client never holds up Accept.
+func NewProxyProtocolListener(l net.Listener) net.Listener {
+	return &proxyProtoListener{Listener: l}
+}
+
+type proxyProtoListener struct {
+	net.Listener
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtoConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyProtoConn strips the PROXY header off the front of Conn
+type proxyProtoConn struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	remote net.Addr // Source named by the header; nil for LOCAL/UNKNOWN
+	err    error
+}
+
+func (c *proxyProtoConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(ProxyHeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyProtoConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// RemoteAddr returns the client named by the PROXY header, or the peer's
+// own address if the header carried none
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader consumes a v1 or v2 header from r and returns the source
+// address it carries
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	start, err := r.Peek(5)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProxyHeader, err)
+	}
+	switch {
+	case string(start) == "PROXY":
+		return readProxyV1(r)
+	case bytes.Equal(start, proxyV2Signature[:5]):
+		return readProxyV2(r)
+	default:
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidProxyHeader)
+	}
+}
+
+// readProxyV1 parses "PROXY TCP4|TCP6 src dst srcport dstport\r\n", or
+// "PROXY UNKNOWN ...\r\n" which names no client
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLen {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidProxyHeader, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: v1 header not terminated by CRLF within %d bytes", ErrInvalidProxyHeader, proxyV1MaxLen)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if fields[0] == "PROXY" && len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if fields[0] != "PROXY" || len(fields) != 6 {
+		return nil, fmt.Errorf("%w: malformed v1 header %q", ErrInvalidProxyHeader, line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil || net.ParseIP(fields[3]) == nil {
+		return nil, fmt.Errorf("%w: bad v1 address in %q", ErrInvalidProxyHeader, line)
+	}
+	switch fields[1] {
+	case "TCP4":
+		if ip.To4() == nil {
+			return nil, fmt.Errorf("%w: TCP4 header carries IPv6 address %s", ErrInvalidProxyHeader, fields[2])
+		}
+	case "TCP6":
+	default:
+		return nil, fmt.Errorf("%w: bad v1 protocol %q", ErrInvalidProxyHeader, fields[1])
+	}
+	port, err := parseProxyPort(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseProxyPort(fields[5]); err != nil {
+		return nil, err
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func parseProxyPort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 0 || port > 65535 || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf("%w: bad v1 port %q", ErrInvalidProxyHeader, s)
+	}
+	return port, nil
+}
+
+// readProxyV2 parses the binary header: signature, version/command,
+// family/transport, address length, then the addresses and any TLVs
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProxyHeader, err)
+	}
+	if !bytes.Equal(header[:12], proxyV2Signature) {
+		return nil, fmt.Errorf("%w: bad v2 signature", ErrInvalidProxyHeader)
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidProxyHeader, header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	if command > 1 {
+		return nil, fmt.Errorf("%w: unsupported v2 command %d", ErrInvalidProxyHeader, command)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProxyHeader, err)
+	}
+
+	// LOCAL connections (e.g. the balancer's own health checks) and
+	// non-TCP families keep the peer's address
+	if command == 0 {
+		return nil, nil
+	}
+	var ipLen int
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		ipLen = net.IPv4len
+	case 0x21: // TCP over IPv6
+		ipLen = net.IPv6len
+	default:
+		return nil, nil
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, fmt.Errorf("%w: v2 address block too short", ErrInvalidProxyHeader)
+	}
+	ip := net.IP(bytes.Clone(payload[:ipLen]))
+	port := int(binary.BigEndian.Uint16(payload[2*ipLen:]))
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
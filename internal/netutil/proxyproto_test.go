@@ -0,0 +1,114 @@
+package netutil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func proxyV2Header(command, family byte, addrs []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	v4 := []byte{192, 0, 2, 7, 10, 0, 0, 1, 0xd4, 0x31, 0x00, 0x50}
+	v6 := make([]byte, 36)
+	v6[0], v6[1], v6[15] = 0x20, 0x01, 0x09
+	binary.BigEndian.PutUint16(v6[32:], 4242)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string // "" when the peer's own address is kept
+		wantErr bool
+	}{
+		{"v1 TCP4", "PROXY TCP4 192.0.2.7 10.0.0.1 54321 80\r\n", "192.0.2.7:54321", false},
+		{"v1 TCP6", "PROXY TCP6 2001:db8::1 ::1 4242 443\r\n", "[2001:db8::1]:4242", false},
+		{"v1 UNKNOWN", "PROXY UNKNOWN\r\n", "", false},
+		{"v2 TCP4", string(proxyV2Header(1, 0x11, v4)), "192.0.2.7:54321", false},
+		{"v2 TCP6", string(proxyV2Header(1, 0x21, v6)), "[2001::9]:4242", false},
+		{"v2 LOCAL", string(proxyV2Header(0, 0x00, nil)), "", false},
+		{"no header", "GET / HTTP/1.1\r\n", "", true},
+		{"v1 missing CRLF", "PROXY TCP4 192.0.2.7 10.0.0.1 54321 80\n", "", true},
+		{"v1 too long", "PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n", "", true},
+		{"v1 bad address", "PROXY TCP4 192.0.2 10.0.0.1 54321 80\r\n", "", true},
+		{"v1 family mismatch", "PROXY TCP4 2001:db8::1 ::1 4242 443\r\n", "", true},
+		{"v1 bad port", "PROXY TCP4 192.0.2.7 10.0.0.1 70000 80\r\n", "", true},
+		{"v1 missing field", "PROXY TCP4 192.0.2.7 10.0.0.1 54321\r\n", "", true},
+		{"v2 bad version", string(append(append([]byte{}, proxyV2Signature...), 0x11, 0x11, 0, 0)), "", true},
+		{"v2 short addresses", string(proxyV2Header(1, 0x11, v4[:6])), "", true},
+		{"truncated", "PRO", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := readProxyHeader(bufio.NewReader(strings.NewReader(tt.input)))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidProxyHeader)
+				return
+			}
+			require.NoError(t, err)
+			if tt.want == "" {
+				assert.Nil(t, addr)
+			} else {
+				require.NotNil(t, addr)
+				assert.Equal(t, tt.want, addr.String())
+			}
+		})
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l := NewProxyProtocolListener(raw)
+	defer l.Close()
+
+	send := func(payload string) net.Conn {
+		client, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		_, err = client.Write([]byte(payload))
+		require.NoError(t, err)
+		return client
+	}
+
+	t.Run("header is stripped", func(t *testing.T) {
+		client := send("PROXY TCP4 203.0.113.9 10.0.0.1 40000 80\r\nhello")
+		defer client.Close()
+
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		assert.Equal(t, "203.0.113.9:40000", conn.RemoteAddr().String())
+		data := make([]byte, 5)
+		_, err = io.ReadFull(conn, data)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+	})
+
+	t.Run("malformed header closes the connection", func(t *testing.T) {
+		client := send("GET / HTTP/1.1\r\n\r\n")
+		defer client.Close()
+
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, ErrInvalidProxyHeader)
+		assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+
+		_, err = client.Read(make([]byte, 1))
+		assert.Error(t, err, "client sees the connection closed")
+	})
+}
@@ -0,0 +1,34 @@
+package netutil
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Default reverse-proxy transport settings; see NewTransport
+const (
+	DefaultMaxIdleConns          = 100
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultExpectContinueTimeout = 1 * time.Second
+)
+
+// NewTransport returns the transport gotunnel proxies requests through when
+// the caller doesn't supply one. It dials with dial (a plain net.Dialer if
+// nil) and, unlike http.DefaultTransport, ignores HTTP_PROXY and friends:
+// backends are local, so an environment proxy would only get in the way.
+func NewTransport(dial func(ctx context.Context, network, addr string) (net.Conn, error)) *http.Transport {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	return &http.Transport{
+		DialContext:           dial,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          DefaultMaxIdleConns,
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		TLSHandshakeTimeout:   DefaultTLSHandshakeTimeout,
+		ExpectContinueTimeout: DefaultExpectContinueTimeout,
+	}
+}
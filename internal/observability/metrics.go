@@ -3,6 +3,7 @@ package observability
 import (
 	"context"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -16,7 +17,9 @@ type Metrics struct {
 	// Tunnel metrics
 	tunnelCount     metric.Int64Counter
 	tunnelDuration  metric.Float64Histogram
-	activeTunnels   metric.Int64UpDownCounter
+	activeTunnels   metric.Int64ObservableGauge
+	tunnelBytes     metric.Int64ObservableCounter
+	badGateways     metric.Int64ObservableCounter
 
 	// HTTP proxy metrics
 	requestCount    metric.Int64Counter
@@ -28,8 +31,12 @@ type Metrics struct {
 	certExpiry      metric.Float64Gauge
 	certGeneration  metric.Int64Counter
 
+	// DNS metrics
+	dnsRegistration metric.Float64Histogram
+
 	// Error metrics
 	errorCount      metric.Int64Counter
+	errorsRecorded  atomic.Int64 // Mirrors errorCount for ErrorsRecorded
 
 	// System metrics
 	memoryUsage     metric.Int64UpDownCounter
@@ -57,7 +64,8 @@ func NewMetrics(provider *Provider) (*Metrics, error) {
 		return nil, err
 	}
 
-	activeTunnels, err := meter.Int64UpDownCounter(
+	// Observed from the tunnel manager; see ObserveActiveTunnels
+	activeTunnels, err := meter.Int64ObservableGauge(
 		"gotunnel.tunnels.active",
 		metric.WithDescription("Number of currently active tunnels"),
 	)
@@ -65,6 +73,25 @@ func NewMetrics(provider *Provider) (*Metrics, error) {
 		return nil, err
 	}
 
+	// Observed from the tunnel manager; see ObserveTunnelBytes
+	tunnelBytes, err := meter.Int64ObservableCounter(
+		"gotunnel.tunnel.bytes",
+		metric.WithDescription("Bytes forwarded through each tunnel, by direction"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Observed from the tunnel manager; see ObserveBadGateways
+	badGateways, err := meter.Int64ObservableCounter(
+		"gotunnel.tunnel.bad_gateways",
+		metric.WithDescription("Requests answered with a 502 error page because the backend failed"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	requestCount, err := meter.Int64Counter(
 		"gotunnel.http.requests.total",
 		metric.WithDescription("Total number of HTTP requests proxied"),
@@ -117,6 +144,15 @@ func NewMetrics(provider *Provider) (*Metrics, error) {
 		return nil, err
 	}
 
+	dnsRegistration, err := meter.Float64Histogram(
+		"gotunnel.dns.registration.duration",
+		metric.WithDescription("Time taken to make a tunnel domain resolvable, by mDNS or hosts file"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	errorCount, err := meter.Int64Counter(
 		"gotunnel.errors.total",
 		metric.WithDescription("Total number of errors by type"),
@@ -139,12 +175,15 @@ func NewMetrics(provider *Provider) (*Metrics, error) {
 		tunnelCount:     tunnelCount,
 		tunnelDuration:  tunnelDuration,
 		activeTunnels:   activeTunnels,
+		tunnelBytes:     tunnelBytes,
+		badGateways:     badGateways,
 		requestCount:    requestCount,
 		requestDuration: requestDuration,
 		requestSize:     requestSize,
 		responseSize:    responseSize,
 		certExpiry:      certExpiry,
 		certGeneration:  certGeneration,
+		dnsRegistration: dnsRegistration,
 		errorCount:      errorCount,
 		memoryUsage:     memoryUsage,
 	}, nil
@@ -160,7 +199,6 @@ func (m *Metrics) TunnelCreated(ctx context.Context, domain string, port int, ht
 	}
 
 	m.tunnelCount.Add(ctx, 1, metric.WithAttributes(attrs...))
-	m.activeTunnels.Add(ctx, 1, metric.WithAttributes(attrs...))
 
 	// Log the event
 	m.provider.Logger().InfoContext(ctx, "Tunnel created",
@@ -176,7 +214,6 @@ func (m *Metrics) TunnelDestroyed(ctx context.Context, domain string, duration t
 	}
 
 	m.tunnelDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(attrs...))
-	m.activeTunnels.Add(ctx, -1, metric.WithAttributes(attrs...))
 
 	// Log the event
 	m.provider.Logger().InfoContext(ctx, "Tunnel destroyed",
@@ -185,6 +222,46 @@ func (m *Metrics) TunnelDestroyed(ctx context.Context, domain string, duration t
 	)
 }
 
+// ObserveActiveTunnels reports count() as the active tunnel gauge on every
+// collection, so the gauge can't drift from the tunnels actually running
+func (m *Metrics) ObserveActiveTunnels(count func() int) (metric.Registration, error) {
+	return m.provider.Meter().RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(m.activeTunnels, int64(count()))
+		return nil
+	}, m.activeTunnels)
+}
+
+// TunnelBytes is a running tunnel's byte totals since it started
+type TunnelBytes struct {
+	Domain string
+	In     int64 // Client to backend
+	Out    int64 // Backend to client
+}
+
+// ObserveTunnelBytes reports the totals from totals() as the per-tunnel byte
+// counter, with a direction attribute of "in" or "out", on every collection
+func (m *Metrics) ObserveTunnelBytes(totals func() []TunnelBytes) (metric.Registration, error) {
+	return m.provider.Meter().RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, t := range totals() {
+			domain := attribute.String("domain", t.Domain)
+			o.ObserveInt64(m.tunnelBytes, t.In, metric.WithAttributes(domain, attribute.String("direction", "in")))
+			o.ObserveInt64(m.tunnelBytes, t.Out, metric.WithAttributes(domain, attribute.String("direction", "out")))
+		}
+		return nil
+	}, m.tunnelBytes)
+}
+
+// ObserveBadGateways reports totals(), keyed by tunnel domain, as the
+// per-tunnel bad gateway counter on every collection
+func (m *Metrics) ObserveBadGateways(totals func() map[string]int64) (metric.Registration, error) {
+	return m.provider.Meter().RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for domain, count := range totals() {
+			o.ObserveInt64(m.badGateways, count, metric.WithAttributes(attribute.String("domain", domain)))
+		}
+		return nil
+	}, m.badGateways)
+}
+
 // HTTP Proxy Metrics
 
 func (m *Metrics) HTTPRequest(ctx context.Context, method, path string, statusCode int, requestSize, responseSize int64, duration time.Duration) {
@@ -228,6 +305,20 @@ func (m *Metrics) CertificateExpiry(ctx context.Context, domain string, daysUnti
 	m.certExpiry.Record(ctx, daysUntilExpiry, metric.WithAttributes(attrs...))
 }
 
+// DNS Metrics
+
+// DNSRegistration records how long making domain resolvable took, by method
+// ("mdns" or "hosts")
+func (m *Metrics) DNSRegistration(ctx context.Context, method, domain string, duration time.Duration, err error) {
+	attrs := []attribute.KeyValue{
+		attribute.String("method", method),
+		attribute.String("domain", domain),
+		attribute.Bool("success", err == nil),
+	}
+
+	m.dnsRegistration.Record(ctx, duration.Seconds(), metric.WithAttributes(attrs...))
+}
+
 // Error Metrics
 
 func (m *Metrics) RecordError(ctx context.Context, errorType, operation string, err error) {
@@ -237,6 +328,7 @@ func (m *Metrics) RecordError(ctx context.Context, errorType, operation string,
 	}
 
 	m.errorCount.Add(ctx, 1, metric.WithAttributes(attrs...))
+	m.errorsRecorded.Add(1)
 
 	// Send to Sentry
 	m.provider.CaptureError(ctx, err, map[string]string{
@@ -252,6 +344,11 @@ func (m *Metrics) RecordError(ctx context.Context, errorType, operation string,
 	)
 }
 
+// ErrorsRecorded returns how many errors RecordError has seen in this process
+func (m *Metrics) ErrorsRecorded() int64 {
+	return m.errorsRecorded.Load()
+}
+
 // System Metrics
 
 func (m *Metrics) UpdateMemoryUsage(ctx context.Context, bytes int64) {
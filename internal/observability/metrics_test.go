@@ -2,12 +2,17 @@ package observability
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 )
 
 func TestNewMetrics(t *testing.T) {
@@ -111,6 +116,7 @@ func TestErrorMetrics(t *testing.T) {
 	metrics.RecordError(ctx, "network_error", "tunnel_start", testErr)
 	metrics.RecordError(ctx, "permission_error", "cert_install", testErr)
 	metrics.RecordError(ctx, "validation_error", "config_load", testErr)
+	assert.Equal(t, int64(3), metrics.ErrorsRecorded())
 
 	// Cleanup
 	err = provider.Shutdown(ctx)
@@ -163,4 +169,180 @@ func TestMemoryMetrics(t *testing.T) {
 	// Cleanup
 	err = provider.Shutdown(ctx)
 	assert.NoError(t, err)
-}
\ No newline at end of file
+}
+// collectGauge reads the current value of an int64 gauge from reader
+func collectGauge(t *testing.T, reader *sdkmetric.ManualReader, name string) (int64, bool) {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			gauge, ok := m.Data.(metricdata.Gauge[int64])
+			require.True(t, ok, "%s is not an int64 gauge", name)
+			require.Len(t, gauge.DataPoints, 1)
+			return gauge.DataPoints[0].Value, true
+		}
+	}
+	return 0, false
+}
+
+func TestActiveTunnelsGauge(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer otel.SetMeterProvider(previous)
+
+	config := DefaultConfig()
+	provider, err := NewProvider(config)
+	require.NoError(t, err)
+	defer provider.Shutdown(context.Background())
+
+	metrics, err := NewMetrics(provider)
+	require.NoError(t, err)
+
+	var count atomic.Int64
+	registration, err := metrics.ObserveActiveTunnels(func() int { return int(count.Load()) })
+	require.NoError(t, err)
+
+	// The gauge follows the source of truth, whatever changed it
+	for _, want := range []int64{0, 3, 1} {
+		count.Store(want)
+		got, ok := collectGauge(t, reader, "gotunnel.tunnels.active")
+		require.True(t, ok)
+		assert.Equal(t, want, got)
+	}
+
+	// Creating/destroying tunnels no longer nudges the value directly
+	metrics.TunnelCreated(context.Background(), "test.local", 8080, false)
+	got, _ := collectGauge(t, reader, "gotunnel.tunnels.active")
+	assert.Equal(t, int64(1), got)
+
+	require.NoError(t, registration.Unregister())
+	_, ok := collectGauge(t, reader, "gotunnel.tunnels.active")
+	assert.False(t, ok)
+}
+
+func TestTunnelBytesCounter(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer otel.SetMeterProvider(previous)
+
+	provider, err := NewProvider(DefaultConfig())
+	require.NoError(t, err)
+	defer provider.Shutdown(context.Background())
+
+	metrics, err := NewMetrics(provider)
+	require.NoError(t, err)
+
+	registration, err := metrics.ObserveTunnelBytes(func() []TunnelBytes {
+		return []TunnelBytes{{Domain: "app.local", In: 100, Out: 2500}}
+	})
+	require.NoError(t, err)
+	defer registration.Unregister()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "gotunnel.tunnel.bytes" {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			require.True(t, ok)
+			assert.True(t, sum.IsMonotonic)
+			for _, dp := range sum.DataPoints {
+				domain, _ := dp.Attributes.Value("domain")
+				direction, _ := dp.Attributes.Value("direction")
+				got[domain.AsString()+" "+direction.AsString()] = dp.Value
+			}
+		}
+	}
+	assert.Equal(t, map[string]int64{"app.local in": 100, "app.local out": 2500}, got)
+}
+
+func TestBadGatewaysCounter(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer otel.SetMeterProvider(previous)
+
+	provider, err := NewProvider(DefaultConfig())
+	require.NoError(t, err)
+	defer provider.Shutdown(context.Background())
+
+	metrics, err := NewMetrics(provider)
+	require.NoError(t, err)
+
+	registration, err := metrics.ObserveBadGateways(func() map[string]int64 {
+		return map[string]int64{"app.local": 3, "api.local": 0}
+	})
+	require.NoError(t, err)
+	defer registration.Unregister()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "gotunnel.tunnel.bad_gateways" {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			require.True(t, ok)
+			for _, dp := range sum.DataPoints {
+				domain, _ := dp.Attributes.Value("domain")
+				got[domain.AsString()] = dp.Value
+			}
+		}
+	}
+	assert.Equal(t, map[string]int64{"app.local": 3, "api.local": 0}, got)
+}
+
+func TestDNSRegistrationHistogram(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer otel.SetMeterProvider(previous)
+
+	provider, err := NewProvider(DefaultConfig())
+	require.NoError(t, err)
+	defer provider.Shutdown(context.Background())
+
+	metrics, err := NewMetrics(provider)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	metrics.DNSRegistration(ctx, "mdns", "app.local", 250*time.Millisecond, nil)
+	metrics.DNSRegistration(ctx, "hosts", "app.local", 2*time.Millisecond, nil)
+	metrics.DNSRegistration(ctx, "hosts", "api.local", time.Millisecond, assert.AnError)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	got := map[string]uint64{}
+	var mdnsSum float64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "gotunnel.dns.registration.duration" {
+				continue
+			}
+			hist, ok := m.Data.(metricdata.Histogram[float64])
+			require.True(t, ok)
+			for _, dp := range hist.DataPoints {
+				method, _ := dp.Attributes.Value("method")
+				success, _ := dp.Attributes.Value("success")
+				got[fmt.Sprintf("%s/%t", method.AsString(), success.AsBool())] += dp.Count
+				if method.AsString() == "mdns" {
+					mdnsSum += dp.Sum
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]uint64{"mdns/true": 1, "hosts/true": 1, "hosts/false": 1}, got)
+	assert.InDelta(t, 0.25, mdnsSum, 1e-9)
+}
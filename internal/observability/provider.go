@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -12,6 +13,8 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -22,10 +25,19 @@ import (
 	"github.com/johncferguson/gotunnel/internal/logging"
 )
 
-const (
-	ServiceName    = "gotunnel"
-	ServiceVersion = "1.0.0" // TODO: Get from build-time ldflags
-)
+const ServiceName = "gotunnel"
+
+// ServiceVersion is the version reported when a Config doesn't set one.
+// main replaces it with the build-time version via SetServiceVersion.
+var ServiceVersion = "dev"
+
+// SetServiceVersion sets the default service version used by DefaultConfig
+// and NewProvider. Empty values are ignored.
+func SetServiceVersion(version string) {
+	if version != "" {
+		ServiceVersion = version
+	}
+}
 
 // Provider manages all observability concerns: logging, tracing, metrics, and error tracking
 type Provider struct {
@@ -49,6 +61,8 @@ type Config struct {
 	LogFormat        string // "json" or "text"
 	Debug            bool   // Enable debug mode
 	Logging          *logging.Config // Structured logging configuration
+	OTLPEndpoint     string            // OTLP/HTTP collector endpoint (e.g. http://localhost:4318); empty disables export
+	OTLPHeaders      map[string]string // Extra headers sent with every OTLP export (e.g. auth tokens)
 }
 
 // NewProvider creates a new observability provider with Sentry OpenTelemetry collection
@@ -94,11 +108,6 @@ func NewProvider(config Config) (*Provider, error) {
 		}
 	}
 
-	// Validate Sentry DSN if provided
-	if config.SentryDSN != "" {
-		// Sentry will validate the DSN internally
-	}
-
 	// Create resource with service information
 	res, err := resource.Merge(
 		resource.Default(),
@@ -171,13 +180,24 @@ func (p *Provider) initTracing() error {
 		sampler = sdktrace.TraceIDRatioBased(p.config.TracesSampleRate)
 	}
 
-	// Create tracer provider with Sentry's span processor
-	p.tracerProvider = sdktrace.NewTracerProvider(
+	opts := []sdktrace.TracerProviderOption{
 		sdktrace.WithResource(p.resource),
 		sdktrace.WithSampler(sampler),
 		// Add Sentry's span processor - this automatically sends spans to Sentry
 		sdktrace.WithSpanProcessor(sentryotel.NewSentrySpanProcessor()),
-	)
+	}
+
+	// Export to an OTLP collector as well when one is configured
+	if p.config.OTLPEndpoint != "" {
+		exporter, err := newOTLPExporter(p.config.OTLPEndpoint, p.config.OTLPHeaders)
+		if err != nil {
+			return fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		// The batch processor is flushed and shut down with the tracer provider
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	p.tracerProvider = sdktrace.NewTracerProvider(opts...)
 
 	// Set global tracer provider
 	otel.SetTracerProvider(p.tracerProvider)
@@ -196,6 +216,22 @@ func (p *Provider) initTracing() error {
 	return nil
 }
 
+// newOTLPExporter creates an OTLP/HTTP span exporter. Endpoints given as a
+// full URL keep their scheme and path; bare host:port endpoints use HTTPS.
+func newOTLPExporter(endpoint string, headers map[string]string) (*otlptrace.Exporter, error) {
+	var opts []otlptracehttp.Option
+	if strings.Contains(endpoint, "://") {
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	} else {
+		opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+	}
+	if len(headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(headers))
+	}
+
+	return otlptracehttp.New(context.Background(), opts...)
+}
+
 // initLogging initializes structured logging with OpenTelemetry correlation
 func (p *Provider) initLogging() {
 	// Create structured logger
@@ -2,11 +2,19 @@ package observability
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 
+	"github.com/getsentry/sentry-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -164,4 +172,104 @@ func TestTraceCorrelation(t *testing.T) {
 	shutdownCtx := context.Background()
 	err = provider.Shutdown(shutdownCtx)
 	assert.NoError(t, err)
-}
\ No newline at end of file
+}
+func TestOTLPExport(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		spanNames []string
+		authValue string
+	)
+
+	// Minimal OTLP/HTTP receiver that decodes trace export requests
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var req collectortrace.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		authValue = r.Header.Get("Authorization")
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spanNames = append(spanNames, span.Name)
+				}
+			}
+		}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	config := DefaultConfig()
+	config.SentryDSN = ""
+	config.OTLPEndpoint = collector.URL
+	config.OTLPHeaders = map[string]string{"Authorization": "Bearer test-token"}
+
+	provider, err := NewProvider(config)
+	require.NoError(t, err)
+
+	_, span := provider.StartSpan(context.Background(), "test.otlp.span")
+	span.End()
+
+	// Shutdown flushes the batch processor to the collector
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, spanNames, "test.otlp.span")
+	assert.Equal(t, "Bearer test-token", authValue)
+}
+
+func TestSentryDisabledWithoutDSN(t *testing.T) {
+	// Start from a hub with no client so earlier tests don't leak state
+	sentry.CurrentHub().BindClient(nil)
+
+	config := DefaultConfig()
+	assert.Empty(t, config.SentryDSN, "Sentry must be opt-in")
+
+	provider, err := NewProvider(config)
+	require.NoError(t, err)
+	defer provider.Shutdown(context.Background())
+
+	assert.Nil(t, sentry.CurrentHub().Client(), "Sentry should not be initialized without a DSN")
+
+	// Capturing must be a silent no-op
+	lastEventID := sentry.CurrentHub().LastEventID()
+	provider.CaptureError(context.Background(), assert.AnError, map[string]string{"test": "true"})
+	assert.Equal(t, lastEventID, sentry.CurrentHub().LastEventID(), "no event should be captured")
+}
+
+func TestSetServiceVersion(t *testing.T) {
+	original := ServiceVersion
+	defer func() { ServiceVersion = original }()
+
+	SetServiceVersion("v1.2.3-test")
+	assert.Equal(t, "v1.2.3-test", DefaultConfig().ServiceVersion)
+
+	// Empty versions don't clobber the injected one
+	SetServiceVersion("")
+	assert.Equal(t, "v1.2.3-test", ServiceVersion)
+
+	// A config without an explicit version picks up the injected one
+	provider, err := NewProvider(Config{})
+	require.NoError(t, err)
+	defer provider.Shutdown(context.Background())
+
+	value, ok := provider.resource.Set().Value(semconv.ServiceVersionKey)
+	require.True(t, ok)
+	assert.Equal(t, "v1.2.3-test", value.AsString())
+}
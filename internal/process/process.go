@@ -0,0 +1,160 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/logging"
+)
+
+// Process is a backend command launched and supervised by gotunnel
+type Process struct {
+	Command string
+	Port    int
+
+	cmd    *exec.Cmd
+	logger *logging.Logger
+	done   chan struct{}
+	err    error
+	output sync.WaitGroup
+}
+
+// Start launches command through the platform shell with PORT set to port
+// in its environment. The child's stdout and stderr are forwarded to logger.
+func Start(command string, port int, logger *logging.Logger) (*Process, error) {
+	if command == "" {
+		return nil, errors.New("command cannot be empty")
+	}
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid backend port: %d", port)
+	}
+	if logger == nil {
+		logger, _ = logging.New(logging.DefaultConfig())
+	}
+
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), "PORT="+strconv.Itoa(port))
+	setProcessGroup(cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture stdout: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture stderr: %w", err)
+	}
+
+	p := &Process{
+		Command: command,
+		Port:    port,
+		cmd:     cmd,
+		logger:  logger.WithComponent("backend"),
+		done:    make(chan struct{}),
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start backend command: %w", err)
+	}
+
+	p.output.Add(2)
+	go p.forward("stdout", stdout)
+	go p.forward("stderr", stderr)
+
+	go func() {
+		// Drain output before Wait so no trailing lines are lost
+		p.output.Wait()
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+
+	p.logger.Info("Backend command started",
+		"command", command,
+		"pid", cmd.Process.Pid,
+		"port", port,
+	)
+	return p, nil
+}
+
+// forward copies each line of r into the logger
+func (p *Process) forward(stream string, r io.Reader) {
+	defer p.output.Done()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if stream == "stderr" {
+			p.logger.Warn(scanner.Text(), "stream", stream)
+		} else {
+			p.logger.Info(scanner.Text(), "stream", stream)
+		}
+	}
+}
+
+// Done is closed once the process has exited
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the exit error once Done is closed
+func (p *Process) Err() error {
+	<-p.done
+	return p.err
+}
+
+// WaitReady blocks until the backend accepts TCP connections on its port,
+// the process exits, or ctx is done
+func (p *Process) WaitReady(ctx context.Context) error {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(p.Port))
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("backend not reachable on %s: %w", addr, ctx.Err())
+		case <-p.done:
+			return fmt.Errorf("backend command exited before becoming ready: %v", p.err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop asks the process to terminate and kills it if it hasn't exited
+// when ctx is done
+func (p *Process) Stop(ctx context.Context) error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+
+	if err := terminate(p.cmd); err != nil {
+		p.logger.Warn("Failed to signal backend command", "error", err)
+	}
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		if err := kill(p.cmd); err != nil {
+			return fmt.Errorf("failed to kill backend command: %w", err)
+		}
+		<-p.done
+	}
+
+	p.logger.Info("Backend command stopped", "command", p.Command)
+	return nil
+}
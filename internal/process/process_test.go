@@ -0,0 +1,97 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperProcess is not a real test; it is the backend launched by the
+// other tests. It serves HTTP on $PORT until killed.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GOTUNNEL_HELPER_PROCESS") != "1" {
+		return
+	}
+	fmt.Println("helper listening on", os.Getenv("PORT"))
+	http.ListenAndServe("127.0.0.1:"+os.Getenv("PORT"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend-Pid", strconv.Itoa(os.Getpid()))
+		fmt.Fprintf(w, "served on port %s", os.Getenv("PORT"))
+	}))
+	os.Exit(0)
+}
+
+func helperCommand(t *testing.T) string {
+	t.Helper()
+	t.Setenv("GOTUNNEL_HELPER_PROCESS", "1")
+	return fmt.Sprintf("%q -test.run=TestHelperProcess", os.Args[0])
+}
+
+func getFreePort(t *testing.T) int {
+	t.Helper()
+	port, err := netutil.FreePort()
+	require.NoError(t, err)
+	return port
+}
+
+func TestStartInjectsPort(t *testing.T) {
+	port := getFreePort(t)
+	proc, err := Start(helperCommand(t), port, nil)
+	require.NoError(t, err)
+	defer proc.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, proc.WaitReady(ctx))
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("served on port %d", port), string(body))
+}
+
+func TestStopTerminatesProcess(t *testing.T) {
+	proc, err := Start(helperCommand(t), getFreePort(t), nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, proc.WaitReady(ctx))
+
+	require.NoError(t, proc.Stop(ctx))
+	select {
+	case <-proc.Done():
+	default:
+		t.Fatal("process should have exited after Stop")
+	}
+}
+
+func TestDoneClosesWhenChildExits(t *testing.T) {
+	proc, err := Start("exit 3", getFreePort(t), nil)
+	require.NoError(t, err)
+
+	select {
+	case <-proc.Done():
+		assert.Error(t, proc.Err())
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done was not closed after the child exited")
+	}
+}
+
+func TestStartValidation(t *testing.T) {
+	_, err := Start("", 8080, nil)
+	assert.Error(t, err)
+
+	_, err = Start("true", 0, nil)
+	assert.Error(t, err)
+}
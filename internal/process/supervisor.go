@@ -0,0 +1,113 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/logging"
+)
+
+// readyTimeout bounds how long a restarted backend gets to accept
+// connections before the restart is logged as not ready
+const readyTimeout = 30 * time.Second
+
+// Supervisor runs a backend command and replaces it with a fresh copy on
+// Restart. The replacement gets the same PORT, so a tunnel in front of it
+// keeps its listener and certificate and only sees the backend briefly
+// refuse connections.
+type Supervisor struct {
+	Command string
+	Port    int
+
+	logger *logging.Logger
+
+	mu       sync.Mutex
+	current  *Process
+	restarts int
+	stopped  bool
+}
+
+// Supervise starts command the way Start does and returns its supervisor
+func Supervise(command string, port int, logger *logging.Logger) (*Supervisor, error) {
+	if logger == nil {
+		logger, _ = logging.New(logging.DefaultConfig())
+	}
+	proc, err := Start(command, port, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &Supervisor{Command: command, Port: port, logger: logger, current: proc}, nil
+}
+
+// Process returns the backend process running now
+func (s *Supervisor) Process() *Process {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// Restarts returns how many times the backend has been restarted
+func (s *Supervisor) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+// Restart stops the backend, killing it if it hasn't exited when ctx is
+// done, and starts the command again
+func (s *Supervisor) Restart(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return errors.New("backend supervisor is stopped")
+	}
+	if err := s.current.Stop(ctx); err != nil {
+		return err
+	}
+	proc, err := Start(s.Command, s.Port, s.logger)
+	if err != nil {
+		return err
+	}
+	s.current = proc
+	s.restarts++
+	return nil
+}
+
+// Stop stops the backend for good
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	return s.current.Stop(ctx)
+}
+
+// RestartOnChange restarts the backend each time w reports changes, until
+// ctx is done. stopTimeout bounds how long the old backend gets to exit.
+func (s *Supervisor) RestartOnChange(ctx context.Context, w *Watcher, stopTimeout time.Duration) {
+	w.Run(ctx, func(changed []string) {
+		s.logger.Info("Files changed, restarting backend",
+			"command", s.Command,
+			"changed", len(changed),
+			"first", changed[0],
+		)
+
+		stopCtx, cancel := context.WithTimeout(ctx, stopTimeout)
+		err := s.Restart(stopCtx)
+		cancel()
+		if err != nil {
+			s.logger.Error("Failed to restart backend", "command", s.Command, "error", err)
+			return
+		}
+
+		readyCtx, cancel := context.WithTimeout(ctx, readyTimeout)
+		defer cancel()
+		if err := s.Process().WaitReady(readyCtx); err != nil {
+			s.logger.Warn("Restarted backend is not accepting connections", "port", s.Port, "error", err)
+			return
+		}
+		s.logger.Info("Backend restarted", "port", s.Port)
+	})
+}
@@ -0,0 +1,75 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backendPid asks the helper backend on port for its pid
+func backendPid(t *testing.T, port int) string {
+	t.Helper()
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.Header.Get("X-Backend-Pid")
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	port := getFreePort(t)
+	sup, err := Supervise(helperCommand(t), port, nil)
+	require.NoError(t, err)
+	defer sup.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, sup.Process().WaitReady(ctx))
+	first := sup.Process()
+	before := backendPid(t, port)
+
+	require.NoError(t, sup.Restart(ctx))
+	require.NoError(t, sup.Process().WaitReady(ctx))
+	assert.Equal(t, 1, sup.Restarts())
+	assert.NotSame(t, first, sup.Process())
+	assert.NotEqual(t, before, backendPid(t, port), "a new backend serves the same port")
+
+	select {
+	case <-first.Done():
+	default:
+		t.Fatal("the old backend should have exited")
+	}
+
+	require.NoError(t, sup.Stop(ctx))
+	assert.Error(t, sup.Restart(ctx), "no restarts after Stop")
+}
+
+func TestSupervisorRestartOnChange(t *testing.T) {
+	port := getFreePort(t)
+	sup, err := Supervise(helperCommand(t), port, nil)
+	require.NoError(t, err)
+	defer sup.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	require.NoError(t, sup.Process().WaitReady(ctx))
+	before := backendPid(t, port)
+
+	dir := t.TempDir()
+	w, err := NewWatcher([]string{dir}, nil)
+	require.NoError(t, err)
+	defer w.Close()
+	w.debounce = 50 * time.Millisecond
+	go sup.RestartOnChange(ctx, w, 5*time.Second)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0o644))
+	require.Eventually(t, func() bool { return sup.Restarts() == 1 }, 10*time.Second, 20*time.Millisecond)
+	require.NoError(t, sup.Process().WaitReady(ctx))
+	assert.NotEqual(t, before, backendPid(t, port))
+}
@@ -0,0 +1,147 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/johncferguson/gotunnel/internal/logging"
+)
+
+// DefaultDebounce is how long a Watcher waits for changes to settle before
+// reporting them, so an editor saving several files or a git checkout
+// restarts the backend once
+const DefaultDebounce = 300 * time.Millisecond
+
+// Watcher reports file changes under a set of directories, including ones
+// created after it started. Hidden directories (e.g. .git) and
+// node_modules aren't watched.
+type Watcher struct {
+	fs       *fsnotify.Watcher
+	debounce time.Duration
+	ignore   map[string]bool // Absolute paths whose changes are dropped
+	logger   *logging.Logger
+}
+
+// NewWatcher watches dirs and everything below them
+func NewWatcher(dirs []string, logger *logging.Logger) (*Watcher, error) {
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no directories to watch")
+	}
+	if logger == nil {
+		logger, _ = logging.New(logging.DefaultConfig())
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	w := &Watcher{
+		fs:       fsw,
+		debounce: DefaultDebounce,
+		ignore:   make(map[string]bool),
+		logger:   logger.WithComponent("watch"),
+	}
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			fsw.Close()
+			return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+		}
+		if err := w.addTree(abs); err != nil {
+			fsw.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Ignore drops changes to paths, e.g. a log file written inside a watched
+// directory, which would otherwise restart the backend every time it logs
+func (w *Watcher) Ignore(paths ...string) {
+	for _, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil {
+			w.ignore[abs] = true
+		}
+	}
+}
+
+// addTree watches root and the directories below it
+func (w *Watcher) addTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && skipDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		if err := w.fs.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// skipDir reports whether a directory holds files that shouldn't restart
+// the backend: VCS metadata, editor state and dependencies
+func skipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "node_modules"
+}
+
+// Run calls onChange with the paths that changed once each burst of changes
+// has settled, until ctx is done. onChange runs on Run's goroutine.
+func (w *Watcher) Run(ctx context.Context, onChange func(changed []string)) {
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+	pending := make(map[string]bool)
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case ev, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			if ev.Op == fsnotify.Chmod || w.ignore[ev.Name] {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() && !skipDir(info.Name()) {
+					if err := w.addTree(ev.Name); err != nil {
+						w.logger.Warn("Failed to watch new directory", "path", ev.Name, "error", err)
+					}
+				}
+			}
+			pending[ev.Name] = true
+			timer.Reset(w.debounce)
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warn("File watcher error", "error", err)
+		case <-timer.C:
+			changed := make([]string, 0, len(pending))
+			for path := range pending {
+				changed = append(changed, path)
+			}
+			sort.Strings(changed)
+			clear(pending)
+			onChange(changed)
+		}
+	}
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	return w.fs.Close()
+}
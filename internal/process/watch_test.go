@@ -0,0 +1,103 @@
+package process
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// watch runs w until the test ends and returns the batches it reports
+func watch(t *testing.T, w *Watcher) <-chan []string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan []string, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx, func(changed []string) { changes <- changed })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		w.Close()
+	})
+	return changes
+}
+
+func nextChange(t *testing.T, changes <-chan []string) []string {
+	t.Helper()
+	select {
+	case changed := <-changes:
+		return changed
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+		return nil
+	}
+}
+
+func TestWatcherDebouncesChanges(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher([]string{dir}, nil)
+	require.NoError(t, err)
+	w.debounce = 100 * time.Millisecond
+	changes := watch(t, w)
+
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	require.NoError(t, os.WriteFile(a, []byte("1"), 0o644))
+	require.NoError(t, os.WriteFile(b, []byte("1"), 0o644))
+	require.NoError(t, os.WriteFile(a, []byte("2"), 0o644))
+
+	assert.Equal(t, []string{a, b}, nextChange(t, changes))
+	select {
+	case changed := <-changes:
+		t.Fatalf("expected one batch, got another: %v", changed)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestWatcherIgnoresPathsAndHiddenDirs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".git"), 0o755))
+	w, err := NewWatcher([]string{dir}, nil)
+	require.NoError(t, err)
+	w.debounce = 50 * time.Millisecond
+	logFile := filepath.Join(dir, "gotunnel.log")
+	w.Ignore(logFile)
+	changes := watch(t, w)
+
+	require.NoError(t, os.WriteFile(logFile, []byte("log"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "index"), []byte("x"), 0o644))
+	main := filepath.Join(dir, "main.go")
+	require.NoError(t, os.WriteFile(main, []byte("package main"), 0o644))
+
+	assert.Equal(t, []string{main}, nextChange(t, changes))
+}
+
+func TestWatcherWatchesNewDirectories(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher([]string{dir}, nil)
+	require.NoError(t, err)
+	w.debounce = 50 * time.Millisecond
+	changes := watch(t, w)
+
+	sub := filepath.Join(dir, "pkg")
+	require.NoError(t, os.Mkdir(sub, 0o755))
+	assert.Equal(t, []string{sub}, nextChange(t, changes))
+
+	file := filepath.Join(sub, "pkg.go")
+	require.NoError(t, os.WriteFile(file, []byte("package pkg"), 0o644))
+	assert.Equal(t, []string{file}, nextChange(t, changes))
+}
+
+func TestNewWatcherErrors(t *testing.T) {
+	_, err := NewWatcher(nil, nil)
+	assert.Error(t, err)
+
+	_, err = NewWatcher([]string{filepath.Join(t.TempDir(), "missing")}, nil)
+	assert.Error(t, err)
+}
@@ -5,7 +5,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
 	"text/template"
+
+	"gopkg.in/yaml.v3"
 )
 
 // External proxy implementations for nginx, caddy, etc.
@@ -27,26 +31,89 @@ func (m *Manager) startCaddyProxy() error {
 	}
 
 	fmt.Println("🔧 Configuring caddy proxy...")
-	return fmt.Errorf("caddy proxy not yet implemented - use --proxy=builtin for now")
+	return m.applyCaddyConfig()
 }
 
-// generateConfigFiles generates configuration for external proxies
-func (m *Manager) generateConfigFiles() error {
-	fmt.Println("📝 Generating proxy configuration files...")
-
-	if err := m.generateNginxConfig(); err != nil {
-		fmt.Printf("⚠️  Failed to generate nginx config: %v\n", err)
+// applyCaddyConfig writes the Caddyfile for the current routes and asks the
+// running caddy to load it. Callers must hold m.mu.
+func (m *Manager) applyCaddyConfig() error {
+	configFile, err := m.writeCaddyfile()
+	if err != nil {
+		return err
 	}
+	return reloadCaddy(configFile)
+}
 
-	if err := m.generateCaddyConfig(); err != nil {
-		fmt.Printf("⚠️  Failed to generate caddy config: %v\n", err)
+// startTraefikProxy writes the dynamic configuration for traefik's file
+// provider, which picks up changes without a reload
+func (m *Manager) startTraefikProxy() error {
+	fmt.Println("🔧 Configuring traefik proxy...")
+	configFile, err := m.writeTraefikConfig()
+	if err != nil {
+		return err
 	}
 
+	fmt.Printf("📝 Generated traefik config: %s\n", configFile)
+	fmt.Printf("💡 Point traefik's file provider at it:\n")
+	fmt.Printf("   --providers.file.filename=%s --providers.file.watch=true\n\n", configFile)
 	return nil
 }
 
-// generateNginxConfig creates nginx configuration for current routes
-func (m *Manager) generateNginxConfig() error {
+// startConfigOnly writes the config file for Type without running a proxy.
+// Route changes rewrite it; see syncExternalConfig.
+func (m *Manager) startConfigOnly() error {
+	configFile, err := m.generateConfigFiles()
+	if err != nil {
+		return err
+	}
+	m.logger.Info("Generated proxy config", "proxy", m.config.Type, "file", configFile,
+		"usage", configUsage(m.config.Type, configFile))
+	return nil
+}
+
+// generateConfigFiles writes the config for the proxy named by Type into
+// the config directory and returns its path. Callers must hold m.mu.
+func (m *Manager) generateConfigFiles() (string, error) {
+	switch m.config.Type {
+	case NginxProxyType:
+		return m.writeNginxConfig()
+	case CaddyProxyType:
+		return m.writeCaddyfile()
+	case TraefikProxyType:
+		return m.writeTraefikConfig()
+	default:
+		return "", fmt.Errorf("can't generate config for proxy type %q (want nginx, caddy or traefik)", m.config.Type)
+	}
+}
+
+// defaultConfigType is the proxy ConfigOnly mode writes config for when Type
+// is unset: the first one installed, or nginx if none is
+func defaultConfigType() ProxyType {
+	for _, proxyType := range DetectAvailableProxies() {
+		if proxyType != BuiltInProxyType {
+			return proxyType
+		}
+	}
+	return NginxProxyType
+}
+
+// configUsage tells the user how to load a generated config file
+func configUsage(proxyType ProxyType, configFile string) string {
+	switch proxyType {
+	case NginxProxyType:
+		return fmt.Sprintf("add 'include %s;' to your nginx configuration, then run: sudo nginx -s reload", configFile)
+	case CaddyProxyType:
+		return fmt.Sprintf("add it to your Caddyfile or run: caddy run --config %s", configFile)
+	case TraefikProxyType:
+		return fmt.Sprintf("run traefik with --providers.file.filename=%s --providers.file.watch=true", configFile)
+	default:
+		return ""
+	}
+}
+
+// writeNginxConfig renders the nginx config for the current routes into the
+// config directory and returns its path
+func (m *Manager) writeNginxConfig() (string, error) {
 	const nginxTemplate = `# Generated by gotunnel
 # Add this to your nginx configuration
 
@@ -110,24 +177,19 @@ server {
 
 	tmpl, err := template.New("nginx").Parse(nginxTemplate)
 	if err != nil {
-		return fmt.Errorf("failed to parse nginx template: %w", err)
+		return "", fmt.Errorf("failed to parse nginx template: %w", err)
 	}
 
-	// Get config directory
-	configDir, err := os.UserConfigDir()
+	gotunnelDir, err := m.configDir()
 	if err != nil {
-		configDir = os.TempDir()
-	}
-	gotunnelDir := filepath.Join(configDir, "gotunnel")
-	if err := os.MkdirAll(gotunnelDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+		return "", err
 	}
 
 	// Create nginx config file
 	configFile := filepath.Join(gotunnelDir, "nginx.conf")
 	file, err := os.Create(configFile)
 	if err != nil {
-		return fmt.Errorf("failed to create nginx config file: %w", err)
+		return "", fmt.Errorf("failed to create nginx config file: %w", err)
 	}
 	defer file.Close()
 
@@ -135,73 +197,235 @@ server {
 	data := struct {
 		Routes map[string]*Route
 	}{
-		Routes: m.routes,
+		Routes: m.routes.Load().byHost,
 	}
 
 	if err := tmpl.Execute(file, data); err != nil {
-		return fmt.Errorf("failed to execute nginx template: %w", err)
+		return "", fmt.Errorf("failed to execute nginx template: %w", err)
 	}
+	return configFile, nil
+}
 
-	fmt.Printf("📝 Generated nginx config: %s\n", configFile)
-	fmt.Printf("💡 Add this to your nginx configuration:\n")
-	fmt.Printf("   include %s;\n", configFile)
-	fmt.Printf("   sudo nginx -s reload\n\n")
+// writeCaddyfile renders the Caddyfile into the config directory and returns
+// its path
+func (m *Manager) writeCaddyfile() (string, error) {
+	caddyfile, err := m.generateCaddyfile()
+	if err != nil {
+		return "", err
+	}
 
-	return nil
+	gotunnelDir, err := m.configDir()
+	if err != nil {
+		return "", err
+	}
+
+	configFile := filepath.Join(gotunnelDir, "Caddyfile")
+	if err := os.WriteFile(configFile, []byte(caddyfile), 0644); err != nil {
+		return "", fmt.Errorf("failed to write caddy config file: %w", err)
+	}
+	return configFile, nil
 }
 
-// generateCaddyConfig creates caddy configuration for current routes  
-func (m *Manager) generateCaddyConfig() error {
+// generateCaddyfile renders one site block per route. HTTPS routes let caddy
+// manage TLS, using its internal CA for local names that can't get a public
+// certificate; plain routes are served over HTTP only.
+func (m *Manager) generateCaddyfile() (string, error) {
 	const caddyTemplate = `# Generated by gotunnel
 # Add this to your Caddyfile
-
-{{range $domain, $route := .Routes}}
-{{$domain}} {
-    reverse_proxy {{$route.TargetHost}}:{{$route.TargetPort}}
+{{range .}}
+{{if .Route.HTTPS}}{{.Name}}{{else}}http://{{.Name}}{{end}} {
+{{- if and .Route.HTTPS .Local}}
+    tls internal
+{{- end}}
+{{- if .Route.HTTPS}}
+    reverse_proxy https://{{.Route.TargetHost}}:{{.Route.TargetPort}}{{if or .Local .Route.InsecureSkipVerify}} {
+        transport http {
+            tls_insecure_skip_verify
+        }
+    }{{end}}
+{{- else}}
+    reverse_proxy {{.Route.TargetHost}}:{{.Route.TargetPort}}
+{{- end}}
 }
-
-{{end}}
-`
+{{end}}`
 
 	tmpl, err := template.New("caddy").Parse(caddyTemplate)
 	if err != nil {
-		return fmt.Errorf("failed to parse caddy template: %w", err)
+		return "", fmt.Errorf("failed to parse caddy template: %w", err)
+	}
+
+	type site struct {
+		Name  string
+		Local bool
+		Route *Route
+	}
+	var sites []site
+	for _, route := range uniqueRoutes(m.routes.Load().byHost) {
+		name := m.siteName(route.Domain)
+		sites = append(sites, site{Name: name, Local: m.isLocalName(name), Route: route})
 	}
 
-	// Get config directory
-	configDir, err := os.UserConfigDir()
+	var b strings.Builder
+	if err := tmpl.Execute(&b, sites); err != nil {
+		return "", fmt.Errorf("failed to execute caddy template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// traefikConfig is the subset of traefik's dynamic configuration gotunnel
+// generates for the file provider
+type traefikConfig struct {
+	HTTP traefikHTTP `yaml:"http"`
+}
+
+type traefikHTTP struct {
+	Routers           map[string]traefikRouter           `yaml:"routers"`
+	Services          map[string]traefikService          `yaml:"services"`
+	ServersTransports map[string]traefikServersTransport `yaml:"serversTransports,omitempty"`
+}
+
+type traefikRouter struct {
+	Rule        string      `yaml:"rule"`
+	Service     string      `yaml:"service"`
+	EntryPoints []string    `yaml:"entryPoints"`
+	TLS         *traefikTLS `yaml:"tls,omitempty"`
+}
+
+type traefikTLS struct{}
+
+type traefikService struct {
+	LoadBalancer traefikLoadBalancer `yaml:"loadBalancer"`
+}
+
+type traefikLoadBalancer struct {
+	Servers          []traefikServer `yaml:"servers"`
+	ServersTransport string          `yaml:"serversTransport,omitempty"`
+}
+
+type traefikServer struct {
+	URL string `yaml:"url"`
+}
+
+type traefikServersTransport struct {
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+}
+
+// traefikLocalTransport lets traefik reach HTTPS tunnels on local names,
+// which use self-signed certificates, and targets of routes with
+// InsecureSkipVerify
+const traefikLocalTransport = "gotunnel-local"
+
+// generateTraefikConfig renders a router and service per route. HTTPS routes
+// are served on the websecure entry point with TLS, plain ones on web.
+func (m *Manager) generateTraefikConfig() (string, error) {
+	config := traefikConfig{HTTP: traefikHTTP{
+		Routers:  make(map[string]traefikRouter),
+		Services: make(map[string]traefikService),
+	}}
+
+	for _, route := range uniqueRoutes(m.routes.Load().byHost) {
+		name := m.siteName(route.Domain)
+		key := strings.ReplaceAll(name, ".", "-")
+
+		router := traefikRouter{
+			Rule:        fmt.Sprintf("Host(`%s`)", name),
+			Service:     key,
+			EntryPoints: []string{"web"},
+		}
+		service := traefikService{LoadBalancer: traefikLoadBalancer{
+			Servers: []traefikServer{{URL: fmt.Sprintf("http://%s:%d", route.TargetHost, route.TargetPort)}},
+		}}
+
+		if route.HTTPS {
+			router.EntryPoints = []string{"websecure"}
+			router.TLS = &traefikTLS{}
+			service.LoadBalancer.Servers[0].URL = fmt.Sprintf("https://%s:%d", route.TargetHost, route.TargetPort)
+			if m.isLocalName(name) || route.InsecureSkipVerify {
+				service.LoadBalancer.ServersTransport = traefikLocalTransport
+				config.HTTP.ServersTransports = map[string]traefikServersTransport{
+					traefikLocalTransport: {InsecureSkipVerify: true},
+				}
+			}
+		}
+
+		config.HTTP.Routers[key] = router
+		config.HTTP.Services[key] = service
+	}
+
+	out, err := yaml.Marshal(config)
 	if err != nil {
-		configDir = os.TempDir()
+		return "", fmt.Errorf("failed to marshal traefik config: %w", err)
 	}
-	gotunnelDir := filepath.Join(configDir, "gotunnel")
-	if err := os.MkdirAll(gotunnelDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+	return "# Generated by gotunnel\n# Traefik dynamic configuration for the file provider\n" + string(out), nil
+}
+
+// writeTraefikConfig renders the traefik config into the config directory and
+// returns its path
+func (m *Manager) writeTraefikConfig() (string, error) {
+	traefik, err := m.generateTraefikConfig()
+	if err != nil {
+		return "", err
 	}
 
-	// Create caddy config file
-	configFile := filepath.Join(gotunnelDir, "Caddyfile")
-	file, err := os.Create(configFile)
+	gotunnelDir, err := m.configDir()
 	if err != nil {
-		return fmt.Errorf("failed to create caddy config file: %w", err)
+		return "", err
 	}
-	defer file.Close()
 
-	// Execute template
-	data := struct {
-		Routes map[string]*Route
-	}{
-		Routes: m.routes,
+	configFile := filepath.Join(gotunnelDir, "traefik.yaml")
+	if err := os.WriteFile(configFile, []byte(traefik), 0644); err != nil {
+		return "", fmt.Errorf("failed to write traefik config file: %w", err)
 	}
+	return configFile, nil
+}
 
-	if err := tmpl.Execute(file, data); err != nil {
-		return fmt.Errorf("failed to execute caddy template: %w", err)
+// configDir returns the directory generated proxy configs are written to,
+// creating it if needed
+func (m *Manager) configDir() (string, error) {
+	gotunnelDir := m.config.ConfigPath
+	if gotunnelDir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			configDir = os.TempDir()
+		}
+		gotunnelDir = filepath.Join(configDir, "gotunnel")
 	}
+	if err := os.MkdirAll(gotunnelDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %w", err)
+	}
+	return gotunnelDir, nil
+}
+
+// uniqueRoutes returns each route once, sorted by domain. AddRoute stores a
+// route under both its bare and TLD-suffixed names.
+func uniqueRoutes(routes map[string]*Route) []*Route {
+	seen := make(map[*Route]bool)
+	var unique []*Route
+	for _, route := range routes {
+		if !seen[route] {
+			seen[route] = true
+			unique = append(unique, route)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		return unique[i].Domain < unique[j].Domain
+	})
+	return unique
+}
 
-	fmt.Printf("📝 Generated caddy config: %s\n", configFile)
-	fmt.Printf("💡 Add this to your Caddyfile or run:\n")
-	fmt.Printf("   caddy run --config %s\n\n", configFile)
+// siteName is the name a route is reachable at; bare names live under the
+// configured TLD
+func (m *Manager) siteName(domain string) string {
+	if !strings.Contains(domain, ".") {
+		return domain + "." + m.config.LocalTLD
+	}
+	return domain
+}
 
-	return nil
+// isLocalName reports whether name is under .local or the configured TLD,
+// neither of which a public CA will issue certificates for
+func (m *Manager) isLocalName(name string) bool {
+	return strings.HasSuffix(name, ".local") || strings.HasSuffix(name, "."+m.config.LocalTLD)
 }
 
 // reloadNginx reloads nginx configuration
@@ -218,15 +442,15 @@ func reloadNginx() error {
 	return nil
 }
 
-// reloadCaddy reloads caddy configuration  
-func reloadCaddy() error {
+// reloadCaddy loads configFile into the running caddy
+func reloadCaddy(configFile string) error {
 	if !commandExists("caddy") {
 		return fmt.Errorf("caddy not found")
 	}
 
-	cmd := exec.Command("caddy", "reload")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to reload caddy: %w", err)
+	cmd := exec.Command("caddy", "reload", "--config", configFile, "--adapter", "caddyfile")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to reload caddy: %w: %s", err, strings.TrimSpace(string(output)))
 	}
 
 	return nil
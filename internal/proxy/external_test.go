@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestGenerateCaddyfile(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: ConfigOnly, ConfigPath: t.TempDir()})
+	routes := []*Route{
+		{Domain: "app1", TargetHost: "127.0.0.1", TargetPort: 3000},
+		{Domain: "app2.local", TargetHost: "127.0.0.1", TargetPort: 3001, HTTPS: true},
+		{Domain: "example.com", TargetHost: "10.0.0.5", TargetPort: 8443, HTTPS: true},
+		{Domain: "dev.example.com", TargetHost: "10.0.0.6", TargetPort: 8443, HTTPS: true, InsecureSkipVerify: true},
+	}
+	for _, route := range routes {
+		require.NoError(t, manager.AddRoute(route))
+	}
+
+	caddyfile, err := manager.generateCaddyfile()
+	require.NoError(t, err)
+
+	// Plain routes stay on HTTP
+	assert.Contains(t, caddyfile, "http://app1.local {\n    reverse_proxy 127.0.0.1:3000\n}")
+	// .local names can't get a public certificate, so use caddy's internal CA
+	assert.Contains(t, caddyfile, "app2.local {\n    tls internal\n    reverse_proxy https://127.0.0.1:3001 {")
+	// Real domains get caddy's automatic HTTPS
+	assert.Contains(t, caddyfile, "example.com {\n    reverse_proxy https://10.0.0.5:8443\n}")
+	assert.NotContains(t, caddyfile, "example.com.local")
+	// Routes that skip verification accept the target's self-signed certificate
+	assert.Contains(t, caddyfile, "dev.example.com {\n    reverse_proxy https://10.0.0.6:8443 {\n        transport http {\n            tls_insecure_skip_verify")
+
+	// Each route appears once even though it's stored under two names
+	assert.Equal(t, 1, strings.Count(caddyfile, "127.0.0.1:3000"))
+
+	if _, err := exec.LookPath("caddy"); err == nil {
+		path := filepath.Join(t.TempDir(), "Caddyfile")
+		require.NoError(t, os.WriteFile(path, []byte(caddyfile), 0644))
+		output, err := exec.Command("caddy", "validate", "--config", path, "--adapter", "caddyfile").CombinedOutput()
+		assert.NoError(t, err, string(output))
+	}
+}
+
+func TestConfigOnlyModeWritesCaddyfile(t *testing.T) {
+	configDir := t.TempDir()
+	manager := NewManager(ProxyConfig{Mode: ConfigOnly, Type: CaddyProxyType, ConfigPath: configDir})
+	require.NoError(t, manager.AddRoute(&Route{Domain: "app.local", TargetHost: "127.0.0.1", TargetPort: 3000}))
+
+	require.NoError(t, manager.Start())
+
+	content, err := os.ReadFile(filepath.Join(configDir, "Caddyfile"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "http://app.local {")
+	assert.NoFileExists(t, filepath.Join(configDir, "nginx.conf"))
+	assert.NoFileExists(t, filepath.Join(configDir, "traefik.yaml"))
+
+	// Tunnels usually start after the proxy, so later routes rewrite the file
+	require.NoError(t, manager.AddRoute(&Route{Domain: "later.local", TargetHost: "127.0.0.1", TargetPort: 3001}))
+	content, err = os.ReadFile(filepath.Join(configDir, "Caddyfile"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "http://later.local {")
+}
+
+func TestConfigOnlyModeDefaultsToDetectedProxy(t *testing.T) {
+	t.Setenv("PATH", t.TempDir()) // No proxy installed
+	configDir := t.TempDir()
+	manager := NewManager(ProxyConfig{Mode: ConfigOnly, ConfigPath: configDir})
+	assert.Equal(t, NginxProxyType, manager.config.Type)
+
+	require.NoError(t, manager.Start())
+	assert.FileExists(t, filepath.Join(configDir, "nginx.conf"))
+
+	if runtime.GOOS == "windows" {
+		return // The fake caddy below isn't executable there
+	}
+	caddy := filepath.Join(t.TempDir(), "caddy")
+	require.NoError(t, os.WriteFile(caddy, []byte("#!/bin/sh\n"), 0755))
+	t.Setenv("PATH", filepath.Dir(caddy))
+	manager = NewManager(ProxyConfig{Mode: ConfigOnly, ConfigPath: configDir})
+	assert.Equal(t, CaddyProxyType, manager.config.Type)
+}
+
+func TestConfigOnlyModeRejectsBuiltInType(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: ConfigOnly, Type: BuiltInProxyType, ConfigPath: t.TempDir()})
+	assert.Error(t, manager.Start())
+}
+
+func TestGenerateTraefikConfig(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: ConfigOnly, ConfigPath: t.TempDir()})
+	routes := []*Route{
+		{Domain: "app1", TargetHost: "127.0.0.1", TargetPort: 3000},
+		{Domain: "app2.local", TargetHost: "127.0.0.1", TargetPort: 3001, HTTPS: true},
+		{Domain: "example.com", TargetHost: "10.0.0.5", TargetPort: 8443, HTTPS: true},
+	}
+	for _, route := range routes {
+		require.NoError(t, manager.AddRoute(route))
+	}
+
+	out, err := manager.generateTraefikConfig()
+	require.NoError(t, err)
+
+	var config traefikConfig
+	require.NoError(t, yaml.Unmarshal([]byte(out), &config))
+	assert.Len(t, config.HTTP.Routers, 3)
+	assert.Len(t, config.HTTP.Services, 3)
+
+	assert.Equal(t, traefikRouter{
+		Rule:        "Host(`app1.local`)",
+		Service:     "app1-local",
+		EntryPoints: []string{"web"},
+	}, config.HTTP.Routers["app1-local"])
+	assert.Equal(t, "http://127.0.0.1:3000", config.HTTP.Services["app1-local"].LoadBalancer.Servers[0].URL)
+
+	// HTTPS routes terminate TLS on websecure and trust self-signed .local tunnels
+	router := config.HTTP.Routers["app2-local"]
+	assert.Equal(t, []string{"websecure"}, router.EntryPoints)
+	assert.NotNil(t, router.TLS)
+	service := config.HTTP.Services["app2-local"]
+	assert.Equal(t, "https://127.0.0.1:3001", service.LoadBalancer.Servers[0].URL)
+	assert.Equal(t, traefikLocalTransport, service.LoadBalancer.ServersTransport)
+	assert.True(t, config.HTTP.ServersTransports[traefikLocalTransport].InsecureSkipVerify)
+
+	// Real domains are verified normally
+	assert.Equal(t, "Host(`example.com`)", config.HTTP.Routers["example-com"].Rule)
+	assert.NotNil(t, config.HTTP.Routers["example-com"].TLS)
+	assert.Empty(t, config.HTTP.Services["example-com"].LoadBalancer.ServersTransport)
+}
+
+func TestTraefikModeRewritesConfigOnRouteChanges(t *testing.T) {
+	configDir := t.TempDir()
+	configFile := filepath.Join(configDir, "traefik.yaml")
+	manager := NewManager(ProxyConfig{Mode: TraefikProxy, ConfigPath: configDir})
+	require.NoError(t, manager.Start())
+
+	require.NoError(t, manager.AddRoute(&Route{Domain: "app.local", TargetHost: "127.0.0.1", TargetPort: 3000}))
+	content, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Host(`app.local`)")
+
+	require.NoError(t, manager.RemoveRoute("app.local"))
+	content, err = os.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "app.local")
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// ErrInvalidRoute is returned by AddRoute for a route the proxy can't
+// forward to
+var ErrInvalidRoute = errors.New("invalid proxy route")
+
+// validatePort checks that port is a usable TCP port
+func validatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port %d out of range 1-65535", port)
+	}
+	return nil
+}
+
+// parseHostPort splits a "host:port" address, such as a backend URL's
+// host, into a non-empty host and a port in 1..65535. IPv6 hosts are
+// bracketed ("[::1]:8080") and returned without the brackets.
+func parseHostPort(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("invalid address %q: missing host", addr)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid address %q: port %q is not a number", addr, portStr)
+	}
+	if err := validatePort(port); err != nil {
+		return "", 0, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	return host, port, nil
+}
+
+// validateRoute checks that route names a domain and a target to reach
+func validateRoute(route *Route) error {
+	if route.Domain == "" {
+		return fmt.Errorf("%w: empty domain", ErrInvalidRoute)
+	}
+	if route.TargetHost == "" {
+		return fmt.Errorf("%w for %s: empty target host", ErrInvalidRoute, route.Domain)
+	}
+	if err := validatePort(route.TargetPort); err != nil {
+		return fmt.Errorf("%w for %s: target %w", ErrInvalidRoute, route.Domain, err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHostPort(t *testing.T) {
+	tests := []struct {
+		addr     string
+		wantHost string
+		wantPort int
+		wantErr  bool
+	}{
+		{"127.0.0.1:8080", "127.0.0.1", 8080, false},
+		{"localhost:1", "localhost", 1, false},
+		{"[::1]:65535", "::1", 65535, false},
+		{"127.0.0.1", "", 0, true},
+		{":8080", "", 0, true},
+		{"127.0.0.1:http", "", 0, true},
+		{"127.0.0.1:0", "", 0, true},
+		{"127.0.0.1:65536", "", 0, true},
+		{"127.0.0.1:-1", "", 0, true},
+		{"::1:8080", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			host, port, err := parseHostPort(tt.addr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantHost, host)
+			assert.Equal(t, tt.wantPort, port)
+		})
+	}
+}
+
+func TestAddRouteRejectsInvalidTargets(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy})
+
+	for name, route := range map[string]*Route{
+		"no domain":      {TargetHost: "127.0.0.1", TargetPort: 3000},
+		"no host":        {Domain: "app.local", TargetPort: 3000},
+		"zero port":      {Domain: "app.local", TargetHost: "127.0.0.1"},
+		"port too large": {Domain: "app.local", TargetHost: "127.0.0.1", TargetPort: 70000},
+	} {
+		err := manager.AddRoute(route)
+		assert.True(t, errors.Is(err, ErrInvalidRoute), "%s: %v", name, err)
+	}
+	assert.Empty(t, manager.ListRoutes())
+
+	require.NoError(t, manager.AddRoute(&Route{Domain: "app.local", TargetHost: "::1", TargetPort: 3000}))
+}
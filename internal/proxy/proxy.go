@@ -1,18 +1,33 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"maps"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/johncferguson/gotunnel/internal/errorpage"
+	"github.com/johncferguson/gotunnel/internal/httpserver"
+	"github.com/johncferguson/gotunnel/internal/logging"
+	"github.com/johncferguson/gotunnel/internal/middleware"
+	"github.com/johncferguson/gotunnel/internal/netutil"
 	"github.com/johncferguson/gotunnel/internal/privilege"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // ProxyMode defines how the proxy should operate
@@ -23,6 +38,7 @@ const (
 	BuiltInProxy ProxyMode = "builtin"  // Use gotunnel's built-in proxy
 	NginxProxy   ProxyMode = "nginx"    // Auto-configure nginx
 	CaddyProxy   ProxyMode = "caddy"    // Auto-configure caddy
+	TraefikProxy ProxyMode = "traefik"  // Write traefik file provider config
 	AutoProxy    ProxyMode = "auto"     // Auto-detect best option
 	ConfigOnly   ProxyMode = "config"   // Generate config files only
 )
@@ -37,6 +53,15 @@ const (
 	TraefikProxyType ProxyType = "traefik"
 )
 
+// AnyPort, as ProxyConfig.HTTPPort or HTTPSPort, makes the built-in proxy
+// listen on any free port; ActualPort and TLSPort report which. Zero
+// ports mean the defaults, 80 and 443.
+const AnyPort = -1
+
+// DefaultRouteDomain, as a route's domain, makes AddRoute set the default
+// route instead of one for a host
+const DefaultRouteDomain = "*"
+
 // ProxyConfig holds configuration for the proxy system
 type ProxyConfig struct {
 	Mode        ProxyMode `yaml:"mode" json:"mode"`
@@ -45,6 +70,34 @@ type ProxyConfig struct {
 	HTTPSPort   int       `yaml:"https_port" json:"https_port"`
 	AutoInstall bool      `yaml:"auto_install" json:"auto_install"`
 	ConfigPath  string    `yaml:"config_path" json:"config_path"`
+	// TerminateTLS makes the built-in proxy serve HTTPS on HTTPSPort,
+	// picking each route's certificate by SNI
+	TerminateTLS bool `yaml:"terminate_tls" json:"terminate_tls"`
+	// LocalTLD is the suffix bare route names are also reachable under,
+	// without the leading dot (default "local")
+	LocalTLD string `yaml:"local_tld" json:"local_tld"`
+	// BufferSize is the size of the pooled buffers the built-in proxy copies
+	// bodies through (default 32KB)
+	BufferSize int `yaml:"buffer_size" json:"buffer_size"`
+	// Transport, if set, carries requests to route targets instead of the
+	// default. Its TLSClientConfig then decides which HTTPS targets are
+	// trusted; route certificates are no longer pinned.
+	Transport *http.Transport `yaml:"-" json:"-"`
+	// Timeouts bounds the built-in proxy's client connections
+	// (default DefaultServerTimeouts)
+	Timeouts *ServerTimeouts `yaml:"timeouts,omitempty" json:"timeouts,omitempty"`
+	// ProxyProtocol makes the built-in proxy expect a PROXY protocol header
+	// on every connection, from a load balancer in front of it, and forward
+	// the client it names as the last X-Forwarded-For entry, whatever
+	// forwarding headers the request itself carries
+	ProxyProtocol bool `yaml:"proxy_protocol" json:"proxy_protocol"`
+	// BindAddr is the interface address the built-in proxy listens on, e.g.
+	// 127.0.0.1 to keep it off the network (default all interfaces)
+	BindAddr string `yaml:"bind_addr,omitempty" json:"bind_addr,omitempty"`
+	// DefaultRoute, if set, catches requests for hosts no route matches
+	// (e.g. a landing page) instead of the built-in proxy's 404 page. Its
+	// Domain is ignored.
+	DefaultRoute *Route `yaml:"default_route,omitempty" json:"default_route,omitempty"`
 }
 
 // Route represents a proxy route mapping
@@ -53,15 +106,40 @@ type Route struct {
 	TargetHost string `json:"target_host"`
 	TargetPort int    `json:"target_port"`
 	HTTPS      bool   `json:"https"`
+
+	// Certificate is served for Domain when the proxy terminates TLS. The
+	// proxy also trusts it when dialing an HTTPS target.
+	Certificate *tls.Certificate `json:"-"`
+
+	// InsecureSkipVerify accepts any certificate from an HTTPS target, e.g.
+	// a local dev server with its own self-signed one
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+
+	// PreserveHost forwards the incoming Host header instead of the target's
+	// address
+	PreserveHost bool `json:"preserve_host"`
+
+	// GRPC proxies to the target over HTTP/2 (h2c for plain targets),
+	// flushing every message and exempting streams from the write timeout
+	GRPC bool `json:"grpc"`
+
+	// ResponseTimeout, if set, bounds how long a request waits for the
+	// target's response, headers and body, before failing with a 504.
+	// WebSocket upgrades are exempt.
+	ResponseTimeout time.Duration `json:"response_timeout"`
 }
 
 // Manager handles proxy operations and routing
 type Manager struct {
 	config     ProxyConfig
-	routes     map[string]*Route // domain -> route mapping
-	server     *http.Server
-	listener   net.Listener
-	actualPort int              // The actual port being used (important for port 0)
+	routes     atomic.Pointer[routeTable] // Replaced, never modified, under mu
+	server     *httpserver.Server
+	actualPort int                // The actual port being used (important for port 0)
+	tlsServer  *httpserver.Server // Serves HTTPS when TerminateTLS is set
+	tlsPort    int              // The actual HTTPS port being used
+	middleware []middleware.Middleware
+	buffers    *netutil.BufferPool
+	logger     *logging.Logger
 	mu         sync.RWMutex
 	ctx        context.Context
 	cancel     context.CancelFunc
@@ -81,13 +159,48 @@ func NewManager(config ProxyConfig) *Manager {
 	if config.Mode == "" {
 		config.Mode = AutoProxy
 	}
+	if config.Mode == ConfigOnly && config.Type == "" {
+		config.Type = defaultConfigType()
+	}
+	config.LocalTLD = strings.TrimPrefix(config.LocalTLD, ".")
+	if config.LocalTLD == "" {
+		config.LocalTLD = "local"
+	}
+	if config.Timeouts == nil {
+		timeouts := DefaultServerTimeouts()
+		config.Timeouts = &timeouts
+	}
+	if config.DefaultRoute != nil {
+		route := *config.DefaultRoute
+		route.Domain = DefaultRouteDomain
+		config.DefaultRoute = &route
+	}
 
-	return &Manager{
-		config: config,
-		routes: make(map[string]*Route),
-		ctx:    ctx,
-		cancel: cancel,
+	m := &Manager{
+		config:  config,
+		buffers: netutil.NewBufferPool(config.BufferSize),
+		logger:  logging.Default().WithComponent("proxy"),
+		ctx:     ctx,
+		cancel:  cancel,
 	}
+	m.routes.Store(&routeTable{byHost: make(map[string]*Route), fallback: config.DefaultRoute})
+	return m
+}
+
+// Use adds middleware around the built-in proxy, first entry outermost. It
+// must be called before Start.
+func (m *Manager) Use(middlewares ...middleware.Middleware) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.middleware = append(m.middleware, middlewares...)
+}
+
+// SetLogger replaces the logger the proxy reports to. It must be called
+// before Start.
+func (m *Manager) SetLogger(logger *logging.Logger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logger = logger.WithComponent("proxy")
 }
 
 // DetectAvailableProxies scans the system for available proxy software
@@ -123,8 +236,10 @@ func (m *Manager) Start() error {
 		return m.startNginxProxy()
 	case CaddyProxy:
 		return m.startCaddyProxy()
+	case TraefikProxy:
+		return m.startTraefikProxy()
 	case ConfigOnly:
-		return m.generateConfigFiles()
+		return m.startConfigOnly()
 	case NoProxy:
 		return nil // No proxy needed
 	default:
@@ -134,70 +249,289 @@ func (m *Manager) Start() error {
 
 // startBuiltInProxy starts the built-in HTTP proxy server
 func (m *Manager) startBuiltInProxy() error {
+	if err := m.config.Timeouts.Validate(); err != nil {
+		return err
+	}
+	if m.config.BindAddr != "" && net.ParseIP(m.config.BindAddr) == nil {
+		return fmt.Errorf("invalid proxy bind address %q: not an IP address", m.config.BindAddr)
+	}
+	if fallback := m.routes.Load().fallback; fallback != nil {
+		if err := validateRoute(fallback); err != nil {
+			return err
+		}
+	}
+
 	// Check if we can bind to privileged ports
 	canBindPrivileged := privilege.HasRootPrivileges()
 	
 	httpPort := m.config.HTTPPort
-	if httpPort == 0 {
-		// Port 0 means use any available port (testing/dynamic allocation)
-		// Keep it as 0 for dynamic allocation
+	if httpPort == AnyPort {
+		httpPort = 0 // Any available port (testing/dynamic allocation)
 	} else if !canBindPrivileged && httpPort < 1024 {
 		// Fall back to high port and warn user
 		httpPort = 8080
-		fmt.Printf("⚠️  Cannot bind to port %d without privileges. Using port %d instead.\n", m.config.HTTPPort, httpPort)
-		fmt.Printf("💡 Access your tunnels via: http://yourapp.local:%d\n", httpPort)
-		fmt.Printf("💡 Or run with sudo for port 80 access: sudo gotunnel ...\n\n")
+		m.logger.Warn("Cannot bind to a privileged port without root, using a fallback port (run with sudo for port 80)",
+			"port", m.config.HTTPPort, "fallback", httpPort,
+			"example", fmt.Sprintf("http://yourapp.%s:%d", m.config.LocalTLD, httpPort))
 	}
 
 	// Create the reverse proxy handler
-	handler := &httputil.ReverseProxy{
-		Director: m.proxyDirector,
-		ErrorHandler: m.proxyErrorHandler,
-	}
-
-	// Create HTTP server
-	m.server = &http.Server{
-		Addr:              fmt.Sprintf(":%d", httpPort),
-		Handler:           handler,
-		ReadHeaderTimeout: 10 * time.Second,
-		WriteTimeout:      10 * time.Second,
-		IdleTimeout:       60 * time.Second,
+	handler := middleware.Chain(m.routeHandler(), m.middleware...)
+	handler = middleware.Recover(func(r *http.Request, err error, stack []byte) {
+		m.logger.Error("Recovered from panic in proxy handler",
+			"method", r.Method, "host", routeHost(r), "path", r.URL.Path,
+			"error", err, "stack", string(stack))
+	})(handler)
+	handler = middleware.Trace(nil, nil)(handler)
+
+	// Create HTTP server. gRPC clients speak HTTP/2 even without TLS.
+	server := &http.Server{
+		Handler: h2c.NewHandler(handler, &http2.Server{}),
 	}
+	m.config.Timeouts.apply(server)
 
 	// Create listener
-	listener, err := net.Listen("tcp", m.server.Addr)
+	listener, err := net.Listen("tcp", m.listenAddr(httpPort))
 	if err != nil {
-		return fmt.Errorf("failed to create proxy listener on port %d: %w", httpPort, err)
+		return fmt.Errorf("failed to create proxy listener on %s: %w", m.listenAddr(httpPort), err)
 	}
-	m.listener = listener
-	
-	// Store the actual port (important for port 0)
-	if tcpListener, ok := listener.(*net.TCPListener); ok {
-		m.actualPort = tcpListener.Addr().(*net.TCPAddr).Port
-	} else {
-		m.actualPort = httpPort
+	if m.config.ProxyProtocol {
+		listener = netutil.NewProxyProtocolListener(listener)
+	}
+
+	m.server = httpserver.New(server, listener)
+	m.server.OnError = func(err error) {
+		m.logger.Error("Proxy server failed", "error", err)
+	}
+	if err := m.server.Start(nil); err != nil {
+		m.server = nil
+		return fmt.Errorf("failed to start proxy on port %d: %w", httpPort, err)
 	}
+	m.actualPort = m.server.Port() // Differs from httpPort for port 0
 
-	// Start server in background
-	go func() {
-		if err := m.server.Serve(m.listener); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("⚠️  Proxy server error: %v\n", err)
+	m.logger.Info("Built-in proxy started", "port", m.actualPort)
+
+	if m.config.TerminateTLS {
+		if err := m.startTLSListener(handler, canBindPrivileged); err != nil {
+			m.server.Close()
+			m.server, m.actualPort = nil, 0
+			return err
 		}
-	}()
+	}
+	return nil
+}
 
-	fmt.Printf("✅ Built-in proxy started on port %d\n", httpPort)
+// listenAddr is the address the built-in proxy binds for port
+func (m *Manager) listenAddr(port int) string {
+	return net.JoinHostPort(m.config.BindAddr, strconv.Itoa(port))
+}
+
+// startTLSListener serves HTTPS on the configured port, choosing the
+// certificate from the SNI server name of each connection
+func (m *Manager) startTLSListener(handler http.Handler, canBindPrivileged bool) error {
+	httpsPort := m.config.HTTPSPort
+	if httpsPort == AnyPort {
+		httpsPort = 0
+	} else if !canBindPrivileged && httpsPort < 1024 {
+		httpsPort = 8443
+		m.logger.Warn("Cannot bind to a privileged port without root, using a fallback port (run with sudo for port 443)",
+			"port", m.config.HTTPSPort, "fallback", httpsPort)
+	}
+
+	listener, err := net.Listen("tcp", m.listenAddr(httpsPort))
+	if err != nil {
+		return fmt.Errorf("failed to create proxy HTTPS listener on %s: %w", m.listenAddr(httpsPort), err)
+	}
+	if m.config.ProxyProtocol {
+		listener = netutil.NewProxyProtocolListener(listener)
+	}
+
+	server := &http.Server{
+		Handler: handler,
+		TLSConfig: &tls.Config{
+			GetCertificate: m.getCertificate,
+			MinVersion:     tls.VersionTLS12,
+		},
+	}
+	m.config.Timeouts.apply(server)
+
+	m.tlsServer = httpserver.New(server, listener)
+	m.tlsServer.OnError = func(err error) {
+		m.logger.Error("Proxy HTTPS server failed", "error", err)
+	}
+	if err := m.tlsServer.Start(nil); err != nil {
+		m.tlsServer = nil
+		return fmt.Errorf("failed to start proxy HTTPS on port %d: %w", httpsPort, err)
+	}
+	m.tlsPort = m.tlsServer.Port()
+
+	m.logger.Info("Built-in proxy serving HTTPS", "port", m.tlsPort)
 	return nil
 }
 
-// proxyDirector handles routing logic for the reverse proxy
-func (m *Manager) proxyDirector(req *http.Request) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// getCertificate picks the certificate of the route named by SNI
+func (m *Manager) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name == "" {
+		return nil, fmt.Errorf("client did not send an SNI server name")
+	}
 
-	host := strings.Split(req.Host, ":")[0] // Remove port from host header
-	route, exists := m.routes[host]
+	route, exists := m.routes.Load().lookup(name)
+	if !exists || route.Certificate == nil {
+		return nil, fmt.Errorf("no certificate for %s", name)
+	}
+	return route.Certificate, nil
+}
+
+// routeHandler proxies each request to its route's target. gRPC routes get
+// their own reverse proxy that speaks HTTP/2 and flushes every message, and
+// have the server's write timeout lifted so long-lived streams survive it.
+// A route's ResponseTimeout bounds each of its requests.
+func (m *Manager) routeHandler() http.Handler {
+	transport := m.newRouteTransport()
+	proxy := &httputil.ReverseProxy{
+		Director:     m.proxyDirector,
+		ErrorHandler: m.proxyErrorHandler,
+		Transport:    transport,
+		BufferPool:   m.buffers,
+	}
+	grpcProxy := &httputil.ReverseProxy{
+		Director:      m.proxyDirector,
+		ErrorHandler:  m.proxyErrorHandler,
+		Transport:     &grpcTransport{tls: transport, h2c: newH2CTransport()},
+		BufferPool:    m.buffers,
+		FlushInterval: -1,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, _ := m.routes.Load().lookup(routeHost(r))
+		ctx := withRoute(r.Context(), route)
+		if route != nil && route.ResponseTimeout > 0 && r.Header.Get("Upgrade") == "" {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, route.ResponseTimeout)
+			defer cancel()
+		}
+		r = r.WithContext(ctx)
+		if route == nil || !route.GRPC {
+			proxy.ServeHTTP(w, r)
+			return
+		}
+		http.NewResponseController(w).SetWriteDeadline(time.Time{}) // No deadline
+		grpcProxy.ServeHTTP(w, r)
+	})
+}
+
+// grpcTransport reaches gRPC targets over HTTP/2: HTTPS targets through tls,
+// which negotiates h2, and plain ones through h2c
+type grpcTransport struct {
+	tls http.RoundTripper
+	h2c http.RoundTripper
+}
+
+func (t *grpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		return t.tls.RoundTrip(req)
+	}
+	return t.h2c.RoundTrip(req)
+}
+
+// newH2CTransport returns a transport that speaks HTTP/2 without TLS
+func newH2CTransport() *http2.Transport {
+	var dialer net.Dialer
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// routeTransport carries each request over verified, or over insecure when
+// its route skips verifying an HTTPS target. Keeping the two apart means a
+// connection dialed without verification is never reused for a route that
+// wants it.
+type routeTransport struct {
+	verified *http.Transport
+	insecure *http.Transport
+}
+
+func (t *routeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if route := routeFrom(req.Context()); route != nil && route.InsecureSkipVerify && req.URL.Scheme == "https" {
+		return t.insecure.RoundTrip(req)
+	}
+	return t.verified.RoundTrip(req)
+}
+
+// newRouteTransport builds the transport routeHandler proxies through: the
+// one from newTransport, plus a copy of it that skips verification for
+// routes with InsecureSkipVerify
+func (m *Manager) newRouteTransport() *routeTransport {
+	verified := m.newTransport()
+	insecure := verified.Clone()
+	if insecure.TLSClientConfig == nil {
+		insecure.TLSClientConfig = &tls.Config{}
+	}
+	insecure.TLSClientConfig.InsecureSkipVerify = true
+	insecure.TLSClientConfig.VerifyConnection = nil
+	return &routeTransport{verified: verified, insecure: insecure}
+}
+
+// newTransport returns the configured transport, or builds the one used to
+// reach route targets. HTTPS
+// targets that present a route's own certificate (e.g. a gotunnel tunnel
+// with a self-signed cert) are trusted; anything else is verified normally.
+func (m *Manager) newTransport() *http.Transport {
+	if m.config.Transport != nil {
+		return m.config.Transport
+	}
+	transport := netutil.NewTransport(nil)
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: true, // Replaced by verifyTarget below
+		VerifyConnection:   m.verifyTarget,
+	}
+	return transport
+}
+
+// verifyTarget accepts a route's pinned certificate or a chain that verifies
+// against the system roots
+func (m *Manager) verifyTarget(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("target presented no certificate")
+	}
+	leaf := cs.PeerCertificates[0]
+
+	pinned := func(route *Route) bool {
+		return route != nil && route.Certificate != nil && len(route.Certificate.Certificate) > 0 &&
+			bytes.Equal(route.Certificate.Certificate[0], leaf.Raw)
+	}
+	routes := m.routes.Load()
+	for _, route := range routes.byHost {
+		if pinned(route) {
+			return nil
+		}
+	}
+	if pinned(routes.fallback) {
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// proxyDirector points the request at the target of the route routeHandler
+// matched it to
+func (m *Manager) proxyDirector(req *http.Request) {
+	host := routeHost(req)
+	route := routeFrom(req.Context())
 	
-	if !exists {
+	if route == nil {
 		// Default behavior - return 404 will be handled by ErrorHandler
 		req.URL = nil
 		return
@@ -211,70 +545,110 @@ func (m *Manager) proxyDirector(req *http.Request) {
 
 	target := &url.URL{
 		Scheme: scheme,
-		Host:   fmt.Sprintf("%s:%d", route.TargetHost, route.TargetPort),
+		Host:   net.JoinHostPort(route.TargetHost, strconv.Itoa(route.TargetPort)),
 	}
 
 	// Update the request
 	req.URL.Scheme = target.Scheme
 	req.URL.Host = target.Host
-	req.Host = target.Host
+	if !route.PreserveHost {
+		req.Host = target.Host
+	}
 
-	// Add proxy headers
-	req.Header.Set("X-Forwarded-For", getClientIP(req))
+	// Add proxy headers. The proxy is the edge, so only the connection's
+	// peer (or the client a PROXY header named) is known: headers claiming
+	// another address are dropped, and ReverseProxy appends the peer to
+	// X-Forwarded-For, whose earlier entries backends mustn't trust.
+	req.Header.Del("X-Real-IP")
+	req.Header.Del("Forwarded")
 	req.Header.Set("X-Forwarded-Proto", scheme)
 	req.Header.Set("X-Forwarded-Host", host)
 }
 
-// proxyErrorHandler handles proxy errors (like 404 for unknown routes)
+// proxyErrorHandler serves a 404 page listing the routes when the host
+// has none, or a 502 page when its tunnel can't be reached
 func (m *Manager) proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
-	host := strings.Split(r.Host, ":")[0]
-	
+	host := routeHost(r)
+
 	if r.URL == nil {
 		// No route found
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, `<!DOCTYPE html>
-<html>
-<head><title>Tunnel Not Found</title></head>
-<body>
-<h1>🚇 gotunnel - Route Not Found</h1>
-<p>No tunnel configured for <strong>%s</strong></p>
-<p>Available routes:</p>
-<ul>`, host)
-
-		m.mu.RLock()
-		for domain := range m.routes {
-			fmt.Fprintf(w, "<li>%s</li>", domain)
+		suffix := "." + m.config.LocalTLD
+		var routes []string
+		for domain := range m.routes.Load().byHost {
+			if strings.HasSuffix(domain, suffix) { // Each route is stored with and without the TLD
+				routes = append(routes, domain)
+			}
 		}
-		m.mu.RUnlock()
+		sort.Strings(routes)
 
-		fmt.Fprint(w, `</ul>
-<p><em>Configure a tunnel with: <code>gotunnel start [name] --port [port]</code></em></p>
-</body>
-</html>`)
+		message := fmt.Sprintf("No tunnel is configured for %s.", host)
+		if len(routes) > 0 {
+			message += " Available routes:"
+		}
+		errorpage.Write(w, r, errorpage.Page{
+			Status:  http.StatusNotFound,
+			Title:   "Route Not Found",
+			Message: message,
+			Details: routes,
+			Hint:    "Configure a tunnel with: gotunnel start --domain [name] --port [port]",
+		})
 		return
 	}
 
-	// Other proxy errors
-	w.WriteHeader(http.StatusBadGateway)
-	fmt.Fprintf(w, "Proxy Error: %v", err)
+	host = r.Header.Get("X-Forwarded-Host") // The director may have rewritten Host
+	if route := routeFrom(r.Context()); route != nil && route.ResponseTimeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		m.logger.Warn("Proxy request timed out", "domain", host, "target", r.URL.Host, "timeout", route.ResponseTimeout)
+		errorpage.Write(w, r, errorpage.Page{
+			Status:  http.StatusGatewayTimeout,
+			Title:   "Tunnel Timed Out",
+			Message: fmt.Sprintf("The tunnel for %s did not respond within %s.", host, route.ResponseTimeout),
+			Domain:  host,
+			Backend: r.URL.Host,
+			Hint:    "Check whether the app behind the tunnel is stuck, or raise the route's response timeout.",
+		})
+		return
+	}
+	m.logger.Warn("Proxy request failed", "domain", host, "target", r.URL.Host, "error", err)
+	errorpage.Write(w, r, errorpage.Page{
+		Status:  http.StatusBadGateway,
+		Title:   "Tunnel Unavailable",
+		Message: fmt.Sprintf("The proxy could not get a response from the tunnel for %s: %v", host, err),
+		Domain:  host,
+		Backend: r.URL.Host,
+		Hint:    "Check that the tunnel is still running with: gotunnel list",
+	})
 }
 
-// AddRoute adds a new route to the proxy
+// AddRoute adds a new route to the proxy, replacing any for the same
+// domain. A route without a target host or port is rejected. A route for
+// DefaultRouteDomain replaces the default route, which only the built-in
+// proxy serves.
 func (m *Manager) AddRoute(route *Route) error {
+	if err := validateRoute(route); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Normalize domain (remove .local suffix if present for storage)
-	domain := route.Domain
-	if strings.HasSuffix(domain, ".local") {
-		domain = strings.TrimSuffix(domain, ".local")
+	routes := m.routes.Load().clone()
+	if route.Domain == DefaultRouteDomain {
+		routes.fallback = route
+		m.routes.Store(routes)
+		m.logger.Info("Set default proxy route",
+			"target", net.JoinHostPort(route.TargetHost, strconv.Itoa(route.TargetPort)))
+		return nil
 	}
 
-	m.routes[domain+".local"] = route
-	m.routes[domain] = route // Support both with and without .local
+	// Support both with and without the TLD
+	bare, full := routeKeys(route.Domain, m.config.LocalTLD)
+	routes.byHost[bare] = route
+	routes.byHost[full] = route
+	m.routes.Store(routes)
 
-	fmt.Printf("🔗 Added proxy route: %s -> %s:%d\n", route.Domain, route.TargetHost, route.TargetPort)
-	return nil
+	m.logger.Info("Added proxy route", "domain", route.Domain,
+		"target", net.JoinHostPort(route.TargetHost, strconv.Itoa(route.TargetPort)))
+	return m.syncExternalConfig()
 }
 
 // RemoveRoute removes a route from the proxy
@@ -282,51 +656,115 @@ func (m *Manager) RemoveRoute(domain string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Remove both variations
-	delete(m.routes, domain)
-	if strings.HasSuffix(domain, ".local") {
-		delete(m.routes, strings.TrimSuffix(domain, ".local"))
-	} else {
-		delete(m.routes, domain+".local")
+	routes := m.routes.Load().clone()
+	if domain == DefaultRouteDomain {
+		routes.fallback = nil
+		m.routes.Store(routes)
+		m.logger.Info("Removed default proxy route")
+		return nil
 	}
 
-	fmt.Printf("🗑️  Removed proxy route: %s\n", domain)
+	// Remove both variations
+	bare, full := routeKeys(domain, m.config.LocalTLD)
+	delete(routes.byHost, bare)
+	delete(routes.byHost, full)
+	m.routes.Store(routes)
+
+	m.logger.Info("Removed proxy route", "domain", domain)
+	return m.syncExternalConfig()
+}
+
+// syncExternalConfig pushes route changes to an external proxy. Callers must
+// hold m.mu.
+func (m *Manager) syncExternalConfig() error {
+	switch m.config.Mode {
+	case CaddyProxy:
+		if err := m.applyCaddyConfig(); err != nil {
+			return fmt.Errorf("failed to update caddy config: %w", err)
+		}
+	case TraefikProxy:
+		// The file provider watches the file, so writing it is enough
+		if _, err := m.writeTraefikConfig(); err != nil {
+			return fmt.Errorf("failed to update traefik config: %w", err)
+		}
+	case ConfigOnly:
+		if _, err := m.generateConfigFiles(); err != nil {
+			return fmt.Errorf("failed to update %s config: %w", m.config.Type, err)
+		}
+	}
 	return nil
 }
 
-// ListRoutes returns all configured routes
-func (m *Manager) ListRoutes() map[string]*Route {
+// Config returns the configuration the manager was created with, defaults
+// filled in
+func (m *Manager) Config() ProxyConfig {
+	return m.config
+}
+
+// ActualPort returns the port the built-in proxy serves HTTP on, which
+// differs from the configured one for port 0 or a privileged port without
+// root. It's 0 while the built-in proxy isn't running.
+func (m *Manager) ActualPort() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	return m.actualPort
+}
 
-	routes := make(map[string]*Route)
-	for k, v := range m.routes {
-		routes[k] = v
-	}
-	return routes
+// TLSPort returns the port the built-in proxy serves HTTPS on, or 0 unless
+// it's running and terminating TLS
+func (m *Manager) TLSPort() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tlsPort
 }
 
-// Stop shuts down the proxy system
-func (m *Manager) Stop() error {
+// DefaultRoute returns the route unmatched hosts go to, or nil if they get
+// the 404 page
+func (m *Manager) DefaultRoute() *Route {
+	return m.routes.Load().fallback
+}
+
+// ListRoutes returns all configured routes, not counting the default route
+func (m *Manager) ListRoutes() map[string]*Route {
+	return maps.Clone(m.routes.Load().byHost)
+}
+
+// Stop shuts down the proxy system, waiting for in-flight requests until ctx
+// is done and then force-closing their connections
+func (m *Manager) Stop(ctx context.Context) error {
 	m.cancel()
 
 	if m.server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		
-		if err := m.server.Shutdown(ctx); err != nil {
+		if err := m.shutdownServer(ctx, m.server); err != nil {
 			return fmt.Errorf("failed to shutdown proxy server: %w", err)
 		}
 	}
 
-	if m.listener != nil {
-		m.listener.Close()
+	if m.tlsServer != nil {
+		if err := m.shutdownServer(ctx, m.tlsServer); err != nil {
+			return fmt.Errorf("failed to shutdown proxy HTTPS server: %w", err)
+		}
 	}
 
-	fmt.Println("✅ Proxy stopped")
+	m.mu.Lock()
+	m.actualPort, m.tlsPort = 0, 0
+	m.mu.Unlock()
+
+	m.logger.Info("Proxy stopped")
 	return nil
 }
 
+// shutdownServer gracefully shuts server down, force-closing connections
+// still active when ctx is done
+func (m *Manager) shutdownServer(ctx context.Context, server *httpserver.Server) error {
+	err := server.Shutdown(ctx)
+	if errors.Is(err, httpserver.ErrForceClosed) {
+		m.logger.Warn("Requests still running at the shutdown deadline, closed their connections")
+		return nil
+	}
+	return err
+}
+
 // Helper functions
 
 func commandExists(cmd string) bool {
@@ -334,18 +772,12 @@ func commandExists(cmd string) bool {
 	return err == nil
 }
 
-func getClientIP(req *http.Request) string {
-	// Try X-Forwarded-For first
-	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
-		return strings.Split(xff, ",")[0]
+// routeHost returns the name a request is routed by. Over TLS the SNI server
+// name wins, since it selected the certificate the client verified; the Host
+// header is only used for plain HTTP or clients that sent no SNI.
+func routeHost(req *http.Request) string {
+	if req.TLS != nil && req.TLS.ServerName != "" {
+		return strings.TrimSuffix(strings.ToLower(req.TLS.ServerName), ".")
 	}
-	
-	// Try X-Real-IP
-	if xri := req.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-	
-	// Fall back to remote address
-	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
-	return ip
-}
\ No newline at end of file
+	return strings.ToLower(strings.Split(req.Host, ":")[0]) // Remove port from host header
+}
@@ -1,16 +1,41 @@
 package proxy
 
 import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/johncferguson/gotunnel/internal/logging"
+	"github.com/johncferguson/gotunnel/internal/middleware"
+	"github.com/johncferguson/gotunnel/internal/netutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestNewManager(t *testing.T) {
@@ -25,7 +50,7 @@ func TestNewManager(t *testing.T) {
 	assert.Equal(t, BuiltInProxy, manager.config.Mode)
 	assert.Equal(t, 8080, manager.config.HTTPPort)
 	assert.Equal(t, 8443, manager.config.HTTPSPort)
-	assert.NotNil(t, manager.routes)
+	assert.NotNil(t, manager.routes.Load())
 }
 
 func TestDetectAvailableProxies(t *testing.T) {
@@ -67,6 +92,27 @@ func TestAddAndRemoveRoute(t *testing.T) {
 	assert.NotContains(t, routes, "test")
 }
 
+func TestSetLoggerQuietSuppressesInfo(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "gotunnel.log")
+	logger, err := logging.New(&logging.Config{
+		Level:  logging.LevelError,
+		Format: logging.FormatText,
+		Output: logFile,
+	})
+	require.NoError(t, err)
+
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy})
+	manager.SetLogger(logger)
+	require.NoError(t, manager.AddRoute(&Route{Domain: "quiet.local", TargetHost: "127.0.0.1", TargetPort: 3000}))
+	require.NoError(t, manager.RemoveRoute("quiet.local"))
+	logger.Error("backend exploded")
+
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "proxy route")
+	assert.Contains(t, string(data), "backend exploded")
+}
+
 func TestBuiltInProxyRouting(t *testing.T) {
 	// Create a test backend server
 	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -75,38 +121,37 @@ func TestBuiltInProxyRouting(t *testing.T) {
 	defer backend.Close()
 
 	// Parse backend URL
-	backendHost := strings.TrimPrefix(backend.URL, "http://")
-	parts := strings.Split(backendHost, ":")
-	require.Len(t, parts, 2)
-	
+	backendHost, backendPort, err := parseHostPort(strings.TrimPrefix(backend.URL, "http://"))
+	require.NoError(t, err)
+
 	// Create proxy manager with dynamic port allocation (port 0)
 	config := ProxyConfig{
 		Mode:     BuiltInProxy,
-		HTTPPort: 0, // Use dynamic port allocation for CI compatibility
+		HTTPPort: AnyPort, // Use dynamic port allocation for CI compatibility
 	}
 	manager := NewManager(config)
 
 	// Add route
 	route := &Route{
 		Domain:     "test.local",
-		TargetHost: parts[0],
-		TargetPort: mustParseInt(parts[1]),
+		TargetHost: backendHost,
+		TargetPort: backendPort,
 		HTTPS:      false,
 	}
-	err := manager.AddRoute(route)
+	err = manager.AddRoute(route)
 	require.NoError(t, err)
 
 	// Start proxy
 	err = manager.Start()
 	require.NoError(t, err)
-	defer manager.Stop()
+	defer manager.Stop(context.Background())
 
 	// Give proxy time to start
 	time.Sleep(100 * time.Millisecond)
 
 	// Test proxy request using actual allocated port
 	client := &http.Client{Timeout: 5 * time.Second}
-	actualPort := manager.actualPort
+	actualPort := manager.ActualPort()
 	req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%d", actualPort), nil)
 	require.NoError(t, err)
 	req.Host = "test.local" // Set Host header for routing
@@ -122,25 +167,287 @@ func TestBuiltInProxyRouting(t *testing.T) {
 	assert.Contains(t, string(body), "Hello from backend!")
 }
 
+func TestBuiltInProxyUsesCustomTransport(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "via custom transport")
+	}))
+	defer backend.Close()
+
+	// The route's target doesn't exist; only the custom dialer can reach the backend
+	var dialed []string
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			var d net.Dialer
+			return d.DialContext(ctx, network, backend.Listener.Addr().String())
+		},
+	}
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort, Transport: transport})
+	require.NoError(t, manager.AddRoute(&Route{Domain: "custom.local", TargetHost: "127.0.0.1", TargetPort: 1}))
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/", manager.ActualPort()), nil)
+	require.NoError(t, err)
+	req.Host = "custom.local"
+	resp, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, "via custom transport", string(body))
+	assert.Equal(t, []string{"127.0.0.1:1"}, dialed)
+}
+
+func TestBuiltInProxyStreamsGRPC(t *testing.T) {
+	echo := grpc.StreamDesc{
+		StreamName:    "Echo",
+		ServerStreams: true,
+		ClientStreams: true,
+		Handler: func(_ any, stream grpc.ServerStream) error {
+			for {
+				var msg wrapperspb.StringValue
+				if err := stream.RecvMsg(&msg); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				if err := stream.SendMsg(wrapperspb.String("echo: " + msg.GetValue())); err != nil {
+					return err
+				}
+			}
+		},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	backend := grpc.NewServer()
+	backend.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Echo",
+		HandlerType: (*any)(nil),
+		Streams:     []grpc.StreamDesc{echo},
+	}, struct{}{})
+	go backend.Serve(listener)
+	defer backend.Stop()
+
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	require.NoError(t, manager.AddRoute(&Route{
+		Domain:     "grpc.local",
+		TargetHost: "127.0.0.1",
+		TargetPort: listener.Addr().(*net.TCPAddr).Port,
+		GRPC:       true,
+	}))
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+
+	conn, err := grpc.NewClient(fmt.Sprintf("127.0.0.1:%d", manager.ActualPort()),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithAuthority("grpc.local"))
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &echo, "/test.Echo/Echo")
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stream.SendMsg(wrapperspb.String(fmt.Sprint("ping ", i))))
+		var reply wrapperspb.StringValue
+		require.NoError(t, stream.RecvMsg(&reply))
+		assert.Equal(t, fmt.Sprint("echo: ping ", i), reply.GetValue())
+	}
+	require.NoError(t, stream.CloseSend())
+	var reply wrapperspb.StringValue
+	assert.Equal(t, io.EOF, stream.RecvMsg(&reply), "the grpc-status trailer should reach the client")
+}
+
+func TestBuiltInProxyStopForceClosesStreams(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	require.NoError(t, manager.Start())
+	require.NoError(t, manager.AddRoute(&Route{
+		Domain:     "stream.local",
+		TargetHost: "127.0.0.1",
+		TargetPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+	}))
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/", manager.ActualPort()), nil)
+	require.NoError(t, err)
+	req.Host = "stream.local"
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	require.NoError(t, manager.Stop(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+
+	_, err = io.ReadAll(resp.Body)
+	assert.Error(t, err)
+}
+
+func TestBuiltInProxyPreserveHost(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	}))
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+
+	for _, preserve := range []bool{false, true} {
+		require.NoError(t, manager.AddRoute(&Route{
+			Domain:       "vhost.local",
+			TargetHost:   "127.0.0.1",
+			TargetPort:   backendPort,
+			PreserveHost: preserve,
+		}))
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d", manager.ActualPort()), nil)
+		require.NoError(t, err)
+		req.Host = "vhost.local"
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		want := fmt.Sprintf("127.0.0.1:%d", backendPort)
+		if preserve {
+			want = "vhost.local"
+		}
+		assert.Equal(t, want, string(body), "preserve=%v", preserve)
+	}
+}
+
+// forwardedBackend starts a backend that echoes the forwarding headers it
+// receives, returning its port
+func forwardedBackend(t *testing.T) int {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"X-Forwarded-For": r.Header.Get("X-Forwarded-For"),
+			"X-Real-IP":       r.Header.Get("X-Real-IP"),
+			"Forwarded":       r.Header.Get("Forwarded"),
+		})
+	}))
+	t.Cleanup(backend.Close)
+	return backend.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestBuiltInProxyIgnoresSpoofedClientHeaders(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+	require.NoError(t, manager.AddRoute(&Route{Domain: "spoof.local", TargetHost: "127.0.0.1", TargetPort: forwardedBackend(t)}))
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d", manager.ActualPort()), nil)
+	require.NoError(t, err)
+	req.Host = "spoof.local"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	req.Header.Set("X-Real-IP", "203.0.113.9")
+	req.Header.Set("Forwarded", "for=203.0.113.9")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var seen map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&seen))
+	// The client's chain is kept, but the peer the proxy saw comes last
+	assert.Equal(t, "203.0.113.9, 127.0.0.1", seen["X-Forwarded-For"])
+	assert.Empty(t, seen["X-Real-IP"])
+	assert.Empty(t, seen["Forwarded"])
+}
+
+func TestBuiltInProxyProtocolOverridesClientHeaders(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort, ProxyProtocol: true})
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+	require.NoError(t, manager.AddRoute(&Route{Domain: "lb.local", TargetHost: "127.0.0.1", TargetPort: forwardedBackend(t)}))
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", manager.ActualPort()))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = fmt.Fprint(conn, "PROXY TCP4 198.51.100.7 10.0.0.1 54321 80\r\n"+
+		"GET / HTTP/1.1\r\nHost: lb.local\r\nX-Forwarded-For: 203.0.113.9\r\nX-Real-IP: 203.0.113.9\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var seen map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&seen))
+	assert.Equal(t, "203.0.113.9, 198.51.100.7", seen["X-Forwarded-For"])
+	assert.Empty(t, seen["X-Real-IP"])
+}
+
+func TestBuiltInProxyMiddleware(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Join(r.Header.Values("X-Chain"), ","))
+	}))
+	defer backend.Close()
+
+	tag := func(name string) middleware.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Add("X-Chain", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	manager.Use(tag("first"), tag("second"))
+	require.NoError(t, manager.AddRoute(&Route{
+		Domain:     "chain.local",
+		TargetHost: "127.0.0.1",
+		TargetPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+	}))
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d", manager.ActualPort()), nil)
+	require.NoError(t, err)
+	req.Host = "chain.local"
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "first,second", string(body))
+}
+
 func TestBuiltInProxyNotFound(t *testing.T) {
 	// Create proxy manager with dynamic port
 	config := ProxyConfig{
 		Mode:     BuiltInProxy,
-		HTTPPort: 0, // Use dynamic port allocation
+		HTTPPort: AnyPort, // Use dynamic port allocation
 	}
 	manager := NewManager(config)
 
 	// Start proxy without any routes
 	err := manager.Start()
 	require.NoError(t, err)
-	defer manager.Stop()
+	defer manager.Stop(context.Background())
 
 	// Give proxy time to start
 	time.Sleep(100 * time.Millisecond)
 
 	// Test request to unknown route
 	client := &http.Client{Timeout: 5 * time.Second}
-	req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%d", manager.actualPort), nil)
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%d", manager.ActualPort()), nil)
 	require.NoError(t, err)
 	req.Host = "unknown.local"
 
@@ -156,10 +463,140 @@ func TestBuiltInProxyNotFound(t *testing.T) {
 	assert.Contains(t, string(body), "unknown.local")
 }
 
+func TestBuiltInProxyDefaultRoute(t *testing.T) {
+	backend := func(name string) int {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, r.Header.Get("X-Forwarded-Host"))
+		}))
+		t.Cleanup(server.Close)
+		return server.Listener.Addr().(*net.TCPAddr).Port
+	}
+
+	manager := NewManager(ProxyConfig{
+		Mode:         BuiltInProxy,
+		HTTPPort:     AnyPort,
+		DefaultRoute: &Route{TargetHost: "127.0.0.1", TargetPort: backend("landing")},
+	})
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+	require.NoError(t, manager.AddRoute(&Route{Domain: "app.local", TargetHost: "127.0.0.1", TargetPort: backend("app")}))
+
+	get := func(host string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d", manager.ActualPort()), nil)
+		require.NoError(t, err)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	_, body := get("app.local")
+	assert.Equal(t, "app app.local", body, "matched hosts keep their route")
+	_, body = get("unknown.local")
+	assert.Equal(t, "landing unknown.local", body)
+
+	// A "*" route replaces the default, and removing it restores the 404 page
+	require.NoError(t, manager.AddRoute(&Route{Domain: DefaultRouteDomain, TargetHost: "127.0.0.1", TargetPort: backend("catch-all")}))
+	_, body = get("unknown.local")
+	assert.Equal(t, "catch-all unknown.local", body)
+	assert.Equal(t, DefaultRouteDomain, manager.DefaultRoute().Domain)
+	assert.NotContains(t, manager.ListRoutes(), DefaultRouteDomain)
+
+	require.NoError(t, manager.RemoveRoute(DefaultRouteDomain))
+	assert.Nil(t, manager.DefaultRoute())
+	status, _ := get("unknown.local")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestBuiltInProxyTracesRequests(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer provider.Shutdown(context.Background())
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+
+	traceparents := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer backend.Close()
+
+	port, err := netutil.FreePort()
+	require.NoError(t, err)
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: port})
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, manager.AddRoute(&Route{Domain: "traced.local", TargetHost: "127.0.0.1", TargetPort: backendPort}))
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://127.0.0.1:%d/jobs/1", manager.ActualPort()), nil)
+	require.NoError(t, err)
+	req.Host = "traced.local"
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	assert.Equal(t, "PUT", attrs["http.request.method"].AsString())
+	assert.Equal(t, "traced.local", attrs["server.address"].AsString())
+	assert.Equal(t, "/jobs/1", attrs["url.path"].AsString())
+	assert.Equal(t, int64(http.StatusAccepted), attrs["http.response.status_code"].AsInt64())
+
+	// The backend continues the proxy's trace
+	assert.Equal(t, fmt.Sprintf("00-%s-%s-01", span.SpanContext.TraceID(), span.SpanContext.SpanID()), <-traceparents)
+}
+
+func TestBuiltInProxyBadGateway(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+
+	// Nothing listens on the route's target
+	deadPort, err := netutil.FreePort()
+	require.NoError(t, err)
+	require.NoError(t, manager.AddRoute(&Route{Domain: "gone.local", TargetHost: "127.0.0.1", TargetPort: deadPort}))
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d", manager.ActualPort()), nil)
+	require.NoError(t, err)
+	req.Host = "gone.local"
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var page struct {
+		Error   string `json:"error"`
+		Domain  string `json:"domain"`
+		Backend string `json:"backend"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	assert.Equal(t, "Tunnel Unavailable", page.Error)
+	assert.Equal(t, "gone.local", page.Domain)
+	assert.Equal(t, fmt.Sprintf("127.0.0.1:%d", deadPort), page.Backend)
+}
+
 func TestProxyLifecycle(t *testing.T) {
 	config := ProxyConfig{
 		Mode:     BuiltInProxy,
-		HTTPPort: 0, // Use dynamic port allocation
+		HTTPPort: AnyPort, // Use dynamic port allocation
 	}
 	manager := NewManager(config)
 
@@ -169,10 +606,10 @@ func TestProxyLifecycle(t *testing.T) {
 
 	// Verify server is running
 	assert.NotNil(t, manager.server)
-	assert.NotNil(t, manager.listener)
+	assert.NotZero(t, manager.ActualPort())
 
 	// Stop proxy
-	err = manager.Stop()
+	err = manager.Stop(context.Background())
 	require.NoError(t, err)
 
 	// Give time for shutdown
@@ -180,13 +617,16 @@ func TestProxyLifecycle(t *testing.T) {
 
 	// Verify connection fails after shutdown
 	client := &http.Client{Timeout: 1 * time.Second}
-	_, err = client.Get(fmt.Sprintf("http://localhost:%d", manager.actualPort))
+	_, err = client.Get(fmt.Sprintf("http://localhost:%d", manager.ActualPort()))
 	assert.Error(t, err) // Should fail to connect
 }
 
 func TestConfigOnlyMode(t *testing.T) {
+	configDir := t.TempDir()
 	config := ProxyConfig{
-		Mode: ConfigOnly,
+		Mode:       ConfigOnly,
+		Type:       NginxProxyType,
+		ConfigPath: configDir,
 	}
 	manager := NewManager(config)
 
@@ -217,7 +657,68 @@ func TestConfigOnlyMode(t *testing.T) {
 
 	// Should not create server in config-only mode
 	assert.Nil(t, manager.server)
-	assert.Nil(t, manager.listener)
+	assert.Zero(t, manager.ActualPort())
+
+	content, err := os.ReadFile(filepath.Join(configDir, "nginx.conf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "server_name app1.local;")
+	assert.Contains(t, string(content), "proxy_pass https://127.0.0.1:3001;")
+}
+
+func TestActualPort(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	assert.Zero(t, manager.ActualPort(), "not started yet")
+
+	require.NoError(t, manager.Start())
+	port := manager.ActualPort()
+	require.NotZero(t, port)
+	assert.Zero(t, manager.TLSPort(), "not terminating TLS")
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	require.NoError(t, err)
+	conn.Close()
+
+	require.NoError(t, manager.Stop(context.Background()))
+	assert.Zero(t, manager.ActualPort())
+}
+
+func TestBindAddr(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort, BindAddr: "127.0.0.1"})
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+	port := strconv.Itoa(manager.ActualPort())
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", port), time.Second)
+	require.NoError(t, err)
+	conn.Close()
+
+	// Not reachable through any of the machine's other addresses
+	addrs, err := net.InterfaceAddrs()
+	require.NoError(t, err)
+	tried := 0
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		tried++
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(ipNet.IP.String(), port), time.Second)
+		if err == nil {
+			conn.Close()
+		}
+		assert.Error(t, err, "proxy bound to loopback answered on %s", ipNet.IP)
+	}
+	if tried == 0 {
+		t.Log("no non-loopback address to check against")
+	}
+}
+
+func TestInvalidBindAddr(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort, BindAddr: "localhost"})
+	err := manager.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bind address")
+	assert.Zero(t, manager.ActualPort())
 }
 
 func TestNoProxyMode(t *testing.T) {
@@ -232,10 +733,10 @@ func TestNoProxyMode(t *testing.T) {
 
 	// Should not create server
 	assert.Nil(t, manager.server)
-	assert.Nil(t, manager.listener)
+	assert.Zero(t, manager.ActualPort())
 
 	// Stop should also succeed
-	err = manager.Stop()
+	err = manager.Stop(context.Background())
 	require.NoError(t, err)
 }
 
@@ -278,29 +779,241 @@ func TestRouteNormalization(t *testing.T) {
 	}
 }
 
-// Helper function for tests
-func mustParseInt(s string) int {
-	if s == "80" {
-		return 80
-	} else if s == "443" {
-		return 443
+func TestRouteNormalizationCustomTLD(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: NoProxy, LocalTLD: ".test"})
+
+	require.NoError(t, manager.AddRoute(&Route{Domain: "app", TargetHost: "127.0.0.1", TargetPort: 3000}))
+	routes := manager.ListRoutes()
+	assert.Contains(t, routes, "app")
+	assert.Contains(t, routes, "app.test")
+	assert.NotContains(t, routes, "app.local")
+	assert.Equal(t, "app.test", manager.siteName("app"))
+
+	require.NoError(t, manager.RemoveRoute("app.test"))
+	assert.Empty(t, manager.ListRoutes())
+}
+
+// testCertificate creates a self-signed certificate for domain
+func testCertificate(t *testing.T, domain string) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestBuiltInProxySNIRouting(t *testing.T) {
+	backends := map[string]*httptest.Server{}
+	roots := x509.NewCertPool()
+	httpsPort, err := netutil.FreePort()
+	require.NoError(t, err)
+
+	manager := NewManager(ProxyConfig{
+		Mode:         BuiltInProxy,
+		HTTPPort:     AnyPort,
+		HTTPSPort:    httpsPort,
+		TerminateTLS: true,
+	})
+	for _, domain := range []string{"alpha.local", "beta.local"} {
+		name := domain
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "backend %s", name)
+		}))
+		defer backend.Close()
+		backends[domain] = backend
+
+		cert := testCertificate(t, domain)
+		roots.AddCert(cert.Leaf)
+		require.NoError(t, manager.AddRoute(&Route{
+			Domain:      domain,
+			TargetHost:  "127.0.0.1",
+			TargetPort:  backend.Listener.Addr().(*net.TCPAddr).Port,
+			Certificate: cert,
+		}))
 	}
-	// For test backend ports, parse from the test server URL
-	// This is a simplified parser for test purposes
-	switch s {
-	case "80":
-		return 80
-	case "443":
-		return 443
-	default:
-		// For httptest server ports, we'll just return a reasonable default
-		// In real code you'd want proper parsing
-		if len(s) == 4 || len(s) == 5 {
-			// Assume it's a valid port number from httptest
-			var port int
-			fmt.Sscanf(s, "%d", &port)
-			return port
+
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+	assert.Equal(t, httpsPort, manager.TLSPort())
+
+	get := func(serverName, host string) (*http.Response, string, error) {
+		client := &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{ServerName: serverName, RootCAs: roots},
+			},
+		}
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://127.0.0.1:%d/", httpsPort), nil)
+		require.NoError(t, err)
+		req.Host = host
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, "", err
 		}
-		return 8080
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body), nil
+	}
+
+	// Each name gets its own certificate and backend
+	for _, domain := range []string{"alpha.local", "beta.local"} {
+		resp, body, err := get(domain, domain)
+		require.NoError(t, err, domain)
+		assert.Equal(t, domain, resp.TLS.PeerCertificates[0].Subject.CommonName)
+		assert.Equal(t, "backend "+domain, body)
+	}
+
+	// SNI decides the route when it disagrees with the Host header
+	resp, body, err := get("beta.local", "alpha.local")
+	require.NoError(t, err)
+	assert.Equal(t, "beta.local", resp.TLS.PeerCertificates[0].Subject.CommonName)
+	assert.Equal(t, "backend beta.local", body)
+
+	// Names without a route get no certificate at all
+	_, _, err = get("unknown.local", "unknown.local")
+	assert.Error(t, err)
+}
+
+func TestProxyTrustsPinnedTargetCertificate(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secure backend")
+	}))
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+
+	request := func() *http.Response {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", manager.ActualPort()), nil)
+		require.NoError(t, err)
+		req.Host = "secure.local"
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// An unknown self-signed target is rejected...
+	require.NoError(t, manager.AddRoute(&Route{
+		Domain:     "secure.local",
+		TargetHost: "127.0.0.1",
+		TargetPort: backendPort,
+		HTTPS:      true,
+	}))
+	resp := request()
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	// ...unless it presents the route's own certificate
+	require.NoError(t, manager.AddRoute(&Route{
+		Domain:      "secure.local",
+		TargetHost:  "127.0.0.1",
+		TargetPort:  backendPort,
+		HTTPS:       true,
+		Certificate: &backend.TLS.Certificates[0],
+	}))
+	resp = request()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "secure backend", string(body))
+}
+
+func TestBuiltInProxySkipsVerifyPerRoute(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "self-signed backend")
+	}))
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+
+	// Two routes to the same self-signed target, only one skipping verification
+	require.NoError(t, manager.AddRoute(&Route{
+		Domain:             "insecure.local",
+		TargetHost:         "127.0.0.1",
+		TargetPort:         backendPort,
+		HTTPS:              true,
+		InsecureSkipVerify: true,
+	}))
+	require.NoError(t, manager.AddRoute(&Route{
+		Domain:     "verified.local",
+		TargetHost: "127.0.0.1",
+		TargetPort: backendPort,
+		HTTPS:      true,
+	}))
+
+	get := func(host string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", manager.ActualPort()), nil)
+		require.NoError(t, err)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
 	}
-}
\ No newline at end of file
+
+	status, body := get("insecure.local")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "self-signed backend", body)
+
+	// The connection the first route opened isn't reused to skip verification here
+	status, _ = get("verified.local")
+	assert.Equal(t, http.StatusBadGateway, status)
+}
+
+func TestBuiltInProxyRouteResponseTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+	require.NoError(t, manager.AddRoute(&Route{
+		Domain:          "slow.local",
+		TargetHost:      "127.0.0.1",
+		TargetPort:      backendPort,
+		ResponseTimeout: 200 * time.Millisecond,
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", manager.ActualPort()), nil)
+	require.NoError(t, err)
+	req.Host = "slow.local"
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Contains(t, string(body), "did not respond within 200ms")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
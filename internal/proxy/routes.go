@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"strings"
+)
+
+// routeTable is a snapshot of the proxy's routes. It's never modified once
+// published: AddRoute and RemoveRoute swap in an updated copy, so a request
+// sees either all of a change (both keys of a route, say) or none of it.
+type routeTable struct {
+	byHost   map[string]*Route // Each route is keyed with and without the TLD
+	fallback *Route            // DefaultRoute; nil serves the 404 page
+}
+
+// lookup returns the route for host, or the default route if none matches
+func (rt *routeTable) lookup(host string) (*Route, bool) {
+	if route, ok := rt.byHost[host]; ok {
+		return route, true
+	}
+	return rt.fallback, rt.fallback != nil
+}
+
+// clone returns a copy of rt that can be modified before it's published
+func (rt *routeTable) clone() *routeTable {
+	return &routeTable{byHost: maps.Clone(rt.byHost), fallback: rt.fallback}
+}
+
+// Routes returns each route once, sorted by domain, where ListRoutes has
+// every route under two keys. The default route isn't included.
+func (m *Manager) Routes() []*Route {
+	seen := make(map[*Route]bool)
+	var routes []*Route
+	for _, route := range m.routes.Load().byHost {
+		if !seen[route] {
+			seen[route] = true
+			routes = append(routes, route)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Domain < routes[j].Domain
+	})
+	return routes
+}
+
+// routeKeys returns the two names a domain is routed by: bare and under the
+// TLD. Hosts are matched case-insensitively.
+func routeKeys(domain, tld string) (bare, full string) {
+	suffix := "." + tld
+	bare = strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(domain), "."), suffix)
+	return bare, bare + suffix
+}
+
+type routeContextKey struct{}
+
+// withRoute records the route a request was matched to, so every later
+// step (picking a transport, directing it) agrees even if the routes change
+// in the meantime
+func withRoute(ctx context.Context, route *Route) context.Context {
+	return context.WithValue(ctx, routeContextKey{}, route)
+}
+
+// routeFrom returns the route recorded by withRoute, or nil if none matched
+func routeFrom(ctx context.Context) *Route {
+	route, _ := ctx.Value(routeContextKey{}).(*Route)
+	return route
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteKeys(t *testing.T) {
+	for _, domain := range []string{"app", "app.local", "App.Local", "app.local."} {
+		bare, full := routeKeys(domain, "local")
+		assert.Equal(t, "app", bare, domain)
+		assert.Equal(t, "app.local", full, domain)
+	}
+}
+
+func TestRemoveRouteClearsBothKeys(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy})
+	require.NoError(t, manager.AddRoute(&Route{Domain: "Mixed.local", TargetHost: "127.0.0.1", TargetPort: 3000}))
+	assert.Len(t, manager.ListRoutes(), 2)
+	assert.Len(t, manager.Routes(), 1)
+
+	// Removing by either name, in any case, drops both keys
+	require.NoError(t, manager.RemoveRoute("MIXED"))
+	assert.Empty(t, manager.ListRoutes())
+}
+
+// TestRoutesChangeWhileServing adds and removes a route while requests are
+// in flight. Run with -race: every request must either reach the route's
+// backend or get the 404 page, and a stable route must never be disturbed.
+func TestRoutesChangeWhileServing(t *testing.T) {
+	backend := func(name string) int {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		}))
+		t.Cleanup(server.Close)
+		return server.Listener.Addr().(*net.TCPAddr).Port
+	}
+	stablePort, churnPort := backend("stable"), backend("churn")
+
+	// Thousands of route changes; only log what goes wrong
+	logger, err := logging.New(&logging.Config{Level: logging.LevelError, Output: "stderr"})
+	require.NoError(t, err)
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort})
+	manager.SetLogger(logger)
+	require.NoError(t, manager.Start())
+	defer manager.Stop(context.Background())
+	require.NoError(t, manager.AddRoute(&Route{Domain: "stable.local", TargetHost: "127.0.0.1", TargetPort: stablePort}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			manager.AddRoute(&Route{Domain: "churn", TargetHost: "127.0.0.1", TargetPort: churnPort})
+			manager.RemoveRoute("churn.local")
+		}
+	}()
+
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 8}}
+	url := fmt.Sprintf("http://127.0.0.1:%d/", manager.ActualPort())
+	get := func(host string) (int, string, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return 0, "", err
+		}
+		req.Host = host
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), err
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				status, body, err := get("stable.local")
+				if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, status) || !assert.Equal(t, "stable", body) {
+					return
+				}
+
+				status, body, err = get("churn.local")
+				if !assert.NoError(t, err) {
+					return
+				}
+				if status == http.StatusOK {
+					assert.Equal(t, "churn", body)
+				} else {
+					assert.Equal(t, http.StatusNotFound, status, "a changing route must route or 404, not fail")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, manager.RemoveRoute("churn"))
+	routes := manager.ListRoutes()
+	assert.NotContains(t, routes, "churn")
+	assert.NotContains(t, routes, "churn.local")
+	assert.Contains(t, routes, "stable.local")
+}
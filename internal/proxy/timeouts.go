@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Default timeouts for the built-in proxy's client connections
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultWriteTimeout      = 10 * time.Second
+	DefaultIdleTimeout       = 60 * time.Second
+)
+
+// ServerTimeouts bounds the built-in proxy's client connections. Each field
+// means what it does on http.Server, so zero disables it: a WriteTimeout of
+// 0 lets long downloads and server-sent events stream without being cut
+// off, and a ReadTimeout of 0 (the default) does the same for uploads.
+type ServerTimeouts struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" json:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" json:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" json:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" json:"idle_timeout"`
+}
+
+// DefaultServerTimeouts returns the timeouts used when ProxyConfig.Timeouts
+// is nil
+func DefaultServerTimeouts() ServerTimeouts {
+	return ServerTimeouts{
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+		WriteTimeout:      DefaultWriteTimeout,
+		IdleTimeout:       DefaultIdleTimeout,
+	}
+}
+
+// Validate rejects negative timeouts
+func (t ServerTimeouts) Validate() error {
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read header", t.ReadHeaderTimeout},
+		{"read", t.ReadTimeout},
+		{"write", t.WriteTimeout},
+		{"idle", t.IdleTimeout},
+	} {
+		if timeout.value < 0 {
+			return fmt.Errorf("invalid proxy %s timeout: %s can't be negative", timeout.name, timeout.value)
+		}
+	}
+	return nil
+}
+
+// apply sets the timeouts on server
+func (t ServerTimeouts) apply(server *http.Server) {
+	server.ReadHeaderTimeout = t.ReadHeaderTimeout
+	server.ReadTimeout = t.ReadTimeout
+	server.WriteTimeout = t.WriteTimeout
+	server.IdleTimeout = t.IdleTimeout
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerTimeoutsValidate(t *testing.T) {
+	assert.NoError(t, DefaultServerTimeouts().Validate())
+	assert.NoError(t, ServerTimeouts{}.Validate(), "zero disables every timeout")
+
+	timeouts := DefaultServerTimeouts()
+	timeouts.WriteTimeout = -time.Second
+	assert.ErrorContains(t, timeouts.Validate(), "write timeout")
+
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: AnyPort, Timeouts: &timeouts})
+	assert.ErrorContains(t, manager.Start(), "can't be negative")
+}
+
+func TestNewManagerDefaultsTimeouts(t *testing.T) {
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy})
+	require.NotNil(t, manager.config.Timeouts)
+	assert.Equal(t, DefaultServerTimeouts(), *manager.config.Timeouts)
+}
+
+// streamThroughProxy fetches a response the backend writes a chunk at a time
+// over about 600ms, through a proxy whose write timeout is writeTimeout
+func streamThroughProxy(t *testing.T, writeTimeout time.Duration) (string, error) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 4; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(150 * time.Millisecond)
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	port, err := netutil.FreePort()
+	require.NoError(t, err)
+	timeouts := DefaultServerTimeouts()
+	timeouts.WriteTimeout = writeTimeout
+	manager := NewManager(ProxyConfig{Mode: BuiltInProxy, HTTPPort: port, Timeouts: &timeouts})
+	require.NoError(t, manager.Start())
+	t.Cleanup(func() { manager.Stop(context.Background()) })
+
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, manager.AddRoute(&Route{Domain: "events.local", TargetHost: "127.0.0.1", TargetPort: backendPort}))
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", manager.ActualPort()), nil)
+	require.NoError(t, err)
+	req.Host = "events.local"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestBuiltInProxyStreamsWithoutWriteTimeout(t *testing.T) {
+	body, err := streamThroughProxy(t, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "data: 0\n\ndata: 1\n\ndata: 2\n\ndata: 3\n\n", body)
+
+	// A short write timeout cuts the same stream off part-way
+	body, err = streamThroughProxy(t, 200*time.Millisecond)
+	if err == nil {
+		assert.False(t, strings.HasSuffix(body, "data: 3\n\n"), "stream should have been cut off")
+	}
+}
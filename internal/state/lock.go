@@ -0,0 +1,115 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/johncferguson/gotunnel/internal/process"
+)
+
+var (
+	// ErrLocked means another running gotunnel holds the lock file
+	ErrLocked = errors.New("another gotunnel is already running")
+
+	// ErrStaleLock means the lock file was left by a gotunnel that has
+	// since exited without removing it
+	ErrStaleLock = errors.New("stale lock file")
+)
+
+// Lock is the lock file a running gotunnel holds, so a second one doesn't
+// race it on hosts file edits and mDNS names
+type Lock struct {
+	path string
+}
+
+// For testing purposes
+var getLockFileFunc = getLockFile
+
+func getLockFile() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".gotunnel", "gotunnel.lock")
+}
+
+// AcquireLock takes the default lock file; see AcquireLockAt
+func AcquireLock(force bool) (*Lock, error) {
+	return AcquireLockAt(getLockFileFunc(), force) // Use the function variable for testing
+}
+
+// AcquireLockAt creates path holding this process's PID. If another
+// process's lock is there and that process is running, it fails with
+// ErrLocked. If the process has died, the lock is stale: force takes it
+// over, otherwise it fails with ErrStaleLock.
+func AcquireLockAt(path string, force bool) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file %s: %w", path, err)
+			}
+			return &Lock{path: path}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		pid, err := readLockPID(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // Released since we tried to create it
+		}
+		if err != nil {
+			return nil, err
+		}
+		if process.Alive(pid) {
+			return nil, fmt.Errorf("%w (pid %d, lock file %s)", ErrLocked, pid, path)
+		}
+		if !force {
+			return nil, fmt.Errorf("%w %s: pid %d is no longer running; use --force to take it over", ErrStaleLock, path, pid)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale lock file: %w", err)
+		}
+	}
+}
+
+// readLockPID returns the PID recorded in a lock file, or 0 if it holds
+// none
+func readLockPID(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, nil
+	}
+	return pid, nil
+}
+
+// Release removes the lock file, unless another process has since taken
+// it over
+func (l *Lock) Release() error {
+	pid, err := readLockPID(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if pid != os.Getpid() {
+		return nil
+	}
+	return os.Remove(l.path)
+}
@@ -0,0 +1,76 @@
+package state
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLock(t *testing.T) {
+	tempDir, cleanup := setupTestStateDir(t)
+	defer cleanup()
+	getLockFileFunc = func() string {
+		return filepath.Join(tempDir, "gotunnel.lock")
+	}
+	defer func() { getLockFileFunc = getLockFile }()
+
+	lock, err := AcquireLock(false)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "gotunnel.lock"))
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(data))
+
+	// A running holder can't be taken over, even with force
+	_, err = AcquireLock(false)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.Contains(t, err.Error(), strconv.Itoa(os.Getpid()))
+	_, err = AcquireLock(true)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, lock.Release())
+	_, err = os.Stat(filepath.Join(tempDir, "gotunnel.lock"))
+	assert.True(t, os.IsNotExist(err))
+
+	lock, err = AcquireLock(false)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+}
+
+func TestAcquireStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gotunnel.lock")
+
+	// A process that has exited leaves its PID behind
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	require.NoError(t, cmd.Run())
+	deadPID := strconv.Itoa(cmd.Process.Pid)
+	require.NoError(t, os.WriteFile(path, []byte(deadPID+"\n"), 0644))
+
+	_, err := AcquireLockAt(path, false)
+	assert.ErrorIs(t, err, ErrStaleLock)
+	assert.Contains(t, err.Error(), deadPID)
+
+	lock, err := AcquireLockAt(path, true)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(data))
+	require.NoError(t, lock.Release())
+}
+
+func TestReleaseKeepsTakenOverLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gotunnel.lock")
+	lock, err := AcquireLockAt(path, false)
+	require.NoError(t, err)
+
+	// Another process took the lock over
+	require.NoError(t, os.WriteFile(path, []byte("1\n"), 0644))
+	require.NoError(t, lock.Release())
+	_, err = os.Stat(path)
+	assert.NoError(t, err, "the other process's lock file stays")
+}
@@ -1,17 +1,66 @@
 package state
 
 import (
+	"encoding/json"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// TunnelState is a tunnel as recorded in the state file. Fields added after
+// the first release are optional, so older files still load, with zero
+// values meaning the defaults.
 type TunnelState struct {
-	Port   int    `yaml:"port"`
-	Domain string `yaml:"domain"`
-	HTTPS  bool   `yaml:"https"`
+	Port      int    `yaml:"port" json:"port"`
+	Domain    string `yaml:"domain" json:"domain"`
+	HTTPS     bool   `yaml:"https" json:"https"`
+	HTTPPort  int    `yaml:"http_port,omitempty" json:"http_port,omitempty"` // Tunnel listen ports; zero means 80/443
+	HTTPSPort int    `yaml:"https_port,omitempty" json:"https_port,omitempty"`
+
+	TargetHost string            `yaml:"target_host,omitempty" json:"target_host,omitempty"` // Backend host; empty means 127.0.0.1
+	Aliases    []string          `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+	Labels     map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// Format is the encoding of a state file
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// FormatForPath picks a state file's format from its extension: JSON for
+// .json, YAML for anything else
+func FormatForPath(path string) Format {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+func (f Format) marshal(tunnels []TunnelState) ([]byte, error) {
+	if f == FormatJSON {
+		if tunnels == nil {
+			tunnels = []TunnelState{} // [] rather than null
+		}
+		data, err := json.MarshalIndent(tunnels, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	return yaml.Marshal(tunnels)
+}
+
+func (f Format) unmarshal(data []byte, tunnels *[]TunnelState) error {
+	if f == FormatJSON {
+		return json.Unmarshal(data, tunnels)
+	}
+	return yaml.Unmarshal(data, tunnels)
 }
 
 // For testing purposes
@@ -22,14 +71,20 @@ func getStateFile() string {
 	return filepath.Join(homeDir, ".gotunnel", "tunnels.yaml")
 }
 
+// SaveTunnels writes tunnels to the default state file
 func SaveTunnels(tunnels []TunnelState) error {
+	return SaveTunnelsTo(getStateFileFunc(), tunnels) // Use the function variable for testing
+}
+
+// SaveTunnelsTo writes tunnels to stateFile, as JSON or YAML depending on
+// its extension
+func SaveTunnelsTo(stateFile string, tunnels []TunnelState) error {
 	log.Println("Saving tunnel states...")
-	data, err := yaml.Marshal(tunnels)
+	data, err := FormatForPath(stateFile).marshal(tunnels)
 	if err != nil {
 		return err
 	}
 
-	stateFile := getStateFileFunc() // Use the function variable for testing
 	if err := os.MkdirAll(filepath.Dir(stateFile), 0755); err != nil {
 		return err
 	}
@@ -42,9 +97,15 @@ func SaveTunnels(tunnels []TunnelState) error {
 	return nil
 }
 
+// LoadTunnels reads the default state file
 func LoadTunnels() ([]TunnelState, error) {
+	return LoadTunnelsFrom(getStateFileFunc()) // Use the function variable for testing
+}
+
+// LoadTunnelsFrom reads stateFile, as JSON or YAML depending on its
+// extension. A missing file holds no tunnels.
+func LoadTunnelsFrom(stateFile string) ([]TunnelState, error) {
 	log.Println("Loading tunnel states...")
-	stateFile := getStateFileFunc() // Use the function variable for testing
 	data, err := os.ReadFile(stateFile)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -56,7 +117,7 @@ func LoadTunnels() ([]TunnelState, error) {
 	}
 
 	var tunnels []TunnelState
-	if err := yaml.Unmarshal(data, &tunnels); err != nil {
+	if err := FormatForPath(stateFile).unmarshal(data, &tunnels); err != nil {
 		log.Printf("Failed to unmarshal tunnel states: %v", err)
 		return nil, err
 	}
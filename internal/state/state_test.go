@@ -119,3 +119,96 @@ func TestTunnelStateSerialization(t *testing.T) {
 	assert.Equal(t, "test.local", loadedTunnels[0].Domain)
 	assert.Equal(t, true, loadedTunnels[0].HTTPS)
 }
+
+func TestFormatForPath(t *testing.T) {
+	assert.Equal(t, FormatJSON, FormatForPath("tunnels.json"))
+	assert.Equal(t, FormatJSON, FormatForPath("/tmp/TUNNELS.JSON"))
+	assert.Equal(t, FormatYAML, FormatForPath("tunnels.yaml"))
+	assert.Equal(t, FormatYAML, FormatForPath("tunnels.yml"))
+	assert.Equal(t, FormatYAML, FormatForPath("tunnels"))
+}
+
+func TestSaveAndLoadTunnelsFormats(t *testing.T) {
+	tempDir, cleanup := setupTestStateDir(t)
+	defer cleanup()
+
+	tunnels := []TunnelState{
+		{Port: 8080, Domain: "test1.local", HTTPS: false},
+		{Port: 8443, Domain: "test2.local", HTTPS: true, HTTPPort: 8081, HTTPSPort: 8444},
+	}
+
+	for _, tt := range []struct {
+		file string
+		want string // Marks the file as written in this format
+	}{
+		{"tunnels.json", `"domain": "test1.local"`},
+		{"tunnels.yaml", "domain: test1.local"},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join(tempDir, tt.file)
+			require.NoError(t, SaveTunnelsTo(path, tunnels))
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Contains(t, string(data), tt.want)
+
+			loaded, err := LoadTunnelsFrom(path)
+			require.NoError(t, err)
+			assert.Equal(t, tunnels, loaded)
+		})
+	}
+}
+
+func TestLoadTunnelsJSONErrors(t *testing.T) {
+	tempDir, cleanup := setupTestStateDir(t)
+	defer cleanup()
+
+	path := filepath.Join(tempDir, "tunnels.json")
+	require.NoError(t, os.WriteFile(path, []byte("- port: 8080\n"), 0644))
+	_, err := LoadTunnelsFrom(path)
+	assert.Error(t, err, "YAML in a .json file isn't read as YAML")
+
+	require.NoError(t, SaveTunnelsTo(path, nil))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", string(data))
+}
+
+func TestFullTunnelStateRoundTrip(t *testing.T) {
+	tempDir, cleanup := setupTestStateDir(t)
+	defer cleanup()
+
+	tunnels := []TunnelState{{
+		Port:       3000,
+		Domain:     "app.local",
+		HTTPS:      true,
+		HTTPPort:   8080,
+		HTTPSPort:  8443,
+		TargetHost: "172.17.0.2",
+		Aliases:    []string{"www.app.local", "api.app.local"},
+		Labels:     map[string]string{"project": "web", "env": "dev"},
+	}}
+	for _, file := range []string{"tunnels.yaml", "tunnels.json"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(tempDir, file)
+			require.NoError(t, SaveTunnelsTo(path, tunnels))
+
+			loaded, err := LoadTunnelsFrom(path)
+			require.NoError(t, err)
+			assert.Equal(t, tunnels, loaded)
+		})
+	}
+}
+
+func TestLoadTunnelsOlderFormat(t *testing.T) {
+	tempDir, cleanup := setupTestStateDir(t)
+	defer cleanup()
+
+	// Written before ports, target host, aliases and labels were recorded
+	path := filepath.Join(tempDir, "tunnels.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("- port: 3000\n  domain: app.local\n  https: true\n"), 0644))
+
+	loaded, err := LoadTunnelsFrom(path)
+	require.NoError(t, err)
+	assert.Equal(t, []TunnelState{{Port: 3000, Domain: "app.local", HTTPS: true}}, loaded)
+}
@@ -0,0 +1,146 @@
+// Package static serves a directory over HTTP, as the in-process backend
+// for gotunnel serve.
+package static
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/johncferguson/gotunnel/internal/httpserver"
+)
+
+// indexFile is served for a directory, and by IndexFallback
+const indexFile = "index.html"
+
+// Options controls how a directory is served
+type Options struct {
+	// Listing lists the files in directories without an index.html,
+	// instead of answering 404
+	Listing bool
+
+	// IndexFallback serves the root index.html for paths that don't
+	// exist, for single-page apps that route in the browser
+	IndexFallback bool
+
+	// Dotfiles serves files and directories whose names start with a dot,
+	// such as .env and .git, which are hidden (404) otherwise
+	Dotfiles bool
+}
+
+// Handler serves the files under dir. Directories serve their index.html,
+// or a listing with Options.Listing.
+func Handler(dir string, opts Options) http.Handler {
+	var root http.FileSystem = http.Dir(dir)
+	if !opts.Dotfiles {
+		root = hideDotfiles{root}
+	}
+	files := http.FileServer(root)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		info, err := stat(root, name)
+		switch {
+		case os.IsNotExist(err) && opts.IndexFallback:
+			serveIndex(w, r, root)
+		case err == nil && info.IsDir() && !opts.Listing && !hasIndex(root, name):
+			if opts.IndexFallback {
+				serveIndex(w, r, root)
+				return
+			}
+			http.NotFound(w, r)
+		default:
+			files.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Serve starts serving dir on a free loopback port, for a tunnel to point
+// at. Close or shut down the returned server to stop it.
+func Serve(dir string, opts Options) (*httpserver.Server, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't serve %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("can't serve %s: not a directory", dir)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for %s: %w", dir, err)
+	}
+	server := httpserver.New(&http.Server{Handler: Handler(dir, opts)}, listener)
+	if err := server.Start(nil); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// hideDotfiles is a FileSystem that can't open, or list, names starting
+// with a dot
+type hideDotfiles struct {
+	http.FileSystem
+}
+
+func (fsys hideDotfiles) Open(name string) (http.File, error) {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return nil, os.ErrNotExist
+		}
+	}
+	f, err := fsys.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return dotfileHidingFile{f}, nil
+}
+
+// dotfileHidingFile leaves names starting with a dot out of listings
+type dotfileHidingFile struct {
+	http.File
+}
+
+func (f dotfileHidingFile) Readdir(n int) ([]os.FileInfo, error) {
+	entries, err := f.File.Readdir(n)
+	visible := entries[:0]
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			visible = append(visible, entry)
+		}
+	}
+	return visible, err
+}
+
+func stat(root http.FileSystem, name string) (os.FileInfo, error) {
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func hasIndex(root http.FileSystem, dir string) bool {
+	info, err := stat(root, path.Join(dir, indexFile))
+	return err == nil && !info.IsDir()
+}
+
+// serveIndex answers with the root index.html, or 404 without one
+func serveIndex(w http.ResponseWriter, r *http.Request, root http.FileSystem) {
+	f, err := root.Open("/" + indexFile)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, indexFile, info.ModTime(), f)
+}
@@ -0,0 +1,106 @@
+package static
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDir holds an index.html, a file, and a directory without an index
+func testDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>home</h1>"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("SECRET=1"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".git"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "config"), []byte("[core]"), 0644))
+	return dir
+}
+
+func get(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	body, err := io.ReadAll(rec.Result().Body)
+	require.NoError(t, err)
+	return rec.Code, string(body)
+}
+
+func TestHandler(t *testing.T) {
+	dir := testDir(t)
+
+	tests := []struct {
+		name     string
+		opts     Options
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "file", path: "/notes.txt", wantCode: http.StatusOK, wantBody: "hello"},
+		{name: "root index", path: "/", wantCode: http.StatusOK, wantBody: "<h1>home</h1>"},
+		{name: "missing", path: "/nope", wantCode: http.StatusNotFound},
+		{name: "no listing", path: "/docs/", wantCode: http.StatusNotFound},
+		{name: "listing", opts: Options{Listing: true}, path: "/docs/", wantCode: http.StatusOK, wantBody: "a.txt"},
+		{name: "fallback", opts: Options{IndexFallback: true}, path: "/app/route", wantCode: http.StatusOK, wantBody: "<h1>home</h1>"},
+		{name: "fallback keeps files", opts: Options{IndexFallback: true}, path: "/notes.txt", wantCode: http.StatusOK, wantBody: "hello"},
+		{name: "escape", path: "/../../etc/passwd", wantCode: http.StatusNotFound},
+		{name: "dotfile", path: "/.env", wantCode: http.StatusNotFound},
+		{name: "dot directory", path: "/.git/config", wantCode: http.StatusNotFound},
+		{name: "dot directory listing", opts: Options{Listing: true}, path: "/.git/", wantCode: http.StatusNotFound},
+		{name: "dotfile with fallback", opts: Options{IndexFallback: true}, path: "/.env", wantCode: http.StatusOK, wantBody: "<h1>home</h1>"},
+		{name: "dotfiles allowed", opts: Options{Dotfiles: true}, path: "/.env", wantCode: http.StatusOK, wantBody: "SECRET=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := get(t, Handler(dir, tt.opts), tt.path)
+			assert.Equal(t, tt.wantCode, code)
+			assert.Contains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestListingHidesDotfiles(t *testing.T) {
+	dir := testDir(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", ".draft"), []byte("wip"), 0644))
+
+	code, body := get(t, Handler(dir, Options{Listing: true}), "/docs/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "a.txt")
+	assert.NotContains(t, body, ".draft")
+
+	_, body = get(t, Handler(dir, Options{Listing: true, Dotfiles: true}), "/docs/")
+	assert.Contains(t, body, ".draft")
+}
+
+func TestServe(t *testing.T) {
+	dir := testDir(t)
+	server, err := Serve(dir, Options{})
+	require.NoError(t, err)
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/notes.txt", server.Port()))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	_, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/", server.Port()))
+	assert.Error(t, err)
+
+	_, err = Serve(filepath.Join(dir, "notes.txt"), Options{})
+	assert.Error(t, err)
+	_, err = Serve(filepath.Join(dir, "missing"), Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,227 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/errorpage"
+	"github.com/johncferguson/gotunnel/internal/logging"
+	"github.com/johncferguson/gotunnel/internal/netutil"
+	"golang.org/x/net/http2"
+)
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultDialTimeout     = 5 * time.Second
+	defaultKeepAlive       = 30 * time.Second
+	defaultMaxIdleConns    = 16 // Idle connections kept per backend
+	defaultIdleConnTimeout = 90 * time.Second
+)
+
+// backendDialer dials the backend, retrying transient failures such as a
+// backend that is still starting up
+type backendDialer struct {
+	dialer  *net.Dialer
+	retries int           // Additional attempts after the first dial
+	backoff time.Duration // Delay before the first retry, doubled each time
+}
+
+func newBackendDialer(retries int, backoff time.Duration) *backendDialer {
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	return &backendDialer{
+		dialer:  &net.Dialer{Timeout: defaultDialTimeout, KeepAlive: defaultKeepAlive},
+		retries: retries,
+		backoff: backoff,
+	}
+}
+
+// backendDialerFor returns a dialer with the retries, dial timeout and
+// keep-alive set in opts
+func backendDialerFor(opts Options) *backendDialer {
+	d := newBackendDialer(opts.BackendRetries, opts.BackendRetryBackoff)
+	if opts.BackendDialTimeout > 0 {
+		d.dialer.Timeout = opts.BackendDialTimeout
+	}
+	if opts.BackendKeepAlive != 0 {
+		d.dialer.KeepAlive = opts.BackendKeepAlive
+	}
+	return d
+}
+
+// DialContext dials addr, retrying transient errors with exponential backoff
+func (d *backendDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	delay := d.backoff
+	for attempt := 0; ; attempt++ {
+		conn, err := d.dialer.DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		if attempt >= d.retries || !isTransientDialError(err) {
+			return nil, fmt.Errorf("%w: %w", ErrBackendUnreachable, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrBackendUnreachable, err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// newTransport returns opts.Transport, or builds the reverse proxy transport
+// around the retrying dialer, keeping idle backend connections for reuse as
+// opts allows. BackendInsecureSkipVerify lets HTTPS backends use self-signed
+// certificates.
+func (d *backendDialer) newTransport(opts Options) *http.Transport {
+	if opts.Transport != nil {
+		return opts.Transport
+	}
+	transport := netutil.NewTransport(d.DialContext)
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: opts.BackendInsecureSkipVerify}
+	transport.MaxIdleConnsPerHost = defaultMaxIdleConns
+	if opts.BackendMaxIdleConns > 0 {
+		transport.MaxIdleConnsPerHost = opts.BackendMaxIdleConns
+	}
+	transport.IdleConnTimeout = idleConnTimeout(opts)
+	transport.ResponseHeaderTimeout = opts.ResponseTimeout
+	return transport
+}
+
+// h2c reports whether the backend is reached over HTTP/2 without TLS
+func (o Options) h2c() bool {
+	return o.BackendH2C || (o.GRPC && o.BackendScheme == "http")
+}
+
+// flushInterval is the reverse proxy's FlushInterval: gRPC messages are
+// flushed as soon as they arrive, anything else as ReverseProxy decides
+func flushInterval(opts Options) time.Duration {
+	if opts.GRPC {
+		return -1
+	}
+	return 0
+}
+
+// idleConnTimeout is how long idle backend connections are kept
+func idleConnTimeout(opts Options) time.Duration {
+	if opts.BackendIdleConnTimeout > 0 {
+		return opts.BackendIdleConnTimeout
+	}
+	return defaultIdleConnTimeout
+}
+
+// roundTripper returns the transport the reverse proxy reaches the backend
+// through: HTTP/2 over cleartext (h2c) for BackendH2C and plain-HTTP gRPC
+// backends, otherwise newTransport's
+func (d *backendDialer) roundTripper(opts Options) http.RoundTripper {
+	if !opts.h2c() {
+		return d.newTransport(opts)
+	}
+	return &http2.Transport{
+		AllowHTTP: true,
+		// h2c skips TLS, so the "TLS" dial is a plain one
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return d.DialContext(ctx, network, addr)
+		},
+		IdleConnTimeout: idleConnTimeout(opts),
+	}
+}
+
+// withResponseTimeout cancels each request to next after timeout, so a hung
+// backend can't hold the client. Upgrade requests are left alone: the
+// transport's ResponseHeaderTimeout covers their handshake, and a deadline
+// would cut the WebSocket off later.
+func withResponseTimeout(next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isResponseTimeout reports whether err means the backend was too slow to
+// respond, as opposed to unreachable (a dial that timed out)
+func isResponseTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	var opErr *net.OpError
+	return errors.As(err, &netErr) && netErr.Timeout() && !(errors.As(err, &opErr) && opErr.Op == "dial")
+}
+
+// isTransientDialError reports whether a dial failure is worth retrying
+func isTransientDialError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// isConnRefused reports whether nothing is listening on the backend port
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// backendErrorHandler returns a ReverseProxy ErrorHandler that serves a
+// 502 page naming the tunnel and its backend instead of Go's empty default
+// response, and counts it in the tunnel's bad gateways
+func backendErrorHandler(t *Tunnel, logger *logging.Logger) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		target := t.backend()
+		backend := target.String()
+
+		// A slow backend is up, just not answering in time
+		if t.opts.ResponseTimeout > 0 && isResponseTimeout(err) {
+			logger.WithContext(r.Context()).Warn("Backend response timed out",
+				"backend", backend,
+				"timeout", t.opts.ResponseTimeout,
+				"error", err,
+			)
+			t.recordBackendError(err)
+			errorpage.Write(w, r, errorpage.Page{
+				Status:  http.StatusGatewayTimeout,
+				Title:   "Backend Timed Out",
+				Message: fmt.Sprintf("%s did not respond within %s.", backend, t.opts.ResponseTimeout),
+				Domain:  t.Domain,
+				Backend: backend,
+				Hint:    "Check whether your app is stuck, or raise the tunnel's response timeout.",
+			})
+			return
+		}
+
+		reason := fmt.Sprintf("gotunnel could not get a response from %s: %v", backend, err)
+		if isConnRefused(err) {
+			reason = fmt.Sprintf("Nothing is listening on %s.", backend)
+		}
+
+		logger.WithContext(r.Context()).Warn("Backend request failed",
+			"backend", backend,
+			"connection_refused", isConnRefused(err),
+			"error", err,
+		)
+		t.badGateways.Add(1)
+		t.recordBackendError(err)
+		if t.backendDown.CompareAndSwap(false, true) {
+			t.event(EventBackendDown, err)
+		}
+
+		errorpage.Write(w, r, errorpage.Page{
+			Status:  http.StatusBadGateway,
+			Title:   "Backend Unavailable",
+			Message: reason,
+			Domain:  t.Domain,
+			Backend: backend,
+			Hint:    fmt.Sprintf("Check that your app is running and listening on port %d.", target.port),
+		})
+	}
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stalledListener returns the address of a loopback listener whose accept
+// queue is full, so further connection attempts hang until they time out
+func stalledListener(t *testing.T) string {
+	t.Helper()
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { syscall.Close(fd) })
+	require.NoError(t, syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}))
+	require.NoError(t, syscall.Listen(fd, 0))
+	sa, err := syscall.Getsockname(fd)
+	require.NoError(t, err)
+	addr := fmt.Sprintf("127.0.0.1:%d", sa.(*syscall.SockaddrInet4).Port)
+
+	// Nothing accepts, so each connection stays queued until the queue is full
+	for i := 0; i < 8; i++ {
+		conn, err := net.DialTimeout("tcp", addr, 200*time.Millisecond)
+		if err != nil {
+			return addr
+		}
+		t.Cleanup(func() { conn.Close() })
+	}
+	t.Skip("could not fill the listener's accept queue")
+	return ""
+}
+
+func TestBackendDialTimeout(t *testing.T) {
+	addr := stalledListener(t)
+
+	dialer := backendDialerFor(Options{BackendRetries: 3, BackendDialTimeout: 150 * time.Millisecond})
+	start := time.Now()
+	_, err := dialer.DialContext(context.Background(), "tcp", addr)
+	elapsed := time.Since(start)
+
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrBackendUnreachable)
+	assert.False(t, isConnRefused(err))
+	// A timeout isn't retried, so this is one attempt, not four
+	assert.GreaterOrEqual(t, elapsed, 150*time.Millisecond)
+	assert.Less(t, elapsed, time.Second)
+}
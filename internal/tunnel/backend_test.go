@@ -0,0 +1,430 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// reservePort returns a loopback port that nothing is listening on
+func reservePort(t *testing.T) int {
+	t.Helper()
+	port, err := netutil.FreePort()
+	require.NoError(t, err)
+	return port
+}
+
+func TestBackendDialerRetriesUntilBackendIsUp(t *testing.T) {
+	port := reservePort(t)
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	// Bring the backend up after the first attempt has already failed
+	started := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(75 * time.Millisecond)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			started <- nil
+			return
+		}
+		started <- l
+	}()
+
+	dialer := newBackendDialer(5, 50*time.Millisecond)
+	conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	conn.Close()
+
+	if l := <-started; l != nil {
+		l.Close()
+	}
+}
+
+func TestBackendDialerGivesUp(t *testing.T) {
+	addr := fmt.Sprintf("127.0.0.1:%d", reservePort(t))
+
+	dialer := newBackendDialer(2, 10*time.Millisecond)
+	_, err := dialer.DialContext(context.Background(), "tcp", addr)
+	require.Error(t, err)
+	assert.True(t, isConnRefused(err))
+	assert.ErrorIs(t, err, ErrBackendUnreachable)
+}
+
+func TestTunnelRetriesBackendStartup(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backendPort := reservePort(t)
+	err := manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort:         backendPort,
+		Domain:              "test-retry.local",
+		HTTPPort:            8196,
+		HTTPSPort:           8496,
+		BackendRetries:      5,
+		BackendRetryBackoff: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	// The backend only starts listening after the tunnel's first dial fails
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "backend is up")
+	})}
+	defer srv.Close()
+	go func() {
+		time.Sleep(75 * time.Millisecond)
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", backendPort))
+		if err == nil {
+			srv.Serve(l)
+		}
+	}()
+
+	resp, err := http.Get("http://127.0.0.1:8196/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "backend is up", string(body))
+}
+
+func TestTunnelBackendDownErrorPage(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backendPort := reservePort(t)
+	err := manager.StartTunnelWithPorts(context.Background(), backendPort, "test-down.local", false, 8197, 8497)
+	require.NoError(t, err)
+
+	resp, err := http.Get("http://127.0.0.1:8197/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Contains(t, string(body), "Nothing is listening on")
+	assert.Contains(t, string(body), fmt.Sprintf("localhost:%d", backendPort))
+	assert.Contains(t, string(body), "test-down.local")
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	// API clients get the same details as JSON
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:8197/api", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var page struct {
+		Status  int    `json:"status"`
+		Domain  string `json:"domain"`
+		Backend string `json:"backend"`
+		Hint    string `json:"hint"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	assert.Equal(t, http.StatusBadGateway, page.Status)
+	assert.Equal(t, "test-down.local", page.Domain)
+	assert.Equal(t, fmt.Sprintf("localhost:%d", backendPort), page.Backend)
+	assert.Contains(t, page.Hint, strconv.Itoa(backendPort))
+
+	info, ok := manager.GetTunnel("test-down.local")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), info["bad_gateways"])
+}
+
+func TestTunnelResponseTimeout(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			// Hang well past the timeout, until the tunnel gives up
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		fmt.Fprint(w, "fast")
+	}))
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	err := manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort:     backendPort,
+		Domain:          "test-slow.local",
+		HTTPPort:        8289,
+		ResponseTimeout: 200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	resp, err := http.Get("http://127.0.0.1:8289/slow")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Contains(t, string(body), "did not respond within 200ms")
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	resp, err = http.Get("http://127.0.0.1:8289/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "fast", string(body))
+
+	// A slow backend isn't an unreachable one
+	info, ok := manager.GetTunnel("test-slow.local")
+	require.True(t, ok)
+	assert.Equal(t, int64(0), info["bad_gateways"])
+
+	assert.ErrorIs(t, manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: backendPort, Domain: "test-negative.local", HTTPPort: 8290, ResponseTimeout: -time.Second,
+	}), ErrInvalidOptions)
+}
+
+func TestTunnelToHTTPSBackend(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "secure backend, tls=%v", r.TLS != nil)
+	}))
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	err := manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort:               backendPort,
+		Domain:                    "tls-backend.local",
+		HTTPPort:                  8214,
+		HTTPSPort:                 8514,
+		BackendScheme:             "https",
+		BackendInsecureSkipVerify: true,
+	})
+	require.NoError(t, err)
+
+	resp, err := http.Get("http://127.0.0.1:8214/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "secure backend, tls=true", string(body))
+
+	// Without skip-verify the self-signed backend certificate is rejected
+	err = manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort:   backendPort,
+		Domain:        "tls-backend-strict.local",
+		HTTPPort:      8215,
+		HTTPSPort:     8515,
+		BackendScheme: "https",
+	})
+	require.NoError(t, err)
+
+	resp, err = http.Get("http://127.0.0.1:8215/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestTunnelRejectsUnknownBackendScheme(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	err := manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort:   8080,
+		Domain:        "bad-scheme.local",
+		HTTPPort:      8216,
+		BackendScheme: "ftp",
+	})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+}
+
+func TestTunnelReusesBackendConnections(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	var conns atomic.Int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	err := manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort:            backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:                 "test-reuse.local",
+		HTTPPort:               8244,
+		BackendKeepAlive:       10 * time.Second,
+		BackendMaxIdleConns:    4,
+		BackendIdleConnTimeout: time.Minute,
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		resp, err := http.Get("http://127.0.0.1:8244/")
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, int32(1), conns.Load(), "sequential requests should share one backend connection")
+}
+
+func TestTunnelUsesCustomTransport(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer backend.Close()
+	backendAddr := backend.Listener.Addr().String()
+
+	var dials atomic.Int32
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials.Add(1)
+			var d net.Dialer
+			return d.DialContext(ctx, network, backendAddr)
+		},
+	}
+	err := manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "test-transport.local",
+		HTTPPort:    8249,
+		Transport:   transport,
+	})
+	require.NoError(t, err)
+
+	resp, err := http.Get("http://127.0.0.1:8249/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, "ok", string(body))
+	assert.Equal(t, int32(1), dials.Load(), "requests should go through the custom transport")
+}
+
+func TestTunnelSpeaksH2CToBackend(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	err := manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "test-h2c.local",
+		HTTPPort:    8250,
+		BackendH2C:  true,
+	})
+	require.NoError(t, err)
+
+	resp, err := http.Get("http://127.0.0.1:8250/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "HTTP/2.0", string(body), "the backend should be reached over HTTP/2")
+}
+
+// echoStream is a bidirectional streaming gRPC method replying to each
+// message as it arrives
+var echoStream = grpc.StreamDesc{
+	StreamName:    "Echo",
+	ServerStreams: true,
+	ClientStreams: true,
+	Handler: func(_ any, stream grpc.ServerStream) error {
+		for {
+			var msg wrapperspb.StringValue
+			if err := stream.RecvMsg(&msg); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := stream.SendMsg(wrapperspb.String("echo: " + msg.GetValue())); err != nil {
+				return err
+			}
+		}
+	},
+}
+
+func TestTunnelStreamsGRPC(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	backend := grpc.NewServer()
+	backend.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Echo",
+		HandlerType: (*any)(nil),
+		Streams:     []grpc.StreamDesc{echoStream},
+	}, struct{}{})
+	go backend.Serve(listener)
+	defer backend.Stop()
+
+	err = manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "test-grpc.local",
+		HTTPPort:    8251,
+		GRPC:        true,
+	})
+	require.NoError(t, err)
+
+	conn, err := grpc.NewClient("127.0.0.1:8251", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &echoStream, "/test.Echo/Echo")
+	require.NoError(t, err)
+
+	// Each reply must arrive while the stream is still open in both directions
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stream.SendMsg(wrapperspb.String(fmt.Sprint("ping ", i))))
+		var reply wrapperspb.StringValue
+		require.NoError(t, stream.RecvMsg(&reply))
+		assert.Equal(t, fmt.Sprint("echo: ping ", i), reply.GetValue())
+	}
+
+	// A clean end of stream needs the backend's grpc-status trailer
+	require.NoError(t, stream.CloseSend())
+	var reply wrapperspb.StringValue
+	assert.Equal(t, io.EOF, stream.RecvMsg(&reply))
+}
@@ -0,0 +1,251 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/errorpage"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 10 * time.Second
+)
+
+// CircuitBreaker stops a tunnel proxying to a backend that keeps failing.
+// After FailureThreshold consecutive failures (the backend can't be reached
+// or answers 502, 503 or 504) the circuit opens and requests get an
+// immediate 503 for Cooldown. Then one request is let through as a probe:
+// if it succeeds the circuit closes, otherwise it opens for another
+// Cooldown. Tunnels that check backend health (HealthGatedMDNS) probe as
+// soon as a check finds the backend accepting connections again.
+type CircuitBreaker struct {
+	FailureThreshold int           `yaml:"failure_threshold,omitempty" json:"failure_threshold,omitempty"` // Default 5
+	Cooldown         time.Duration `yaml:"cooldown,omitempty" json:"cooldown,omitempty"`                   // Default 10s
+}
+
+// Validate rejects negative thresholds and cooldowns
+func (c CircuitBreaker) Validate() error {
+	if c.FailureThreshold < 0 {
+		return fmt.Errorf("failure threshold can't be negative: %d", c.FailureThreshold)
+	}
+	if c.Cooldown < 0 {
+		return fmt.Errorf("cooldown can't be negative: %s", c.Cooldown)
+	}
+	return nil
+}
+
+// circuitState is where a breaker is in its closed, open, half-open cycle
+type circuitState int
+
+const (
+	circuitClosed   circuitState = iota // Requests flow, failures are counted
+	circuitOpen                         // Requests fail fast until the cooldown ends
+	circuitHalfOpen                     // One probe request is in flight
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitClosed:
+		return "closed"
+	case circuitOpen:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// breaker tracks one backend's circuit
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	// onChange is called, with mu held, when the circuit opens after being
+	// closed and when it closes again
+	onChange func(state circuitState)
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int       // Consecutive failures while closed
+	openedAt time.Time // When the circuit last opened
+	probedAt time.Time // When the current probe was let through
+}
+
+func newBreaker(cfg CircuitBreaker, onChange func(state circuitState)) *breaker {
+	b := &breaker{
+		threshold: cfg.FailureThreshold,
+		cooldown:  cfg.Cooldown,
+		now:       time.Now,
+		onChange:  onChange,
+	}
+	if b.threshold == 0 {
+		b.threshold = defaultBreakerThreshold
+	}
+	if b.cooldown == 0 {
+		b.cooldown = defaultBreakerCooldown
+	}
+	return b
+}
+
+// allow reports whether a request may go to the backend. Once the cooldown
+// is over the first caller becomes the probe; wait is how long the others
+// should back off for.
+func (b *breaker) allow() (ok bool, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitClosed:
+		return true, 0
+	case circuitOpen:
+		remaining := b.cooldown - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return false, remaining
+		}
+		b.probedAt = b.now()
+		b.setState(circuitHalfOpen)
+		return true, 0
+	default:
+		// A probe that never reported back (e.g. it panicked) doesn't hold
+		// the circuit half-open for good
+		remaining := b.cooldown - b.now().Sub(b.probedAt)
+		if remaining > 0 {
+			return false, remaining
+		}
+		b.probedAt = b.now()
+		return true, 0
+	}
+}
+
+// success records a working response, closing the circuit
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.setState(circuitClosed)
+}
+
+// failure records a failed request, opening the circuit once there have
+// been enough in a row, or straight away if it was the probe
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitClosed:
+		b.failures++
+		if b.failures < b.threshold {
+			return
+		}
+	case circuitOpen:
+		return // Requests let through before the circuit opened
+	}
+	b.failures = 0
+	b.openedAt = b.now()
+	b.setState(circuitOpen)
+}
+
+// abandon records a request that ended without telling whether the backend
+// works, e.g. because the client went away, so another can probe
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitHalfOpen {
+		b.setState(circuitOpen)
+	}
+}
+
+// healthy lets the next request probe straight away, for a health check
+// that found the backend accepting connections
+func (b *breaker) healthy() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitOpen {
+		b.openedAt = b.now().Add(-b.cooldown)
+	}
+}
+
+// setState moves to state, reporting the circuit opening or closing. The
+// caller must hold b.mu.
+func (b *breaker) setState(state circuitState) {
+	from := b.state
+	b.state = state
+	if b.onChange == nil || from == state {
+		return
+	}
+	if (from == circuitClosed && state == circuitOpen) || state == circuitClosed {
+		b.onChange(state)
+	}
+}
+
+// isBackendFailure reports whether a backend response counts against the
+// circuit breaker
+func isBackendFailure(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// circuitGate answers requests with a 503 while t's circuit is open instead
+// of passing them to next
+func (t *Tunnel) circuitGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := t.breaker.allow()
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		backend := t.backend().String()
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		errorpage.Write(w, r, errorpage.Page{
+			Status:  http.StatusServiceUnavailable,
+			Title:   "Backend Circuit Open",
+			Message: fmt.Sprintf("%s failed repeatedly, so gotunnel is not sending it requests for now.", backend),
+			Domain:  t.Domain,
+			Backend: backend,
+			Hint:    fmt.Sprintf("gotunnel will try the backend again in %s.", time.Duration(retryAfter)*time.Second),
+		})
+	})
+}
+
+// recordBackendError counts a failed backend request against t's circuit
+func (t *Tunnel) recordBackendError(err error) {
+	if t.breaker == nil {
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		t.breaker.abandon()
+		return
+	}
+	t.breaker.failure()
+}
+
+// recordBackendResponse counts a backend response for or against t's circuit
+func (t *Tunnel) recordBackendResponse(status int) {
+	if t.breaker == nil {
+		return
+	}
+	if isBackendFailure(status) {
+		t.breaker.failure()
+		return
+	}
+	t.breaker.success()
+}
+
+// circuitChanged logs and reports t's circuit opening or closing
+func (t *Tunnel) circuitChanged(state circuitState) {
+	if state == circuitOpen {
+		t.logger.Warn("Backend keeps failing, opened its circuit",
+			"backend", t.backend().String(), "cooldown", t.breaker.cooldown)
+		t.event(EventCircuitOpen, nil)
+		return
+	}
+	t.logger.Info("Backend recovered, closed its circuit", "backend", t.backend().String())
+	t.event(EventCircuitShut, nil)
+}
@@ -0,0 +1,169 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	var changes []circuitState
+	b := newBreaker(CircuitBreaker{FailureThreshold: 3, Cooldown: 10 * time.Second}, func(state circuitState) {
+		changes = append(changes, state)
+	})
+	b.now = func() time.Time { return now }
+
+	// Failures below the threshold, or interrupted by a success, don't trip it
+	b.failure()
+	b.failure()
+	b.success()
+	b.failure()
+	b.failure()
+	ok, _ := b.allow()
+	assert.True(t, ok)
+	assert.Empty(t, changes)
+
+	b.failure()
+	ok, wait := b.allow()
+	assert.False(t, ok, "open after 3 failures in a row")
+	assert.Equal(t, 10*time.Second, wait)
+	assert.Equal(t, []circuitState{circuitOpen}, changes)
+
+	now = now.Add(4 * time.Second)
+	_, wait = b.allow()
+	assert.Equal(t, 6*time.Second, wait)
+
+	// After the cooldown exactly one request probes
+	now = now.Add(6 * time.Second)
+	ok, _ = b.allow()
+	assert.True(t, ok)
+	ok, _ = b.allow()
+	assert.False(t, ok, "only one probe at a time")
+
+	// A failed probe reopens the circuit for another cooldown
+	b.failure()
+	ok, wait = b.allow()
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Second, wait)
+
+	// A health check that finds the backend up lets a probe through early
+	b.healthy()
+	ok, _ = b.allow()
+	assert.True(t, ok)
+	b.success()
+	ok, _ = b.allow()
+	assert.True(t, ok)
+	assert.Equal(t, []circuitState{circuitOpen, circuitClosed}, changes)
+}
+
+func TestBreakerAbandonedProbe(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBreaker(CircuitBreaker{FailureThreshold: 1, Cooldown: time.Second}, nil)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	now = now.Add(time.Second)
+	ok, _ := b.allow()
+	require.True(t, ok)
+
+	// The client went away, so the next request probes instead
+	b.abandon()
+	ok, _ = b.allow()
+	assert.True(t, ok)
+
+	// A probe that never reports back stops blocking after a cooldown
+	ok, _ = b.allow()
+	assert.False(t, ok)
+	now = now.Add(time.Second)
+	ok, _ = b.allow()
+	assert.True(t, ok)
+}
+
+func TestTunnelCircuitBreaker(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	var failing atomic.Bool
+	var hits atomic.Int32
+	failing.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if failing.Load() {
+			// Slow failures are what the breaker saves clients from waiting on
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer backend.Close()
+
+	var mu sync.Mutex
+	var events []EventType
+	manager.OnEvent(func(ev TunnelEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ev.Type == EventCircuitOpen || ev.Type == EventCircuitShut {
+			events = append(events, ev.Type)
+		}
+	})
+
+	const cooldown = 300 * time.Millisecond
+	require.NoError(t, manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort:    backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:         "breaker",
+		HTTPPort:       8262,
+		CircuitBreaker: &CircuitBreaker{FailureThreshold: 3, Cooldown: cooldown},
+	}))
+
+	get := func() (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get("http://127.0.0.1:8262/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	// The backend's failures pass through until the threshold trips
+	for i := 0; i < 3; i++ {
+		resp, _ := get()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	assert.Equal(t, int32(3), hits.Load())
+
+	// While open, requests fail fast without reaching the backend
+	start := time.Now()
+	resp, body := get()
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+	assert.Contains(t, body, "Backend Circuit Open")
+	assert.Equal(t, int32(3), hits.Load())
+
+	// After the cooldown a successful probe closes the circuit
+	failing.Store(false)
+	time.Sleep(cooldown)
+	resp, body = get()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", body)
+	resp, _ = get()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(5), hits.Load())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []EventType{EventCircuitOpen, EventCircuitShut}, events)
+}
@@ -0,0 +1,114 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/johncferguson/gotunnel/internal/cert"
+)
+
+// certReloadDelay is how long the certificate files must go unchanged
+// before they're reloaded, so a tool rotating them has written both
+const certReloadDelay = 300 * time.Millisecond
+
+// tunnelCerts are the certificates an HTTPS tunnel serves: its domain's
+// and one per alias, in the order of Tunnel.Aliases
+type tunnelCerts struct {
+	primary *tls.Certificate
+	aliases []tls.Certificate
+}
+
+// loadCerts gets the certificate of every name t serves from certs
+func (t *Tunnel) loadCerts(certs cert.CertProvider) (*tunnelCerts, error) {
+	primary, err := certs.EnsureCert(t.Domain)
+	if err != nil {
+		return nil, fmt.Errorf("%w for %s: %w", ErrCertUnavailable, t.Domain, err)
+	}
+	loaded := &tunnelCerts{primary: primary}
+	for _, alias := range t.Aliases {
+		aliasCert, err := certs.EnsureCert(alias)
+		if err != nil {
+			return nil, fmt.Errorf("%w for alias %s: %w", ErrCertUnavailable, alias, err)
+		}
+		loaded.aliases = append(loaded.aliases, *aliasCert)
+	}
+	return loaded, nil
+}
+
+// newCertWatcher watches the directories holding t's certificate and key
+// files. Directories rather than the files themselves are watched, as
+// tools commonly rotate certificates by renaming a new file into place.
+func (t *Tunnel) newCertWatcher() (*fsnotify.Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate watcher: %w", err)
+	}
+	for _, file := range []string{t.opts.CertFile, t.opts.KeyFile} {
+		if err := w.Add(filepath.Dir(file)); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("%w: failed to watch %s: %w", ErrInvalidOptions, file, err)
+		}
+	}
+	return w, nil
+}
+
+// reloadCertsOnChange reloads t's certificate files whenever they change,
+// until the tunnel stops. A pair that doesn't load, typically because only
+// one of the two files has been rewritten so far, is skipped and the
+// current certificate kept until the next change.
+func (m *Manager) reloadCertsOnChange(t *Tunnel, w *fsnotify.Watcher) {
+	defer close(t.certsDone)
+	defer w.Close()
+
+	files := make(map[string]bool)
+	for _, file := range []string{t.opts.CertFile, t.opts.KeyFile} {
+		files[filepath.Clean(file)] = true
+	}
+
+	timer := time.NewTimer(certReloadDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-t.ctx.Done():
+			timer.Stop()
+			return
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if ev.Op != fsnotify.Chmod && files[filepath.Clean(ev.Name)] {
+				timer.Reset(certReloadDelay)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			t.logger.Warn("Certificate watcher error", "error", err)
+		case <-timer.C:
+			m.reloadCerts(t)
+		}
+	}
+}
+
+// reloadCerts loads t's certificate files again and serves them from now
+// on, on the tunnel's listener and through the proxy alike
+func (m *Manager) reloadCerts(t *Tunnel) {
+	loaded, err := t.loadCerts(&cert.FileProvider{CertFile: t.opts.CertFile, KeyFile: t.opts.KeyFile})
+	if err != nil {
+		t.logger.Warn("Certificate files changed but can't be loaded yet, still serving the previous certificate", "error", err)
+		return
+	}
+	t.certs.Store(loaded)
+
+	for _, route := range t.routes {
+		updated := *route
+		updated.Certificate = t.certFor(route.Domain)
+		if err := m.proxyManager.AddRoute(&updated); err != nil {
+			t.logger.Warn("Failed to update proxy route certificate", "domain", route.Domain, "error", err)
+		}
+	}
+	t.logger.Info("Reloaded certificate", "cert_file", t.opts.CertFile, "expires", loaded.primary.Leaf.NotAfter)
+}
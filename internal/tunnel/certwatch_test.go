@@ -0,0 +1,85 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// servedCert returns the leaf certificate the tunnel on addr serves for name
+func servedCert(t *testing.T, addr, name string) *x509.Certificate {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: name, InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0]
+}
+
+func TestTunnelWatchCerts(t *testing.T) {
+	manager, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+
+	const domain = "rotated.local"
+	certDir := filepath.Join(tempDir, "certs")
+	require.NoError(t, os.Mkdir(certDir, 0o755))
+	certFile, keyFile, _ := writeTestCertFiles(t, certDir, domain)
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: testServer.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      domain,
+		HTTPS:       true,
+		HTTPPort:    8270,
+		HTTPSPort:   8271,
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		WatchCerts:  true,
+	}))
+	manager.mu.RLock()
+	tunnel := manager.tunnels[domain]
+	manager.mu.RUnlock()
+	server := tunnel.servers[0].server
+
+	const addr = "127.0.0.1:8271"
+	first := servedCert(t, addr, domain)
+
+	// A new certificate without its key doesn't load, so the old pair is
+	// still served until the key follows
+	nextDir := filepath.Join(tempDir, "next")
+	require.NoError(t, os.Mkdir(nextDir, 0o755))
+	nextCert, nextKey, _ := writeTestCertFiles(t, nextDir, domain)
+	copyFile := func(src, dst string) {
+		data, err := os.ReadFile(src)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dst, data, 0o600))
+	}
+	copyFile(nextCert, certFile)
+	time.Sleep(3 * certReloadDelay)
+	assert.Equal(t, first.Raw, servedCert(t, addr, domain).Raw)
+
+	copyFile(nextKey, keyFile)
+	require.Eventually(t, func() bool {
+		return !first.Equal(servedCert(t, addr, domain))
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Equal(t, servedCert(t, addr, domain).Raw, tunnel.certFor(domain).Leaf.Raw)
+	assert.Same(t, server, tunnel.servers[0].server, "the listener was not restarted")
+
+	require.NoError(t, manager.StopTunnel(ctx, domain))
+	select {
+	case <-tunnel.certsDone:
+	default:
+		t.Fatal("the certificate watcher should have exited")
+	}
+}
@@ -0,0 +1,253 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/middleware"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a set of tunnels in the file format `gotunnel up -f` reads and
+// `gotunnel export` writes. The proxy section uses the same keys as the
+// global config file, so an exported file can also be passed as
+// $GOTUNNEL_CONFIG to restore the proxy settings.
+type Config struct {
+	Proxy   *ProxySettings `yaml:"proxy,omitempty"`
+	Tunnels []TunnelConfig `yaml:"tunnels"`
+}
+
+// ProxySettings records the proxy the tunnels were routed through
+type ProxySettings struct {
+	Mode      string `yaml:"mode"`
+	HTTPPort  int    `yaml:"http_port,omitempty"`
+	HTTPSPort int    `yaml:"https_port,omitempty"`
+}
+
+// TunnelConfig is the serializable part of Options. Middleware and
+// Transport can't be written to a file, so they aren't recorded.
+type TunnelConfig struct {
+	Domain     string                 `yaml:"domain"`
+	Port       int                    `yaml:"port"` // Backend port
+	Aliases    []string               `yaml:"aliases,omitempty"`
+	HTTPS      bool                   `yaml:"https,omitempty"`
+	HTTPPort   int                    `yaml:"http_port,omitempty"`
+	HTTPSPort  int                    `yaml:"https_port,omitempty"`
+	ListenAddr string                 `yaml:"listen_addr,omitempty"`
+	IPFamily   string                 `yaml:"ip_family,omitempty"`
+	CORS       *middleware.CORSConfig `yaml:"cors,omitempty"`
+	CertFile   string                 `yaml:"cert_file,omitempty"`
+	KeyFile    string                 `yaml:"key_file,omitempty"`
+	WatchCerts bool                   `yaml:"watch_certs,omitempty"`
+
+	ClientCAFile string `yaml:"client_ca_file,omitempty"`
+
+	AlsoHTTP     bool `yaml:"also_http,omitempty"`
+	RedirectHTTP bool `yaml:"redirect_http,omitempty"`
+
+	ProxyProtocol bool `yaml:"proxy_protocol,omitempty"`
+
+	BackendRetries         int           `yaml:"backend_retries,omitempty"`
+	BackendRetryBackoff    time.Duration `yaml:"backend_retry_backoff,omitempty"`
+	BackendDialTimeout     time.Duration `yaml:"backend_dial_timeout,omitempty"`
+	BackendKeepAlive       time.Duration `yaml:"backend_keepalive,omitempty"`
+	BackendMaxIdleConns    int           `yaml:"backend_max_idle_conns,omitempty"`
+	BackendIdleConnTimeout time.Duration `yaml:"backend_idle_conn_timeout,omitempty"`
+
+	HealthGatedMDNS       bool          `yaml:"mdns_when_healthy,omitempty"`
+	BackendHealthInterval time.Duration `yaml:"backend_health_interval,omitempty"`
+
+	MDNSTXT map[string]string `yaml:"mdns_txt,omitempty"`
+	Labels  map[string]string `yaml:"labels,omitempty"`
+
+	BackendHost string `yaml:"backend_host,omitempty"`
+
+	BackendScheme             string `yaml:"backend_scheme,omitempty"`
+	BackendInsecureSkipVerify bool   `yaml:"backend_insecure,omitempty"`
+	BackendH2C                bool   `yaml:"backend_h2c,omitempty"`
+	GRPC                      bool   `yaml:"grpc,omitempty"`
+	PreserveHost              bool   `yaml:"preserve_host,omitempty"`
+	StripPathPrefix           string `yaml:"strip_path_prefix,omitempty"`
+	AddPathPrefix             string `yaml:"add_path_prefix,omitempty"`
+	InjectHTML                string `yaml:"inject_html,omitempty"`
+
+	IdleTimeout    time.Duration   `yaml:"idle_timeout,omitempty"`
+	CircuitBreaker *CircuitBreaker `yaml:"circuit_breaker,omitempty"`
+
+	ResponseTimeout time.Duration `yaml:"response_timeout,omitempty"`
+}
+
+// Export describes the running tunnels, ordered by domain, and the proxy
+// they're routed through
+func (m *Manager) Export() Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cfg := Config{Tunnels: make([]TunnelConfig, 0, len(m.tunnels))}
+	if m.useProxy && m.proxyManager != nil {
+		proxyConfig := m.proxyManager.Config()
+		cfg.Proxy = &ProxySettings{
+			Mode:      string(proxyConfig.Mode),
+			HTTPPort:  proxyConfig.HTTPPort,
+			HTTPSPort: proxyConfig.HTTPSPort,
+		}
+	}
+	for domain, t := range m.tunnels {
+		tc := tunnelConfig(t.opts)
+		tc.Domain = domain
+		cfg.Tunnels = append(cfg.Tunnels, tc)
+	}
+	sort.Slice(cfg.Tunnels, func(i, j int) bool {
+		return cfg.Tunnels[i].Domain < cfg.Tunnels[j].Domain
+	})
+	return cfg
+}
+
+// tunnelConfig records the serializable fields of opts
+func tunnelConfig(opts Options) TunnelConfig {
+	return TunnelConfig{
+		Domain:     opts.Domain,
+		Port:       opts.BackendPort,
+		Aliases:    opts.Aliases,
+		HTTPS:      opts.HTTPS,
+		HTTPPort:   opts.HTTPPort,
+		HTTPSPort:  opts.HTTPSPort,
+		ListenAddr: opts.ListenAddr,
+		IPFamily:   opts.IPFamily,
+		CORS:       opts.CORS,
+		CertFile:   opts.CertFile,
+		KeyFile:    opts.KeyFile,
+		WatchCerts: opts.WatchCerts,
+
+		ClientCAFile: opts.ClientCAFile,
+
+		AlsoHTTP:     opts.AlsoHTTP,
+		RedirectHTTP: opts.RedirectHTTP,
+
+		ProxyProtocol: opts.ProxyProtocol,
+
+		BackendRetries:         opts.BackendRetries,
+		BackendRetryBackoff:    opts.BackendRetryBackoff,
+		BackendDialTimeout:     opts.BackendDialTimeout,
+		BackendKeepAlive:       opts.BackendKeepAlive,
+		BackendMaxIdleConns:    opts.BackendMaxIdleConns,
+		BackendIdleConnTimeout: opts.BackendIdleConnTimeout,
+
+		HealthGatedMDNS:       opts.HealthGatedMDNS,
+		BackendHealthInterval: opts.BackendHealthInterval,
+
+		MDNSTXT: opts.MDNSTXT,
+		Labels:  opts.Labels,
+
+		BackendHost: opts.BackendHost,
+
+		BackendScheme:             opts.BackendScheme,
+		BackendInsecureSkipVerify: opts.BackendInsecureSkipVerify,
+		BackendH2C:                opts.BackendH2C,
+		GRPC:                      opts.GRPC,
+		PreserveHost:              opts.PreserveHost,
+		StripPathPrefix:           opts.StripPathPrefix,
+		AddPathPrefix:             opts.AddPathPrefix,
+		InjectHTML:                opts.InjectHTML,
+
+		IdleTimeout:    opts.IdleTimeout,
+		CircuitBreaker: opts.CircuitBreaker,
+
+		ResponseTimeout: opts.ResponseTimeout,
+	}
+}
+
+// Options converts the entry back into tunnel options
+func (tc TunnelConfig) Options() Options {
+	return Options{
+		BackendPort: tc.Port,
+		Domain:      tc.Domain,
+		Aliases:     tc.Aliases,
+		HTTPS:       tc.HTTPS,
+		HTTPPort:    tc.HTTPPort,
+		HTTPSPort:   tc.HTTPSPort,
+		ListenAddr:  tc.ListenAddr,
+		IPFamily:    tc.IPFamily,
+		CORS:        tc.CORS,
+		CertFile:    tc.CertFile,
+		KeyFile:     tc.KeyFile,
+		WatchCerts:  tc.WatchCerts,
+
+		ClientCAFile: tc.ClientCAFile,
+
+		AlsoHTTP:     tc.AlsoHTTP,
+		RedirectHTTP: tc.RedirectHTTP,
+
+		ProxyProtocol: tc.ProxyProtocol,
+
+		BackendRetries:         tc.BackendRetries,
+		BackendRetryBackoff:    tc.BackendRetryBackoff,
+		BackendDialTimeout:     tc.BackendDialTimeout,
+		BackendKeepAlive:       tc.BackendKeepAlive,
+		BackendMaxIdleConns:    tc.BackendMaxIdleConns,
+		BackendIdleConnTimeout: tc.BackendIdleConnTimeout,
+
+		HealthGatedMDNS:       tc.HealthGatedMDNS,
+		BackendHealthInterval: tc.BackendHealthInterval,
+
+		MDNSTXT: tc.MDNSTXT,
+		Labels:  tc.Labels,
+
+		BackendHost: tc.BackendHost,
+
+		BackendScheme:             tc.BackendScheme,
+		BackendInsecureSkipVerify: tc.BackendInsecureSkipVerify,
+		BackendH2C:                tc.BackendH2C,
+		GRPC:                      tc.GRPC,
+		PreserveHost:              tc.PreserveHost,
+		StripPathPrefix:           tc.StripPathPrefix,
+		AddPathPrefix:             tc.AddPathPrefix,
+		InjectHTML:                tc.InjectHTML,
+
+		IdleTimeout:    tc.IdleTimeout,
+		CircuitBreaker: tc.CircuitBreaker,
+
+		ResponseTimeout: tc.ResponseTimeout,
+	}
+}
+
+// Options returns the options of every tunnel in the file
+func (c *Config) Options() []Options {
+	opts := make([]Options, 0, len(c.Tunnels))
+	for _, tc := range c.Tunnels {
+		opts = append(opts, tc.Options())
+	}
+	return opts
+}
+
+// Write encodes the config as YAML
+func (c *Config) Write(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return fmt.Errorf("failed to encode tunnel config: %w", err)
+	}
+	return enc.Close()
+}
+
+// LoadConfig reads a tunnel config file. ${VAR} references are expanded
+// from the environment before parsing, as in the global config file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tunnel config: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &cfg); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse tunnel config %s: %w", ErrInvalidOptions, path, err)
+	}
+	for i, tc := range cfg.Tunnels {
+		if tc.Domain == "" {
+			return nil, fmt.Errorf("%w: tunnel %d in %s has no domain", ErrInvalidDomain, i+1, path)
+		}
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,107 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	manager, tempDir, cleanup := setupTestManager(t)
+	started := []Options{
+		{
+			BackendPort: backendPort,
+			Domain:      "export-api",
+			Aliases:     []string{"export-api-v2.local"},
+			HTTPPort:    8260,
+			CORS: &middleware.CORSConfig{
+				AllowedOrigins: []string{"http://web.local"},
+				AllowedMethods: []string{"GET", "POST"},
+				AllowedHeaders: []string{"Authorization"},
+			},
+
+			BackendRetries:     2,
+			BackendDialTimeout: 3 * time.Second,
+			ResponseTimeout:    20 * time.Second,
+		},
+		{
+			BackendPort:  backendPort,
+			Domain:       "export-web",
+			HTTPPort:     8261,
+			IPFamily:     IPFamily4,
+			PreserveHost: true,
+		},
+	}
+	for _, opts := range started {
+		require.NoError(t, manager.StartTunnelWithOptions(ctx, opts))
+	}
+
+	exported := manager.Export()
+	require.Len(t, exported.Tunnels, 2)
+	assert.Equal(t, "export-api.local", exported.Tunnels[0].Domain)
+	assert.Equal(t, []string{"export-api-v2.local"}, exported.Tunnels[0].Aliases)
+	assert.Equal(t, 8260, exported.Tunnels[0].HTTPPort)
+	assert.Equal(t, backendPort, exported.Tunnels[1].Port)
+	assert.Nil(t, exported.Proxy, "no proxy in use")
+
+	path := filepath.Join(t.TempDir(), "tunnels.yaml")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, exported.Write(f))
+	require.NoError(t, f.Close())
+
+	// Free the names and ports before restoring the export elsewhere
+	cleanup()
+	_, err = os.Stat(tempDir)
+	require.True(t, os.IsNotExist(err))
+
+	loaded, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, exported, *loaded)
+
+	fresh, _, cleanup := setupTestManager(t)
+	defer cleanup()
+	for _, opts := range loaded.Options() {
+		require.NoError(t, fresh.StartTunnelWithOptions(ctx, opts))
+	}
+	assert.Equal(t, exported, fresh.Export())
+	for i, opts := range started {
+		opts.Domain += ".local"
+		assert.True(t, sameOptions(opts.withDefaults(), loaded.Tunnels[i].Options()), opts.Domain)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	_, err := LoadConfig(filepath.Join(dir, "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = LoadConfig(write("bad.yaml", "tunnels:\n  default_https: true\n"))
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+
+	_, err = LoadConfig(write("nodomain.yaml", "tunnels:\n  - port: 3000\n"))
+	assert.ErrorIs(t, err, ErrInvalidDomain)
+
+	t.Setenv("EXPORT_TEST_PORT", "3001")
+	cfg, err := LoadConfig(write("env.yaml", "tunnels:\n  - domain: app.local\n    port: ${EXPORT_TEST_PORT}\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []Options{{Domain: "app.local", BackendPort: 3001}}, cfg.Options())
+}
@@ -0,0 +1,95 @@
+package tunnel
+
+import (
+	"log"
+	"net"
+	"strconv"
+)
+
+// planStart logs what starting a tunnel for domain would change, without
+// touching certificates, ports, the hosts file, mDNS or the proxy. opts and
+// aliases have already been validated. The caller must hold m.mu.
+func (m *Manager) planStart(opts Options, domain string, aliases []string) {
+	names := append([]string{domain}, aliases...)
+
+	if opts.HTTPS {
+		for _, name := range names {
+			log.Printf("[dry-run] would load or generate a certificate for %s", name)
+		}
+	}
+
+	scheme, port := "HTTP", opts.HTTPPort
+	if opts.HTTPS {
+		scheme, port = "HTTPS", opts.HTTPSPort
+	}
+	listen := net.JoinHostPort(opts.ListenAddr, strconv.Itoa(port))
+	proxied := m.useProxy && m.proxyManager != nil
+	if proxied {
+		ports := "any free port"
+		if m.ports != nil {
+			ports = "range " + m.ports.r.String()
+		}
+		listen = "an internal port from " + ports
+	}
+	log.Printf("[dry-run] would listen for %s on %s, forwarding to %s://%s",
+		scheme, listen, opts.BackendScheme, net.JoinHostPort(opts.backendHost(), strconv.Itoa(opts.BackendPort)))
+	if opts.HTTPS && opts.servesHTTP() {
+		httpListen := net.JoinHostPort(opts.ListenAddr, strconv.Itoa(opts.HTTPPort))
+		if opts.RedirectHTTP {
+			log.Printf("[dry-run] would listen for HTTP on %s, redirecting to HTTPS", httpListen)
+		} else {
+			log.Printf("[dry-run] would listen for HTTP on %s too", httpListen)
+		}
+	}
+
+	for _, name := range names {
+		if m.editsHosts() {
+			log.Printf("[dry-run] would add %s to %s", name, hostsFile)
+		}
+		if m.useMDNS && opts.HealthGatedMDNS {
+			log.Printf("[dry-run] would advertise %s over mDNS while port %d accepts connections", name, opts.BackendPort)
+		} else if m.useMDNS {
+			log.Printf("[dry-run] would advertise %s over mDNS", name)
+		}
+		if m.useMDNS && len(opts.MDNSTXT) > 0 {
+			log.Printf("[dry-run] would add TXT records %v to %s's mDNS advertisement", opts.MDNSTXT, name)
+		}
+		if proxied {
+			log.Printf("[dry-run] would add proxy route %s -> the tunnel's internal %s port", name, scheme)
+		}
+	}
+	if opts.ClientCAFile != "" {
+		log.Printf("[dry-run] would require client certificates signed by a CA in %s", opts.ClientCAFile)
+	}
+	if opts.ProxyProtocol {
+		log.Printf("[dry-run] would require a PROXY protocol header on each connection")
+	}
+	if opts.InjectHTML != "" {
+		log.Printf("[dry-run] would insert %q into HTML responses", opts.InjectHTML)
+	}
+	if opts.IdleTimeout > 0 {
+		log.Printf("[dry-run] would stop the tunnel after %s without requests", opts.IdleTimeout)
+	}
+}
+
+// planStop logs what stopping the tunnel for domain would undo. The caller
+// must hold m.mu.
+func (m *Manager) planStop(domain string) {
+	names := []string{domain}
+	if tunnel, ok := m.tunnels[domain]; ok {
+		names = tunnel.names()
+	}
+
+	log.Printf("[dry-run] would stop the tunnel for %s and close its listener", domain)
+	for _, name := range names {
+		if m.editsHosts() {
+			log.Printf("[dry-run] would remove %s from %s", name, hostsFile)
+		}
+		if m.useMDNS {
+			log.Printf("[dry-run] would stop advertising %s over mDNS", name)
+		}
+		if m.useProxy && m.proxyManager != nil {
+			log.Printf("[dry-run] would remove proxy route %s", name)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/johncferguson/gotunnel/internal/cert"
+	"github.com/johncferguson/gotunnel/internal/dnsserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	certDir := filepath.Join(tempDir, "certs")
+	manager, err := NewManagerWithOptions(cert.New(certDir), nil, ManagerOptions{
+		UseMDNS:  true,
+		UseHosts: true,
+		DryRun:   true,
+	})
+	require.NoError(t, err)
+	manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.backup"))
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	before, err := os.ReadFile(hostsFile)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: 3000,
+		Domain:      "dry",
+		Aliases:     []string{"dry-alias"},
+		HTTPS:       true,
+		HTTPPort:    8243,
+		HTTPSPort:   8242,
+	}))
+
+	// Nothing changed: no hosts entry, listener, mDNS record or certificate
+	after, err := os.ReadFile(hostsFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+
+	l, err := net.Listen("tcp", "127.0.0.1:8242")
+	require.NoError(t, err, "dry run must not bind the tunnel port")
+	l.Close()
+
+	assert.False(t, dnsserver.IsRegistered("dry.local"))
+	assert.Empty(t, manager.ListTunnels())
+	_, err = os.Stat(certDir)
+	assert.True(t, os.IsNotExist(err), "no certificates generated")
+	_, err = os.Stat(filepath.Join(tempDir, "hosts.backup"))
+	assert.True(t, os.IsNotExist(err), "no hosts backup taken")
+
+	out := logs.String()
+	assert.Contains(t, out, "would load or generate a certificate for dry-alias.local")
+	assert.Contains(t, out, "would listen for HTTPS on 0.0.0.0:8242, forwarding to http://127.0.0.1:3000")
+	assert.Contains(t, out, "would add dry.local to "+hostsFile)
+	assert.Contains(t, out, "would advertise dry-alias.local over mDNS")
+
+	logs.Reset()
+	require.NoError(t, manager.StopTunnel(ctx, "dry.local"))
+	assert.Contains(t, logs.String(), "would remove dry.local from "+hostsFile)
+	require.NoError(t, manager.Stop(ctx))
+}
@@ -0,0 +1,17 @@
+package tunnel
+
+import "errors"
+
+// Sentinel errors returned (wrapped) by the Manager, so callers can tell
+// failures apart with errors.Is. The gotunnel CLI exits with the code noted
+// on each.
+var (
+	ErrInvalidPort        = errors.New("invalid port")               // Exit code 2
+	ErrInvalidDomain      = errors.New("invalid domain")             // Exit code 2
+	ErrInvalidOptions     = errors.New("invalid tunnel options")     // Exit code 2
+	ErrDuplicateDomain    = errors.New("duplicate domain")           // Exit code 2
+	ErrTunnelNotFound     = errors.New("tunnel not found")           // Exit code 2
+	ErrBindFailed         = errors.New("failed to bind tunnel port") // Exit code 3
+	ErrCertUnavailable    = errors.New("certificate unavailable")    // Exit code 4
+	ErrBackendUnreachable = errors.New("backend unreachable")        // Exit code 5
+)
@@ -0,0 +1,138 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/cert"
+	"github.com/johncferguson/gotunnel/internal/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartTunnelErrors(t *testing.T) {
+	manager, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: 8080,
+		Domain:      "taken",
+		Aliases:     []string{"www.taken"},
+		HTTPPort:    8209,
+		HTTPSPort:   8509,
+	}))
+
+	// Something else already owns this port
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer occupied.Close()
+	occupiedPort := occupied.Addr().(*net.TCPAddr).Port
+
+	certFile, keyFile, _ := writeTestCertFiles(t, tempDir, "someone-else.local")
+
+	tests := []struct {
+		name string
+		opts Options
+		want error
+	}{
+		{"invalid backend port", Options{BackendPort: -1, Domain: "a", HTTPPort: 8210}, ErrInvalidPort},
+		{"backend port too large", Options{BackendPort: 70000, Domain: "a", HTTPPort: 8210}, ErrInvalidPort},
+		{"invalid HTTP port", Options{BackendPort: 8080, Domain: "a", HTTPPort: -1}, ErrInvalidPort},
+		{"invalid HTTPS port", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, HTTPSPort: 70000}, ErrInvalidPort},
+		{"empty domain", Options{BackendPort: 8080, HTTPPort: 8210}, ErrInvalidDomain},
+		{"empty alias", Options{BackendPort: 8080, Domain: "a", Aliases: []string{""}, HTTPPort: 8210}, ErrInvalidDomain},
+		{"hosts file injection", Options{BackendPort: 8080, Domain: "foo\n127.0.0.1 evil", HTTPPort: 8210}, ErrInvalidDomain},
+		{"alias with a space", Options{BackendPort: 8080, Domain: "a", Aliases: []string{"b c"}, HTTPPort: 8210}, ErrInvalidDomain},
+		{"invalid listen address", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, ListenAddr: "nope"}, ErrInvalidOptions},
+		{"invalid IP family", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, IPFamily: "5"}, ErrInvalidOptions},
+		{"IPv4 address for IPv6 family", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, ListenAddr: "127.0.0.1", IPFamily: IPFamily6}, ErrInvalidOptions},
+		{"negative retries", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, BackendRetries: -1}, ErrInvalidOptions},
+		{"negative dial timeout", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, BackendDialTimeout: -time.Second}, ErrInvalidOptions},
+		{"plain HTTP alongside an HTTP tunnel", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, AlsoHTTP: true}, ErrInvalidOptions},
+		{"HTTP and HTTPS on one port", Options{BackendPort: 8080, Domain: "a", HTTPS: true, RedirectHTTP: true, HTTPPort: 8510, HTTPSPort: 8510}, ErrInvalidPort},
+		{"negative idle timeout", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, IdleTimeout: -time.Second}, ErrInvalidOptions},
+		{"watching certificates without files", Options{BackendPort: 8080, Domain: "a", HTTPS: true, HTTPPort: 8210, HTTPSPort: 8510, WatchCerts: true}, ErrInvalidOptions},
+		{"mDNS TXT key with separator", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, MDNSTXT: map[string]string{"a=b": "c"}}, ErrInvalidOptions},
+		{"label key with separator", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, Labels: map[string]string{"a=b": "c"}}, ErrInvalidOptions},
+		{"client CA for an HTTP tunnel", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, ClientCAFile: certFile}, ErrInvalidOptions},
+		{"client CA while also serving HTTP", Options{BackendPort: 8080, Domain: "a", HTTPS: true, HTTPPort: 8210, HTTPSPort: 8510, AlsoHTTP: true, ClientCAFile: certFile}, ErrInvalidOptions},
+		{"h2c to https backend", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, BackendScheme: "https", BackendH2C: true}, ErrInvalidOptions},
+		{"cert without key", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, CertFile: certFile}, ErrInvalidOptions},
+		{"negative circuit breaker cooldown", Options{BackendPort: 8080, Domain: "a", HTTPPort: 8210, CircuitBreaker: &CircuitBreaker{Cooldown: -time.Second}}, ErrInvalidOptions},
+		{"duplicate domain", Options{BackendPort: 8080, Domain: "taken.local", HTTPPort: 8210}, ErrDuplicateDomain},
+		{"domain is another tunnel's alias", Options{BackendPort: 8080, Domain: "www.taken", HTTPPort: 8210}, ErrDuplicateDomain},
+		{"alias collides", Options{BackendPort: 8080, Domain: "a", Aliases: []string{"taken"}, HTTPPort: 8210}, ErrDuplicateDomain},
+		{"certificate mismatch", Options{BackendPort: 8080, Domain: "a", HTTPS: true, HTTPPort: 8210, HTTPSPort: 8510, CertFile: certFile, KeyFile: keyFile}, ErrCertUnavailable},
+		{"port in use", Options{BackendPort: 8080, Domain: "a", HTTPPort: occupiedPort, ListenAddr: "127.0.0.1"}, ErrBindFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := manager.StartTunnelWithOptions(ctx, tt.opts)
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	err = manager.StopTunnel(ctx, "missing.local")
+	assert.ErrorIs(t, err, ErrTunnelNotFound)
+}
+
+func TestProxyModeRejectsPlainHTTP(t *testing.T) {
+	manager, err := NewManagerWithOptions(cert.New(t.TempDir()), nil, ManagerOptions{
+		ProxyManager: proxy.NewManager(proxy.ProxyConfig{Mode: proxy.BuiltInProxy, HTTPPort: proxy.AnyPort}),
+		UseProxy:     true,
+		UseMDNS:      true,
+	})
+	require.NoError(t, err)
+
+	// The proxy never routes to the HTTP listener these would add
+	for _, opts := range []Options{
+		{BackendPort: 8080, Domain: "a", HTTPS: true, AlsoHTTP: true},
+		{BackendPort: 8080, Domain: "a", HTTPS: true, RedirectHTTP: true},
+	} {
+		err := manager.StartTunnelWithOptions(context.Background(), opts)
+		assert.ErrorIs(t, err, ErrInvalidOptions)
+		assert.ErrorContains(t, err, "--proxy none")
+	}
+	assert.Zero(t, manager.Count())
+}
+
+func TestStartTunnelReportsBindErrorPromptly(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	occupied, err := net.Listen("tcp", "0.0.0.0:0")
+	require.NoError(t, err)
+	defer occupied.Close()
+
+	// Well under the startup check's timeout, so nothing waited on it; the
+	// bound is loose enough for a loaded CI machine
+	start := time.Now()
+	err = manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: 8080,
+		Domain:      "occupied",
+		HTTPPort:    occupied.Addr().(*net.TCPAddr).Port,
+	})
+	assert.ErrorIs(t, err, ErrBindFailed)
+	assert.Less(t, time.Since(start), startupCheckTimeout/2)
+	assert.Zero(t, manager.Count())
+
+	// A tunnel that does start is accepting connections as soon as it returns
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	freePort := free.Addr().(*net.TCPAddr).Port
+	require.NoError(t, free.Close())
+	require.NoError(t, manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: 8080,
+		Domain:      "free",
+		HTTPPort:    freePort,
+	}))
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(freePort)))
+	require.NoError(t, err)
+	conn.Close()
+}
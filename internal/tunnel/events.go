@@ -0,0 +1,43 @@
+package tunnel
+
+import "time"
+
+// EventType identifies a tunnel lifecycle event
+type EventType string
+
+const (
+	EventStarted     EventType = "started"      // The tunnel is serving requests
+	EventStopped     EventType = "stopped"      // The tunnel was stopped and its names released
+	EventBackendDown EventType = "backend_down" // A request to a healthy backend failed
+	EventBackendUp   EventType = "backend_up"   // The backend answered again after being down
+	EventCircuitOpen EventType = "circuit_open" // The circuit breaker tripped; requests fail fast
+	EventCircuitShut EventType = "circuit_shut" // The circuit breaker closed again after a probe succeeded
+	EventError       EventType = "error"        // Starting or stopping the tunnel failed, or a request handler panicked
+)
+
+// TunnelEvent describes a change in a tunnel's state
+type TunnelEvent struct {
+	Type   EventType
+	Domain string
+	Time   time.Time
+	Err    error // The failure for EventError (wrapping middleware.ErrPanic after a panic) and EventBackendDown
+}
+
+// OnEvent registers fn to receive tunnel lifecycle events, replacing any
+// earlier hook; nil removes it. fn runs synchronously, sometimes with the
+// manager locked, so it must not call back into the Manager and should hand
+// slow work off to another goroutine.
+func (m *Manager) OnEvent(fn func(TunnelEvent)) {
+	if fn == nil {
+		m.onEvent.Store(nil)
+		return
+	}
+	m.onEvent.Store(&fn)
+}
+
+// emit delivers an event for domain to the registered hook, if any
+func (m *Manager) emit(typ EventType, domain string, err error) {
+	if fn := m.onEvent.Load(); fn != nil {
+		(*fn)(TunnelEvent{Type: typ, Domain: domain, Time: time.Now(), Err: err})
+	}
+}
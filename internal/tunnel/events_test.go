@@ -0,0 +1,121 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/johncferguson/gotunnel/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventRecorder collects events delivered to a Manager's OnEvent hook
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []TunnelEvent
+}
+
+func (r *eventRecorder) record(e TunnelEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var types []EventType
+	for _, e := range r.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestOnEventStartedThenStopped(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	var rec eventRecorder
+	manager.OnEvent(rec.record)
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: 8080,
+		Domain:      "events",
+		HTTPPort:    8235,
+		HTTPSPort:   8535,
+	}))
+	require.NoError(t, manager.StopTunnel(ctx, "events.local"))
+
+	assert.Equal(t, []EventType{EventStarted, EventStopped}, rec.types())
+	for _, e := range rec.events {
+		assert.Equal(t, "events.local", e.Domain)
+		assert.False(t, e.Time.IsZero())
+		assert.NoError(t, e.Err)
+	}
+
+	// A failed start is reported as an error event
+	err := manager.StartTunnelWithOptions(ctx, Options{BackendPort: 0, Domain: "events"})
+	require.Error(t, err)
+	require.Len(t, rec.events, 3)
+	assert.Equal(t, EventError, rec.events[2].Type)
+	assert.ErrorIs(t, rec.events[2].Err, ErrInvalidPort)
+
+	// Removing the hook stops delivery
+	manager.OnEvent(nil)
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: 8080,
+		Domain:      "events",
+		HTTPPort:    8235,
+		HTTPSPort:   8535,
+	}))
+	assert.Len(t, rec.types(), 3)
+}
+
+func TestOnEventBackendDownAndUp(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	var rec eventRecorder
+	manager.OnEvent(rec.record)
+
+	backendPort, err := netutil.FreePort()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backendPort,
+		Domain:      "flaky",
+		HTTPPort:    8236,
+		HTTPSPort:   8536,
+	}))
+
+	get := func() int {
+		resp, err := http.Get("http://127.0.0.1:8236/")
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Repeated failures report the backend down only once
+	assert.Equal(t, http.StatusBadGateway, get())
+	assert.Equal(t, http.StatusBadGateway, get())
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(backendPort)))
+	require.NoError(t, err)
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	backend.Listener = listener
+	backend.Start()
+	defer backend.Close()
+
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, http.StatusOK, get())
+
+	assert.Equal(t, []EventType{EventStarted, EventBackendDown, EventBackendUp}, rec.types())
+	assert.ErrorIs(t, rec.events[1].Err, ErrBackendUnreachable)
+}
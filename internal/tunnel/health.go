@@ -0,0 +1,80 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/dnsserver"
+)
+
+const defaultHealthInterval = 2 * time.Second
+
+// backendReachable reports whether something accepts connections on the
+// backend's host and port within timeout
+func backendReachable(ctx context.Context, backend backendTarget, timeout time.Duration) bool {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", backend.addr())
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// advertiseWhileHealthy checks the backend every health interval, advertising
+// the tunnel's names over mDNS on listenPort while it accepts connections and
+// withdrawing them while it doesn't. It returns, closing t.healthDone, once
+// the tunnel is stopped.
+func (t *Tunnel) advertiseWhileHealthy(listenPort int) {
+	defer close(t.healthDone)
+
+	interval := t.opts.BackendHealthInterval
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	timeout := min(interval, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	advertised := false
+	for {
+		up := backendReachable(t.ctx, t.backend(), timeout)
+		if up && t.breaker != nil {
+			t.breaker.healthy()
+		}
+		switch {
+		case up && !advertised:
+			advertised = true
+			for _, name := range t.names() {
+				err := t.register(RegistrationMDNS, name, func() error {
+					return dnsserver.RegisterDomainWithTXT(t.ctx, name, listenPort, t.opts.MDNSTXT)
+				})
+				if err != nil {
+					if t.ctx.Err() != nil {
+						return
+					}
+					t.logger.Warn("Failed to advertise over mDNS", "domain", name, "error", err)
+					advertised = false // Try again on the next check
+				}
+			}
+			if advertised {
+				t.logger.Info("Backend is up, advertising over mDNS", "backend", t.backend().String())
+			}
+		case !up && advertised:
+			advertised = false
+			for _, name := range t.names() {
+				if err := dnsserver.UnregisterDomain(name); err != nil {
+					t.logger.Warn("Failed to withdraw from mDNS", "domain", name, "error", err)
+				}
+			}
+			t.logger.Info("Backend is down, withdrew from mDNS", "backend", t.backend().String())
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
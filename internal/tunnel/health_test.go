@@ -0,0 +1,61 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/johncferguson/gotunnel/internal/dnsserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthGatedMDNS(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backendPort := reservePort(t)
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort:           backendPort,
+		Domain:                "gated",
+		HTTPPort:              8246,
+		HealthGatedMDNS:       true,
+		BackendHealthInterval: 50 * time.Millisecond,
+	}))
+
+	// Nothing listens on the backend port yet, so the name isn't advertised
+	time.Sleep(200 * time.Millisecond)
+	assert.False(t, dnsserver.IsRegistered("gated.local"))
+
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", backendPort))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return dnsserver.IsRegistered("gated.local") },
+		2*time.Second, 20*time.Millisecond, "not advertised once the backend came up")
+
+	// The advertisement is withdrawn while the backend is down
+	l.Close()
+	assert.Eventually(t, func() bool { return !dnsserver.IsRegistered("gated.local") },
+		2*time.Second, 20*time.Millisecond, "still advertised after the backend went down")
+
+	l, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", backendPort))
+	require.NoError(t, err)
+	defer l.Close()
+	assert.Eventually(t, func() bool { return dnsserver.IsRegistered("gated.local") },
+		2*time.Second, 20*time.Millisecond, "not re-advertised after the backend recovered")
+
+	require.NoError(t, manager.StopTunnel(ctx, "gated.local"))
+	assert.False(t, dnsserver.IsRegistered("gated.local"))
+}
+
+func TestBackendReachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+
+	assert.True(t, backendReachable(context.Background(), backendTarget{host: "127.0.0.1", port: port}, time.Second))
+	l.Close()
+	assert.False(t, backendReachable(context.Background(), backendTarget{host: "127.0.0.1", port: port}, time.Second))
+}
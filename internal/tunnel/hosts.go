@@ -0,0 +1,307 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/johncferguson/gotunnel/internal/process"
+)
+
+// The entries gotunnel adds to the hosts file live between these markers,
+// each tagged with the PID of the process that added it. Cleanup removes
+// exactly those lines, and entries whose process has died (e.g. after a
+// crash) can be found and removed by a later run.
+const (
+	hostsBlockBegin = "# BEGIN gotunnel"
+	hostsBlockEnd   = "# END gotunnel"
+)
+
+// hostsMu serializes this process's read-modify-write cycles on the hosts file
+var hostsMu sync.Mutex
+
+// hostsEntry is a name in the managed block
+type hostsEntry struct {
+	ip   string
+	name string
+	pid  int // Process that added it
+}
+
+func (e hostsEntry) String() string {
+	return fmt.Sprintf("%s\t%s\t# pid %d", e.ip, e.name, e.pid)
+}
+
+// parseHostsEntry parses a line written by hostsEntry.String
+func parseHostsEntry(line string) (hostsEntry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 5 || fields[2] != "#" || fields[3] != "pid" {
+		return hostsEntry{}, false
+	}
+	pid, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return hostsEntry{}, false
+	}
+	return hostsEntry{ip: fields[0], name: fields[1], pid: pid}, true
+}
+
+// hostsContent is the hosts file split around the managed block. Lines
+// outside the block are kept verbatim.
+type hostsContent struct {
+	before  []string
+	entries []hostsEntry
+	after   []string
+}
+
+// parseHosts splits content around the managed block. A block without its
+// end marker is treated as ordinary lines rather than risk dropping the
+// user's entries.
+func parseHosts(content string) *hostsContent {
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	begin, end := -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if begin < 0 && trimmed == hostsBlockBegin {
+			begin = i
+		} else if begin >= 0 && trimmed == hostsBlockEnd {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return &hostsContent{before: lines}
+	}
+
+	h := &hostsContent{before: lines[:begin], after: lines[end+1:]}
+	for _, line := range lines[begin+1 : end] {
+		if entry, ok := parseHostsEntry(line); ok {
+			h.entries = append(h.entries, entry)
+		}
+	}
+	return h
+}
+
+// String renders the hosts file, leaving out the block once it's empty
+func (h *hostsContent) String() string {
+	lines := append([]string(nil), h.before...)
+	if len(h.entries) > 0 {
+		lines = append(lines, hostsBlockBegin)
+		for _, entry := range h.entries {
+			lines = append(lines, entry.String())
+		}
+		lines = append(lines, hostsBlockEnd)
+	}
+	lines = append(lines, h.after...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// mapsName reports whether a line outside the block maps name, so the
+// user's own entries take precedence over gotunnel's
+func (h *hostsContent) mapsName(name string) bool {
+	for _, line := range append(append([]string(nil), h.before...), h.after...) {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		for i := 1; i < len(fields); i++ {
+			if strings.EqualFold(fields[i], name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func readHostsFile() (*hostsContent, error) {
+	content, err := os.ReadFile(hostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hosts file: %w", err)
+	}
+	return parseHosts(string(content)), nil
+}
+
+// writeHostsFile replaces the hosts file with h through a synced temporary
+// file, so a crash mid-write leaves the old file or the new one, never a
+// truncated one. A hosts file that can't be replaced, such as a container's
+// bind-mounted /etc/hosts, is rewritten in place instead.
+func writeHostsFile(h *hostsContent) error {
+	// Replacing would get around a read-only hosts file in a writable
+	// directory, so check the file itself can be written
+	f, err := os.OpenFile(hostsFile, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to update hosts file: %w", err)
+	}
+	f.Close()
+
+	data := []byte(h.String())
+	if err := replaceFile(hostsFile, data); err != nil {
+		if err := os.WriteFile(hostsFile, data, 0644); err != nil {
+			return fmt.Errorf("failed to update hosts file: %w", err)
+		}
+	}
+	return nil
+}
+
+// replaceFile atomically replaces path with data, keeping path's permissions
+func replaceFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".gotunnel-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// updateHostsFile maps domain to ip in the managed block. Names the user
+// maps themselves, or another running gotunnel already added, are left
+// alone; entries left by a dead process are taken over.
+func updateHostsFile(domain, ip string) error {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	h, err := readHostsFile()
+	if err != nil {
+		return err
+	}
+	if h.mapsName(domain) {
+		return nil
+	}
+
+	pid := os.Getpid()
+	for i, entry := range h.entries {
+		if entry.name != domain {
+			continue
+		}
+		if entry.pid == pid || process.Alive(entry.pid) {
+			return nil
+		}
+		h.entries[i].ip = ip
+		h.entries[i].pid = pid
+		return writeHostsFile(h)
+	}
+
+	h.entries = append(h.entries, hostsEntry{ip: ip, name: domain, pid: pid})
+	return writeHostsFile(h)
+}
+
+// removeFromHostsFile removes this process's entry for domain
+func removeFromHostsFile(domain string) error {
+	pid := os.Getpid()
+	_, err := removeHostsEntries(func(entry hostsEntry) bool {
+		return entry.name == domain && entry.pid == pid
+	})
+	return err
+}
+
+// removeHostsEntries removes the managed entries matching drop and returns
+// their names. The file is only rewritten if something matched.
+func removeHostsEntries(drop func(hostsEntry) bool) ([]string, error) {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	h, err := readHostsFile()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	kept := h.entries[:0]
+	for _, entry := range h.entries {
+		if drop(entry) {
+			removed = append(removed, entry.name)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	h.entries = kept
+	return removed, writeHostsFile(h)
+}
+
+// isStale reports whether entry belongs to a gotunnel process that's gone
+func isStale(entry hostsEntry) bool {
+	return entry.pid != os.Getpid() && !process.Alive(entry.pid)
+}
+
+// StaleHostsEntries lists the names gotunnel processes that are no longer
+// running left in the hosts file, typically because they crashed
+func StaleHostsEntries() ([]string, error) {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	h, err := readHostsFile()
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, entry := range h.entries {
+		if isStale(entry) {
+			stale = append(stale, entry.name)
+		}
+	}
+	return stale, nil
+}
+
+// RemoveStaleHostsEntries removes the entries StaleHostsEntries reports and
+// returns their names
+func RemoveStaleHostsEntries() ([]string, error) {
+	return removeHostsEntries(isStale)
+}
+
+// backupHostsFile keeps a copy of the hosts file from before gotunnel's
+// first edit, for recovering by hand should the file ever get mangled
+func (m *Manager) backupHostsFile() error {
+	content, err := os.ReadFile(hostsFile)
+	if err != nil {
+		return fmt.Errorf("failed to read hosts file: %w", err)
+	}
+
+	if err := os.WriteFile(m.hostsBackup, content, 0644); err != nil {
+		return fmt.Errorf("failed to create hosts backup: %w", err)
+	}
+
+	return nil
+}
+
+// cleanupHostsFile removes any entries this process still has in the hosts
+// file and deletes the backup. Unlike restoring the backup, this keeps edits
+// made since, including other gotunnel processes' entries.
+func (m *Manager) cleanupHostsFile() error {
+	pid := os.Getpid()
+	if _, err := removeHostsEntries(func(entry hostsEntry) bool { return entry.pid == pid }); err != nil {
+		return err
+	}
+
+	if m.hostsBackup != "" {
+		if err := os.Remove(m.hostsBackup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			m.logger.Warn("Failed to remove hosts backup file", "path", m.hostsBackup, "error", err)
+		}
+	}
+	return nil
+}
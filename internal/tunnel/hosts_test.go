@@ -0,0 +1,153 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deadPID is above Linux's pid_max, so no process has it
+const deadPID = 999999999
+
+// useHostsFile points hostsFile at a temporary file holding content
+func useHostsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	original := hostsFile
+	hostsFile = path
+	t.Cleanup(func() { hostsFile = original })
+	return path
+}
+
+func readHosts(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestHostsBlockAddAndRemove(t *testing.T) {
+	const original = "127.0.0.1\tlocalhost\n# my comment\n10.0.0.5\tnas.lan\n"
+	path := useHostsFile(t, original)
+	pid := os.Getpid()
+
+	require.NoError(t, updateHostsFile("a.local", "127.0.0.1"))
+	require.NoError(t, updateHostsFile("b.local", "127.0.0.1"))
+	require.NoError(t, updateHostsFile("a.local", "127.0.0.1")) // Already there
+	assert.Equal(t, original+fmt.Sprintf(
+		"# BEGIN gotunnel\n127.0.0.1\ta.local\t# pid %d\n127.0.0.1\tb.local\t# pid %d\n# END gotunnel\n", pid, pid),
+		readHosts(t, path))
+
+	require.NoError(t, removeFromHostsFile("a.local"))
+	assert.NotContains(t, readHosts(t, path), "a.local")
+	assert.Contains(t, readHosts(t, path), "127.0.0.1\tb.local")
+
+	// Removing the last entry removes the block, leaving the file as it was
+	require.NoError(t, removeFromHostsFile("b.local"))
+	assert.Equal(t, original, readHosts(t, path))
+}
+
+func TestWriteHostsFileReplacesAtomically(t *testing.T) {
+	path := useHostsFile(t, "127.0.0.1\tlocalhost\n")
+	require.NoError(t, os.Chmod(path, 0600))
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+
+	require.NoError(t, updateHostsFile("atomic.local", "127.0.0.1"))
+
+	// A new file took the old one's place, with its permissions, and no
+	// temporary file is left beside it
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.False(t, os.SameFile(before, after))
+	assert.Equal(t, os.FileMode(0600), after.Mode().Perm())
+	assert.Contains(t, readHosts(t, path), "atomic.local")
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestHostsBlockKeepsOtherEntries(t *testing.T) {
+	// Edits made after the block was written survive, wherever they are
+	path := useHostsFile(t, "127.0.0.1\tlocalhost\n")
+	require.NoError(t, updateHostsFile("a.local", "127.0.0.1"))
+	content := readHosts(t, path) + "10.0.0.9\tadded-later.lan\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	require.NoError(t, removeFromHostsFile("a.local"))
+	assert.Equal(t, "127.0.0.1\tlocalhost\n10.0.0.9\tadded-later.lan\n", readHosts(t, path))
+
+	// The user's own mapping takes precedence
+	useHostsFile(t, "10.0.0.1\tmine.local # dev box\n")
+	require.NoError(t, updateHostsFile("mine.local", "127.0.0.1"))
+	assert.Equal(t, "10.0.0.1\tmine.local # dev box\n", readHosts(t, hostsFile))
+
+	// A block missing its end marker is treated as ordinary lines
+	broken := "# BEGIN gotunnel\n127.0.0.1\told.local\t# pid 1\n192.168.1.2\tprinter.lan\n"
+	path = useHostsFile(t, broken)
+	require.NoError(t, updateHostsFile("new.local", "127.0.0.1"))
+	assert.Contains(t, readHosts(t, path), broken)
+}
+
+func TestStaleHostsEntries(t *testing.T) {
+	path := useHostsFile(t, fmt.Sprintf("127.0.0.1\tlocalhost\n"+
+		"# BEGIN gotunnel\n"+
+		"127.0.0.1\tcrashed.local\t# pid %d\n"+
+		"127.0.0.1\tparent.local\t# pid %d\n"+
+		"127.0.0.1\tmine.local\t# pid %d\n"+
+		"# END gotunnel\n", deadPID, os.Getppid(), os.Getpid()))
+
+	stale, err := StaleHostsEntries()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"crashed.local"}, stale)
+
+	// Another running process's entry is neither stale nor ours to remove
+	require.NoError(t, removeFromHostsFile("parent.local"))
+	assert.Contains(t, readHosts(t, path), "parent.local")
+
+	removed, err := RemoveStaleHostsEntries()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"crashed.local"}, removed)
+	content := readHosts(t, path)
+	assert.NotContains(t, content, "crashed.local")
+	assert.Contains(t, content, "parent.local")
+	assert.Contains(t, content, "mine.local")
+
+	stale, err = StaleHostsEntries()
+	require.NoError(t, err)
+	assert.Empty(t, stale)
+}
+
+func TestUpdateHostsFileTakesOverStaleEntry(t *testing.T) {
+	path := useHostsFile(t, fmt.Sprintf("# BEGIN gotunnel\n127.0.0.1\tapp.local\t# pid %d\n# END gotunnel\n", deadPID))
+
+	require.NoError(t, updateHostsFile("app.local", "127.0.0.1"))
+	assert.Equal(t, fmt.Sprintf("# BEGIN gotunnel\n127.0.0.1\tapp.local\t# pid %d\n# END gotunnel\n", os.Getpid()),
+		readHosts(t, path))
+
+	stale, err := StaleHostsEntries()
+	require.NoError(t, err)
+	assert.Empty(t, stale)
+}
+
+func TestHostsEntryFollowsListenAddr(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	// A tunnel bound to one address is reached there, not on 127.0.0.1
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: 8080,
+		Domain:      "bound",
+		HTTPPort:    8294,
+		ListenAddr:  "127.0.0.2",
+	}))
+	defer manager.StopTunnel(ctx, "bound.local")
+	assert.Contains(t, readHosts(t, hostsFile), fmt.Sprintf("127.0.0.2\tbound.local\t# pid %d", os.Getpid()))
+}
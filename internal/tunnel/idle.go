@@ -0,0 +1,66 @@
+package tunnel
+
+import (
+	"context"
+	"time"
+)
+
+// idleStopTimeout bounds how long stopping an idle tunnel may take. No
+// requests are in flight by then, so it only covers closing listeners.
+const idleStopTimeout = 5 * time.Second
+
+// touch records request activity for the idle timeout
+func (t *Tunnel) touch() {
+	t.lastRequest.Store(time.Now().UnixNano())
+}
+
+// waitIdle blocks until the tunnel has served no request, and has none in
+// flight, for its IdleTimeout. It returns how long the tunnel was idle, or
+// false if the tunnel was stopped first.
+func (t *Tunnel) waitIdle() (time.Duration, bool) {
+	timeout := t.opts.IdleTimeout
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return 0, false
+		case <-timer.C:
+		}
+
+		idleFor := time.Since(time.Unix(0, t.lastRequest.Load()))
+		switch {
+		case t.inFlight.Load() > 0:
+			// A long request (e.g. a stream) keeps the tunnel busy
+			timer.Reset(timeout)
+		case idleFor >= timeout:
+			return idleFor, true
+		default:
+			timer.Reset(timeout - idleFor)
+		}
+	}
+}
+
+// stopWhenIdle stops t once it has been idle for its IdleTimeout. It
+// returns without stopping anything if t is stopped first.
+func (m *Manager) stopWhenIdle(t *Tunnel) {
+	idleFor, idle := t.waitIdle()
+	close(t.idleDone) // Stopping below mustn't wait for this goroutine
+	if !idle {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tunnels[t.Domain] != t {
+		return // Stopped while the timer fired
+	}
+
+	t.logger.Info("Stopping idle tunnel", "idle_for", idleFor.Round(time.Millisecond), "idle_timeout", t.opts.IdleTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), idleStopTimeout)
+	defer cancel()
+	if err := m.stopTunnelLocked(ctx, t.Domain); err != nil {
+		t.logger.Error("Failed to stop idle tunnel", "error", err)
+	}
+}
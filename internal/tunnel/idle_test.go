@@ -0,0 +1,103 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTunnelIdleTimeout(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d, err := time.ParseDuration(r.URL.Query().Get("sleep")); err == nil {
+			time.Sleep(d)
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer backend.Close()
+
+	var mu sync.Mutex
+	var stopped []string
+	manager.OnEvent(func(ev TunnelEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ev.Type == EventStopped {
+			stopped = append(stopped, ev.Domain)
+		}
+	})
+
+	const idleTimeout = 300 * time.Millisecond
+	require.NoError(t, manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "idle",
+		HTTPPort:    8268,
+		IdleTimeout: idleTimeout,
+	}))
+
+	get := func(query string) {
+		t.Helper()
+		resp, err := http.Get("http://127.0.0.1:8268/" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	running := func() bool {
+		_, ok := manager.GetTunnel("idle.local")
+		return ok
+	}
+
+	// Requests flowing for longer than the timeout keep it running
+	for i := 0; i < 6; i++ {
+		get("")
+		time.Sleep(idleTimeout / 3)
+	}
+	assert.True(t, running())
+
+	// So does one request taking longer than the timeout
+	get("?sleep=" + (2 * idleTimeout).String())
+	assert.True(t, running())
+
+	require.Eventually(t, func() bool { return !running() }, 5*idleTimeout, 20*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{"idle.local"}, stopped)
+	mu.Unlock()
+
+	_, err := net.DialTimeout("tcp", "127.0.0.1:8268", time.Second)
+	assert.Error(t, err, "the idle tunnel's listener is closed")
+}
+
+func TestTunnelIdleCheckerExitsOnStop(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: testServer.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "idle-stop",
+		HTTPPort:    8269,
+		IdleTimeout: time.Hour,
+	}))
+	manager.mu.RLock()
+	tunnel := manager.tunnels["idle-stop.local"]
+	manager.mu.RUnlock()
+
+	require.NoError(t, manager.StopTunnel(ctx, "idle-stop.local"))
+	select {
+	case <-tunnel.idleDone:
+	default:
+		t.Fatal("the idle checker should have exited")
+	}
+}
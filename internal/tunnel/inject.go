@@ -0,0 +1,76 @@
+package tunnel
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxInjectBody is the largest page injectHTML buffers to rewrite
+const maxInjectBody = 4 << 20
+
+// injectHTML inserts snippet before the closing </body> tag of an HTML
+// response, or appends it if there's none, and fixes up Content-Length.
+// Other content types, compressed bodies and HEAD responses are left
+// alone, as are pages over maxInjectBody or without a Content-Length
+// (e.g. streamed), which would otherwise be held back until they ended.
+func injectHTML(resp *http.Response, snippet string) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" || resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return nil
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return nil
+	}
+
+	if resp.ContentLength < 0 || resp.ContentLength > maxInjectBody {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxInjectBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return err
+	}
+	if len(body) > maxInjectBody {
+		// Longer than its Content-Length said; pass it on as it came
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+
+	at := lastIndexFold(body, "</body>")
+	if at < 0 {
+		at = len(body)
+	}
+	modified := make([]byte, 0, len(body)+len(snippet))
+	modified = append(modified, body[:at]...)
+	modified = append(modified, snippet...)
+	modified = append(modified, body[at:]...)
+
+	resp.Body = io.NopCloser(bytes.NewReader(modified))
+	resp.ContentLength = int64(len(modified))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(modified)))
+	resp.TransferEncoding = nil
+	return nil
+}
+
+// lastIndexFold returns the index of the last ASCII case-insensitive match
+// of substr in s, or -1
+func lastIndexFold(s []byte, substr string) int {
+	for i := len(s) - len(substr); i >= 0; i-- {
+		if bytes.EqualFold(s[i:i+len(substr)], []byte(substr)) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,154 @@
+package tunnel
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const banner = `<div id="banner">staging</div>`
+
+func TestInjectHTML(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"before closing body", "text/html; charset=utf-8", "<html><body><p>hi</p></body></html>", "<html><body><p>hi</p>" + banner + "</body></html>"},
+		{"uppercase tag", "text/html", "<BODY>hi</BODY>", "<BODY>hi" + banner + "</BODY>"},
+		{"last closing tag", "text/html", "<pre></body></pre><body></body>", "<pre></body></pre><body>" + banner + "</body>"},
+		{"no closing tag", "text/html", "<p>fragment</p>", "<p>fragment</p>" + banner},
+		{"JSON", "application/json", `{"body":"</body>"}`, `{"body":"</body>"}`},
+		{"no content type", "", "</body>", "</body>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				Header:        http.Header{"Content-Type": {tt.contentType}, "Content-Length": {strconv.Itoa(len(tt.body))}},
+				Body:          io.NopCloser(strings.NewReader(tt.body)),
+				ContentLength: int64(len(tt.body)),
+				Request:       httptest.NewRequest(http.MethodGet, "/", nil),
+			}
+			require.NoError(t, injectHTML(resp, banner))
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(body))
+			assert.Equal(t, int64(len(tt.want)), resp.ContentLength)
+			assert.Equal(t, strconv.Itoa(len(tt.want)), resp.Header.Get("Content-Length"))
+		})
+	}
+}
+
+func TestInjectHTMLSkips(t *testing.T) {
+	// Compressed bodies aren't rewritten
+	resp := &http.Response{
+		Header:  http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"gzip"}},
+		Body:    io.NopCloser(strings.NewReader("compressed")),
+		Request: httptest.NewRequest(http.MethodGet, "/", nil),
+	}
+	require.NoError(t, injectHTML(resp, banner))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "compressed", string(body))
+
+	// A HEAD response keeps the length of the page it describes
+	resp = &http.Response{
+		Header:        http.Header{"Content-Type": {"text/html"}, "Content-Length": {"100"}},
+		Body:          http.NoBody,
+		ContentLength: 100,
+		Request:       httptest.NewRequest(http.MethodHead, "/", nil),
+	}
+	require.NoError(t, injectHTML(resp, banner))
+	assert.Equal(t, int64(100), resp.ContentLength)
+	assert.Equal(t, "100", resp.Header.Get("Content-Length"))
+
+	// Pages too big to buffer, or of unknown length, pass through as they are
+	big := strings.Repeat("x", maxInjectBody+1) + "</body>"
+	for _, length := range []int64{int64(len(big)), -1} {
+		resp = &http.Response{
+			Header:        http.Header{"Content-Type": {"text/html"}},
+			Body:          io.NopCloser(strings.NewReader(big)),
+			ContentLength: length,
+			Request:       httptest.NewRequest(http.MethodGet, "/", nil),
+		}
+		require.NoError(t, injectHTML(resp, banner))
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, len(big), len(body), "length %d", length)
+		assert.Equal(t, length, resp.ContentLength)
+	}
+
+	// As do bodies longer than their Content-Length claimed
+	resp = &http.Response{
+		Header:        http.Header{"Content-Type": {"text/html"}},
+		Body:          io.NopCloser(strings.NewReader(big)),
+		ContentLength: 10,
+		Request:       httptest.NewRequest(http.MethodGet, "/", nil),
+	}
+	require.NoError(t, injectHTML(resp, banner))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, big, string(body))
+}
+
+func TestTunnelInjectsHTML(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "<html><body>hello</body></html>")
+		case "/api":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"hello":"world"}`)
+		case "/gzip":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			io.WriteString(gz, "<html><body>zipped</body></html>")
+			gz.Close()
+		}
+	}))
+	defer backend.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "banner",
+		HTTPPort:    8284,
+		InjectHTML:  banner,
+	}))
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := http.Get("http://127.0.0.1:8284" + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	resp, body := get("/page")
+	assert.Equal(t, "<html><body>hello"+banner+"</body></html>", body)
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+
+	_, body = get("/api")
+	assert.Equal(t, `{"hello":"world"}`, body)
+	assert.NotContains(t, body, banner)
+
+	// The client decompresses the page the tunnel passed through untouched
+	_, body = get("/gzip")
+	assert.Equal(t, "<html><body>zipped</body></html>", body)
+}
@@ -0,0 +1,89 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// validateLabels checks that labels can be written and selected as
+// key=value pairs
+func validateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if key == "" || strings.ContainsAny(key, "=,") || strings.Contains(value, ",") {
+			return fmt.Errorf("%w: invalid label %q", ErrInvalidOptions, key+"="+value)
+		}
+	}
+	return nil
+}
+
+// matchesLabels reports whether labels has every key of selector with the
+// same value. An empty selector matches any tunnel.
+func matchesLabels(labels, selector map[string]string) bool {
+	for key, want := range selector {
+		if value, ok := labels[key]; !ok || value != want {
+			return false
+		}
+	}
+	return true
+}
+
+// ListTunnelsMatching is ListTunnels limited to tunnels whose labels
+// include every key=value pair of selector
+func (m *Manager) ListTunnelsMatching(selector map[string]string) []map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tunnelList := make([]map[string]interface{}, 0, len(m.tunnels))
+	for domain, tunnel := range m.tunnels {
+		if matchesLabels(tunnel.opts.Labels, selector) {
+			tunnelList = append(tunnelList, tunnel.info(domain))
+		}
+	}
+	return tunnelList
+}
+
+// StopAllMatching stops the tunnels whose labels include every key=value
+// pair of selector and leaves the others running. An empty selector stops
+// every tunnel, as Stop does.
+func (m *Manager) StopAllMatching(ctx context.Context, selector map[string]string) error {
+	if len(selector) == 0 {
+		return m.Stop(ctx)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waitForStarts()
+
+	var errs []error
+	for domain, tunnel := range m.tunnels {
+		if !matchesLabels(tunnel.opts.Labels, selector) {
+			continue
+		}
+		if err := m.stopTunnelLocked(ctx, domain); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop tunnel %s: %w", domain, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("errors stopping tunnels: %v", errs)
+	}
+	return nil
+}
+
+// traceAttributes identifies the tunnel on the spans of its requests: its
+// domain, and each label as tunnel.label.<key>
+func (t *Tunnel) traceAttributes() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("tunnel.domain", t.Domain)}
+	keys := make([]string, 0, len(t.opts.Labels))
+	for key := range t.opts.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attrs = append(attrs, attribute.String("tunnel.label."+key, t.opts.Labels[key]))
+	}
+	return attrs
+}
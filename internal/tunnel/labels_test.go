@@ -0,0 +1,115 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// domains returns the sorted domains of tunnel statuses
+func domains(tunnels []map[string]interface{}) []string {
+	names := make([]string, 0, len(tunnels))
+	for _, info := range tunnels {
+		names = append(names, info["domain"].(string))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLabels(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := setupTestServer()
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	for i, tc := range []struct {
+		domain string
+		labels map[string]string
+	}{
+		{"web-dev", map[string]string{"project": "web", "env": "dev"}},
+		{"web-staging", map[string]string{"project": "web", "env": "staging"}},
+		{"api-dev", map[string]string{"project": "api", "env": "dev"}},
+	} {
+		require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+			BackendPort: backendPort,
+			Domain:      tc.domain,
+			HTTPPort:    8274 + i,
+			Labels:      tc.labels,
+		}))
+		defer manager.StopTunnel(ctx, tc.domain+".local")
+	}
+
+	info, ok := manager.GetTunnel("web-dev.local")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"project": "web", "env": "dev"}, info["labels"])
+
+	assert.Equal(t, []string{"api-dev.local", "web-dev.local", "web-staging.local"},
+		domains(manager.ListTunnelsMatching(nil)), "an empty selector matches every tunnel")
+	assert.Equal(t, []string{"web-dev.local", "web-staging.local"},
+		domains(manager.ListTunnelsMatching(map[string]string{"project": "web"})))
+	assert.Equal(t, []string{"web-dev.local"},
+		domains(manager.ListTunnelsMatching(map[string]string{"project": "web", "env": "dev"})))
+	assert.Empty(t, manager.ListTunnelsMatching(map[string]string{"project": "mobile"}))
+}
+
+func TestStopAllMatching(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := setupTestServer()
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	for i, tc := range []struct {
+		domain string
+		labels map[string]string
+	}{
+		{"stop-web-dev", map[string]string{"project": "web", "env": "dev"}},
+		{"stop-web-staging", map[string]string{"project": "web", "env": "staging"}},
+		{"stop-api-dev", map[string]string{"project": "api", "env": "dev"}},
+	} {
+		require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+			BackendPort: backendPort,
+			Domain:      tc.domain,
+			HTTPPort:    8277 + i,
+			Labels:      tc.labels,
+		}))
+	}
+
+	require.NoError(t, manager.StopAllMatching(ctx, map[string]string{"project": "web"}))
+	assert.Equal(t, []string{"stop-api-dev.local"}, domains(manager.ListTunnels()))
+	for _, port := range []string{"8277", "8278"} {
+		_, err := net.Dial("tcp", "127.0.0.1:"+port)
+		assert.Error(t, err, "port %s is closed", port)
+	}
+	conn, err := net.Dial("tcp", "127.0.0.1:8279")
+	require.NoError(t, err, "the unmatched tunnel still serves")
+	conn.Close()
+
+	// A selector nothing matches stops nothing; an empty one stops the rest
+	require.NoError(t, manager.StopAllMatching(ctx, map[string]string{"env": "prod"}))
+	assert.Equal(t, 1, manager.Count())
+	require.NoError(t, manager.StopAllMatching(ctx, nil))
+	assert.Zero(t, manager.Count())
+}
+
+func TestTraceAttributes(t *testing.T) {
+	tunnel := &Tunnel{
+		Domain: "app.local",
+		opts:   Options{Labels: map[string]string{"project": "web", "env": "dev"}},
+	}
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("tunnel.domain", "app.local"),
+		attribute.String("tunnel.label.env", "dev"),
+		attribute.String("tunnel.label.project", "web"),
+	}, tunnel.traceAttributes())
+}
@@ -0,0 +1,157 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/johncferguson/gotunnel/internal/netutil"
+	"github.com/johncferguson/gotunnel/internal/proxy"
+)
+
+// PortRange is an inclusive range of TCP ports
+type PortRange struct {
+	First int
+	Last  int
+}
+
+// ParsePortRange parses "first-last", e.g. "9000-9100"
+func ParsePortRange(s string) (PortRange, error) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok {
+		return PortRange{}, fmt.Errorf("%w: port range %q must look like 9000-9100", ErrInvalidOptions, s)
+	}
+	var r PortRange
+	var err error
+	if r.First, err = strconv.Atoi(strings.TrimSpace(first)); err != nil {
+		return PortRange{}, fmt.Errorf("%w: invalid start of port range %q", ErrInvalidOptions, s)
+	}
+	if r.Last, err = strconv.Atoi(strings.TrimSpace(last)); err != nil {
+		return PortRange{}, fmt.Errorf("%w: invalid end of port range %q", ErrInvalidOptions, s)
+	}
+	return r, r.Validate()
+}
+
+// Validate checks the range is ordered and within valid port numbers
+func (r PortRange) Validate() error {
+	if r.First <= 0 || r.Last > 65535 || r.First > r.Last {
+		return fmt.Errorf("%w: invalid port range %s", ErrInvalidOptions, r)
+	}
+	return nil
+}
+
+// Contains reports whether port is in the range
+func (r PortRange) Contains(port int) bool {
+	return port >= r.First && port <= r.Last
+}
+
+// CheckProxyPorts makes sure the ports a proxy with config listens on are
+// outside r, so tunnels taking ports from r can't collide with it. Call it
+// before starting the proxy.
+func CheckProxyPorts(r PortRange, config proxy.ProxyConfig) error {
+	if r.Contains(config.HTTPPort) {
+		return fmt.Errorf("%w: proxy HTTP port %d is inside the tunnel port range %s", ErrInvalidPort, config.HTTPPort, r)
+	}
+	// The built-in proxy only listens for HTTPS when it terminates TLS
+	listensHTTPS := config.Mode != proxy.BuiltInProxy || config.TerminateTLS
+	if listensHTTPS && r.Contains(config.HTTPSPort) {
+		return fmt.Errorf("%w: proxy HTTPS port %d is inside the tunnel port range %s", ErrInvalidPort, config.HTTPSPort, r)
+	}
+	return nil
+}
+
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// portPool hands out ports from a range, lowest free first, so released
+// ports are reused before the range grows. Callers must hold Manager.mu.
+type portPool struct {
+	r    PortRange
+	used map[int]bool
+}
+
+func newPortPool(r PortRange) *portPool {
+	return &portPool{r: r, used: make(map[int]bool)}
+}
+
+// allocate hands out the lowest port that's neither in use by a tunnel
+// nor refused by bindable, e.g. because another process listens on it
+func (p *portPool) allocate(bindable func(port int) bool) (int, error) {
+	for port := p.r.First; port <= p.r.Last; port++ {
+		if !p.used[port] && bindable(port) {
+			p.used[port] = true
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no free ports left in tunnel port range %s", ErrBindFailed, p.r)
+}
+
+// reserve keeps port from being handed out, e.g. because something else
+// listens on it
+func (p *portPool) reserve(port int) {
+	if p.r.Contains(port) {
+		p.used[port] = true
+	}
+}
+
+func (p *portPool) release(port int) {
+	delete(p.used, port)
+}
+
+// canBind reports whether a tunnel listening on host with network could
+// bind port right now
+func canBind(network, host string, port int) bool {
+	config := &net.ListenConfig{Control: setSocketOptions}
+	l, err := config.Listen(context.Background(), network, net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// allocateTunnelPorts picks the internal HTTP and HTTPS listen ports for a
+// proxy-mode tunnel described by opts, from the configured range if there
+// is one. pooled reports whether they must be released back to the range.
+func (m *Manager) allocateTunnelPorts(opts Options) (httpPort, httpsPort int, pooled bool, err error) {
+	if m.ports == nil {
+		// startTunnel binds OS-assigned ports straight away, keeping the
+		// race window small
+		if httpPort, err = netutil.FreePort(); err != nil {
+			return 0, 0, false, fmt.Errorf("%w for HTTP: %w", ErrBindFailed, err)
+		}
+		if httpsPort, err = netutil.FreePort(); err != nil {
+			return 0, 0, false, fmt.Errorf("%w for HTTPS: %w", ErrBindFailed, err)
+		}
+		return httpPort, httpsPort, false, nil
+	}
+
+	// The built-in proxy may have been given any free port, which could be
+	// one of ours
+	m.ports.reserve(m.proxyManager.ActualPort())
+	m.ports.reserve(m.proxyManager.TLSPort())
+
+	// Ports another process holds are skipped rather than failing the start
+	bindable := func(port int) bool {
+		return canBind(listenNetwork(opts.IPFamily), opts.ListenAddr, port)
+	}
+	if httpPort, err = m.ports.allocate(bindable); err != nil {
+		return 0, 0, false, err
+	}
+	if httpsPort, err = m.ports.allocate(bindable); err != nil {
+		m.ports.release(httpPort)
+		return 0, 0, false, err
+	}
+	return httpPort, httpsPort, true, nil
+}
+
+// releaseTunnelPorts returns a tunnel's pooled ports to the range
+func (m *Manager) releaseTunnelPorts(t *Tunnel) {
+	if t.pooledPorts && m.ports != nil {
+		m.ports.release(t.HTTPPort)
+		m.ports.release(t.HTTPSPort)
+	}
+}
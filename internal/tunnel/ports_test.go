@@ -0,0 +1,228 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/johncferguson/gotunnel/internal/cert"
+	"github.com/johncferguson/gotunnel/internal/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    PortRange
+		wantErr bool
+	}{
+		{"9000-9100", PortRange{9000, 9100}, false},
+		{" 9000 - 9000 ", PortRange{9000, 9000}, false},
+		{"9000", PortRange{}, true},
+		{"abc-9100", PortRange{}, true},
+		{"9100-9000", PortRange{}, true},
+		{"0-10", PortRange{}, true},
+		{"65000-70000", PortRange{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePortRange(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidOptions)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPortPool(t *testing.T) {
+	pool := newPortPool(PortRange{First: 9000, Last: 9003})
+	anyPort := func(int) bool { return true }
+
+	// Ports come out in order until the range is used up
+	for want := 9000; want <= 9003; want++ {
+		port, err := pool.allocate(anyPort)
+		require.NoError(t, err)
+		assert.Equal(t, want, port)
+	}
+	_, err := pool.allocate(anyPort)
+	assert.ErrorIs(t, err, ErrBindFailed)
+	assert.Contains(t, err.Error(), "9000-9003")
+
+	// Freed ports are handed out again, lowest first
+	pool.release(9002)
+	pool.release(9001)
+	port, err := pool.allocate(anyPort)
+	require.NoError(t, err)
+	assert.Equal(t, 9001, port)
+	port, err = pool.allocate(anyPort)
+	require.NoError(t, err)
+	assert.Equal(t, 9002, port)
+	_, err = pool.allocate(anyPort)
+	assert.ErrorIs(t, err, ErrBindFailed)
+}
+
+func TestPortPoolSkipsUnbindablePorts(t *testing.T) {
+	pool := newPortPool(PortRange{First: 9000, Last: 9002})
+
+	port, err := pool.allocate(func(port int) bool { return port != 9000 })
+	require.NoError(t, err)
+	assert.Equal(t, 9001, port)
+
+	// The skipped port is handed out once it can be bound
+	port, err = pool.allocate(func(int) bool { return true })
+	require.NoError(t, err)
+	assert.Equal(t, 9000, port)
+
+	_, err = pool.allocate(func(int) bool { return false })
+	assert.ErrorIs(t, err, ErrBindFailed)
+}
+
+func TestManagerTunnelPortRangeSkipsTakenPort(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	// Another process holds the first port of the range
+	occupied, err := net.Listen("tcp", "0.0.0.0:8295")
+	require.NoError(t, err)
+	defer occupied.Close()
+
+	manager, err := NewManagerWithOptions(cert.New(filepath.Join(tempDir, "certs")), nil, ManagerOptions{
+		ProxyManager: proxy.NewManager(proxy.ProxyConfig{Mode: proxy.NoProxy}),
+		UseProxy:     true,
+		UseMDNS:      true,
+		TunnelPorts:  &PortRange{First: 8295, Last: 8297},
+	})
+	require.NoError(t, err)
+	defer manager.Stop(context.Background())
+
+	require.NoError(t, manager.StartTunnelWithOptions(context.Background(), Options{BackendPort: backendPort, Domain: "range-taken"}))
+	tunnel := manager.tunnels["range-taken.local"]
+	assert.Equal(t, []int{8296, 8297}, []int{tunnel.HTTPPort, tunnel.HTTPSPort})
+}
+
+func TestManagerTunnelPortRange(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	// Room for two tunnels, each taking an HTTP and an HTTPS port
+	manager, err := NewManagerWithOptions(cert.New(filepath.Join(tempDir, "certs")), nil, ManagerOptions{
+		ProxyManager: proxy.NewManager(proxy.ProxyConfig{Mode: proxy.NoProxy}),
+		UseProxy:     true,
+		UseMDNS:      true,
+		TunnelPorts:  &PortRange{First: 8230, Last: 8233},
+	})
+	require.NoError(t, err)
+	defer manager.Stop(context.Background())
+
+	ctx := context.Background()
+	start := func(domain string) error {
+		return manager.StartTunnelWithOptions(ctx, Options{BackendPort: backendPort, Domain: domain})
+	}
+
+	require.NoError(t, start("range-a"))
+	require.NoError(t, start("range-b"))
+	assert.ErrorIs(t, start("range-c"), ErrBindFailed, "range is exhausted")
+
+	// The failed start didn't leak anything; stopping a tunnel frees its ports
+	a := manager.tunnels["range-a.local"]
+	reused := []int{a.HTTPPort, a.HTTPSPort}
+	require.NoError(t, manager.StopTunnel(ctx, "range-a.local"))
+	require.NoError(t, start("range-c"))
+
+	c := manager.tunnels["range-c.local"]
+	assert.Equal(t, reused, []int{c.HTTPPort, c.HTTPSPort})
+	for _, tunnel := range manager.tunnels {
+		assert.GreaterOrEqual(t, tunnel.HTTPPort, 8230)
+		assert.LessOrEqual(t, tunnel.HTTPSPort, 8233)
+	}
+}
+
+func TestManagerRejectsInvalidPortRange(t *testing.T) {
+	_, err := NewManagerWithOptions(cert.New(t.TempDir()), nil, ManagerOptions{
+		UseMDNS:     true,
+		TunnelPorts: &PortRange{First: 9100, Last: 9000},
+	})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+}
+
+func TestCheckProxyPorts(t *testing.T) {
+	r := PortRange{First: 9080, Last: 9180}
+	tests := []struct {
+		name   string
+		config proxy.ProxyConfig
+		want   string
+	}{
+		{"outside", proxy.ProxyConfig{Mode: proxy.BuiltInProxy, HTTPPort: 80, HTTPSPort: 443}, ""},
+		{"HTTP inside", proxy.ProxyConfig{Mode: proxy.BuiltInProxy, HTTPPort: 9080, HTTPSPort: 443}, "proxy HTTP port 9080"},
+		{"unused HTTPS inside", proxy.ProxyConfig{Mode: proxy.BuiltInProxy, HTTPPort: 80, HTTPSPort: 9180}, ""},
+		{"HTTPS inside", proxy.ProxyConfig{Mode: proxy.BuiltInProxy, HTTPPort: 80, HTTPSPort: 9180, TerminateTLS: true}, "proxy HTTPS port 9180"},
+		{"external proxy HTTPS inside", proxy.ProxyConfig{Mode: proxy.NginxProxy, HTTPPort: 80, HTTPSPort: 9100}, "proxy HTTPS port 9100"},
+		{"any port", proxy.ProxyConfig{Mode: proxy.BuiltInProxy, HTTPPort: proxy.AnyPort, HTTPSPort: proxy.AnyPort, TerminateTLS: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckProxyPorts(r, tt.config)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidPort)
+			assert.Contains(t, err.Error(), tt.want)
+			assert.Contains(t, err.Error(), "9080-9180")
+		})
+	}
+}
+
+func TestManagerRejectsProxyPortInRange(t *testing.T) {
+	_, err := NewManagerWithOptions(cert.New(t.TempDir()), nil, ManagerOptions{
+		ProxyManager: proxy.NewManager(proxy.ProxyConfig{Mode: proxy.BuiltInProxy, HTTPPort: 9080}),
+		UseProxy:     true,
+		UseMDNS:      true,
+		TunnelPorts:  &PortRange{First: 9080, Last: 9180},
+	})
+	assert.ErrorIs(t, err, ErrInvalidPort)
+	assert.EqualError(t, err, "invalid port: proxy HTTP port 9080 is inside the tunnel port range 9080-9180")
+}
+
+func TestTunnelPortsSkipProxyPort(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	// The proxy is given any free port, which happens to start the range
+	proxyManager := proxy.NewManager(proxy.ProxyConfig{Mode: proxy.BuiltInProxy, HTTPPort: proxy.AnyPort})
+	require.NoError(t, proxyManager.Start())
+	defer proxyManager.Stop(context.Background())
+	proxyPort := proxyManager.ActualPort()
+
+	manager, err := NewManagerWithOptions(cert.New(filepath.Join(tempDir, "certs")), nil, ManagerOptions{
+		ProxyManager: proxyManager,
+		UseProxy:     true,
+		UseMDNS:      true,
+		TunnelPorts:  &PortRange{First: proxyPort, Last: proxyPort + 4},
+	})
+	require.NoError(t, err)
+	defer manager.Stop(context.Background())
+
+	require.NoError(t, manager.StartTunnelWithOptions(context.Background(), Options{BackendPort: backendPort, Domain: "skip-proxy-port"}))
+	tunnel := manager.tunnels["skip-proxy-port.local"]
+	assert.NotEqual(t, proxyPort, tunnel.HTTPPort)
+	assert.NotEqual(t, proxyPort, tunnel.HTTPSPort)
+}
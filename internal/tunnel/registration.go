@@ -0,0 +1,52 @@
+package tunnel
+
+import "time"
+
+// Ways a tunnel's names are made resolvable, as reported in Registration
+const (
+	RegistrationMDNS  = "mdns"
+	RegistrationHosts = "hosts"
+)
+
+// Registration is the timing of one name being made resolvable
+type Registration struct {
+	Domain   string
+	Method   string // RegistrationMDNS or RegistrationHosts
+	Duration time.Duration
+	Err      error // Set if the registration failed
+}
+
+// OnRegistration registers fn to receive the timing of every mDNS
+// registration and hosts file edit, replacing any earlier hook; nil removes
+// it. As with OnEvent, fn runs synchronously and should return quickly.
+func (m *Manager) OnRegistration(fn func(Registration)) {
+	if fn == nil {
+		m.onRegistration.Store(nil)
+		return
+	}
+	m.onRegistration.Store(&fn)
+}
+
+// registered delivers a registration timing to the registered hook, if any
+func (m *Manager) registered(r Registration) {
+	if fn := m.onRegistration.Load(); fn != nil {
+		(*fn)(r)
+	}
+}
+
+// register runs fn to make name resolvable by method, logging how long it
+// took and reporting the timing to the manager's hook
+func (t *Tunnel) register(method, name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	duration := time.Since(start)
+
+	t.logger.Performance(method+"_registration", duration, map[string]any{
+		"domain":  name,
+		"success": err == nil,
+	})
+	if t.onRegistered != nil {
+		t.onRegistered(Registration{Domain: name, Method: method, Duration: duration, Err: err})
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrationTimings(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := setupTestServer()
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	var (
+		mu    sync.Mutex
+		timed []Registration
+	)
+	manager.OnRegistration(func(r Registration) {
+		mu.Lock()
+		defer mu.Unlock()
+		timed = append(timed, r)
+	})
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backendPort,
+		Domain:      "timed",
+		HTTPPort:    8285,
+	}))
+	defer manager.StopTunnel(ctx, "timed.local")
+
+	mu.Lock()
+	defer mu.Unlock()
+	methods := map[string]bool{}
+	for _, r := range timed {
+		assert.Equal(t, "timed.local", r.Domain)
+		assert.NoError(t, r.Err)
+		assert.Positive(t, r.Duration)
+		methods[r.Method] = true
+	}
+	assert.Equal(t, map[string]bool{RegistrationHosts: true, RegistrationMDNS: true}, methods)
+}
@@ -0,0 +1,103 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ReloadResult reports how Reload changed the running tunnel set
+type ReloadResult struct {
+	Added     []string
+	Removed   []string
+	Updated   []string // Restarted because their options changed
+	Unchanged []string
+	Errors    map[string]error // Per-domain failures; other entries were still applied
+}
+
+// Reload converges the running tunnels on desired: tunnels missing from it are
+// stopped, new ones are started, and ones whose options changed are restarted.
+// A failure on one entry is recorded in the result and doesn't stop the rest.
+func (m *Manager) Reload(ctx context.Context, desired []Options) ReloadResult {
+	result := ReloadResult{Errors: make(map[string]error)}
+
+	wanted := make(map[string]Options, len(desired))
+	for _, opts := range desired {
+		domain := m.localDomain(opts.Domain)
+		if _, dup := wanted[domain]; dup {
+			result.Errors[domain] = fmt.Errorf("tunnel for domain %s is listed more than once", domain)
+			continue
+		}
+		opts.Domain = domain
+		wanted[domain] = opts.withDefaults()
+	}
+
+	m.mu.RLock()
+	running := make(map[string]Options, len(m.tunnels))
+	for domain, t := range m.tunnels {
+		running[domain] = t.opts
+	}
+	m.mu.RUnlock()
+
+	// Stop removed and changed tunnels first so their names and ports are
+	// free for anything being added
+	var toStart []string
+	for domain, current := range running {
+		opts, keep := wanted[domain]
+		switch {
+		case !keep:
+			if err := m.StopTunnel(ctx, domain); err != nil {
+				result.Errors[domain] = err
+				continue
+			}
+			result.Removed = append(result.Removed, domain)
+		case sameOptions(current, opts):
+			result.Unchanged = append(result.Unchanged, domain)
+		default:
+			if err := m.StopTunnel(ctx, domain); err != nil {
+				result.Errors[domain] = err
+				continue
+			}
+			if opts.Middleware == nil {
+				opts.Middleware = current.Middleware
+			}
+			if opts.Transport == nil {
+				opts.Transport = current.Transport
+			}
+			wanted[domain] = opts
+			toStart = append(toStart, domain)
+		}
+	}
+	for domain := range wanted {
+		if _, exists := running[domain]; !exists {
+			toStart = append(toStart, domain)
+		}
+	}
+
+	sort.Strings(toStart)
+	for _, domain := range toStart {
+		if err := m.StartTunnelWithOptions(ctx, wanted[domain]); err != nil {
+			result.Errors[domain] = err
+			continue
+		}
+		if _, existed := running[domain]; existed {
+			result.Updated = append(result.Updated, domain)
+		} else {
+			result.Added = append(result.Added, domain)
+		}
+	}
+
+	sort.Strings(result.Removed)
+	sort.Strings(result.Unchanged)
+	return result
+}
+
+// sameOptions reports whether two tunnels are configured alike. Middleware
+// functions can't be compared and config files can't set a Transport, so
+// both are ignored.
+func sameOptions(a, b Options) bool {
+	a.Middleware, b.Middleware = nil, nil
+	a.Transport, b.Transport = nil, nil
+	return reflect.DeepEqual(a, b)
+}
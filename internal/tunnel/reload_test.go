@@ -0,0 +1,98 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/johncferguson/gotunnel/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadKeepsMiddleware(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("X-Chain"))
+	}))
+	defer backend.Close()
+
+	ctx := context.Background()
+	opts := Options{BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port, Domain: "reload-mw", HTTPPort: 8226, HTTPSPort: 8526}
+	withMiddleware := opts
+	withMiddleware.Middleware = []middleware.Middleware{headerTagger("kept")}
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, withMiddleware))
+
+	// Config reloads can't carry middleware; that alone isn't a change
+	result := manager.Reload(ctx, []Options{opts})
+	assert.Equal(t, []string{"reload-mw.local"}, result.Unchanged)
+
+	// A restarted tunnel keeps its middleware
+	opts.BackendRetries = 1
+	result = manager.Reload(ctx, []Options{opts})
+	require.Empty(t, result.Errors)
+	assert.Equal(t, []string{"reload-mw.local"}, result.Updated)
+
+	resp, err := http.Get("http://127.0.0.1:8226/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "kept", string(body))
+}
+
+func TestManagerReload(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	keep := Options{BackendPort: backendPort, Domain: "reload-keep", HTTPPort: 8202, HTTPSPort: 8502}
+	change := Options{BackendPort: backendPort, Domain: "reload-change", HTTPPort: 8203, HTTPSPort: 8503}
+	drop := Options{BackendPort: backendPort, Domain: "reload-drop", HTTPPort: 8204, HTTPSPort: 8504}
+	for _, opts := range []Options{keep, change, drop} {
+		require.NoError(t, manager.StartTunnelWithOptions(ctx, opts))
+	}
+
+	changed := change
+	changed.BackendPort = backendPort + 1
+	add := Options{BackendPort: backendPort, Domain: "reload-add.local", HTTPPort: 8205, HTTPSPort: 8505}
+	invalid := Options{BackendPort: 0, Domain: "reload-invalid", HTTPPort: 8206, HTTPSPort: 8506}
+
+	result := manager.Reload(ctx, []Options{keep, changed, add, invalid})
+
+	assert.Equal(t, []string{"reload-add.local"}, result.Added)
+	assert.Equal(t, []string{"reload-drop.local"}, result.Removed)
+	assert.Equal(t, []string{"reload-change.local"}, result.Updated)
+	assert.Equal(t, []string{"reload-keep.local"}, result.Unchanged)
+	require.Len(t, result.Errors, 1, "a bad entry must not abort the reload")
+	assert.ErrorIs(t, result.Errors["reload-invalid.local"], ErrInvalidPort)
+
+	info, ok := manager.GetTunnel("reload-change.local")
+	require.True(t, ok)
+	assert.Equal(t, backendPort+1, info["port"])
+	_, ok = manager.GetTunnel("reload-drop.local")
+	assert.False(t, ok)
+
+	resp, err := http.Get("http://127.0.0.1:8205/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Reloading the same set again is a no-op
+	result = manager.Reload(ctx, []Options{keep, changed, add})
+	assert.Empty(t, result.Added)
+	assert.Empty(t, result.Removed)
+	assert.Empty(t, result.Updated)
+	assert.Len(t, result.Unchanged, 3)
+	assert.Empty(t, result.Errors)
+}
@@ -0,0 +1,65 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// backendTarget is the host and port a tunnel forwards requests to
+type backendTarget struct {
+	host string
+	port int
+}
+
+// addr is the target as host:port, for dialing
+func (b backendTarget) addr() string {
+	return net.JoinHostPort(b.host, strconv.Itoa(b.port))
+}
+
+// String names the target in logs and error pages, keeping the familiar
+// localhost:<port> for a backend on this machine
+func (b backendTarget) String() string {
+	if b.host == "127.0.0.1" {
+		return fmt.Sprintf("localhost:%d", b.port)
+	}
+	return b.addr()
+}
+
+// backend returns where the tunnel forwards requests now
+func (t *Tunnel) backend() backendTarget {
+	if b := t.target.Load(); b != nil {
+		return *b
+	}
+	return backendTarget{host: t.opts.backendHost(), port: t.Port}
+}
+
+// Retarget points a running tunnel at another backend host and port, e.g.
+// a container that came back with a new address, without restarting its
+// listeners. Requests already in flight finish against the old backend.
+// The tunnel's options follow, so export and the state file record the new
+// backend.
+func (m *Manager) Retarget(domain, host string, port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("%w for backend: %d", ErrInvalidPort, port)
+	}
+	if host == "" {
+		host = Options{}.backendHost()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tunnels[m.localDomain(domain)]
+	if !ok {
+		return fmt.Errorf("%w: no tunnel for domain %s", ErrTunnelNotFound, domain)
+	}
+	// Only read under m.mu once the tunnel runs; requests use t.target
+	t.opts.BackendHost = host
+	t.opts.BackendPort = port
+	target := backendTarget{host: host, port: port}
+	old := t.target.Swap(&target)
+	if old == nil || *old != target {
+		t.logger.Info("Backend moved", "backend", target.String())
+	}
+	return nil
+}
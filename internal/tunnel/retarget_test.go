@@ -0,0 +1,55 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetarget(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := func(name string) (*httptest.Server, int) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		}))
+		return srv, srv.Listener.Addr().(*net.TCPAddr).Port
+	}
+	first, firstPort := backend("first")
+	defer first.Close()
+	second, secondPort := backend("second")
+	defer second.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{BackendPort: firstPort, Domain: "retarget.local", HTTPPort: 8287}))
+	defer manager.StopTunnel(ctx, "retarget.local")
+
+	get := func() string {
+		resp, err := http.Get("http://127.0.0.1:8287/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	assert.Equal(t, "first", get())
+
+	require.NoError(t, manager.Retarget("retarget", "127.0.0.1", secondPort))
+	assert.Equal(t, "second", get())
+	assert.Equal(t, secondPort, manager.ListTunnels()[0]["port"])
+
+	// The export records the new backend
+	assert.Equal(t, secondPort, manager.Export().Tunnels[0].Port)
+	assert.Equal(t, "127.0.0.1", manager.Export().Tunnels[0].BackendHost)
+
+	assert.ErrorIs(t, manager.Retarget("nope", "127.0.0.1", secondPort), ErrTunnelNotFound)
+	assert.ErrorIs(t, manager.Retarget("retarget", "127.0.0.1", 0), ErrInvalidPort)
+}
@@ -0,0 +1,78 @@
+package tunnel
+
+import (
+	"net/url"
+	"strings"
+)
+
+// rewritePath applies a tunnel's StripPathPrefix and AddPathPrefix to the
+// URL of a request bound for the backend. Each is applied on its own: a
+// path without the strip prefix passes through unstripped but still gets
+// the added prefix. An encoded path (RawPath, e.g. with %2F in a segment)
+// is rewritten alongside Path so the encoding survives.
+func rewritePath(u *url.URL, strip, add string) {
+	strip, add = normalizePathPrefix(strip), normalizePathPrefix(add)
+	if strip == "" && add == "" {
+		return
+	}
+
+	path, rawPath := u.Path, u.RawPath
+	if strip != "" {
+		if stripped, ok := cutPathPrefix(path, strip); ok {
+			path = stripped
+			if rawPath != "" {
+				// Fall back to re-encoding Path if the prefix is encoded
+				// differently in the request
+				rawPath, ok = cutPathPrefix(rawPath, escapePath(strip))
+				if !ok {
+					rawPath = ""
+				}
+			}
+		}
+	}
+	if add != "" {
+		path = joinPathPrefix(add, path)
+		if rawPath != "" {
+			rawPath = joinPathPrefix(escapePath(add), rawPath)
+		}
+	}
+	u.Path, u.RawPath = path, rawPath
+}
+
+// normalizePathPrefix gives prefix a leading slash and no trailing one, so
+// "service", "/service" and "/service/" mean the same; "/" means none
+func normalizePathPrefix(prefix string) string {
+	trimmed := strings.Trim(prefix, "/")
+	if trimmed == "" {
+		return ""
+	}
+	return "/" + trimmed
+}
+
+// cutPathPrefix removes prefix from path if it's there as whole segments,
+// so "/service" matches "/service" and "/service/x" but not "/services".
+// The rest keeps a single leading slash.
+func cutPathPrefix(path, prefix string) (string, bool) {
+	if path == prefix {
+		return "/", true
+	}
+	rest, ok := strings.CutPrefix(path, prefix+"/")
+	if !ok {
+		return path, false
+	}
+	return "/" + strings.TrimLeft(rest, "/"), true
+}
+
+// joinPathPrefix puts prefix in front of path with exactly one slash
+// between them, keeping a trailing slash on path
+func joinPathPrefix(prefix, path string) string {
+	if path == "" {
+		return prefix
+	}
+	return prefix + "/" + strings.TrimLeft(path, "/")
+}
+
+// escapePath encodes a decoded path the way it appears in a URL
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
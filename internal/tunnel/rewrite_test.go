@@ -0,0 +1,84 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewritePath(t *testing.T) {
+	tests := []struct {
+		name        string
+		strip, add  string
+		path        string
+		want        string // Escaped path sent to the backend
+		wantDecoded string
+	}{
+		{"no prefixes", "", "", "/a/b", "/a/b", "/a/b"},
+		{"strip", "/service", "", "/service/a", "/a", "/a"},
+		{"strip whole path", "/service", "", "/service", "/", "/"},
+		{"strip keeps trailing slash", "/service", "", "/service/a/", "/a/", "/a/"},
+		{"strip prefix written loosely", "service/", "", "/service/a", "/a", "/a"},
+		{"strip no match passes through", "/service", "", "/other/a", "/other/a", "/other/a"},
+		{"strip matches whole segments only", "/service", "", "/services/a", "/services/a", "/services/a"},
+		{"strip leaves no double slash", "/service", "", "/service//a", "/a", "/a"},
+		{"strip keeps encoded segments", "/service", "", "/service/a%2Fb", "/a%2Fb", "/a/b"},
+		{"add", "", "/service", "/a", "/service/a", "/service/a"},
+		{"add to root", "", "/service", "/", "/service/", "/service/"},
+		{"add with trailing slash", "", "/service/", "/a", "/service/a", "/service/a"},
+		{"add keeps encoded segments", "", "/service", "/a%2Fb", "/service/a%2Fb", "/service/a/b"},
+		{"add encodes prefix", "", "/my service", "/a", "/my%20service/a", "/my service/a"},
+		{"strip then add", "/api", "/v2", "/api/users", "/v2/users", "/v2/users"},
+		{"add without strip match", "/api", "/v2", "/health", "/v2/health", "/v2/health"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse("http://backend" + tt.path + "?q=1")
+			require.NoError(t, err)
+			rewritePath(u, tt.strip, tt.add)
+			assert.Equal(t, tt.want, u.EscapedPath())
+			assert.Equal(t, tt.wantDecoded, u.Path)
+			assert.Equal(t, "q=1", u.RawQuery, "query is untouched")
+		})
+	}
+}
+
+func TestTunnelPathPrefixes(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.RequestURI())
+	}))
+	defer backend.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort:     backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:          "prefixed",
+		HTTPPort:        8263,
+		StripPathPrefix: "/public",
+		AddPathPrefix:   "/service",
+	}))
+
+	for path, want := range map[string]string{
+		"/public/docs?page=2": "/service/docs?page=2",
+		"/public/a%2Fb":       "/service/a%2Fb",
+		"/":                   "/service/",
+	} {
+		resp, err := http.Get("http://127.0.0.1:8263" + path)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(body), path)
+	}
+}
@@ -0,0 +1,18 @@
+package tunnel
+
+import "github.com/johncferguson/gotunnel/internal/state"
+
+// OptionsFromState converts a state file entry back into tunnel options.
+// Fields an older state file lacks keep their defaults.
+func OptionsFromState(ts state.TunnelState) Options {
+	return Options{
+		BackendPort: ts.Port,
+		Domain:      ts.Domain,
+		Aliases:     ts.Aliases,
+		HTTPS:       ts.HTTPS,
+		HTTPPort:    ts.HTTPPort,
+		HTTPSPort:   ts.HTTPSPort,
+		Labels:      ts.Labels,
+		BackendHost: ts.TargetHost,
+	}
+}
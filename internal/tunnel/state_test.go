@@ -0,0 +1,44 @@
+package tunnel
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/johncferguson/gotunnel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsFromStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tunnels.json")
+	require.NoError(t, state.SaveTunnelsTo(path, []state.TunnelState{{
+		Port:       3000,
+		Domain:     "state-web.local",
+		HTTPPort:   8286,
+		HTTPSPort:  8686,
+		TargetHost: "172.17.0.2",
+		Aliases:    []string{"state-www.local"},
+		Labels:     map[string]string{"project": "web"},
+	}}))
+	loaded, err := state.LoadTunnelsFrom(path)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+
+	assert.Equal(t, Options{
+		BackendPort: 3000,
+		Domain:      "state-web.local",
+		Aliases:     []string{"state-www.local"},
+		HTTPPort:    8286,
+		HTTPSPort:   8686,
+		BackendHost: "172.17.0.2",
+		Labels:      map[string]string{"project": "web"},
+	}, OptionsFromState(loaded[0]))
+
+	// Older files hold only the backend port and domain
+	assert.Equal(t, Options{BackendPort: 3000, Domain: "old.local"}, OptionsFromState(state.TunnelState{Port: 3000, Domain: "old.local"}))
+}
+
+func TestBackendHost(t *testing.T) {
+	assert.Equal(t, "127.0.0.1", Options{}.backendHost())
+	assert.Equal(t, "172.17.0.2", Options{BackendHost: "172.17.0.2"}.backendHost())
+}
@@ -1,152 +1,599 @@
 package tunnel
 
 import (
-	"bufio"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/johncferguson/gotunnel/internal/cert"
 	"github.com/johncferguson/gotunnel/internal/dnsserver"
+	"github.com/johncferguson/gotunnel/internal/httpserver"
 	"github.com/johncferguson/gotunnel/internal/logging"
+	"github.com/johncferguson/gotunnel/internal/middleware"
+	"github.com/johncferguson/gotunnel/internal/netutil"
 	"github.com/johncferguson/gotunnel/internal/proxy"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 const (
-	defaultHostsFile = "/etc/hosts"
+	defaultHostsFile  = "/etc/hosts"
+	defaultListenAddr = "0.0.0.0" // All interfaces, so mDNS clients can reach the tunnel
+)
+
+// IP families a tunnel can listen on; see Options.IPFamily
+const (
+	IPFamilyDual = "dual" // IPv4 and IPv6, or IPv4 alone where IPv6 is disabled
+	IPFamily4    = "4"
+	IPFamily6    = "6"
 )
 
 // For testing purposes - allow overriding the hosts file path
 var hostsFile = defaultHostsFile
 
 type Tunnel struct {
-	Port        int    // Backend target port (where user's app runs)
-	HTTPPort    int    // Tunnel HTTP listen port (default 80)
-	HTTPSPort   int    // Tunnel HTTPS listen port (default 443) 
+	Port          int    // Backend target port (where user's app runs)
+	BackendScheme string // "http" or "https"
+	HTTPPort      int    // Tunnel HTTP listen port (default 80)
+	HTTPSPort     int    // Tunnel HTTPS listen port (default 443)
+	Domain        string
+	Aliases       []string // Extra domains served by the same tunnel
+	TargetIP      string
+	ListenAddr    string // Interface address the tunnel binds to
+	HTTPS         bool
+	servers       []*tunnelServer // One per listen port
+	done          chan struct{}
+	Cert          *tls.Certificate       // As loaded at start; WatchCerts may since have replaced it
+	CORS          *middleware.CORSConfig // Optional CORS handling in front of the backend
+	dialer        *backendDialer
+	logger        *logging.Logger // Tagged with the tunnel domain
+	startedAt     time.Time
+	opts          Options      // As requested, so Reload can diff against it
+	requests      atomic.Int64 // Requests served since the tunnel started
+	bytesIn       atomic.Int64 // Client to backend, request bodies only for HTTP
+	bytesOut      atomic.Int64 // Backend to client, response bodies only for HTTP
+	badGateways   atomic.Int64 // Requests answered with a 502 because the backend failed
+	breaker       *breaker     // Set when opts.CircuitBreaker is
+	pooledPorts   bool         // HTTPPort/HTTPSPort came from the manager's port range
+
+	emit        func(EventType, string, error) // Manager's event hook
+	backendDown atomic.Bool                    // Last backend request failed
+	buffers     httputil.BufferPool            // Shared copy buffers for the reverse proxy
+
+	onRegistered func(Registration) // Manager's registration timing hook
+
+	target atomic.Pointer[backendTarget] // Where requests go now; see Retarget
+
+	// Base context of every request; cancelled when the tunnel stops so
+	// in-flight backend requests are abandoned
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	healthDone chan struct{} // Closed when the HealthGatedMDNS checker exits; nil if none runs
+
+	lastRequest atomic.Int64  // Unix nanoseconds of the last request's start or end
+	inFlight    atomic.Int64  // Requests being served
+	idleDone    chan struct{} // Closed when the IdleTimeout checker exits; nil if none runs
+
+	certs       atomic.Pointer[tunnelCerts] // Served by SNI; nil for HTTP tunnels
+	routes      []*proxy.Route              // Registered with the proxy in proxy mode
+	certWatcher *fsnotify.Watcher           // Set while starting with WatchCerts
+	clientCAs   *x509.CertPool              // Loaded from ClientCAFile; nil accepts any client
+	certsDone   chan struct{}               // Closed when the WatchCerts watcher exits; nil if none runs
+}
+
+// tunnelServer is one of a tunnel's listeners and the server on it. An
+// HTTPS tunnel that also serves plain HTTP has two.
+type tunnelServer struct {
+	scheme string // "http" or "https"
+	server *httpserver.Server
+}
+
+// event reports a state change of this tunnel to the manager's hook
+func (t *Tunnel) event(typ EventType, err error) {
+	if t.emit != nil {
+		t.emit(typ, t.Domain, err)
+	}
+}
+
+// names returns the primary domain followed by its aliases
+func (t *Tunnel) names() []string {
+	return append([]string{t.Domain}, t.Aliases...)
+}
+
+// certFor returns the certificate served for name, or nil for HTTP tunnels
+func (t *Tunnel) certFor(name string) *tls.Certificate {
+	certs := t.certs.Load()
+	if !t.HTTPS || certs == nil {
+		return nil
+	}
+	for i, alias := range t.Aliases {
+		if alias == name && i < len(certs.aliases) {
+			return &certs.aliases[i]
+		}
+	}
+	return certs.primary
+}
+
+// RequestCount returns the number of requests served since the tunnel started
+func (t *Tunnel) RequestCount() int64 {
+	return t.requests.Load()
+}
+
+// BadGateways returns the number of requests answered with a 502 because
+// the backend couldn't be reached or failed mid-response
+func (t *Tunnel) BadGateways() int64 {
+	return t.badGateways.Load()
+}
+
+// countRequests wraps next so every request increments the tunnel's counter
+// and counts as activity for the idle timeout
+func (t *Tunnel) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.requests.Add(1)
+		t.inFlight.Add(1)
+		t.touch()
+		defer func() {
+			t.touch()
+			t.inFlight.Add(-1)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BytesTransferred returns the bytes forwarded from clients to the backend
+// and back since the tunnel started. For HTTP only bodies are counted, not
+// headers or framing, and upgraded (e.g. WebSocket) connections aren't
+// counted.
+func (t *Tunnel) BytesTransferred() (in, out int64) {
+	return t.bytesIn.Load(), t.bytesOut.Load()
+}
+
+// countBytes wraps next so request and response bodies add to the tunnel's
+// byte counters
+func (t *Tunnel) countBytes(next http.Handler) http.Handler {
+	return middleware.AccessLog(func(r *http.Request, entry middleware.AccessLogEntry) {
+		t.bytesOut.Add(entry.Bytes)
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &countingReader{ReadCloser: r.Body, n: &t.bytesIn}
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// countingReader adds the bytes read through it to n
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// logRequests wraps next so every request is logged with its status and latency
+func (t *Tunnel) logRequests(next http.Handler) http.Handler {
+	return middleware.AccessLog(func(r *http.Request, entry middleware.AccessLogEntry) {
+		t.logger.WithContext(r.Context()).ProxyRequest(r.Method, r.Host, r.URL.Path, entry.Status, entry.Duration, r.UserAgent(), clientIP(r))
+	})(next)
+}
+
+// clientIP is the address of the client that sent r, as named by a PROXY
+// protocol header if the tunnel expects one
+func clientIP(r *http.Request) string {
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return ip
+	}
+	return r.RemoteAddr
+}
+
+// recoverPanics wraps next so a panicking handler answers 500 instead of
+// taking the process down. The panic is logged with its stack and reported
+// as an EventError.
+func (t *Tunnel) recoverPanics(next http.Handler) http.Handler {
+	return middleware.Recover(func(r *http.Request, err error, stack []byte) {
+		t.logger.WithContext(r.Context()).Error("Recovered from panic while serving request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"error", err,
+			"stack", string(stack),
+		)
+		t.event(EventError, err)
+	})(next)
+}
+
+// Options describes a tunnel to start. Zero ports fall back to the
+// production defaults (80/443).
+type Options struct {
+	BackendPort int                    // Backend target port (where user's app runs)
 	Domain      string
-	TargetIP    string
+	Aliases     []string               // Additional domains routed to the same backend
 	HTTPS       bool
-	server      *http.Server
-	listener    net.Listener
-	done        chan struct{}
-	Cert        *tls.Certificate
+	HTTPPort    int                    // Tunnel HTTP listen port (default 80)
+	HTTPSPort   int                    // Tunnel HTTPS listen port (default 443)
+	ListenAddr  string                 // Interface address to bind (default all interfaces)
+	IPFamily    string                 // IPFamilyDual (default), IPFamily4 or IPFamily6
+	CORS        *middleware.CORSConfig // Optional; nil leaves responses untouched
+	CertFile    string                 // Existing certificate to serve instead of generating one with mkcert
+	KeyFile     string                 // Private key for CertFile
+
+	// WatchCerts reloads CertFile and KeyFile whenever they change, e.g.
+	// when an external tool rotates them, without restarting the listener
+	WatchCerts bool
+
+	// ClientCAFile, if set, makes an HTTPS tunnel require a client
+	// certificate signed by one of the CAs in this PEM bundle (mutual TLS).
+	// Handshakes without one fail before any request is read. Clients must
+	// reach the tunnel directly, not through a proxy that terminates TLS.
+	ClientCAFile string
+
+	// AlsoHTTP makes an HTTPS tunnel serve plain HTTP on HTTPPort as well,
+	// and RedirectHTTP makes that listener redirect to HTTPS instead
+	AlsoHTTP     bool
+	RedirectHTTP bool
+
+	// ProxyProtocol expects every connection to start with a PROXY protocol
+	// (v1 or v2) header, as sent by a load balancer in front of the tunnel,
+	// and treats the client it names as the remote address. Connections
+	// without a valid header are dropped.
+	ProxyProtocol bool
+
+	// Retries for backend dials that fail transiently (e.g. connection
+	// refused while the app starts). Zero disables retrying.
+	BackendRetries      int
+	BackendRetryBackoff time.Duration // Delay before the first retry (default 100ms), doubled each attempt
+
+	// Backend connection tuning, for raw and reverse-proxied traffic alike.
+	// A negative BackendKeepAlive disables TCP keep-alives.
+	BackendDialTimeout     time.Duration // Per dial attempt (default 5s)
+	BackendKeepAlive       time.Duration // TCP keep-alive period (default 30s)
+	BackendMaxIdleConns    int           // Idle connections kept for reuse (default 16)
+	BackendIdleConnTimeout time.Duration // How long an idle connection is kept (default 90s)
+
+	// Transport, if set, carries reverse-proxied requests to the backend
+	// instead of one built from the options above, e.g. to cap connections
+	// or dial a unix socket. Raw TCP forwarding and health checks still dial
+	// the backend port directly. Reload keeps a tunnel's Transport unless
+	// the new options set one.
+	Transport *http.Transport
+
+	// HealthGatedMDNS advertises the tunnel over mDNS only while its backend
+	// accepts connections, checked every BackendHealthInterval (default 2s),
+	// so clients don't discover a name that would refuse them
+	HealthGatedMDNS       bool
+	BackendHealthInterval time.Duration
+
+	// MDNSTXT adds TXT records (e.g. path=/health, proto=https) to the
+	// tunnel's mDNS advertisements for service-discovery clients, overriding
+	// the defaults (version, ip, port) of the same key
+	MDNSTXT map[string]string
+
+	// Labels tag the tunnel for grouping, e.g. project=web or env=dev. They
+	// show in its status, select it in bulk operations (ListTunnelsMatching,
+	// StopAllMatching), and are set on its request spans as
+	// tunnel.label.<key> attributes.
+	Labels map[string]string
+
+	// BackendHost is the host the backend runs on (default 127.0.0.1), for
+	// backends on another machine or in a container
+	BackendHost string
+
+	// Scheme the backend speaks: "http" (default) or "https" for dev servers
+	// that already terminate TLS, typically with a self-signed certificate
+	BackendScheme             string
+	BackendInsecureSkipVerify bool // Accept any backend certificate
+
+	// BackendH2C speaks HTTP/2 over cleartext to the backend, as gRPC dev
+	// servers expect. It requires the "http" backend scheme and no Transport.
+	BackendH2C bool
+
+	// GRPC tunnels a gRPC server: the backend is reached over HTTP/2 (h2c
+	// unless BackendScheme is "https"), plain HTTP clients may use h2c, and
+	// responses are flushed immediately so streams aren't held up
+	GRPC bool
+
+	// PreserveHost sends the incoming Host header (e.g. app.local) to the
+	// backend instead of its own address, for backends that route by Host
+	PreserveHost bool
+
+	// StripPathPrefix removes a leading path prefix (e.g. "/service") from
+	// requests before they reach the backend, and AddPathPrefix puts one in
+	// front, e.g. to expose a backend mounted under a subpath at the tunnel
+	// root. Paths without StripPathPrefix pass through unstripped.
+	StripPathPrefix string
+	AddPathPrefix   string
+
+	// InjectHTML, if set, is inserted before </body> in the backend's HTML
+	// responses, e.g. a banner marking a staging environment. Compressed
+	// responses, and those too big or of unknown length to buffer, are
+	// passed through untouched.
+	InjectHTML string
+
+	// IdleTimeout, if set, stops the tunnel once it has gone this long
+	// without a request, e.g. for a short-lived demo
+	IdleTimeout time.Duration
+
+	// ResponseTimeout, if set, bounds how long a request waits for the
+	// backend's response, headers and body, before failing with a 504.
+	// WebSocket upgrades are only held to it until the backend answers.
+	ResponseTimeout time.Duration
+
+	// CircuitBreaker, if set, fails requests fast with a 503 while the
+	// backend keeps failing instead of waiting on it each time
+	CircuitBreaker *CircuitBreaker
+
+	// Middleware wraps the reverse proxy, first entry outermost. It runs
+	// inside CORS and request logging. Reload can't compare functions, so a
+	// reloaded tunnel keeps the middleware it was started with.
+	Middleware []middleware.Middleware
 }
 
 type Manager struct {
 	tunnels      map[string]*Tunnel
 	mu           sync.RWMutex
-	certManager  *cert.CertManager
+	certManager  cert.CertProvider
 	hostsBackup  string
 	proxyManager *proxy.Manager
 	logger       *logging.Logger
 	useProxy     bool
+	useMDNS      bool
+	useHosts     bool
+	ports        *portPool // Internal ports for proxy-mode tunnels; nil uses OS-assigned ports
+	buffers      *netutil.BufferPool
+	dryRun       bool // Log side effects instead of performing them
+	tld          string    // Suffix added to bare domains, without the leading dot
+
+	// starting maps the names of tunnels part-way through starting to their
+	// primary domain; started is signalled whenever an entry is removed
+	starting map[string]string
+	started  *sync.Cond
+
+	// ctx is the parent of every tunnel's request contexts; Close cancels it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	onEvent atomic.Pointer[func(TunnelEvent)] // Hook set by OnEvent
+
+	onRegistration atomic.Pointer[func(Registration)] // Hook set by OnRegistration
 }
 
-func NewManager(certManager *cert.CertManager, logger *logging.Logger) *Manager {
-	if logger == nil {
-		logger, _ = logging.New(logging.DefaultConfig())
+// ManagerOptions configures how a Manager routes tunnels and makes their
+// domains resolvable. At least one of UseMDNS and UseHosts must be set.
+type ManagerOptions struct {
+	ProxyManager *proxy.Manager
+	UseProxy     bool // Route through ProxyManager instead of binding 80/443 per tunnel
+	UseMDNS      bool // Advertise domains over mDNS (off for networks that block it)
+	UseHosts     bool // Add domains to the hosts file (always skipped in proxy mode)
+
+	// TunnelPorts, if set, is where proxy-mode tunnels take their internal
+	// listen ports from, instead of any port the OS assigns
+	TunnelPorts *PortRange
+
+	// LocalTLD is the suffix given to bare domains (default "local"). Only
+	// .local names can be advertised over mDNS; any other TLD, such as
+	// "test", resolves through the hosts file alone.
+	LocalTLD string
+
+	// AdvertiseIP, if set, is the address advertised over mDNS instead of
+	// the detected outbound one. The mDNS responder is shared, so this
+	// applies to every manager in the process; managers that leave it nil
+	// keep whatever address was set before.
+	AdvertiseIP net.IP
+
+	// BufferSize is the size of the copy buffers tunnels share when
+	// proxying request and response bodies (default 32KB)
+	BufferSize int
+
+	// DryRun makes starting and stopping tunnels log the certificates,
+	// listeners, hosts entries, mDNS records and proxy routes involved
+	// instead of creating or removing them
+	DryRun bool
+}
+
+// DefaultLocalTLD is the TLD tunnel domains get when none is configured
+const DefaultLocalTLD = "local"
+
+// NormalizeTLD lowercases tld and strips a leading dot, so ".Test" and
+// "test" are the same. An empty tld means DefaultLocalTLD.
+func NormalizeTLD(tld string) (string, error) {
+	tld = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tld), "."))
+	if tld == "" {
+		return DefaultLocalTLD, nil
+	}
+	for _, r := range tld {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return "", fmt.Errorf("%w: TLD %q must be a single label of letters, digits and hyphens", ErrInvalidOptions, tld)
+		}
+	}
+	if strings.HasPrefix(tld, "-") || strings.HasSuffix(tld, "-") {
+		return "", fmt.Errorf("%w: TLD %q can't start or end with a hyphen", ErrInvalidOptions, tld)
 	}
+	return tld, nil
+}
+
+func NewManager(certManager cert.CertProvider, logger *logging.Logger) *Manager {
 	return NewManagerWithProxy(certManager, nil, false, logger)
 }
 
-func NewManagerWithProxy(certManager *cert.CertManager, proxyManager *proxy.Manager, useProxy bool, logger *logging.Logger) *Manager {
+func NewManagerWithProxy(certManager cert.CertProvider, proxyManager *proxy.Manager, useProxy bool, logger *logging.Logger) *Manager {
+	m, _ := NewManagerWithOptions(certManager, logger, ManagerOptions{
+		ProxyManager: proxyManager,
+		UseProxy:     useProxy,
+		UseMDNS:      true,
+		UseHosts:     true,
+	})
+	return m
+}
+
+// NewManagerWithOptions creates a Manager configured by opts, getting
+// certificates from certManager for tunnels without their own files
+func NewManagerWithOptions(certManager cert.CertProvider, logger *logging.Logger, opts ManagerOptions) (*Manager, error) {
+	if !opts.UseMDNS && !opts.UseHosts {
+		return nil, fmt.Errorf("%w: mDNS and the hosts file can't both be disabled", ErrInvalidOptions)
+	}
+	tld, err := NormalizeTLD(opts.LocalTLD)
+	if err != nil {
+		return nil, err
+	}
+	useMDNS := opts.UseMDNS && tld == DefaultLocalTLD
+	if !useMDNS && !opts.UseHosts {
+		return nil, fmt.Errorf("%w: .%s domains resolve only through the hosts file, which is disabled", ErrInvalidOptions, tld)
+	}
+	var ports *portPool
+	if opts.TunnelPorts != nil {
+		if err := opts.TunnelPorts.Validate(); err != nil {
+			return nil, err
+		}
+		if opts.UseProxy && opts.ProxyManager != nil {
+			if err := CheckProxyPorts(*opts.TunnelPorts, opts.ProxyManager.Config()); err != nil {
+				return nil, err
+			}
+		}
+		ports = newPortPool(*opts.TunnelPorts)
+	}
 	if logger == nil {
 		logger, _ = logging.New(logging.DefaultConfig())
 	}
+	// Leave the shared address alone unless asked, so a second manager
+	// doesn't undo the first one's choice
+	if opts.AdvertiseIP != nil {
+		if !dnsserver.IsLocalAddress(opts.AdvertiseIP) {
+			logger.Warn("Advertised IP isn't assigned to any local interface; tunnels may be unreachable",
+				"advertise_ip", opts.AdvertiseIP.String())
+		}
+		dnsserver.SetAdvertiseIP(opts.AdvertiseIP)
+	}
+
 	// Initialize DNS server when creating a new manager
-	if err := dnsserver.StartDNSServer(); err != nil {
-		logger.Warn("Failed to initialize DNS server", "error", err)
-	} else {
-		logger.Info("DNS server initialized successfully")
+	if useMDNS {
+		if err := dnsserver.StartDNSServer(); err != nil {
+			logger.Warn("Failed to initialize DNS server", "error", err)
+		} else {
+			logger.Info("DNS server initialized successfully")
+		}
 	}
 
-	return &Manager{
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		ctx:          ctx,
+		cancel:       cancel,
 		tunnels:      make(map[string]*Tunnel),
+		starting:     make(map[string]string),
 		certManager:  certManager,
-		proxyManager: proxyManager,
-		useProxy:     useProxy,
+		proxyManager: opts.ProxyManager,
+		useProxy:     opts.UseProxy,
+		useMDNS:      useMDNS,
+		tld:          tld,
+		useHosts:     opts.UseHosts,
+		ports:        ports,
+		buffers:      netutil.NewBufferPool(opts.BufferSize),
+		dryRun:       opts.DryRun,
 		logger:       logger.WithComponent("tunnel"),
 	}
+	m.started = sync.NewCond(&m.mu)
+	return m, nil
 }
 
-// backupHostsFile creates a backup of the hosts file
-func (m *Manager) backupHostsFile() error {
-	content, err := os.ReadFile(hostsFile)
-	if err != nil {
-		return fmt.Errorf("failed to read hosts file: %w", err)
-	}
-
-	if err := os.WriteFile(m.hostsBackup, content, 0644); err != nil {
-		return fmt.Errorf("failed to create hosts backup: %w", err)
-	}
+// editsHosts reports whether tunnel domains go in the hosts file
+func (m *Manager) editsHosts() bool {
+	return m.useHosts && !m.useProxy
+}
 
-	return nil
+// StartTunnelWithPorts starts a tunnel with custom listen ports (for testing)
+func (m *Manager) StartTunnelWithPorts(ctx context.Context, backendPort int, domain string, https bool, httpPort, httpsPort int) error {
+	return m.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backendPort,
+		Domain:      domain,
+		HTTPS:       https,
+		HTTPPort:    httpPort,
+		HTTPSPort:   httpsPort,
+	})
 }
 
-// restoreHostsFile restores the hosts file from backup
-func (m *Manager) restoreHostsFile() error {
-	if m.hostsBackup == "" {
-		return nil // No backup exists
+// withDefaults fills in the listen ports and address left unset
+func (o Options) withDefaults() Options {
+	if o.HTTPSPort == 0 {
+		o.HTTPSPort = 443
 	}
-
-	content, err := os.ReadFile(m.hostsBackup)
-	if err != nil {
-		return fmt.Errorf("failed to read hosts backup: %w", err)
+	if o.HTTPPort == 0 {
+		o.HTTPPort = 80
 	}
-
-	if err := os.WriteFile(hostsFile, content, 0644); err != nil {
-		return fmt.Errorf("failed to restore hosts file: %w", err)
+	if o.IPFamily == "" {
+		o.IPFamily = IPFamilyDual
 	}
-
-	// Clean up backup file
-	if err := os.Remove(m.hostsBackup); err != nil {
-		log.Printf("Warning: Failed to remove backup file: %v", err)
+	if o.ListenAddr == "" {
+		o.ListenAddr = defaultListenAddr
+		if o.IPFamily == IPFamily6 {
+			o.ListenAddr = "::"
+		}
 	}
-
-	return nil
+	if o.BackendScheme == "" {
+		o.BackendScheme = "http"
+	}
+	return o
 }
 
-// StartTunnelWithPorts starts a tunnel with custom listen ports (for testing)
-func (m *Manager) StartTunnelWithPorts(ctx context.Context, backendPort int, domain string, https bool, httpPort, httpsPort int) error {
-	// Set defaults if needed
-	if httpsPort == 0 {
-		httpsPort = 443
-	}
-	if httpPort == 0 {
-		httpPort = 80
+// backendHost is the host requests are forwarded to
+func (o Options) backendHost() string {
+	if o.BackendHost == "" {
+		return "127.0.0.1"
 	}
+	return o.BackendHost
+}
+
+// servesHTTP reports whether an HTTPS tunnel also listens on its HTTP port
+func (o Options) servesHTTP() bool {
+	return o.AlsoHTTP || o.RedirectHTTP
+}
 
-	m.logger.WithContext(ctx).Info("Starting tunnel",
-		"domain", domain,
-		"backend_port", backendPort,
-		"https", https,
-		"http_port", httpPort,
-		"https_port", httpsPort,
+// StartTunnelWithOptions starts a tunnel described by opts. Canceling ctx
+// abandons a start still in progress.
+func (m *Manager) StartTunnelWithOptions(ctx context.Context, opts Options) error {
+	opts = opts.withDefaults()
+
+	logger := m.logger.WithTunnel(m.localDomain(opts.Domain)).WithContext(ctx)
+	logger.Info("Starting tunnel",
+		"domain", opts.Domain,
+		"backend_port", opts.BackendPort,
+		"https", opts.HTTPS,
+		"http_port", opts.HTTPPort,
+		"https_port", opts.HTTPSPort,
 	)
 
 	startTime := time.Now()
-	err := m.startTunnelInternal(ctx, backendPort, domain, https, httpPort, httpsPort)
+	err := m.startTunnelInternal(ctx, opts)
 	
 	if err != nil {
-		m.logger.WithContext(ctx).TunnelError(domain, err, map[string]any{
-			"backend_port": backendPort,
+		logger.TunnelError(opts.Domain, err, map[string]any{
+			"backend_port": opts.BackendPort,
 			"duration": time.Since(startTime),
 		})
+		m.emit(EventError, m.localDomain(opts.Domain), err)
 		return err
 	}
+	if m.dryRun {
+		return nil
+	}
 
-	m.logger.WithContext(ctx).TunnelStarted(domain, backendPort, fmt.Sprintf("localhost:%d", backendPort))
+	logger.TunnelStarted(opts.Domain, opts.BackendPort, fmt.Sprintf("localhost:%d", opts.BackendPort))
+	m.emit(EventStarted, m.localDomain(opts.Domain), nil)
 	return nil
 }
 
@@ -155,109 +602,447 @@ func (m *Manager) StartTunnel(ctx context.Context, backendPort int, domain strin
 	return m.StartTunnelWithPorts(ctx, backendPort, domain, https, 80, httpsPort)
 }
 
-func (m *Manager) startTunnelInternal(ctx context.Context, backendPort int, domain string, https bool, httpPort, httpsPort int) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+func (m *Manager) startTunnelInternal(ctx context.Context, opts Options) error {
+	backendPort, domain, https := opts.BackendPort, opts.Domain, opts.HTTPS
+	httpPort, httpsPort := opts.HTTPPort, opts.HTTPSPort
 
 	// Validate inputs
 	if backendPort <= 0 || backendPort > 65535 {
-		return fmt.Errorf("invalid backend port: %d", backendPort)
+		return fmt.Errorf("%w for backend: %d", ErrInvalidPort, backendPort)
 	}
 	if domain == "" {
-		return fmt.Errorf("domain cannot be empty")
+		return fmt.Errorf("%w: empty domain", ErrInvalidDomain)
+	}
+	if err := validateDomain(m.localDomain(domain)); err != nil {
+		return err
 	}
 	if httpPort <= 0 || httpPort > 65535 {
-		return fmt.Errorf("invalid HTTP port: %d", httpPort)
+		return fmt.Errorf("%w for HTTP: %d", ErrInvalidPort, httpPort)
 	}
 	if httpsPort <= 0 || httpsPort > 65535 {
-		return fmt.Errorf("invalid HTTPS port: %d", httpsPort)
+		return fmt.Errorf("%w for HTTPS: %d", ErrInvalidPort, httpsPort)
+	}
+	if net.ParseIP(opts.ListenAddr) == nil {
+		return fmt.Errorf("%w: invalid listen address: %q", ErrInvalidOptions, opts.ListenAddr)
+	}
+	if err := checkIPFamily(opts.IPFamily, opts.ListenAddr); err != nil {
+		return err
+	}
+	if opts.BackendScheme != "http" && opts.BackendScheme != "https" {
+		return fmt.Errorf("%w: invalid backend scheme: %q", ErrInvalidOptions, opts.BackendScheme)
+	}
+	if opts.h2c() && (opts.BackendScheme != "http" || opts.Transport != nil) {
+		return fmt.Errorf("%w: h2c needs the http backend scheme and can't be combined with a custom transport", ErrInvalidOptions)
+	}
+	if opts.BackendRetries < 0 {
+		return fmt.Errorf("%w: invalid backend retries: %d", ErrInvalidOptions, opts.BackendRetries)
+	}
+	if opts.BackendDialTimeout < 0 || opts.BackendIdleConnTimeout < 0 || opts.BackendMaxIdleConns < 0 {
+		return fmt.Errorf("%w: backend dial timeout, idle timeout and idle connections can't be negative", ErrInvalidOptions)
 	}
+	if opts.BackendHealthInterval < 0 {
+		return fmt.Errorf("%w: invalid backend health interval: %s", ErrInvalidOptions, opts.BackendHealthInterval)
+	}
+	if opts.CORS != nil {
+		if err := opts.CORS.Validate(); err != nil {
+			return fmt.Errorf("%w: invalid CORS configuration: %w", ErrInvalidOptions, err)
+		}
+	}
+	if opts.servesHTTP() {
+		if !https {
+			return fmt.Errorf("%w: serving or redirecting plain HTTP alongside HTTPS needs an HTTPS tunnel", ErrInvalidOptions)
+		}
+		if httpPort == httpsPort {
+			return fmt.Errorf("%w: HTTP and HTTPS can't share port %d", ErrInvalidPort, httpPort)
+		}
+		if m.useProxy && m.proxyManager != nil {
+			// The proxy only routes to the tunnel's HTTPS port
+			return fmt.Errorf("%w: serving or redirecting plain HTTP alongside HTTPS needs --proxy none", ErrInvalidOptions)
+		}
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return fmt.Errorf("%w: certificate and key files must be provided together", ErrInvalidOptions)
+	}
+	if opts.WatchCerts && (!https || opts.CertFile == "") {
+		return fmt.Errorf("%w: watching certificates needs an HTTPS tunnel with certificate and key files", ErrInvalidOptions)
+	}
+	if opts.ClientCAFile != "" && !https {
+		return fmt.Errorf("%w: client certificates need an HTTPS tunnel", ErrInvalidOptions)
+	}
+	if opts.ClientCAFile != "" && opts.AlsoHTTP {
+		// Plain HTTP can't ask for a certificate; only redirecting is safe
+		return fmt.Errorf("%w: client certificates can't be required while also serving plain HTTP", ErrInvalidOptions)
+	}
+	if opts.ClientCAFile != "" && m.useProxy && m.proxyManager != nil {
+		return fmt.Errorf("%w: client certificates can't be checked behind the proxy, which terminates TLS", ErrInvalidOptions)
+	}
+	if opts.IdleTimeout < 0 {
+		return fmt.Errorf("%w: invalid idle timeout: %s", ErrInvalidOptions, opts.IdleTimeout)
+	}
+	if opts.ResponseTimeout < 0 {
+		return fmt.Errorf("%w: invalid response timeout: %s", ErrInvalidOptions, opts.ResponseTimeout)
+	}
+	for key, value := range opts.MDNSTXT {
+		// RFC 6763: a record is key=value in at most 255 bytes
+		if key == "" || strings.Contains(key, "=") || len(key)+1+len(value) > 255 {
+			return fmt.Errorf("%w: invalid mDNS TXT record %q", ErrInvalidOptions, key+"="+value)
+		}
+	}
+	if err := validateLabels(opts.Labels); err != nil {
+		return err
+	}
+	if opts.CircuitBreaker != nil {
+		if err := opts.CircuitBreaker.Validate(); err != nil {
+			return fmt.Errorf("%w: invalid circuit breaker: %w", ErrInvalidOptions, err)
+		}
+	}
+
+	// Claim the names and ports while holding the lock. Certificates, the
+	// listener and the startup wait come after it's released, so many
+	// tunnels can start at once.
+	m.mu.Lock()
+	tunnel, err := m.reserveTunnel(opts)
+	m.mu.Unlock()
+	if err != nil || tunnel == nil {
+		return err
+	}
+
+	err = m.launchTunnel(ctx, tunnel)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unreserve(tunnel)
+	if err != nil {
+		m.releaseTunnelPorts(tunnel)
+		return err
+	}
+
+	// Add to internal map for tracking
+	tunnel.startedAt = time.Now()
+	m.tunnels[tunnel.Domain] = tunnel
+	if opts.IdleTimeout > 0 {
+		tunnel.touch()
+		tunnel.idleDone = make(chan struct{})
+		go m.stopWhenIdle(tunnel)
+	}
+
+	// Register with proxy if using proxy mode
+	if m.useProxy && m.proxyManager != nil {
+		targetHost := tunnel.dialHost()
+		// Proxy routes to the port the tunnel actually listens on
+		targetPort := tunnel.HTTPPort
+		if https {
+			targetPort = tunnel.HTTPSPort
+		}
+		for _, name := range tunnel.names() {
+			route := &proxy.Route{
+				Domain:      name,
+				TargetHost:  targetHost,
+				TargetPort:  targetPort,
+				HTTPS:       https,
+				Certificate: tunnel.certFor(name), // Lets the proxy terminate TLS by SNI
+
+				// The tunnel can only pass on the Host it receives
+				PreserveHost: opts.PreserveHost,
+				GRPC:         opts.GRPC,
+			}
+
+			tunnel.routes = append(tunnel.routes, route)
+			if err := m.proxyManager.AddRoute(route); err != nil {
+				tunnel.logger.Warn("Failed to register proxy route", "domain", name, "error", err)
+			} else {
+				tunnel.logger.Debug("Registered proxy route", "domain", name, "target", net.JoinHostPort(targetHost, strconv.Itoa(targetPort)))
+			}
+		}
+	}
+
+	// Started once the routes are registered: the watcher reads them as it
+	// reloads, and they don't change after this
+	if tunnel.certWatcher != nil {
+		tunnel.certsDone = make(chan struct{})
+		go m.reloadCertsOnChange(tunnel, tunnel.certWatcher)
+	}
+
+	// Create hosts file backup before first modification
+	if m.editsHosts() && len(m.tunnels) == 1 {
+		if err := m.backupHostsFile(); err != nil {
+			return fmt.Errorf("failed to backup hosts file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// reserveTunnel checks that opts' domain and aliases are free, allocates
+// the tunnel's ports and claims its names until unreserve, so a concurrent
+// start of the same name fails as a duplicate. It returns nil on a dry run,
+// after logging the plan. The caller must hold m.mu.
+func (m *Manager) reserveTunnel(opts Options) (*Tunnel, error) {
+	domain := opts.Domain
 
 	// Prevent duplicate tunnels for the same domain
 	if _, exists := m.tunnels[domain]; exists {
-		return fmt.Errorf("tunnel for domain %s already exists", domain)
+		return nil, fmt.Errorf("%w: tunnel for %s already exists", ErrDuplicateDomain, domain)
+	}
+	if owner, taken := m.domainOwner(m.localDomain(domain)); taken {
+		return nil, fmt.Errorf("%w: %s is already served by tunnel %s", ErrDuplicateDomain, domain, owner)
+	}
+
+	aliases, err := m.normalizeAliases(m.localDomain(domain), opts.Aliases)
+	if err != nil {
+		return nil, err
+	}
+	if m.dryRun {
+		m.planStart(opts, m.localDomain(domain), aliases)
+		return nil, nil
 	}
 
 	// If using proxy, modify ports to avoid conflicts
-	tunnelHTTPPort := httpPort
-	tunnelHTTPSPort := httpsPort
-	
+	tunnelHTTPPort := opts.HTTPPort
+	tunnelHTTPSPort := opts.HTTPSPort
+	pooledPorts := false
+
 	if m.useProxy && m.proxyManager != nil {
-		// Use high ports for actual tunnel, proxy will handle 80/443
-		// Start from 9080 to avoid conflicts with proxy on 8080
-		tunnelHTTPPort = 9080 + len(m.tunnels)  // Dynamic port allocation  
-		tunnelHTTPSPort = 9443 + len(m.tunnels)
-		
-		log.Printf("Using proxy mode: tunnel will run on ports %d/%d, accessible via proxy on %d/%d", 
-			tunnelHTTPPort, tunnelHTTPSPort, httpPort, httpsPort)
-	}
+		// Use internal ports for the actual tunnel, proxy will handle 80/443
+		tunnelHTTPPort, tunnelHTTPSPort, pooledPorts, err = m.allocateTunnelPorts(opts)
+		if err != nil {
+			return nil, err
+		}
 
-	// Convert domain to .local if not already
-	if !strings.HasSuffix(domain, ".local") {
-		domain = domain + ".local"
+		m.logger.Info("Using proxy mode",
+			"tunnel_http_port", tunnelHTTPPort, "tunnel_https_port", tunnelHTTPSPort,
+			"proxy_http_port", opts.HTTPPort, "proxy_https_port", opts.HTTPSPort)
 	}
 
+	// Add the TLD if not already there
+	domain = m.localDomain(domain)
+	opts.Domain = domain
+
 	// Create new tunnel instance
 	tunnel := &Tunnel{
-		Port:      backendPort,      // Backend target port (where user's app runs)
-		HTTPPort:  tunnelHTTPPort,   // Tunnel HTTP listen port (may be high port if using proxy)
-		HTTPSPort: tunnelHTTPSPort,  // Tunnel HTTPS listen port (may be high port if using proxy)
-		Domain:    domain,
-		TargetIP:  "127.0.0.1",
-		HTTPS:     https,
-		done:      make(chan struct{}), // Initialize the done channel
+		Port:          opts.BackendPort, // Backend target port (where user's app runs)
+		BackendScheme: opts.BackendScheme,
+		HTTPPort:      tunnelHTTPPort,  // Tunnel HTTP listen port (may be high port if using proxy)
+		HTTPSPort:     tunnelHTTPSPort, // Tunnel HTTPS listen port (may be high port if using proxy)
+		Domain:        domain,
+		Aliases:       aliases,
+		TargetIP:      "127.0.0.1",
+		ListenAddr:    opts.ListenAddr,
+		HTTPS:         opts.HTTPS,
+		CORS:          opts.CORS,
+		dialer:        backendDialerFor(opts),
+		logger:        m.logger.WithTunnel(domain),
+		opts:          opts,
+		pooledPorts:   pooledPorts,
+		emit:          m.emit,
+		onRegistered:  m.registered,
+		buffers:       m.buffers,
+		done:          make(chan struct{}), // Initialize the done channel
 	}
+	tunnel.target.Store(&backendTarget{host: opts.backendHost(), port: opts.BackendPort})
+	if opts.CircuitBreaker != nil {
+		tunnel.breaker = newBreaker(*opts.CircuitBreaker, tunnel.circuitChanged)
+	}
+
+	for _, name := range tunnel.names() {
+		m.starting[name] = domain
+	}
+	return tunnel, nil
+}
+
+// unreserve releases the names reserveTunnel claimed for t and wakes anyone
+// waiting for starts to finish. The caller must hold m.mu.
+func (m *Manager) unreserve(t *Tunnel) {
+	for _, name := range t.names() {
+		delete(m.starting, name)
+	}
+	m.started.Broadcast()
+}
+
+// waitForStarts blocks until no tunnel is part-way through starting, so
+// stopping everything doesn't miss one. The caller must hold m.mu, which is
+// released while waiting.
+func (m *Manager) waitForStarts() {
+	for len(m.starting) > 0 {
+		m.started.Wait()
+	}
+}
+
+// launchTunnel loads the tunnel's certificates and starts serving it. It
+// runs without m.mu held, and gives up once ctx is done.
+func (m *Manager) launchTunnel(ctx context.Context, tunnel *Tunnel) error {
+	domain, opts := tunnel.Domain, tunnel.opts
 
 	// Ensure the SSL/TLS certificate is available
-	if https {
-		cert, err := m.certManager.EnsureCert(domain)
+	if tunnel.HTTPS {
+		certs := m.certManager
+		if opts.CertFile != "" {
+			// A provided certificate must cover the aliases too (e.g. a wildcard)
+			certs = &cert.FileProvider{CertFile: opts.CertFile, KeyFile: opts.KeyFile}
+		}
+		loaded, err := tunnel.loadCerts(certs)
 		if err != nil {
-			return fmt.Errorf("failed to ensure certificate: %w", err)
+			return err
 		}
-		tunnel.Cert = cert
+		tunnel.Cert = loaded.primary
+		tunnel.certs.Store(loaded)
+	}
+	if opts.ClientCAFile != "" {
+		pool, err := loadClientCAs(opts.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		tunnel.clientCAs = pool
+	}
+
+	// Watch before starting so a file that can't be watched fails the start
+	if opts.WatchCerts {
+		w, err := tunnel.newCertWatcher()
+		if err != nil {
+			return fmt.Errorf("failed to watch %s certificate files: %w", domain, err)
+		}
+		tunnel.certWatcher = w
 	}
 
-	if err := m.startTunnel(tunnel); err != nil {
+	if err := m.startTunnel(ctx, tunnel); err != nil {
+		if tunnel.certWatcher != nil {
+			tunnel.certWatcher.Close()
+		}
 		return fmt.Errorf("failed to start tunnel: %w", err)
 	}
+	return nil
+}
 
-	// Add to internal map for tracking
-	m.tunnels[domain] = tunnel
+// checkIPFamily validates family and that addr belongs to it
+func checkIPFamily(family, addr string) error {
+	ip := net.ParseIP(addr)
+	switch family {
+	case IPFamilyDual:
+		return nil
+	case IPFamily4:
+		if ip.To4() == nil {
+			return fmt.Errorf("%w: listen address %s isn't an IPv4 address", ErrInvalidOptions, addr)
+		}
+		return nil
+	case IPFamily6:
+		if ip.To4() != nil {
+			return fmt.Errorf("%w: listen address %s isn't an IPv6 address", ErrInvalidOptions, addr)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: invalid IP family %q (want 4, 6 or dual)", ErrInvalidOptions, family)
+}
 
-	// Register with proxy if using proxy mode
-	if m.useProxy && m.proxyManager != nil {
-		route := &proxy.Route{
-			Domain:     domain,
-			TargetHost: "127.0.0.1",
-			TargetPort: tunnel.HTTPPort, // Proxy routes to tunnel's actual port
-			HTTPS:      https,
-		}
-		
-		if err := m.proxyManager.AddRoute(route); err != nil {
-			log.Printf("Warning: Failed to register proxy route: %v", err)
-		} else {
-			log.Printf("✅ Registered proxy route: %s -> 127.0.0.1:%d", domain, tunnel.HTTPPort)
+// listenNetwork returns the network a tunnel of the given IP family binds
+// on. For "tcp", Go listens on an unspecified address (0.0.0.0 or ::) over
+// IPv6 with IPv4-mapped addresses, falling back to IPv4 alone where IPv6
+// is disabled.
+func listenNetwork(family string) string {
+	switch family {
+	case IPFamily4:
+		return "tcp4"
+	case IPFamily6:
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// localDomain appends the manager's TLD if domain doesn't already have it
+func (m *Manager) localDomain(domain string) string {
+	if !strings.HasSuffix(domain, "."+m.tld) {
+		return domain + "." + m.tld
+	}
+	return domain
+}
+
+// Limits on names written to the hosts file and advertised over mDNS
+const (
+	maxDomainLength = 253
+	maxLabelLength  = 63
+)
+
+// validateDomain rejects names that aren't plain DNS names: dot-separated
+// labels of letters, digits and hyphens. Anything else (spaces, newlines,
+// slashes) could corrupt the hosts file or mDNS records.
+func validateDomain(name string) error {
+	if len(name) > maxDomainLength {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidDomain, name, maxDomainLength)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return fmt.Errorf("%w: %q has an empty label", ErrInvalidDomain, name)
+		}
+		if len(label) > maxLabelLength {
+			return fmt.Errorf("%w: label %q in %q is longer than %d characters", ErrInvalidDomain, label, name, maxLabelLength)
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' {
+				return fmt.Errorf("%w: %q may only contain letters, digits, hyphens and dots", ErrInvalidDomain, name)
+			}
+		}
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("%w: label %q in %q can't start or end with a hyphen", ErrInvalidDomain, label, name)
 		}
 	}
+	return nil
+}
 
-	// Create hosts file backup before first modification (only if not using proxy)
-	if !m.useProxy && len(m.tunnels) == 1 {
-		if err := m.backupHostsFile(); err != nil {
-			return fmt.Errorf("failed to backup hosts file: %w", err)
+// TLD returns the suffix, without the leading dot, given to bare domains
+func (m *Manager) TLD() string {
+	return m.tld
+}
+
+// domainOwner reports which tunnel, if any, already serves name as its
+// primary domain or an alias, including tunnels still starting. Callers
+// must hold m.mu.
+func (m *Manager) domainOwner(name string) (string, bool) {
+	if domain, ok := m.starting[name]; ok {
+		return domain, true
+	}
+	for domain, tunnel := range m.tunnels {
+		for _, existing := range tunnel.names() {
+			if existing == name {
+				return domain, true
+			}
 		}
 	}
+	return "", false
+}
 
-	return nil
+// normalizeAliases adds the TLD to each alias and rejects empty,
+// duplicate, or already-served names. Callers must hold m.mu.
+func (m *Manager) normalizeAliases(domain string, aliases []string) ([]string, error) {
+	seen := map[string]bool{domain: true}
+	normalized := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		if alias == "" {
+			return nil, fmt.Errorf("%w: empty alias", ErrInvalidDomain)
+		}
+		alias = m.localDomain(alias)
+		if err := validateDomain(alias); err != nil {
+			return nil, err
+		}
+		if seen[alias] {
+			return nil, fmt.Errorf("%w: alias %s is listed twice", ErrDuplicateDomain, alias)
+		}
+		if owner, taken := m.domainOwner(alias); taken {
+			return nil, fmt.Errorf("%w: alias %s collides with tunnel %s", ErrDuplicateDomain, alias, owner)
+		}
+		seen[alias] = true
+		normalized = append(normalized, alias)
+	}
+	return normalized, nil
 }
 
 func (m *Manager) Stop(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.waitForStarts()
 
 	var errs []error
-	// Stop all tunnels
-	for domain, tunnel := range m.tunnels {
-		if err := tunnel.stop(ctx); err != nil {
+	// Tear down every tunnel, including its proxy routes and mDNS records
+	for domain := range m.tunnels {
+		if err := m.stopTunnelLocked(ctx, domain); err != nil {
 			errs = append(errs, fmt.Errorf("failed to stop tunnel %s: %w", domain, err))
 		}
 	}
@@ -265,9 +1050,11 @@ func (m *Manager) Stop(ctx context.Context) error {
 	// Clear the tunnels map
 	m.tunnels = make(map[string]*Tunnel)
 
-	// Restore hosts file from backup
-	if err := m.restoreHostsFile(); err != nil {
-		errs = append(errs, fmt.Errorf("failed to restore hosts file: %w", err))
+	// Remove any hosts entries left; a dry run never added any
+	if !m.dryRun && m.editsHosts() {
+		if err := m.cleanupHostsFile(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to clean up hosts file: %w", err))
+		}
 	}
 
 	// If there were any errors, return them combined
@@ -282,60 +1069,134 @@ func (m *Manager) StopTunnel(ctx context.Context, domain string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	return m.stopTunnelLocked(ctx, domain)
+}
+
+// stopTunnelLocked stops a single tunnel and removes its hosts entries, proxy
+// routes and mDNS records. The caller must hold m.mu.
+func (m *Manager) stopTunnelLocked(ctx context.Context, domain string) error {
+	if m.dryRun {
+		m.planStop(domain)
+		return nil
+	}
+
 	tunnel, exists := m.tunnels[domain]
 	if !exists {
-		return fmt.Errorf("tunnel for domain %s does not exist", domain)
+		return fmt.Errorf("%w: no tunnel for domain %s", ErrTunnelNotFound, domain)
 	}
 
 	// Stop the tunnel
 	if err := tunnel.stop(ctx); err != nil {
+		m.emit(EventError, domain, err)
 		return fmt.Errorf("failed to stop tunnel: %w", err)
 	}
+	if tunnel.healthDone != nil {
+		<-tunnel.healthDone // Stopping cancelled it; don't race its mDNS updates
+	}
+	if tunnel.idleDone != nil {
+		<-tunnel.idleDone
+	}
+	if tunnel.certsDone != nil {
+		<-tunnel.certsDone // Don't race its proxy route updates
+	}
 
-	// Remove from hosts file (only if not using proxy mode)
-	if !m.useProxy {
-		if err := removeFromHostsFile(domain); err != nil {
-			log.Printf("Warning: Failed to remove from hosts file: %v", err)
+	for _, name := range tunnel.names() {
+		// Remove from hosts file (only if we added it)
+		if m.editsHosts() {
+			if err := removeFromHostsFile(name); err != nil {
+				tunnel.logger.Warn("Failed to remove from hosts file", "domain", name, "error", err)
+			}
 		}
-	}
 
-	// Remove from proxy if using proxy mode
-	if m.useProxy && m.proxyManager != nil {
-		if err := m.proxyManager.RemoveRoute(domain); err != nil {
-			log.Printf("Warning: Failed to remove proxy route: %v", err)
-		} else {
-			log.Printf("🗑️  Removed proxy route: %s", domain)
+		// Remove from proxy if using proxy mode
+		if m.useProxy && m.proxyManager != nil {
+			if err := m.proxyManager.RemoveRoute(name); err != nil {
+				tunnel.logger.Warn("Failed to remove proxy route", "domain", name, "error", err)
+			} else {
+				tunnel.logger.Debug("Removed proxy route", "domain", name)
+			}
 		}
-	}
 
-	// Unregister from mDNS
-	if err := dnsserver.UnregisterDomain(domain); err != nil {
-		return fmt.Errorf("failed to unregister domain from mDNS: %w", err)
+		// Unregister from mDNS
+		if m.useMDNS {
+			if err := dnsserver.UnregisterDomain(name); err != nil {
+				return fmt.Errorf("failed to unregister domain %s from mDNS: %w", name, err)
+			}
+		}
 	}
 
 	// Remove from tunnels map
 	delete(m.tunnels, domain)
+	m.releaseTunnelPorts(tunnel)
+	tunnel.logger.WithContext(ctx).TunnelStopped(domain, time.Since(tunnel.startedAt))
+	m.emit(EventStopped, domain, nil)
 	return nil
 }
 
+// setForwardedHeaders tells the backend how the client reached the tunnel so
+// it can build absolute URLs. X-Forwarded-For is appended by ReverseProxy
+// itself. Headers set by a trusted proxy in front of the tunnel (such as the
+// built-in one) are kept, as the tunnel only sees that proxy's request; from
+// anyone else they're replaced, so a client can't spoof them.
+func setForwardedHeaders(req *http.Request, https, trusted bool) {
+	proto := "http"
+	if https {
+		proto = "https"
+	}
+	if !trusted {
+		req.Header.Del("X-Forwarded-For")
+		req.Header.Del("Forwarded")
+	}
+	if !trusted || req.Header.Get("X-Forwarded-Proto") == "" {
+		req.Header.Set("X-Forwarded-Proto", proto)
+	}
+	if !trusted || req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", req.Host)
+	}
+
+	// RFC 7239: IPv6 nodes are bracketed and quoted
+	node := "unknown"
+	if ip, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		node = ip
+		if strings.Contains(ip, ":") {
+			node = fmt.Sprintf("%q", "["+ip+"]")
+		}
+	}
+	forwarded := fmt.Sprintf("for=%s;host=%q;proto=%s", node, req.Host, proto)
+	if prior := req.Header.Get("Forwarded"); prior != "" {
+		forwarded = prior + ", " + forwarded
+	}
+	req.Header.Set("Forwarded", forwarded)
+}
+
+// trustsForwarded reports whether req's forwarding headers can be kept: it
+// came from this machine, as the built-in proxy's requests do, over
+// loopback or the one interface the tunnel is bound to
+func (t *Tunnel) trustsForwarded(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.Equal(net.ParseIP(t.ListenAddr)))
+}
+
+// stop closes the tunnel's listener and waits for in-flight requests until
+// ctx is done. Requests still running then (e.g. long-lived streams) are
+// cancelled and their connections force-closed.
 func (t *Tunnel) stop(ctx context.Context) error {
-	if t.server != nil {
+	for _, ts := range t.servers {
 		// Server shutdown should gracefully close the listener
-		if err := t.server.Shutdown(ctx); err != nil {
-			// If graceful shutdown fails, force close the listener
-			if t.listener != nil {
-				t.listener.Close()
-			}
-			return fmt.Errorf("error shutting down server: %w", err)
-		}
-		t.server = nil
-	} else if t.listener != nil {
-		// Only close listener directly if server wasn't running
-		if err := t.listener.Close(); err != nil {
-			return fmt.Errorf("error closing listener: %w", err)
+		err := ts.server.Shutdown(ctx)
+		if errors.Is(err, httpserver.ErrForceClosed) {
+			t.logger.Warn("Requests still running at the shutdown deadline, closed their connections", "scheme", ts.scheme)
+		} else if err != nil {
+			return fmt.Errorf("error shutting down %s server: %w", ts.scheme, err)
 		}
 	}
-	t.listener = nil
+	t.servers = nil
+
+	t.cancelRequests()
 
 	// Remove from hosts file (will be handled by manager for proxy mode)
 	// Note: This is called from manager which handles proxy mode appropriately
@@ -344,247 +1205,498 @@ func (t *Tunnel) stop(ctx context.Context) error {
 	return nil
 }
 
+// cancelRequests cancels the context of every request the tunnel is serving
+func (t *Tunnel) cancelRequests() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
 func (m *Manager) ListTunnels() []map[string]interface{} {
+	return m.ListTunnelsMatching(nil)
+}
+
+// Count returns the number of running tunnels
+func (m *Manager) Count() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	return len(m.tunnels)
+}
 
-	tunnelList := make([]map[string]interface{}, 0, len(m.tunnels))
-	for domain, tunnel := range m.tunnels {
-		tunnelInfo := map[string]interface{}{
-			"domain": domain,
-			"port":   tunnel.Port,
-			"https":  tunnel.HTTPS,
-		}
-		tunnelList = append(tunnelList, tunnelInfo)
+// GetTunnel returns the status of a single tunnel
+func (m *Manager) GetTunnel(domain string) (map[string]interface{}, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tunnel, exists := m.tunnels[domain]
+	if !exists {
+		return nil, false
 	}
+	return tunnel.info(domain), true
+}
 
-	return tunnelList
+// info summarizes the tunnel for status output
+func (t *Tunnel) info(domain string) map[string]interface{} {
+	return map[string]interface{}{
+		"domain":    domain,
+		"aliases":   t.Aliases,
+		"labels":    t.opts.Labels,
+		"port":      t.backend().port,
+		"https":     t.HTTPS,
+		"requests":  t.RequestCount(),
+		"bytes_in":  t.bytesIn.Load(),
+		"bytes_out": t.bytesOut.Load(),
+
+		"bad_gateways": t.badGateways.Load(),
+	}
 }
 
 func handleConnection(ctx context.Context, clientConn net.Conn, tunnel *Tunnel) {
 	defer clientConn.Close()
 
 	// Connect to the local application (with a timeout)
-	dialCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-	localConn, err := (&net.Dialer{Timeout: 5 * time.Second}).DialContext(dialCtx, "tcp", fmt.Sprintf("localhost:%d", tunnel.Port))
+	dialer := tunnel.dialer
+	if dialer == nil {
+		dialer = newBackendDialer(0, 0)
+	}
+	logger := tunnel.logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+	backend := tunnel.backend()
+	localConn, err := dialer.DialContext(ctx, "tcp", backend.addr())
 	if err != nil {
-		log.Println("Error connecting to local application:", err)
+		if isConnRefused(err) {
+			logger.Warn("Local application is not listening", "port", backend.port, "error", err)
+		} else {
+			logger.Error("Failed to connect to local application", "port", backend.port, "error", err)
+		}
 		return
 	}
 	defer localConn.Close()
 
-	// Forward traffic (using the context for cancellation)
-	go func() {
-		// Use io.Copy with a context-aware mechanism:
-		if _, err := io.Copy(localConn, clientConn); err != nil && !errors.Is(err, context.Canceled) {
-			log.Printf("Error copying from client to local app: %v", err)
+	// io.Copy ignores ctx, so close both connections when it's cancelled to
+	// unblock the copies
+	closeBoth := sync.OnceFunc(func() {
+		clientConn.Close()
+		localConn.Close()
+	})
+	stop := context.AfterFunc(ctx, closeBoth)
+	defer stop()
+
+	var wg sync.WaitGroup
+	forward := func(dst, src net.Conn, direction string, counter *atomic.Int64) {
+		defer wg.Done()
+		n, err := io.Copy(dst, src)
+		counter.Add(n)
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				logger.Warn("Failed to forward connection data", "direction", direction, "error", err)
+			}
+			closeBoth()
+			return
+		}
+		// Pass the EOF on so the other side can finish its response
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			closeBoth()
 		}
-	}()
-
-	if _, err := io.Copy(clientConn, localConn); err != nil && !errors.Is(err, context.Canceled) {
-		log.Printf("Error copying from local app to client: %v", err)
 	}
-}
 
-func (m *Manager) startTunnel(t *Tunnel) error {
-	// Get the machine's network IP for the proxy
-	ip := dnsserver.GetOutboundIP()
-	t.TargetIP = ip.String()
+	wg.Add(2)
+	go forward(localConn, clientConn, "from client to local app", &tunnel.bytesIn)
+	go forward(clientConn, localConn, "from local app to client", &tunnel.bytesOut)
+	wg.Wait()
+}
 
-	// Update /etc/hosts file (skip if using proxy mode)
-	if !m.useProxy {
-		if err := updateHostsFile(t.Domain); err != nil {
-			return fmt.Errorf("failed to update hosts file: %w", err)
-		}
-	} else {
-		log.Printf("Skipping hosts file update (using proxy mode)")
+func (m *Manager) startTunnel(ctx context.Context, t *Tunnel) (err error) {
+	// A caller that gave up while certificates loaded gets no listeners,
+	// hosts entries or mDNS names
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("start canceled: %w", err)
 	}
 
-	// Register domain with DNS server (use tunnel listen port, not backend port)
-	listenPort := t.HTTPPort
-	if t.HTTPS {
-		listenPort = t.HTTPSPort
-	}
-	if err := dnsserver.RegisterDomain(t.Domain, listenPort); err != nil {
-		return fmt.Errorf("failed to register domain: %w", err)
-	}
+	// Get the machine's network IP for the proxy
+	ip := dnsserver.AdvertisedIP()
+	t.TargetIP = ip.String()
 
 	// Create reverse proxy
 	proxy := &httputil.ReverseProxy{
 		Director: func(req *http.Request) {
-			targetURL := fmt.Sprintf("http://127.0.0.1:%d", t.Port)
+			targetURL := fmt.Sprintf("%s://%s", t.BackendScheme, t.backend().addr())
 			target, _ := url.Parse(targetURL)
+			setForwardedHeaders(req, req.TLS != nil, t.trustsForwarded(req))
 			req.URL.Scheme = target.Scheme
 			req.URL.Host = target.Host
-			req.Host = target.Host
+			if !t.opts.PreserveHost {
+				req.Host = target.Host
+			}
+			rewritePath(req.URL, t.opts.StripPathPrefix, t.opts.AddPathPrefix)
+		},
+		Transport:     t.dialer.roundTripper(t.opts),
+		ErrorHandler:  backendErrorHandler(t, t.logger),
+		BufferPool:    t.buffers,
+		FlushInterval: flushInterval(t.opts),
+		ModifyResponse: func(resp *http.Response) error {
+			t.recordBackendResponse(resp.StatusCode)
+			if t.backendDown.CompareAndSwap(true, false) {
+				t.event(EventBackendUp, nil)
+			}
+			if t.opts.InjectHTML != "" {
+				return injectHTML(resp, t.opts.InjectHTML)
+			}
+			return nil
 		},
 	}
 
-	// Create the listener before the server
-	var err error
-	var baseListener net.Listener
-
-	// Create listener with reuse options
-	config := &net.ListenConfig{
-		Control: setSocketOptions,
+	// Wrap the proxy with optional middleware
+	var handler http.Handler = proxy
+	if t.opts.ResponseTimeout > 0 {
+		handler = withResponseTimeout(handler, t.opts.ResponseTimeout)
 	}
-
-	// Create server first with proper configuration
-	t.server = &http.Server{
-		Handler: proxy,
+	if t.breaker != nil {
+		handler = t.circuitGate(handler)
 	}
-
-	// Initialize done channel
+	handler = middleware.Chain(handler, t.opts.Middleware...)
+	if t.CORS != nil {
+		handler = middleware.CORS(*t.CORS)(handler)
+	}
+	handler = t.recoverPanics(handler)
+	handler = t.logRequests(handler)
+	handler = t.countRequests(handler)
+	handler = t.countBytes(handler)
+	handler = middleware.Trace(nil, nil, t.traceAttributes()...)(handler)
+
+	// Requests derive from the manager's context so stopping the tunnel or
+	// manager cancels them
+	t.ctx, t.cancel = context.WithCancel(m.ctx)
 	t.done = make(chan struct{})
 
-	// Explicitly bind to all interfaces with the tunnel listen port
+	// Bind every listener before serving on any, so a taken port fails the
+	// start without leaving the others up
 	if t.HTTPS {
 		// Listen on HTTPS port for the tunnel (default 443)
-		baseListener, err = config.Listen(context.Background(), "tcp", fmt.Sprintf("0.0.0.0:%d", t.HTTPSPort))
+		err := t.listen(ctx, "https", t.HTTPSPort, handler)
 		if err != nil {
-			return fmt.Errorf("failed to create HTTPS listener: %w", err)
-		}
-
-		// Create TLS config
-		tlsConfig := &tls.Config{
-			Certificates: []tls.Certificate{*t.Cert},
-			MinVersion:   tls.VersionTLS12,
-			ServerName:   t.Domain,
-			ClientAuth:   tls.NoClientCert,
-			CipherSuites: []uint16{
-				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			},
-			PreferServerCipherSuites: true,
-			NextProtos:               []string{"h2", "http/1.1"},
-		}
-
-		t.listener = tls.NewListener(baseListener, tlsConfig)
-	} else {
+			t.cancel()
+			return err
+		}
+	}
+	if !t.HTTPS || t.opts.servesHTTP() {
 		// Listen on HTTP port for the tunnel (default 80), not backend port
-		baseListener, err = config.Listen(context.Background(), "tcp", fmt.Sprintf("0.0.0.0:%d", t.HTTPPort))
-		if err != nil {
-			return fmt.Errorf("failed to create HTTP listener: %w", err)
+		httpHandler := handler
+		if t.HTTPS && t.opts.RedirectHTTP {
+			httpHandler = t.redirectToHTTPS()
+		} else if t.opts.GRPC {
+			// gRPC clients speak HTTP/2 even without TLS
+			httpHandler = h2c.NewHandler(handler, &http2.Server{})
 		}
-		t.listener = baseListener
+		if err := t.listen(ctx, "http", t.HTTPPort, httpHandler); err != nil {
+			t.closeListeners()
+			t.cancel()
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		t.closeListeners()
+		t.cancel()
+		return fmt.Errorf("start canceled: %w", err)
 	}
 
-	// Start server in goroutine with proper error handling
-	serverErrChan := make(chan error, 1)
-	go func() {
-		if err := t.server.Serve(t.listener); err != nil && err != http.ErrServerClosed {
-			log.Printf("Server error: %v", err)
-			serverErrChan <- err
+	// The names are registered only once the listeners are bound; a start
+	// failing after that takes them back out
+	var hostsAdded, mdnsAdded []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, name := range hostsAdded {
+			if err := removeFromHostsFile(name); err != nil {
+				t.logger.Warn("Failed to remove from hosts file", "domain", name, "error", err)
+			}
+		}
+		for _, name := range mdnsAdded {
+			if err := dnsserver.UnregisterDomain(name); err != nil {
+				t.logger.Warn("Failed to unregister domain from mDNS", "domain", name, "error", err)
+			}
 		}
-		close(serverErrChan)
 	}()
 
-	// Wait a short time to catch immediate startup errors
-	select {
-	case err := <-serverErrChan:
+	// Update /etc/hosts file (skip if using proxy mode or disabled), pointing
+	// the names where the tunnel listens: loopback, unless it's bound to one
+	// interface. mDNS is enough to resolve the names if the hosts file isn't
+	// writable.
+	if m.editsHosts() {
+		for _, name := range t.names() {
+			err := t.register(RegistrationHosts, name, func() error { return updateHostsFile(name, t.dialHost()) })
+			if err != nil {
+				if !m.useMDNS {
+					t.closeListeners()
+					t.cancel()
+					return fmt.Errorf("failed to update hosts file: %w", err)
+				}
+				t.logger.Warn("Failed to update hosts file, relying on mDNS", "domain", name, "error", err)
+				continue
+			}
+			hostsAdded = append(hostsAdded, name)
+		}
+	} else if m.useProxy {
+		t.logger.Debug("Skipping hosts file update in proxy mode")
+	}
+
+	// Register domain and aliases with DNS server (use tunnel listen port, not
+	// backend port). Health-gated tunnels register once the server is up.
+	listenPort := t.HTTPPort
+	if t.HTTPS {
+		listenPort = t.HTTPSPort
+	}
+	if m.useMDNS && !t.opts.HealthGatedMDNS {
+		for _, name := range t.names() {
+			err := t.register(RegistrationMDNS, name, func() error {
+				return dnsserver.RegisterDomainWithTXT(m.ctx, name, listenPort, t.opts.MDNSTXT)
+			})
+			if err != nil {
+				t.closeListeners()
+				t.cancel()
+				return fmt.Errorf("failed to register domain %s: %w", name, err)
+			}
+			mdnsAdded = append(mdnsAdded, name)
+		}
+	}
+
+	// Make sure every listener accepts connections before reporting success
+	for _, ts := range t.servers {
+		ts.server.OnError = func(err error) {
+			t.logger.Error("Tunnel server failed", "scheme", ts.scheme, "error", err)
+		}
+		err := ts.server.Start(func(addr net.Addr) error {
+			return t.checkServing(ctx, ts.scheme, addr)
+		})
 		if err != nil {
+			t.closeListeners()
+			t.cancel()
 			return fmt.Errorf("server startup error: %w", err)
 		}
-	case <-time.After(100 * time.Millisecond):
-		// Server started successfully
 	}
 
+	if m.useMDNS && t.opts.HealthGatedMDNS {
+		t.healthDone = make(chan struct{})
+		go t.advertiseWhileHealthy(listenPort)
+	}
 	return nil
 }
 
-func (m *Manager) StopAll(ctx context.Context) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// startupCheckTimeout bounds the connection checkServing makes to a
+// freshly started listener
+const startupCheckTimeout = 2 * time.Second
 
-	// Stop each tunnel
-	for domain, _ := range m.tunnels {
-		if err := m.StopTunnel(ctx, domain); err != nil {
-			return fmt.Errorf("error stopping tunnel %s: %w", domain, err)
-		}
+// dialHost is the address the tunnel is reached on from this machine:
+// loopback, unless it's bound to one specific interface
+func (t *Tunnel) dialHost() string {
+	if !net.ParseIP(t.ListenAddr).IsUnspecified() {
+		return t.ListenAddr
+	}
+	if t.opts.IPFamily == IPFamily6 {
+		return "::1"
 	}
+	return "127.0.0.1"
+}
 
-	// Clear the tunnels map
-	m.tunnels = make(map[string]*Tunnel)
+// checkServing connects to the listener on listenAddr, completing a TLS
+// handshake for HTTPS so the server doesn't log an aborted one. A listener
+// expecting the PROXY protocol is sent an UNKNOWN header first.
+func (t *Tunnel) checkServing(ctx context.Context, scheme string, listenAddr net.Addr) error {
+	port := listenAddr.(*net.TCPAddr).Port
+	addr := net.JoinHostPort(t.dialHost(), strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: startupCheckTimeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%s listener on %s is not accepting connections: %w", scheme, addr, err)
+	}
+	defer conn.Close()
+	if t.opts.ProxyProtocol {
+		if _, err := io.WriteString(conn, "PROXY UNKNOWN\r\n"); err != nil {
+			return fmt.Errorf("%s listener on %s is not accepting connections: %w", scheme, addr, err)
+		}
+	}
+	if scheme != "https" {
+		return nil
+	}
 
+	handshakeCtx, cancel := context.WithTimeout(ctx, startupCheckTimeout)
+	defer cancel()
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         t.Domain,
+		InsecureSkipVerify: true, // Only checking that the listener answers
+	})
+	err = tlsConn.HandshakeContext(handshakeCtx)
+	// Without a client certificate of its own, the check is turned away
+	// by a tunnel that requires one; the alert still shows TLS is served
+	if err != nil && !(t.clientCAs != nil && isRemoteAlert(err)) {
+		return fmt.Errorf("%s listener on %s is not accepting connections: %w", scheme, addr, err)
+	}
 	return nil
 }
 
-func (m *Manager) Close(ctx context.Context) error {
-	if err := m.StopAll(ctx); err != nil {
-		return fmt.Errorf("failed to stop all tunnels: %w", err)
-	}
+// isRemoteAlert reports whether err is a TLS alert sent by the peer
+func isRemoteAlert(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "remote error"
+}
 
-	// Shutdown DNS server when closing manager
-	if err := dnsserver.Shutdown(); err != nil {
-		log.Printf("Warning: Failed to shutdown DNS server: %v", err)
+// listen binds the tunnel's listen address on port and adds a server for it,
+// not yet serving, that answers with handler. HTTPS listeners terminate TLS
+// with the tunnel's certificates.
+func (t *Tunnel) listen(ctx context.Context, scheme string, port int, handler http.Handler) error {
+	config := &net.ListenConfig{
+		Control: setSocketOptions,
+	}
+	addr := net.JoinHostPort(t.ListenAddr, strconv.Itoa(port))
+	listener, err := config.Listen(ctx, listenNetwork(t.opts.IPFamily), addr)
+	if err != nil {
+		return fmt.Errorf("%w %s for %s: %w", ErrBindFailed, addr, strings.ToUpper(scheme), err)
+	}
+	if t.opts.ProxyProtocol {
+		listener = netutil.NewProxyProtocolListener(listener)
+	}
+	if scheme == "https" {
+		listener = tls.NewListener(listener, t.tlsConfig())
 	}
 
+	t.servers = append(t.servers, &tunnelServer{
+		scheme: scheme,
+		server: httpserver.New(&http.Server{
+			Handler:     handler,
+			BaseContext: func(net.Listener) context.Context { return t.ctx },
+		}, listener),
+	})
 	return nil
 }
 
-func (m *Manager) SetHostsBackupDir(dir string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.hostsBackup = dir
+// closeListeners closes the tunnel's listeners and any connections they
+// have accepted, for a start that failed part way
+func (t *Tunnel) closeListeners() {
+	for _, ts := range t.servers {
+		ts.server.Close()
+	}
+	t.servers = nil
 }
 
-// updateHostsFile adds or updates an entry in /etc/hosts
-func updateHostsFile(domain string) error {
+// tlsConfig serves the tunnel's certificate, or an alias's picked by SNI
+func (t *Tunnel) tlsConfig() *tls.Config {
+	clientAuth := tls.NoClientCert
+	if t.clientCAs != nil {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: t.Domain,
+		ClientAuth: clientAuth,
+		ClientCAs:  t.clientCAs,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+		PreferServerCipherSuites: true,
+		NextProtos:               []string{"h2", "http/1.1"},
 
-	// Read current hosts file
-	content, err := os.ReadFile(hostsFile)
+		// Looked up per handshake so reloaded certificates are served at once
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return t.certFor(strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")), nil
+		},
+	}
+}
+
+// loadClientCAs reads the PEM bundle of CAs whose client certificates the
+// tunnel accepts
+func loadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to read hosts file: %w", err)
+		return nil, fmt.Errorf("%w: failed to read client CA bundle: %w", ErrCertUnavailable, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: no PEM certificates in client CA bundle %s", ErrCertUnavailable, path)
 	}
+	return pool, nil
+}
 
-	// Check if entry already exists
-	scanner := bufio.NewScanner(strings.NewReader(string(content)))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, domain) {
-			// Entry already exists
-			return nil
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS. The
+// redirect is temporary (307) so browsers don't remember it once the
+// tunnel is back to plain HTTP, and keeps the method and body. In proxy
+// mode the port is the proxy's HTTPS port, which the client reaches.
+func (t *Tunnel) redirectToHTTPS() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
 		}
-	}
+		if host == "" {
+			host = t.Domain
+		}
+		if port := t.opts.HTTPSPort; port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawPath:  r.URL.RawPath,
+			RawQuery: r.URL.RawQuery,
+		}
+		http.Redirect(w, r, target.String(), http.StatusTemporaryRedirect)
+	})
+}
+
+func (m *Manager) StopAll(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waitForStarts()
 
-	// Add new entry
-	entry := fmt.Sprintf("\n127.0.0.1\t%s\n", domain)
-	if err := os.WriteFile(hostsFile, []byte(string(content)+entry), 0644); err != nil {
-		return fmt.Errorf("failed to update hosts file: %w", err)
+	// Stop each tunnel; StopTunnel would try to take m.mu again
+	for domain := range m.tunnels {
+		if err := m.stopTunnelLocked(ctx, domain); err != nil {
+			return fmt.Errorf("error stopping tunnel %s: %w", domain, err)
+		}
 	}
 
+	// Clear the tunnels map
+	m.tunnels = make(map[string]*Tunnel)
+
 	return nil
 }
 
-// removeFromHostsFile removes an entry from /etc/hosts
-func removeFromHostsFile(domain string) error {
+func (m *Manager) Close(ctx context.Context) error {
+	// Abandon whatever requests are still in flight once tunnels are stopped
+	defer m.cancel()
 
-	// Read current hosts file
-	content, err := os.ReadFile(hostsFile)
-	if err != nil {
-		return fmt.Errorf("failed to read hosts file: %w", err)
+	if err := m.StopAll(ctx); err != nil {
+		return fmt.Errorf("failed to stop all tunnels: %w", err)
 	}
 
-	var newLines []string
-	scanner := bufio.NewScanner(strings.NewReader(string(content)))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if !strings.Contains(line, domain) {
-			newLines = append(newLines, line)
+	// Shutdown DNS server when closing manager
+	if m.useMDNS {
+		if err := dnsserver.Shutdown(); err != nil {
+			m.logger.Warn("Failed to shut down DNS server", "error", err)
 		}
 	}
 
-	// Write back the file without the domain
-	if err := os.WriteFile(hostsFile, []byte(strings.Join(newLines, "\n")+"\n"), 0644); err != nil {
-		return fmt.Errorf("failed to update hosts file: %w", err)
-	}
-
 	return nil
 }
 
+func (m *Manager) SetHostsBackupDir(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hostsBackup = dir
+}
+
 // resolveHostname resolves a hostname, using the system DNS for .local domains
 func resolveHostname(hostname string) (string, error) {
 	if strings.HasSuffix(hostname, ".local") {
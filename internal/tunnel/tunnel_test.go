@@ -1,15 +1,38 @@
 package tunnel
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/johncferguson/gotunnel/internal/cert"
+	"github.com/johncferguson/gotunnel/internal/dnsserver"
+	"github.com/johncferguson/gotunnel/internal/logging"
+	"github.com/johncferguson/gotunnel/internal/middleware"
+	"github.com/johncferguson/gotunnel/internal/netutil"
+	"github.com/johncferguson/gotunnel/internal/process"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -19,7 +42,7 @@ func setupTestManager(t *testing.T) (*Manager, string, func()) {
 	require.NoError(t, err)
 
 	certManager := cert.New(filepath.Join(tempDir, "certs"))
-	manager := NewManager(certManager)
+	manager := NewManager(certManager, nil)
 	
 	// Set a temp directory for hosts backup for testing
 	hostsBackupFile := filepath.Join(tempDir, "hosts.backup")
@@ -60,6 +83,22 @@ func TestNewManager(t *testing.T) {
 	assert.NotNil(t, manager.certManager)
 }
 
+func TestNewManagerKeepsAdvertiseIP(t *testing.T) {
+	forced := net.ParseIP("192.0.2.10")
+	dnsserver.SetAdvertiseIP(forced)
+	defer dnsserver.SetAdvertiseIP(nil)
+
+	// A manager without its own address leaves the shared one in place
+	_, err := NewManagerWithOptions(cert.New(t.TempDir()), nil, ManagerOptions{UseHosts: true})
+	require.NoError(t, err)
+	assert.True(t, dnsserver.AdvertisedIP().Equal(forced))
+
+	other := net.ParseIP("192.0.2.20")
+	_, err = NewManagerWithOptions(cert.New(t.TempDir()), nil, ManagerOptions{UseHosts: true, AdvertiseIP: other})
+	require.NoError(t, err)
+	assert.True(t, dnsserver.AdvertisedIP().Equal(other))
+}
+
 func TestStartAndStopTunnel(t *testing.T) {
 	manager, _, cleanup := setupTestManager(t)
 	defer cleanup()
@@ -99,21 +138,31 @@ func TestStartAndStopTunnel(t *testing.T) {
 }
 
 func TestHTTPSTunnel(t *testing.T) {
-	manager, _, cleanup := setupTestManager(t)
+	_, tempDir, cleanup := setupTestManager(t)
 	defer cleanup()
 
+	// Self-signed certificates exercise the HTTPS path without mkcert
+	certs := cert.NewSelfSignedProvider()
+	manager, err := NewManagerWithOptions(certs, nil, ManagerOptions{UseHosts: true})
+	require.NoError(t, err)
+	manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.backup"))
+	defer manager.Close(context.Background())
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
 	ctx := context.Background()
 	domain := "test-https.local"
-	backendPort := 8080
-	httpPort := 8181   // Use different port to avoid conflicts
-	httpsPort := 8444  // Use different port to avoid conflicts
-
-	// Start HTTPS tunnel with custom ports
-	err := manager.StartTunnelWithPorts(ctx, backendPort, domain, true, httpPort, httpsPort)
-	if err != nil {
-		t.Skipf("Skipping HTTPS test (might need certificates): %v", err)
-		return
-	}
+	httpsPort := 8444 // Use different port to avoid conflicts
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backendPort,
+		Domain:      domain,
+		Aliases:     []string{"www.test-https"},
+		HTTPS:       true,
+		HTTPPort:    8181,
+		HTTPSPort:   httpsPort,
+	}))
 	defer manager.StopTunnel(ctx, domain)
 
 	// Verify HTTPS tunnel
@@ -122,6 +171,133 @@ func TestHTTPSTunnel(t *testing.T) {
 	manager.mu.RUnlock()
 	assert.True(t, tunnel.HTTPS)
 	assert.Equal(t, httpsPort, tunnel.HTTPSPort)
+
+	// Each name is served its own certificate, picked by SNI
+	for _, name := range []string{domain, "www.test-https.local"} {
+		served, err := certs.EnsureCert(name)
+		require.NoError(t, err)
+		roots := x509.NewCertPool()
+		roots.AddCert(served.Leaf)
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: name},
+		}}
+		resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/", httpsPort))
+		require.NoError(t, err, name)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Hello, tunnel!\n", string(body))
+	}
+}
+
+// newSelfSignedManager returns a manager whose HTTPS tunnels use
+// self-signed certificates, and a client trusting the one for domain
+func newSelfSignedManager(t *testing.T, tempDir, domain string) (*Manager, *http.Client) {
+	t.Helper()
+	certs := cert.NewSelfSignedProvider()
+	manager, err := NewManagerWithOptions(certs, nil, ManagerOptions{UseHosts: true})
+	require.NoError(t, err)
+	manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.backup"))
+
+	served, err := certs.EnsureCert(domain)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(served.Leaf)
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: domain},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return manager, client
+}
+
+func TestHTTPSTunnelAlsoServesHTTP(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	const domain = "both.local"
+	manager, client := newSelfSignedManager(t, tempDir, domain)
+	defer manager.Close(context.Background())
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("X-Forwarded-Proto"))
+	}))
+	defer backend.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      domain,
+		HTTPS:       true,
+		AlsoHTTP:    true,
+		HTTPPort:    8264,
+		HTTPSPort:   8265,
+	}))
+
+	// The same tunnel answers on both ports, telling the backend which
+	// scheme each request arrived over
+	for url, proto := range map[string]string{
+		"http://127.0.0.1:8264/":  "http",
+		"https://127.0.0.1:8265/": "https",
+	} {
+		resp, err := client.Get(url)
+		require.NoError(t, err, url)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, url)
+		assert.Equal(t, proto, string(body), url)
+	}
+	info, ok := manager.GetTunnel(domain)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), info["requests"])
+
+	// Stopping the tunnel closes both listeners
+	require.NoError(t, manager.StopTunnel(ctx, domain))
+	for _, port := range []int{8264, 8265} {
+		_, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+		assert.Error(t, err, "port %d should be closed", port)
+	}
+}
+
+func TestHTTPSTunnelRedirectsHTTP(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	const domain = "redirect.local"
+	manager, client := newSelfSignedManager(t, tempDir, domain)
+	defer manager.Close(context.Background())
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+
+	require.NoError(t, manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort:  testServer.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:       domain,
+		HTTPS:        true,
+		RedirectHTTP: true,
+		HTTPPort:     8266,
+		HTTPSPort:    8267,
+	}))
+
+	req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:8266/a%2Fb?x=1", nil)
+	require.NoError(t, err)
+	req.Host = domain + ":8266"
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://redirect.local:8267/a%2Fb?x=1", resp.Header.Get("Location"))
+
+	resp, err = client.Get("https://127.0.0.1:8267/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, tunnel!\n", string(body))
 }
 
 func TestMultipleTunnels(t *testing.T) {
@@ -152,6 +328,520 @@ func TestMultipleTunnels(t *testing.T) {
 	assert.Len(t, tunnels, 0)
 }
 
+func TestStopUnregistersMDNS(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backendPort,
+		Domain:      "stop-mdns",
+		Aliases:     []string{"www.stop-mdns"},
+		HTTPPort:    8217,
+		HTTPSPort:   8517,
+	}))
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backendPort,
+		Domain:      "stop-mdns-2",
+		HTTPPort:    8218,
+		HTTPSPort:   8518,
+	}))
+
+	names := []string{"stop-mdns.local", "www.stop-mdns.local", "stop-mdns-2.local"}
+	for _, name := range names {
+		require.True(t, dnsserver.IsRegistered(name), name)
+	}
+
+	require.NoError(t, manager.Stop(ctx))
+
+	assert.Equal(t, 0, manager.Count())
+	for _, name := range names {
+		assert.False(t, dnsserver.IsRegistered(name), name)
+	}
+}
+
+func TestStopAllDoesNotDeadlock(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+			BackendPort: backendPort,
+			Domain:      fmt.Sprintf("stop-all-%d", i),
+			HTTPPort:    8219 + i,
+			HTTPSPort:   8519 + i,
+		}))
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- manager.StopAll(ctx) }()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("StopAll did not return")
+	}
+	assert.Equal(t, 0, manager.Count())
+}
+
+func TestTunnelForwardedHeaders(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	seen := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "forwarded",
+		HTTPPort:    8222,
+		HTTPSPort:   8522,
+	}))
+	defer manager.StopTunnel(ctx, "forwarded.local")
+
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:8222/", nil)
+	require.NoError(t, err)
+	req.Host = "forwarded.local"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("Forwarded", "for=203.0.113.7")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	headers := <-seen
+	assert.Equal(t, "203.0.113.7, 127.0.0.1", headers.Get("X-Forwarded-For"))
+	assert.Equal(t, "http", headers.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "forwarded.local", headers.Get("X-Forwarded-Host"))
+	assert.Equal(t, `for=203.0.113.7, for=127.0.0.1;host="forwarded.local";proto=http`, headers.Get("Forwarded"))
+}
+
+func TestSetForwardedHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://app.local/", nil)
+	req.RemoteAddr = "[::1]:54321"
+	setForwardedHeaders(req, true, true)
+	assert.Equal(t, "https", req.Header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, `for="[::1]";host="app.local";proto=https`, req.Header.Get("Forwarded"))
+
+	// Values from a trusted proxy in front of the tunnel win
+	req = httptest.NewRequest(http.MethodGet, "http://127.0.0.1:9080/", nil)
+	req.Header.Set("X-Forwarded-Host", "app.local")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	setForwardedHeaders(req, false, true)
+	assert.Equal(t, "app.local", req.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "https", req.Header.Get("X-Forwarded-Proto"))
+
+	// Anyone else's are replaced
+	req = httptest.NewRequest(http.MethodGet, "http://myapp.local/", nil)
+	req.RemoteAddr = "192.0.2.10:40000"
+	req.Header.Set("X-Forwarded-Host", "evil.example")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("Forwarded", "for=203.0.113.7")
+	setForwardedHeaders(req, false, false)
+	assert.Equal(t, "myapp.local", req.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "http", req.Header.Get("X-Forwarded-Proto"))
+	assert.Empty(t, req.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, `for=192.0.2.10;host="myapp.local";proto=http`, req.Header.Get("Forwarded"))
+}
+
+func TestTrustsForwarded(t *testing.T) {
+	tunnel := &Tunnel{ListenAddr: "192.168.1.10"}
+	for addr, want := range map[string]bool{
+		"127.0.0.1:5000":    true,
+		"[::1]:5000":        true,
+		"192.168.1.10:5000": true, // The built-in proxy dialing a bound tunnel
+		"192.168.1.20:5000": false,
+		"garbage":           false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = addr
+		assert.Equal(t, want, tunnel.trustsForwarded(req), addr)
+	}
+}
+
+func TestTunnelSmallBuffersCopyWholeBody(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	manager, err := NewManagerWithOptions(cert.New(filepath.Join(tempDir, "certs")), nil, ManagerOptions{
+		UseMDNS:    true,
+		UseHosts:   true,
+		BufferSize: 1024,
+	})
+	require.NoError(t, err)
+	manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.backup"))
+	defer manager.Stop(context.Background())
+
+	// Echo the request body back, so it crosses the proxy in both directions
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer backend.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "buffers",
+		HTTPPort:    8239,
+		HTTPSPort:   8539,
+	}))
+
+	body := make([]byte, 1<<20)
+	_, err = rand.Read(body)
+	require.NoError(t, err)
+
+	resp, err := http.Post("http://127.0.0.1:8239/", "application/octet-stream", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	echoed, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, bytes.Equal(body, echoed), "body changed crossing the tunnel")
+}
+
+func TestTunnelPreserveHost(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	}))
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name         string
+		preserveHost bool
+		httpPort     int
+		want         string
+	}{
+		{"rewrites host by default", false, 8223, fmt.Sprintf("127.0.0.1:%d", backendPort)},
+		{"preserves host", true, 8224, "vhost-8224.local"},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain := fmt.Sprintf("vhost-%d", tt.httpPort)
+			require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+				BackendPort:  backendPort,
+				Domain:       domain,
+				HTTPPort:     tt.httpPort,
+				HTTPSPort:    tt.httpPort + 300,
+				PreserveHost: tt.preserveHost,
+			}))
+			defer manager.StopTunnel(ctx, domain+".local")
+
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", tt.httpPort), nil)
+			require.NoError(t, err)
+			req.Host = domain + ".local"
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(body))
+		})
+	}
+}
+
+// headerTagger is a middleware that appends name to the X-Chain request header
+func headerTagger(name string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Add("X-Chain", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestTunnelMiddlewareChain(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Join(r.Header.Values("X-Chain"), ","))
+	}))
+	defer backend.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "chain",
+		HTTPPort:    8225,
+		HTTPSPort:   8525,
+		Middleware:  []middleware.Middleware{headerTagger("first"), headerTagger("second")},
+	}))
+	defer manager.StopTunnel(ctx, "chain.local")
+
+	resp, err := http.Get("http://127.0.0.1:8225/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "first,second", string(body))
+}
+
+func TestTunnelRecoversFromPanics(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	var events []TunnelEvent
+	var mu sync.Mutex
+	manager.OnEvent(func(ev TunnelEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, ev)
+	})
+
+	backend := setupTestServer()
+	defer backend.Close()
+
+	panicky := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/panic" {
+				panic("middleware bug")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "panicky",
+		HTTPPort:    8247,
+		Middleware:  []middleware.Middleware{panicky},
+	}))
+	defer manager.StopTunnel(ctx, "panicky.local")
+
+	resp, err := http.Get("http://127.0.0.1:8247/panic")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	// The tunnel keeps serving
+	resp, err = http.Get("http://127.0.0.1:8247/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var panics int
+	for _, ev := range events {
+		if ev.Type == EventError && errors.Is(ev.Err, middleware.ErrPanic) {
+			panics++
+			assert.Equal(t, "panicky.local", ev.Domain)
+		}
+	}
+	assert.Equal(t, 1, panics)
+}
+
+func TestHandleConnectionStopsOnCancel(t *testing.T) {
+	// A backend that accepts and then stays silent
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	clientConn, peer := net.Pipe()
+	defer peer.Close()
+	tunnel := &Tunnel{Port: backend.Addr().(*net.TCPAddr).Port}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		handleConnection(ctx, clientConn, tunnel)
+		close(done)
+	}()
+
+	// Traffic flows until the context is cancelled
+	_, err = peer.Write([]byte("ping"))
+	require.NoError(t, err)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("copy goroutines kept running after cancellation")
+	}
+}
+
+func TestHandleConnectionCountsBytes(t *testing.T) {
+	// An echo backend
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer backend.Close()
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	clientConn, peer := net.Pipe()
+	tunnel := &Tunnel{Port: backend.Addr().(*net.TCPAddr).Port}
+	done := make(chan struct{})
+	go func() {
+		handleConnection(context.Background(), clientConn, tunnel)
+		close(done)
+	}()
+
+	payload := bytes.Repeat([]byte("x"), 5000)
+	go peer.Write(payload)
+	echoed := make([]byte, len(payload))
+	_, err = io.ReadFull(peer, echoed)
+	require.NoError(t, err)
+	peer.Close()
+	<-done
+
+	in, out := tunnel.BytesTransferred()
+	assert.Equal(t, int64(len(payload)), in)
+	assert.Equal(t, int64(len(payload)), out)
+}
+
+func TestTunnelCountsHTTPBytes(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	// Echo the request body back
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer backend.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "bytes",
+		HTTPPort:    8248,
+	}))
+	defer manager.StopTunnel(ctx, "bytes.local")
+
+	payload := bytes.Repeat([]byte("y"), 10000)
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post("http://127.0.0.1:8248/", "application/octet-stream", bytes.NewReader(payload))
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Len(t, body, len(payload))
+	}
+
+	// Bodies are counted exactly; headers and framing aren't counted
+	info, ok := manager.GetTunnel("bytes.local")
+	require.True(t, ok)
+	assert.Equal(t, int64(2*len(payload)), info["bytes_in"])
+	assert.Equal(t, int64(2*len(payload)), info["bytes_out"])
+}
+
+func TestStopTunnelCancelsInFlightRequests(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	cancelled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stream forever, like a long-poll or event stream
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "inflight",
+		HTTPPort:    8227,
+		HTTPSPort:   8527,
+	}))
+
+	resp, err := http.Get("http://127.0.0.1:8227/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// The request can't finish before the deadline, so it's cancelled and
+	// the tunnel still stops
+	stopCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, manager.StopTunnel(stopCtx, "inflight.local"))
+	assert.Zero(t, manager.Count())
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("backend request was not cancelled")
+	}
+}
+
+func TestStopRespectsShutdownDeadline(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	// The backend ignores cancellation, so only force-closing ends the stream
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:      "deadline",
+		HTTPPort:    8245,
+	}))
+
+	resp, err := http.Get("http://127.0.0.1:8245/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	stopCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	require.NoError(t, manager.Stop(stopCtx))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Zero(t, manager.Count())
+
+	// The client's stream was cut off rather than left hanging
+	_, err = io.ReadAll(resp.Body)
+	assert.Error(t, err)
+}
+
 func TestErrorCases(t *testing.T) {
 	manager, _, cleanup := setupTestManager(t)
 	defer cleanup()
@@ -208,3 +898,1062 @@ func TestErrorCases(t *testing.T) {
 		})
 	}
 }
+
+func TestTunnelWithCORS(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	err := manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backendPort,
+		Domain:      "test-cors.local",
+		HTTPPort:    8190,
+		HTTPSPort:   8490,
+		CORS: &middleware.CORSConfig{
+			AllowedOrigins: []string{"http://localhost:3000"},
+		},
+	})
+	require.NoError(t, err)
+
+	// Preflight is answered by the tunnel
+	req, err := http.NewRequest(http.MethodOptions, "http://127.0.0.1:8190/", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "http://localhost:3000", resp.Header.Get("Access-Control-Allow-Origin"))
+
+	// Simple requests reach the backend with CORS headers added
+	req, err = http.NewRequest(http.MethodGet, "http://127.0.0.1:8190/", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "http://localhost:3000")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "Hello, tunnel!")
+	assert.Equal(t, "http://localhost:3000", resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestTunnelRejectsInvalidCORS(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	err := manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: 8080,
+		Domain:      "bad-cors.local",
+		HTTPPort:    8191,
+		CORS: &middleware.CORSConfig{
+			AllowedOrigins:   []string{"*"},
+			AllowCredentials: true,
+		},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid CORS configuration")
+}
+
+// TestHelperProcess is not a real test; it is the backend launched by
+// TestTunnelToExecBackend. It serves HTTP on $PORT until killed.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GOTUNNEL_HELPER_PROCESS") != "1" {
+		return
+	}
+	http.ListenAndServe("127.0.0.1:"+os.Getenv("PORT"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "served on port %s", os.Getenv("PORT"))
+	}))
+	os.Exit(0)
+}
+
+func TestTunnelToExecBackend(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	// Allocate the backend port the same way `start --exec --port 0` does
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	backendPort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	t.Setenv("GOTUNNEL_HELPER_PROCESS", "1")
+	proc, err := process.Start(fmt.Sprintf("%q -test.run=TestHelperProcess", os.Args[0]), backendPort, nil)
+	require.NoError(t, err)
+	defer proc.Stop(context.Background())
+
+	readyCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, proc.WaitReady(readyCtx))
+
+	err = manager.StartTunnelWithPorts(context.Background(), backendPort, "test-exec.local", false, 8192, 8492)
+	require.NoError(t, err)
+
+	resp, err := http.Get("http://127.0.0.1:8192/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("served on port %d", backendPort), string(body))
+}
+
+func TestTunnelRequestCounter(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	domain := "test-counter.local"
+	require.NoError(t, manager.StartTunnelWithPorts(ctx, backendPort, domain, false, 8193, 8493))
+
+	const numRequests = 5
+	for i := 0; i < numRequests; i++ {
+		resp, err := http.Get("http://127.0.0.1:8193/")
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	info, ok := manager.GetTunnel(domain)
+	require.True(t, ok)
+	assert.Equal(t, int64(numRequests), info["requests"])
+
+	tunnels := manager.ListTunnels()
+	require.Len(t, tunnels, 1)
+	assert.Equal(t, int64(numRequests), tunnels[0]["requests"])
+
+	// Restarting the tunnel resets the counter
+	require.NoError(t, manager.StopTunnel(ctx, domain))
+	require.NoError(t, manager.StartTunnelWithPorts(ctx, backendPort, domain, false, 8193, 8493))
+	info, ok = manager.GetTunnel(domain)
+	require.True(t, ok)
+	assert.Equal(t, int64(0), info["requests"])
+
+	_, ok = manager.GetTunnel("missing.local")
+	assert.False(t, ok)
+}
+
+func TestTunnelListenAddr(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	err := manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backendPort,
+		Domain:      "test-loopback.local",
+		HTTPPort:    8194,
+		HTTPSPort:   8494,
+		ListenAddr:  "127.0.0.1",
+	})
+	require.NoError(t, err)
+
+	// Reachable on loopback
+	resp, err := http.Get("http://127.0.0.1:8194/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Not reachable through a non-loopback interface
+	lanIP := dnsserver.GetOutboundIP()
+	if lanIP.IsLoopback() {
+		t.Skip("no non-loopback interface available")
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(lanIP.String(), "8194"), time.Second)
+	if err == nil {
+		conn.Close()
+	}
+	assert.Error(t, err, "tunnel bound to loopback should not accept LAN connections")
+}
+
+func TestTunnelIPFamilies(t *testing.T) {
+	if l, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skip("IPv6 loopback not available")
+	} else {
+		l.Close()
+	}
+
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	reachable := func(host string, port int) bool {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+
+	tests := []struct {
+		family     string
+		port       int
+		ipv4, ipv6 bool
+	}{
+		{"", 8257, true, true}, // Dual-stack by default
+		{IPFamily4, 8258, true, false},
+		{IPFamily6, 8259, false, true},
+	}
+	for _, tt := range tests {
+		require.NoError(t, manager.StartTunnelWithOptions(context.Background(), Options{
+			BackendPort: backendPort,
+			Domain:      "family-" + strconv.Itoa(tt.port),
+			HTTPPort:    tt.port,
+			IPFamily:    tt.family,
+		}), tt.family)
+		assert.Equal(t, tt.ipv4, reachable("127.0.0.1", tt.port), "family %q over IPv4", tt.family)
+		assert.Equal(t, tt.ipv6, reachable("::1", tt.port), "family %q over IPv6", tt.family)
+	}
+
+	// A dual-stack tunnel serves requests over IPv6
+	resp, err := http.Get("http://[::1]:8257/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTunnelInvalidListenAddr(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	err := manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: 8080,
+		Domain:      "bad-listen.local",
+		HTTPPort:    8195,
+		ListenAddr:  "not-an-ip",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid listen address")
+}
+
+func TestTunnelAliases(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	err := manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backendPort,
+		Domain:      "app-alias",
+		Aliases:     []string{"www.app-alias"},
+		HTTPPort:    8198,
+		HTTPSPort:   8498,
+	})
+	require.NoError(t, err)
+
+	// Both names resolve locally
+	content, err := os.ReadFile(hostsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "127.0.0.1\tapp-alias.local")
+	assert.Contains(t, string(content), "127.0.0.1\twww.app-alias.local")
+
+	// ...and reach the same backend
+	for _, host := range []string{"app-alias.local", "www.app-alias.local"} {
+		req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:8198/", nil)
+		require.NoError(t, err)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "Hello, tunnel!\n", string(body), host)
+	}
+
+	info, ok := manager.GetTunnel("app-alias.local")
+	require.True(t, ok)
+	assert.Equal(t, []string{"www.app-alias.local"}, info["aliases"])
+
+	// Stopping the tunnel removes every name
+	require.NoError(t, manager.StopTunnel(ctx, "app-alias.local"))
+	content, err = os.ReadFile(hostsFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "app-alias.local")
+}
+
+func TestTunnelAliasCollisions(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	err := manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: 8080,
+		Domain:      "collide",
+		Aliases:     []string{"www.collide"},
+		HTTPPort:    8199,
+		HTTPSPort:   8499,
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		domain  string
+		aliases []string
+	}{
+		{"alias matches existing domain", "other", []string{"collide"}},
+		{"alias matches existing alias", "other", []string{"www.collide.local"}},
+		{"domain matches existing alias", "www.collide", nil},
+		{"alias duplicates own domain", "other", []string{"other"}},
+		{"duplicate aliases", "other", []string{"a.other", "a.other.local"}},
+		{"empty alias", "other", []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := manager.StartTunnelWithOptions(ctx, Options{
+				BackendPort: 8080,
+				Domain:      tt.domain,
+				Aliases:     tt.aliases,
+				HTTPPort:    8200,
+				HTTPSPort:   8500,
+			})
+			assert.Error(t, err)
+		})
+	}
+
+	assert.Len(t, manager.ListTunnels(), 1)
+}
+
+func TestTunnelLogsCarryDomain(t *testing.T) {
+	manager, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	logFile := filepath.Join(tempDir, "tunnel.log")
+	logger, err := logging.New(&logging.Config{
+		Level:  logging.LevelDebug,
+		Format: logging.FormatJSON,
+		Output: logFile,
+	})
+	require.NoError(t, err)
+	manager.logger = logger.WithComponent("tunnel")
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	err = manager.StartTunnelWithPorts(ctx, backendPort, "test-logs.local", false, 8201, 8501)
+	require.NoError(t, err)
+
+	resp, err := http.Get("http://127.0.0.1:8201/")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.NoError(t, manager.StopTunnel(ctx, "test-logs.local"))
+
+	content, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+
+	events := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		assert.Equal(t, "test-logs.local", record["tunnel"], "record missing tunnel: %s", line)
+		if event, ok := record["event"].(string); ok {
+			events[event] = true
+		}
+	}
+	assert.True(t, events["tunnel_started"])
+	assert.True(t, events["proxy_request"])
+	assert.True(t, events["tunnel_stopped"])
+}
+
+func TestProxyProtocolClientIP(t *testing.T) {
+	manager, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	logFile := filepath.Join(tempDir, "tunnel.log")
+	logger, err := logging.New(&logging.Config{
+		Level:  logging.LevelDebug,
+		Format: logging.FormatJSON,
+		Output: logFile,
+	})
+	require.NoError(t, err)
+	manager.logger = logger.WithComponent("tunnel")
+
+	forwardedFor := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedFor <- r.Header.Get("X-Forwarded-For")
+	}))
+	defer backend.Close()
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort:   backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:        "test-proxyproto.local",
+		HTTPPort:      8273,
+		ProxyProtocol: true,
+	}))
+	defer manager.StopTunnel(ctx, "test-proxyproto.local")
+
+	conn, err := net.Dial("tcp", "127.0.0.1:8273")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "PROXY TCP4 198.51.100.23 127.0.0.1 51000 8273\r\n"+
+		"GET / HTTP/1.1\r\nHost: test-proxyproto.local\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "198.51.100.23", <-forwardedFor)
+
+	// A connection without the header is dropped before reaching the backend
+	plain, err := net.Dial("tcp", "127.0.0.1:8273")
+	require.NoError(t, err)
+	defer plain.Close()
+	_, err = io.WriteString(plain, "GET / HTTP/1.1\r\nHost: test-proxyproto.local\r\n\r\n")
+	require.NoError(t, err)
+	_, err = http.ReadResponse(bufio.NewReader(plain), nil)
+	assert.Error(t, err)
+
+	require.NoError(t, manager.StopTunnel(ctx, "test-proxyproto.local"))
+
+	content, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	var logged []string
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		if record["event"] == "proxy_request" {
+			logged = append(logged, record["client_ip"].(string))
+		}
+	}
+	assert.Equal(t, []string{"198.51.100.23"}, logged)
+}
+
+func TestProxyProtocolHTTPS(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	const domain = "test-proxyproto-tls.local"
+	manager, client := newSelfSignedManager(t, tempDir, domain)
+	defer manager.Close(context.Background())
+
+	forwardedFor := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedFor <- r.Header.Get("X-Forwarded-For")
+	}))
+	defer backend.Close()
+
+	// The startup check has to send a header of its own for this to start
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort:   backend.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:        domain,
+		HTTPS:         true,
+		HTTPPort:      8292,
+		HTTPSPort:     8291,
+		ProxyProtocol: true,
+	}))
+	defer manager.StopTunnel(ctx, domain)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:8291")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "PROXY TCP4 198.51.100.24 127.0.0.1 51000 8291\r\n")
+	require.NoError(t, err)
+	tlsConn := tls.Client(conn, client.Transport.(*http.Transport).TLSClientConfig)
+	_, err = io.WriteString(tlsConn, "GET / HTTP/1.1\r\nHost: "+domain+"\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(tlsConn), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "198.51.100.24", <-forwardedFor)
+}
+
+// writeTestCertFiles writes a self-signed certificate for domain, standing in
+// for one issued outside gotunnel, and returns a pool that trusts it
+func writeTestCertFiles(t *testing.T, dir, domain string) (string, string, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, domain+".crt")
+	keyFile := filepath.Join(dir, domain+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return certFile, keyFile, pool
+}
+
+func TestTunnelWithCertFiles(t *testing.T) {
+	manager, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	certFile, keyFile, pool := writeTestCertFiles(t, tempDir, "corp-cert.local")
+
+	ctx := context.Background()
+	err := manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: backendPort,
+		Domain:      "corp-cert.local",
+		HTTPS:       true,
+		HTTPPort:    8207,
+		HTTPSPort:   8507,
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+	})
+	require.NoError(t, err)
+
+	// The client only trusts the provided cert, so this proves it's the one served
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "corp-cert.local"},
+	}}
+	resp, err := client.Get("https://127.0.0.1:8507/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, tunnel!\n", string(body))
+}
+
+func TestTunnelRejectsMismatchedCertFiles(t *testing.T) {
+	manager, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	certFile, keyFile, _ := writeTestCertFiles(t, tempDir, "someone-else.local")
+
+	err := manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: 8080,
+		Domain:      "mine.local",
+		HTTPS:       true,
+		HTTPPort:    8208,
+		HTTPSPort:   8508,
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not cover mine.local")
+
+	err = manager.StartTunnelWithOptions(context.Background(), Options{
+		BackendPort: 8080,
+		Domain:      "mine.local",
+		HTTPS:       true,
+		HTTPPort:    8208,
+		HTTPSPort:   8508,
+		CertFile:    certFile,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must be provided together")
+}
+
+func TestManagerResolutionModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		useMDNS  bool
+		useHosts bool
+		port     int
+	}{
+		{"mDNS and hosts", true, true, 8211},
+		{"hosts only", false, true, 8212},
+		{"mDNS only", true, false, 8213},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, tempDir, cleanup := setupTestManager(t)
+			defer cleanup()
+
+			manager, err := NewManagerWithOptions(cert.New(filepath.Join(tempDir, "certs")), nil, ManagerOptions{
+				UseMDNS:  tt.useMDNS,
+				UseHosts: tt.useHosts,
+			})
+			require.NoError(t, err)
+			manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.backup"))
+
+			domain := fmt.Sprintf("resolve-%d.local", tt.port)
+			ctx := context.Background()
+			require.NoError(t, manager.StartTunnelWithPorts(ctx, 8080, domain, false, tt.port, tt.port+300))
+
+			content, err := os.ReadFile(hostsFile)
+			require.NoError(t, err)
+			assert.Equal(t, tt.useHosts, strings.Contains(string(content), domain), "hosts entry")
+			assert.Equal(t, tt.useMDNS, dnsserver.IsRegistered(domain), "mDNS registration")
+
+			_, err = os.Stat(filepath.Join(tempDir, "hosts.backup"))
+			assert.Equal(t, tt.useHosts, err == nil, "hosts backup")
+
+			require.NoError(t, manager.StopTunnel(ctx, domain))
+			content, err = os.ReadFile(hostsFile)
+			require.NoError(t, err)
+			assert.NotContains(t, string(content), domain)
+			assert.False(t, dnsserver.IsRegistered(domain))
+		})
+	}
+
+	t.Run("neither", func(t *testing.T) {
+		_, err := NewManagerWithOptions(cert.New(t.TempDir()), nil, ManagerOptions{})
+		assert.ErrorIs(t, err, ErrInvalidOptions)
+	})
+}
+
+func TestReadOnlyHostsFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		useMDNS bool
+		port    int
+	}{
+		{"mDNS enabled", true, 8237},
+		{"hosts only", false, 8238},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, tempDir, cleanup := setupTestManager(t)
+			defer cleanup()
+
+			require.NoError(t, os.Chmod(hostsFile, 0444))
+			if f, err := os.OpenFile(hostsFile, os.O_WRONLY, 0); err == nil {
+				f.Close()
+				t.Skip("hosts file is still writable (running as root?)")
+			}
+
+			manager, err := NewManagerWithOptions(cert.New(filepath.Join(tempDir, "certs")), nil, ManagerOptions{
+				UseMDNS:  tt.useMDNS,
+				UseHosts: true,
+			})
+			require.NoError(t, err)
+			manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.backup"))
+
+			domain := fmt.Sprintf("readonly-%d.local", tt.port)
+			ctx := context.Background()
+			err = manager.StartTunnelWithPorts(ctx, 8080, domain, false, tt.port, tt.port+300)
+			if !tt.useMDNS {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "failed to update hosts file")
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, dnsserver.IsRegistered(domain))
+			require.NoError(t, manager.StopTunnel(ctx, domain))
+		})
+	}
+}
+
+func TestNormalizeTLD(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"", "local", false},
+		{"local", "local", false},
+		{".test", "test", false},
+		{"Dev", "dev", false},
+		{"my-lab", "my-lab", false},
+		{"dev.test", "", true},
+		{"-test", "", true},
+		{"te st", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeTLD(tt.in)
+		if tt.wantErr {
+			assert.ErrorIs(t, err, ErrInvalidOptions, tt.in)
+			continue
+		}
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestValidateDomain(t *testing.T) {
+	valid := []string{"myapp.local", "my-app.local", "api.v2.myapp.local", "MyApp.local", "app1.test"}
+	for _, name := range valid {
+		assert.NoError(t, validateDomain(name), name)
+	}
+
+	invalid := []string{
+		"foo\n127.0.0.1 evil.local",
+		"foo bar.local",
+		"foo/bar.local",
+		"foo..local",
+		".local",
+		"-foo.local",
+		"foo-.local",
+		"foo_bar.local",
+		strings.Repeat("a", 64) + ".local",
+		strings.Repeat("a.", 127) + "local",
+	}
+	for _, name := range invalid {
+		assert.ErrorIs(t, validateDomain(name), ErrInvalidDomain, name)
+	}
+}
+
+func TestCustomTLD(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	manager, err := NewManagerWithOptions(cert.New(filepath.Join(tempDir, "certs")), nil, ManagerOptions{
+		UseMDNS:  true,
+		UseHosts: true,
+		LocalTLD: ".test",
+	})
+	require.NoError(t, err)
+	manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.backup"))
+	assert.Equal(t, "test", manager.TLD())
+	assert.Equal(t, "app.test", manager.localDomain("app"))
+	assert.Equal(t, "app.test", manager.localDomain("app.test"))
+	assert.Equal(t, "app.local.test", manager.localDomain("app.local"))
+
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort: 8080,
+		Domain:      "tld-app",
+		Aliases:     []string{"tld-alias"},
+		HTTPPort:    8234,
+		HTTPSPort:   8534,
+	}))
+
+	tunnels := manager.ListTunnels()
+	require.Len(t, tunnels, 1)
+	assert.Equal(t, "tld-app.test", tunnels[0]["domain"])
+
+	// .test names can't be advertised over mDNS, so they go in the hosts file
+	content, err := os.ReadFile(hostsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "tld-app.test")
+	assert.Contains(t, string(content), "tld-alias.test")
+	assert.False(t, dnsserver.IsRegistered("tld-app.test"))
+
+	require.NoError(t, manager.StopTunnel(ctx, "tld-app.test"))
+	content, err = os.ReadFile(hostsFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "tld-app.test")
+
+	t.Run("needs hosts file", func(t *testing.T) {
+		_, err := NewManagerWithOptions(cert.New(t.TempDir()), nil, ManagerOptions{
+			UseMDNS:  true,
+			LocalTLD: "test",
+		})
+		assert.ErrorIs(t, err, ErrInvalidOptions)
+	})
+}
+
+func TestConcurrentStarts(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	manager, err := NewManagerWithOptions(cert.New(filepath.Join(tempDir, "certs")), nil, ManagerOptions{UseHosts: true})
+	require.NoError(t, err)
+	manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.backup"))
+	defer manager.Close(context.Background())
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	const numTunnels = 20
+	ports := make([]int, numTunnels)
+	for i := range ports {
+		ports[i], err = netutil.FreePort()
+		require.NoError(t, err)
+	}
+
+	ctx := context.Background()
+	errs := make([]error, numTunnels)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < numTunnels; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = manager.StartTunnelWithOptions(ctx, Options{
+				BackendPort: backendPort,
+				Domain:      fmt.Sprintf("concurrent-%d", i),
+				HTTPPort:    ports[i],
+			})
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	for i, err := range errs {
+		require.NoError(t, err, "tunnel %d", i)
+	}
+	assert.Equal(t, numTunnels, manager.Count())
+
+	// Each start waits 100ms for the server to come up, so one at a time
+	// would take at least 2s
+	assert.Less(t, elapsed, numTunnels*100*time.Millisecond/2, "starts ran one at a time")
+
+	content, err := os.ReadFile(hostsFile)
+	require.NoError(t, err)
+	for i := 0; i < numTunnels; i++ {
+		assert.Contains(t, string(content), fmt.Sprintf("concurrent-%d.local", i))
+	}
+
+	require.NoError(t, manager.Stop(ctx))
+	assert.Equal(t, 0, manager.Count())
+}
+
+func TestConcurrentStartsOfSameDomain(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	const attempts = 5
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// A different port each, so only the reservation stops duplicates
+			errs <- manager.StartTunnelWithOptions(context.Background(), Options{
+				BackendPort: backendPort,
+				Domain:      "contended",
+				HTTPPort:    8252 + i,
+			})
+		}(i)
+	}
+
+	// Stopping everything waits for starts in progress rather than missing them
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(20 * time.Millisecond)
+		assert.NoError(t, manager.StopAll(context.Background()))
+	}()
+	wg.Wait()
+	close(errs)
+
+	started := 0
+	for err := range errs {
+		if err == nil {
+			started++
+		} else {
+			assert.ErrorIs(t, err, ErrDuplicateDomain)
+		}
+	}
+	assert.Equal(t, 1, started)
+	assert.Equal(t, 0, manager.Count())
+}
+
+// cancelingCerts stands in for a certificate provider slow enough that the
+// caller gives up, canceling the start while it generates
+type cancelingCerts struct {
+	cert.CertProvider
+	cancel context.CancelFunc
+}
+
+func (c cancelingCerts) EnsureCert(domain string) (*tls.Certificate, error) {
+	c.cancel()
+	return c.CertProvider.EnsureCert(domain)
+}
+
+func TestStartCanceled(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	certs := cert.NewSelfSignedProvider()
+	manager, err := NewManagerWithOptions(cancelingCerts{CertProvider: certs, cancel: cancel}, nil, ManagerOptions{UseHosts: true})
+	require.NoError(t, err)
+	manager.SetHostsBackupDir(filepath.Join(tempDir, "hosts.backup"))
+	defer manager.Close(context.Background())
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	opts := Options{BackendPort: backendPort, Domain: "canceled", HTTPS: true, HTTPSPort: 8288}
+	err = manager.StartTunnelWithOptions(ctx, opts)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, manager.Count())
+
+	// Nothing was bound or written, and the name is free again
+	content, err := os.ReadFile(hostsFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "canceled.local")
+	listener, err := net.Listen("tcp", "127.0.0.1:8288")
+	require.NoError(t, err)
+	listener.Close()
+
+	manager.certManager = certs
+	require.NoError(t, manager.StartTunnelWithOptions(context.Background(), opts))
+	assert.Equal(t, 1, manager.Count())
+}
+
+func TestStartCanceledAfterRegistering(t *testing.T) {
+	manager, _, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+	backendPort := testServer.Listener.Addr().(*net.TCPAddr).Port
+
+	// The caller gives up once the names are registered, while the
+	// listener's startup check is still to come
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.OnRegistration(func(r Registration) {
+		if r.Method == RegistrationMDNS {
+			cancel()
+		}
+	})
+
+	err := manager.StartTunnelWithOptions(ctx, Options{BackendPort: backendPort, Domain: "canceled-late", HTTPPort: 8298})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, manager.Count())
+
+	// The registrations were undone
+	assert.False(t, dnsserver.IsRegistered("canceled-late.local"))
+	content, err := os.ReadFile(hostsFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), hostsBlockBegin)
+}
+
+// writeClientCA writes a CA certificate to dir and returns its file and a
+// function issuing client certificates signed by it
+func writeClientCA(t *testing.T, dir, name string) (string, func() tls.Certificate) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageCertSign,
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	caFile := filepath.Join(dir, name+".pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644))
+
+	issue := func() tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "developer"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	return caFile, issue
+}
+
+func TestClientCertificates(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	domain := "test-mtls.local"
+	manager, client := newSelfSignedManager(t, tempDir, domain)
+	defer manager.Close(context.Background())
+
+	testServer := setupTestServer()
+	defer testServer.Close()
+
+	caFile, issue := writeClientCA(t, tempDir, "client-ca")
+	ctx := context.Background()
+	require.NoError(t, manager.StartTunnelWithOptions(ctx, Options{
+		BackendPort:  testServer.Listener.Addr().(*net.TCPAddr).Port,
+		Domain:       domain,
+		HTTPS:        true,
+		HTTPPort:     8281,
+		HTTPSPort:    8280,
+		ClientCAFile: caFile,
+	}))
+	defer manager.StopTunnel(ctx, domain)
+
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		transport := client.Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		return (&http.Client{Transport: transport}).Get("https://127.0.0.1:8280/")
+	}
+
+	// A client certificate signed by the CA is let through
+	resp, err := get(issue())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Without one, or with one from another CA, the handshake fails
+	_, err = get()
+	assert.Error(t, err, "no client certificate")
+	_, issueOther := writeClientCA(t, tempDir, "other-ca")
+	_, err = get(issueOther())
+	assert.Error(t, err, "client certificate from an untrusted CA")
+}
+
+func TestClientCAFileErrors(t *testing.T) {
+	_, tempDir, cleanup := setupTestManager(t)
+	defer cleanup()
+	manager, _ := newSelfSignedManager(t, tempDir, "test-mtls-bad.local")
+	defer manager.Close(context.Background())
+
+	notPEM := filepath.Join(tempDir, "not-a-bundle.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("hello"), 0644))
+
+	for _, caFile := range []string{filepath.Join(tempDir, "missing.pem"), notPEM} {
+		err := manager.StartTunnelWithOptions(context.Background(), Options{
+			BackendPort:  8080,
+			Domain:       "test-mtls-bad.local",
+			HTTPS:        true,
+			HTTPPort:     8283,
+			HTTPSPort:    8282,
+			ClientCAFile: caFile,
+		})
+		assert.ErrorIs(t, err, ErrCertUnavailable, caFile)
+	}
+}
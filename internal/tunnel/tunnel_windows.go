@@ -2,9 +2,7 @@
 
 package tunnel
 
-import (
-	"syscall"
-)
+import "syscall"
 
 func setSocketOptions(network, address string, c syscall.RawConn) error {
 	var opErr error